@@ -0,0 +1,79 @@
+package rtc
+
+import (
+	"time"
+)
+
+//
+// This file contains the lifetime and activity accounting of a connection: when it was created, and when the last message was sent and
+// received on each of its channels (including keep-alive pings and pongs). The reaper of an RTCMap uses this to close connections that
+// have been idle for too long (e.g. spectators that left their browser tab open)
+//
+
+// The activity of a single channel
+type ChannelActivity struct {
+	LastSent     time.Time // zero if nothing was sent yet
+	LastReceived time.Time // zero if nothing was received yet
+}
+
+// Returns how long ago the connection was created
+func (r *RTC) Age() time.Duration {
+	return r.clock().Sub(r.createdAt)
+}
+
+// Returns how long no message was sent or received on any channel of the connection (or how long ago it was created, if none was)
+func (r *RTC) IdleFor() time.Duration {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	last := r.createdAt
+	for _, activity := range r.activity {
+		if activity.LastSent.After(last) {
+			last = activity.LastSent
+		}
+		if activity.LastReceived.After(last) {
+			last = activity.LastReceived
+		}
+	}
+	return r.clock().Sub(last)
+}
+
+// Returns the activity of every channel that sent or received a message, by label
+func (r *RTC) Activity() map[string]ChannelActivity {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	activity := make(map[string]ChannelActivity, len(r.activity))
+	for label, a := range r.activity {
+		activity[label] = *a
+	}
+	return activity
+}
+
+// Record that a message was sent or received on the channel with the given label
+func (r *RTC) recordActivity(label string, sent bool) {
+	now := r.clock()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	activity := r.activity[label]
+	if activity == nil {
+		activity = &ChannelActivity{}
+		r.activity[label] = activity
+	}
+	if sent {
+		activity.LastSent = now
+	} else {
+		activity.LastReceived = now
+	}
+}
+
+// Close the connections that have been idle for longer than timeout when the reaper runs (see StartReaper). The car is never closed for
+// being idle. Pass 0 to disable this, which is the default
+func (m *RTCMap) SetIdleTimeout(timeout time.Duration) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.idleTimeout = timeout
+}
@@ -0,0 +1,101 @@
+package rtc
+
+import (
+	"testing"
+	"time"
+)
+
+// A clock that only moves when it is advanced
+type fakeClock struct {
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Now()}
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+// Create a connection whose activity accounting uses the fake clock, as if it was created now
+func (c *fakeClock) newRTC(id string) *RTC {
+	r := NewRTC(id)
+	r.clock = c.Now
+	r.createdAt = c.now
+	return r
+}
+
+func TestAgeAndIdleFor(t *testing.T) {
+	clock := newFakeClock()
+	r := clock.newRTC("spectator")
+
+	clock.advance(10 * time.Minute)
+	if age, idle := r.Age(), r.IdleFor(); age != 10*time.Minute || idle != 10*time.Minute {
+		t.Errorf("Expected an age and idle time of 10m, got %s and %s", age, idle)
+	}
+
+	r.recordActivity(DataChannelLabel, true)
+	clock.advance(time.Minute)
+	if age, idle := r.Age(), r.IdleFor(); age != 11*time.Minute || idle != time.Minute {
+		t.Errorf("Expected an age of 11m and an idle time of 1m, got %s and %s", age, idle)
+	}
+	if activity := r.Activity()[DataChannelLabel]; activity.LastSent.IsZero() || !activity.LastReceived.IsZero() {
+		t.Errorf("Expected only a sent message on the data channel, got %+v", activity)
+	}
+}
+
+func TestPongCountsAsActivity(t *testing.T) {
+	clock := newFakeClock()
+	r := clock.newRTC("spectator")
+	r.SetControlChannel(NewMockChannel(ControlChannelLabel))
+
+	clock.advance(time.Hour)
+	sent := time.Now().UnixNano()
+	r.handleControlMessage(pongFrame(sent, sent))
+	if idle := r.IdleFor(); idle != 0 {
+		t.Errorf("Expected a pong to reset the idle time, got %s", idle)
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	clock := newFakeClock()
+	m := NewRTCMap()
+	m.SetIdleTimeout(30 * time.Minute)
+	var evicted []string
+	m.OnEvicted(func(id string) { evicted = append(evicted, id) })
+
+	spectator, car := clock.newRTC("spectator"), NewRTC("car")
+	reasons := closeReasons(spectator)
+	if err := m.Add("spectator", spectator, false); err != nil {
+		t.Fatalf("Cannot add spectator: %v", err)
+	}
+	if err := m.Add("car", car, true); err != nil {
+		t.Fatalf("Cannot add car: %v", err)
+	}
+	t.Cleanup(func() { m.DestroyAll() })
+
+	deadSince := make(map[*RTC]time.Time)
+	clock.advance(20 * time.Minute)
+	spectator.recordActivity(DataChannelLabel, false)
+	clock.advance(25 * time.Minute)
+	m.reap(deadSince)
+	if count := m.Count(); count != 2 {
+		t.Fatalf("Expected the spectator to be kept alive by its activity, got %d connections", count)
+	}
+
+	clock.advance(10 * time.Minute)
+	m.reap(deadSince)
+	expectClosed(t, reasons, CloseReasonIdleTimeout)
+	if len(evicted) != 1 || evicted[0] != "spectator" {
+		t.Errorf("Expected only the spectator to be evicted, got %v", evicted)
+	}
+	// The car has been idle for almost an hour, but is exempt
+	if m.Get("car") != car {
+		t.Error("Expected the car to stay in the map")
+	}
+}
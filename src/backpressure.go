@@ -0,0 +1,155 @@
+package rtc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+//
+// This file contains the backpressure on the data channel. pion buffers every message that cannot be sent yet without limit, so on a bad link
+// the buffered amount grows until we run out of memory. With a maximum buffered amount configured, senders can wait for the buffer to drain
+// or drop messages instead
+//
+
+// The data channel buffers more than the configured maximum, so the message was not sent
+var ErrBufferFull = errors.New("Data channel buffer is full")
+
+// How often a blocking send re-checks the buffered amount, in case the low threshold event was missed
+const bufferPollInterval = 50 * time.Millisecond
+
+// The maximum buffered amount that SendDataBytesCtx and SendControlBytesCtx wait for if no maximum is configured (see SetMaxBufferedAmount).
+// Without it, pion would take every message of a stalled peer and the context would never apply
+const DefaultCtxMaxBufferedAmount = 1 << 20
+
+// Set the maximum number of bytes that may be buffered on the data channel by SendDataBytesBlocking and SendDataBytesDropIfFull.
+// Blocked senders are woken up when the buffer drains below half of the maximum. Pass 0 to disable the limit
+func (r *RTC) SetMaxBufferedAmount(max uint64) {
+	r.lock.Lock()
+	r.maxBufferedAmount = max
+	r.lock.Unlock()
+
+	if notifier, ok := r.dataMessageChannel().(bufferedAmountNotifier); ok {
+		notifier.SetBufferedAmountLowThreshold(max / 2)
+	}
+}
+
+// Returns the number of bytes that are buffered on the data channel, waiting to be sent
+func (r *RTC) BufferedAmount() uint64 {
+	dc := r.dataMessageChannel()
+	if dc == nil {
+		return 0
+	}
+	return dc.BufferedAmount()
+}
+
+// Send bytes on the data channel once the buffer has room for them (see SetMaxBufferedAmount), or return the context error when ctx is done.
+// A message that is larger than the maximum is sent once the buffer is empty
+func (r *RTC) SendDataBytesBlocking(ctx context.Context, b []byte) error {
+	if err := r.waitForBufferRoom(ctx, r.dataMessageChannel(), len(b), 0); err != nil {
+		return err
+	}
+	return r.SendDataBytes(b)
+}
+
+// Same as SendDataBytes, but gives up when ctx is done before the message is handed to the data channel, because the buffer is full
+// (see SetMaxBufferedAmount, DefaultCtxMaxBufferedAmount applies if no maximum is configured) or the queue of the writer is full
+// (see StartWriter). The context error is returned in that case
+func (r *RTC) SendDataBytesCtx(ctx context.Context, b []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	dc := r.dataMessageChannel()
+	if err := channelOpen(dc); err != nil {
+		log := r.Log()
+		log.Warn().Err(err).Msg("Cannot send on data channel")
+		return err
+	}
+	if err := r.limitSend(ctx, r.getDataLimiter()); err != nil {
+		return err
+	}
+	if err := r.waitForBufferRoom(ctx, dc, len(b), DefaultCtxMaxBufferedAmount); err != nil {
+		return err
+	}
+	return r.sendCtx(ctx, dc, r.encodeData(r.unbatched(r.compress(b))), DefaultPriority)
+}
+
+// Same as SendControlBytes, but gives up when ctx is done before the message is handed to the control channel (see SendDataBytesCtx).
+// The maximum buffered amount applies to the control channel as well
+func (r *RTC) SendControlBytesCtx(ctx context.Context, b []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	dc := r.controlMessageChannel()
+	if err := channelOpen(dc); err != nil {
+		log := r.Log()
+		log.Warn().Err(err).Msg("Cannot send control data")
+		return err
+	}
+	if err := r.limitSend(ctx, r.getControlLimiter()); err != nil {
+		return err
+	}
+	if err := r.waitForBufferRoom(ctx, dc, len(b), DefaultCtxMaxBufferedAmount); err != nil {
+		return err
+	}
+	return r.sendCtx(ctx, dc, b, ControlPriority)
+}
+
+// Blocks until the buffer of the channel has room for a message of the given size, or returns the context error when ctx is done.
+// The fallback is the maximum buffered amount if none is configured (0 means unlimited)
+func (r *RTC) waitForBufferRoom(ctx context.Context, dc MessageChannel, size int, fallback uint64) error {
+	for {
+		r.lock.Lock()
+		drained := r.bufferDrained
+		r.lock.Unlock()
+
+		if r.hasBufferRoom(dc, size, fallback) {
+			return nil
+		}
+
+		// Only the data channel signals that its buffer drained, so poll as well
+		select {
+		case <-drained:
+		case <-time.After(bufferPollInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-r.closed:
+			return fmt.Errorf("Cannot send message. Connection is destroyed")
+		}
+	}
+}
+
+// Send bytes on the data channel if the buffer has room for them (see SetMaxBufferedAmount), otherwise return ErrBufferFull
+func (r *RTC) SendDataBytesDropIfFull(b []byte) error {
+	if !r.hasBufferRoom(r.dataMessageChannel(), len(b), 0) {
+		return ErrBufferFull
+	}
+	return r.SendDataBytes(b)
+}
+
+// Whether a message of the given size can be buffered on the channel without exceeding the maximum buffered amount, or the fallback
+// if no maximum is configured
+func (r *RTC) hasBufferRoom(dc MessageChannel, size int, fallback uint64) bool {
+	r.lock.Lock()
+	max := r.maxBufferedAmount
+	r.lock.Unlock()
+	if max == 0 {
+		max = fallback
+	}
+
+	if dc == nil {
+		return true
+	}
+	buffered := dc.BufferedAmount()
+	return max == 0 || buffered == 0 || buffered+uint64(size) <= max
+}
+
+// Wake up the blocked senders
+func (r *RTC) handleBufferedAmountLow() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	close(r.bufferDrained)
+	r.bufferDrained = make(chan struct{})
+}
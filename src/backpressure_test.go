@@ -0,0 +1,241 @@
+package rtc_test
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/VU-ASE/roverrtc/src/rtctest"
+)
+
+// How much later than its context a send may give up (e.g. because of the poll interval of the buffered amount)
+const bufferTolerance = 150 * time.Millisecond
+
+// A mock channel with a slow consumer: sent messages are buffered and drained at a fixed rate. Records the highest buffered amount
+type slowChannel struct {
+	*rtc.MockChannel
+	lock      *sync.Mutex
+	buffered  uint64
+	peak      uint64
+	threshold uint64
+	onLow     func()
+}
+
+func newSlowChannel() *slowChannel {
+	var lock sync.Mutex
+	return &slowChannel{MockChannel: rtc.NewMockChannel(rtc.DataChannelLabel), lock: &lock}
+}
+
+func (s *slowChannel) Send(b []byte) error {
+	if err := s.MockChannel.Send(b); err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.buffered += uint64(len(b))
+	if s.buffered > s.peak {
+		s.peak = s.buffered
+	}
+	return nil
+}
+
+func (s *slowChannel) BufferedAmount() uint64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.buffered
+}
+
+func (s *slowChannel) SetBufferedAmountLowThreshold(threshold uint64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.threshold = threshold
+}
+
+func (s *slowChannel) OnBufferedAmountLow(handler func()) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.onLow = handler
+}
+
+// Consume up to n bytes of the buffer every interval until ctx is done, and signal when the buffer drains below the threshold
+func (s *slowChannel) consume(ctx context.Context, n uint64, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		s.lock.Lock()
+		before := s.buffered
+		s.buffered -= min(n, s.buffered)
+		crossed := before > s.threshold && s.buffered <= s.threshold
+		onLow := s.onLow
+		s.lock.Unlock()
+		if crossed && onLow != nil {
+			onLow()
+		}
+	}
+}
+
+func (s *slowChannel) Peak() uint64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.peak
+}
+
+func TestSendBlockingRespectsBufferCap(t *testing.T) {
+	const max = 4096
+	r := rtc.NewRTC("spectator")
+	t.Cleanup(func() { r.Destroy() })
+	dc := newSlowChannel()
+	r.SetDataChannel(dc)
+	r.SetMaxBufferedAmount(max)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go dc.consume(ctx, 1024, time.Millisecond)
+
+	message := make([]byte, 1000)
+	const count = 50
+	for i := 0; i < count; i++ {
+		sendCtx, sendCancel := context.WithTimeout(ctx, receiveTimeout)
+		err := r.SendDataBytesBlocking(sendCtx, message)
+		sendCancel()
+		if err != nil {
+			t.Fatalf("Cannot send message %d: %v", i, err)
+		}
+		if buffered := r.BufferedAmount(); buffered > max {
+			t.Fatalf("Buffered amount %d exceeds the maximum of %d", buffered, max)
+		}
+	}
+	if peak := dc.Peak(); peak > max {
+		t.Errorf("Buffered amount peaked at %d, above the maximum of %d", peak, max)
+	}
+	if sent := len(dc.Sent()); sent != count {
+		t.Errorf("Expected %d messages to be sent, got %d", count, sent)
+	}
+}
+
+func TestSendBlockingGivesUpWithContext(t *testing.T) {
+	r := rtc.NewRTC("spectator")
+	t.Cleanup(func() { r.Destroy() })
+	dc := rtc.NewMockChannel(rtc.DataChannelLabel)
+	r.SetDataChannel(dc)
+	r.SetMaxBufferedAmount(1024)
+	dc.SetBufferedAmount(1024)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := r.SendDataBytesBlocking(ctx, []byte("frame")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the send to give up with the context, got %v", err)
+	}
+	if sent := len(dc.Sent()); sent != 0 {
+		t.Errorf("Expected nothing to be sent on a full buffer, got %d messages", sent)
+	}
+}
+
+func TestSendDropIfFull(t *testing.T) {
+	r := rtc.NewRTC("spectator")
+	t.Cleanup(func() { r.Destroy() })
+	dc := rtc.NewMockChannel(rtc.DataChannelLabel)
+	r.SetDataChannel(dc)
+	r.SetMaxBufferedAmount(1024)
+
+	dc.SetBufferedAmount(1020)
+	if err := r.SendDataBytesDropIfFull([]byte("frame")); !errors.Is(err, rtc.ErrBufferFull) {
+		t.Fatalf("Expected ErrBufferFull, got %v", err)
+	}
+	if sent := len(dc.Sent()); sent != 0 {
+		t.Errorf("Expected the message to be dropped, got %d messages", sent)
+	}
+
+	dc.SetBufferedAmount(100)
+	if err := r.SendDataBytesDropIfFull([]byte("frame")); err != nil {
+		t.Fatalf("Expected the message to be sent once the buffer drained, got %v", err)
+	}
+	if sent := len(dc.Sent()); sent != 1 {
+		t.Errorf("Expected the message to be sent, got %d messages", sent)
+	}
+}
+
+func TestSendCtxWhenPeerStopsReading(t *testing.T) {
+	client, server := rtctest.NewConnectedPair(t)
+	// The peer stops reading, so the receive window fills up and the buffer of the client grows
+	release := make(chan struct{})
+	defer close(release)
+	server.OnData(func(b []byte) { <-release })
+
+	message := make([]byte, 64*1024)
+	const timeout = 100 * time.Millisecond
+	deadline := time.Now().Add(receiveTimeout)
+	for time.Now().Before(deadline) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		start := time.Now()
+		err := client.SendDataBytesCtx(ctx, message)
+		elapsed := time.Since(start)
+		cancel()
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Expected the send to give up with the context, got %v", err)
+		}
+		if elapsed > timeout+bufferTolerance {
+			t.Errorf("Expected the send to give up promptly after %s, it took %s", timeout, elapsed)
+		}
+		return
+	}
+	t.Fatal("Expected a send to give up once the peer stopped reading")
+}
+
+func TestSendControlCtxWhenBufferIsFull(t *testing.T) {
+	r := rtc.NewRTC("rover")
+	t.Cleanup(func() { r.Destroy() })
+	control := rtc.NewMockChannel(rtc.ControlChannelLabel)
+	r.SetControlChannel(control)
+	control.SetBufferedAmount(2 * rtc.DefaultCtxMaxBufferedAmount)
+
+	const timeout = 50 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	start := time.Now()
+	if err := r.SendControlBytesCtx(ctx, []byte("stop")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the send to give up with the context, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > timeout+bufferTolerance {
+		t.Errorf("Expected the send to give up promptly after %s, it took %s", timeout, elapsed)
+	}
+	if sent := len(control.Sent()); sent != 0 {
+		t.Errorf("Expected nothing to be sent, got %d messages", sent)
+	}
+
+	// Sends that give up do not leave goroutines behind
+	before := runtime.NumGoroutine()
+	for i := 0; i < 20; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+		_ = r.SendControlBytesCtx(ctx, []byte("stop"))
+		cancel()
+	}
+	if after := runtime.NumGoroutine(); after > before+2 {
+		t.Errorf("Expected abandoned sends to not leak goroutines, went from %d to %d goroutines", before, after)
+	}
+
+	// The send without context keeps its semantics and hands the message to the channel
+	if err := r.SendControlBytes([]byte("stop")); err != nil {
+		t.Errorf("Expected the send without context to succeed, got %v", err)
+	}
+}
@@ -0,0 +1,143 @@
+package rtc
+
+import (
+	"encoding/binary"
+	"sync"
+	"time"
+)
+
+//
+// This file contains the (opt-in) batching of small data messages, to save the per-message overhead of SCTP when sending many small
+// messages (e.g. telemetry). Consecutive messages are coalesced into a single batch, which is sent when it is full or when its oldest
+// message has waited for the maximum delay. A batch is a concatenation of length-prefixed messages:
+//
+//	| length (4 bytes, big endian) | message | length | message | ...
+//
+// The control channel is never batched
+//
+
+const batchLengthSize = 4
+
+type batcher struct {
+	lock     *sync.Mutex
+	maxDelay time.Duration // how long a message may wait in the batch
+	maxBytes int           // the size at which the batch is sent right away
+	pending  []byte        // the batch that is being filled
+	timer    *time.Timer   // fires when the oldest message in the batch has waited for the maximum delay
+}
+
+// Enable batching on the data channel: messages sent with SendDataBytes (and the methods built on it) are coalesced and sent once the batch
+// holds maxBytes bytes, or once the oldest message waited for maxDelay. Incoming batches are split up, so handlers still see the individual
+// messages. Both peers need to enable batching. Sending a batched message does not return the error of the underlying send, it is logged instead
+func (r *RTC) EnableBatching(maxDelay time.Duration, maxBytes int) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var lock sync.Mutex
+	r.batcher = &batcher{
+		lock:     &lock,
+		maxDelay: maxDelay,
+		maxBytes: maxBytes,
+	}
+}
+
+// Add a message to the batch, sending the batch if it is full
+func (r *RTC) addToBatch(b *batcher, payload []byte) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	// A message that does not fit in the batch anymore goes into the next one
+	if len(b.pending) > 0 && len(b.pending)+batchLengthSize+len(payload) > b.maxBytes {
+		r.sendBatch(b)
+	}
+
+	b.pending = appendBatchEntry(b.pending, payload)
+	if len(b.pending) >= b.maxBytes {
+		r.sendBatch(b)
+	} else if b.timer == nil {
+		b.timer = time.AfterFunc(b.maxDelay, func() {
+			r.flushBatch()
+		})
+	}
+}
+
+// Send the pending batch right away, if batching is enabled (e.g. before the connection is closed)
+func (r *RTC) flushBatch() {
+	r.lock.Lock()
+	b := r.batcher
+	r.lock.Unlock()
+
+	if b == nil {
+		return
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	r.sendBatch(b)
+}
+
+// Returns a single message as a batch, after sending the pending batch to preserve the order. If batching is disabled, the message
+// is returned as-is. Used by the send methods that bypass the batch (e.g. to send with a priority)
+func (r *RTC) unbatched(payload []byte) []byte {
+	r.lock.Lock()
+	b := r.batcher
+	r.lock.Unlock()
+
+	if b == nil {
+		return payload
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	r.sendBatch(b)
+	return appendBatchEntry(nil, payload)
+}
+
+// Send the pending batch, the caller must hold the lock of the batcher so that batches are sent in order
+func (r *RTC) sendBatch(b *batcher) {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	if len(b.pending) == 0 {
+		return
+	}
+	batch := b.pending
+	b.pending = nil
+
+	log := r.Log()
+	dc := r.dataMessageChannel()
+	if err := channelOpen(dc); err != nil {
+		log.Warn().Err(err).Int("length", len(batch)).Msg("Dropped batch, cannot send on data channel")
+		return
+	}
+	if err := r.send(dc, r.encodeData(batch), DefaultPriority); err != nil {
+		log.Warn().Err(err).Int("length", len(batch)).Msg("Cannot send batch")
+	}
+}
+
+// Split an incoming batch into its messages and deliver them one by one
+func (r *RTC) deliverBatch(batch []byte) {
+	log := r.Log()
+
+	for len(batch) > 0 {
+		if len(batch) < batchLengthSize {
+			log.Warn().Int("length", len(batch)).Msg("Dropped rest of batch, too short to contain a length")
+			return
+		}
+		length := binary.BigEndian.Uint32(batch)
+		batch = batch[batchLengthSize:]
+		if uint64(length) > uint64(len(batch)) {
+			log.Warn().Uint32("length", length).Int("remaining", len(batch)).Msg("Dropped rest of batch, message is truncated")
+			return
+		}
+		r.deliverMessage(batch[:length])
+		batch = batch[length:]
+	}
+}
+
+// Append a length-prefixed message to a batch
+func appendBatchEntry(batch []byte, payload []byte) []byte {
+	batch = binary.BigEndian.AppendUint32(batch, uint32(len(payload)))
+	return append(batch, payload...)
+}
@@ -0,0 +1,131 @@
+package rtc_test
+
+import (
+	"bytes"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/VU-ASE/roverrtc/src/rtctest"
+)
+
+// Create a connection that batches its data messages, on mock control and data channels
+func newBatchingConnection(maxDelay time.Duration, maxBytes int) (*rtc.RTC, *rtc.MockChannel, *rtc.MockChannel) {
+	r := rtc.NewRTC("rover")
+	control, data := rtc.NewMockChannel(rtc.ControlChannelLabel), rtc.NewMockChannel(rtc.DataChannelLabel)
+	r.SetControlChannel(control)
+	r.SetDataChannel(data)
+	r.EnableBatching(maxDelay, maxBytes)
+	return r, control, data
+}
+
+func TestBatchingRoundTrip(t *testing.T) {
+	sender, _, sent := newBatchingConnection(time.Hour, 64)
+	messages := [][]byte{
+		bytes.Repeat([]byte{1}, 10),
+		bytes.Repeat([]byte{2}, 10),
+		{},
+		bytes.Repeat([]byte{3}, 10),
+		bytes.Repeat([]byte{4}, 30),
+	}
+
+	// The first four messages fit in one batch (of 4 * 4 length bytes and 30 message bytes), the last one does not
+	for _, msg := range messages {
+		if err := sender.SendDataBytes(msg); err != nil {
+			t.Fatalf("Cannot send message: %v", err)
+		}
+	}
+	if n := len(sent.Sent()); n != 1 {
+		t.Fatalf("Expected the full batch to be sent, got %d batches", n)
+	}
+
+	// The batch that is still pending is sent before the connection is closed
+	if err := sender.Destroy(); err != nil {
+		t.Fatalf("Cannot destroy connection: %v", err)
+	}
+	batches := sent.Sent()
+	if len(batches) != 2 {
+		t.Fatalf("Expected the pending batch to be sent on destroy, got %d batches", len(batches))
+	}
+
+	receiver, _, received := newBatchingConnection(time.Hour, 64)
+	delivered := collectData(receiver)
+	for _, batch := range batches {
+		received.Inject(batch)
+	}
+	for _, msg := range messages {
+		expectMessage(t, delivered, msg)
+	}
+	expectNoMessage(t, delivered)
+}
+
+func TestBatchingFlushesAfterDelay(t *testing.T) {
+	r, _, data := newBatchingConnection(20*time.Millisecond, 1024)
+	t.Cleanup(func() { r.Destroy() })
+
+	if err := r.SendDataBytes([]byte("telemetry")); err != nil {
+		t.Fatalf("Cannot send message: %v", err)
+	}
+	deadline := time.Now().Add(receiveTimeout)
+	for len(data.Sent()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the batch to be sent after the maximum delay")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestControlIsNeverBatched(t *testing.T) {
+	r, control, data := newBatchingConnection(time.Hour, 1024)
+	t.Cleanup(func() { r.Destroy() })
+
+	if err := r.SendControlBytes([]byte("stop")); err != nil {
+		t.Fatalf("Cannot send control message: %v", err)
+	}
+	sent := control.Sent()
+	if len(sent) != 1 || !bytes.Equal(sent[0], []byte("stop")) {
+		t.Errorf("Expected the control message to be sent as-is right away, got %q", sent)
+	}
+	if n := len(data.Sent()); n != 0 {
+		t.Errorf("Expected nothing on the data channel, got %d messages", n)
+	}
+}
+
+// Send b.N messages of 100 bytes from the client to the server and wait until all of them are delivered
+func benchmarkSmallMessages(b *testing.B, batching bool) {
+	client, server := rtctest.NewConnectedPair(b)
+	if batching {
+		client.EnableBatching(5*time.Millisecond, 16*1024)
+		server.EnableBatching(5*time.Millisecond, 16*1024)
+	}
+	var delivered atomic.Int64
+	done := make(chan struct{})
+	server.OnData(func(msg []byte) {
+		if delivered.Add(1) == int64(b.N) {
+			close(done)
+		}
+	})
+	msg := bytes.Repeat([]byte{0x2a}, 100)
+
+	b.SetBytes(int64(len(msg)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := client.SendDataBytes(msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Minute):
+		b.Fatalf("Expected %d messages to be delivered, got %d", b.N, delivered.Load())
+	}
+}
+
+func BenchmarkSmallMessages(b *testing.B) {
+	benchmarkSmallMessages(b, false)
+}
+
+func BenchmarkSmallMessagesBatched(b *testing.B) {
+	benchmarkSmallMessages(b, true)
+}
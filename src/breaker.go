@@ -0,0 +1,170 @@
+package rtc
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+//
+// This file contains the tracking of consecutive send failures per channel, and the (opt-in) circuit breaker on top of it. When the
+// transport of a peer dies, every send fails, so instead of reporting each failure the OnSendFailure handler is called once per streak.
+// With the circuit breaker enabled, a channel that failed too often in a row is marked unhealthy and sends fail fast with ErrChannelUnhealthy.
+// Once the probe interval passed, the next send is let through as a probe: if it succeeds the breaker closes again, otherwise it stays open
+//
+
+// The channel failed too many sends in a row, so the send was not attempted (see EnableCircuitBreaker)
+var ErrChannelUnhealthy = errors.New("Channel is unhealthy")
+
+// The state of the circuit breaker of a channel
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota // sends go through
+	BreakerOpen                         // sends fail with ErrChannelUnhealthy until the probe interval passed
+	BreakerHalfOpen                     // a probe send is let through to check whether the channel recovered
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+type sendFailureFunc func(channel string, err error)
+
+// The send health of a single channel
+type channelHealth struct {
+	failures int // the number of consecutive failed sends
+	state    BreakerState
+	since    time.Time // when the breaker was opened, or when the last probe was let through
+}
+
+// The send failure tracking and the circuit breaker, guarded by the lock of the connection
+type sendHealth struct {
+	failureThreshold int
+	onFailure        sendFailureFunc
+	breakerThreshold int // 0 disables the circuit breaker
+	probeInterval    time.Duration
+	channels         map[string]*channelHealth // label -> send health, once a send on the channel was attempted
+}
+
+// Register a handler that is called once a channel failed threshold sends in a row. It is called once per streak of failures,
+// not for every failure, and again after a send on the channel succeeded and it starts failing again
+func (r *RTC) OnSendFailure(threshold int, handler func(channel string, err error)) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.health.failureThreshold = threshold
+	r.health.onFailure = handler
+}
+
+// Open the circuit breaker of a channel once it failed threshold sends in a row, after which sends on it fail with ErrChannelUnhealthy.
+// Every probeInterval, a single send is let through to check whether the channel recovered. Pass a threshold of 0 to disable the
+// circuit breaker (which closes all breakers), this is the default
+func (r *RTC) EnableCircuitBreaker(threshold int, probeInterval time.Duration) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.health.breakerThreshold = threshold
+	r.health.probeInterval = probeInterval
+	if threshold <= 0 {
+		for _, health := range r.health.channels {
+			health.state = BreakerClosed
+		}
+	}
+}
+
+// Returns the state of the circuit breaker of the channel with the given label
+func (r *RTC) BreakerState(label string) BreakerState {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	state, _ := r.healthOf(label)
+	return state
+}
+
+// Returns the breaker state and the number of consecutive failed sends of a channel, the caller must hold the lock
+func (r *RTC) healthOf(label string) (BreakerState, int) {
+	health := r.health.channels[label]
+	if health == nil {
+		return BreakerClosed, 0
+	}
+	return health.state, health.failures
+}
+
+// Returns an error wrapping ErrChannelUnhealthy if the breaker of the channel does not let a send through
+func (r *RTC) allowSend(label string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	health := r.health.channels[label]
+	if r.health.breakerThreshold <= 0 || health == nil || health.state == BreakerClosed {
+		return nil
+	}
+	// A probe that never completed (e.g. because it was not sent) does not keep the breaker half-open forever
+	if time.Since(health.since) < r.health.probeInterval {
+		return fmt.Errorf("%w: %d sends on channel %s failed in a row", ErrChannelUnhealthy, health.failures, label)
+	}
+	health.state = BreakerHalfOpen
+	health.since = time.Now()
+	return nil
+}
+
+// Record the result of a send on the channel with the given label, and open or close its breaker accordingly
+func (r *RTC) recordSendResult(label string, err error) {
+	r.lock.Lock()
+	if r.health.channels == nil {
+		r.health.channels = make(map[string]*channelHealth)
+	}
+	health := r.health.channels[label]
+	if health == nil {
+		health = &channelHealth{}
+		r.health.channels[label] = health
+	}
+
+	if err == nil {
+		recovered := health.state != BreakerClosed
+		health.failures = 0
+		health.state = BreakerClosed
+		r.lock.Unlock()
+		if recovered {
+			log := r.Log()
+			log.Info().Str("label", label).Msg("Closed circuit breaker, channel recovered")
+		}
+		return
+	}
+
+	health.failures++
+	opened := false
+	switch {
+	case health.state == BreakerHalfOpen:
+		health.state = BreakerOpen
+		health.since = time.Now()
+	case health.state == BreakerClosed && r.health.breakerThreshold > 0 && health.failures >= r.health.breakerThreshold:
+		health.state = BreakerOpen
+		health.since = time.Now()
+		opened = true
+	}
+	failures := health.failures
+	var handler sendFailureFunc
+	if r.health.onFailure != nil && failures == r.health.failureThreshold {
+		handler = r.health.onFailure
+	}
+	r.lock.Unlock()
+
+	if opened {
+		log := r.Log()
+		log.Warn().Err(err).Str("label", label).Int("failures", failures).Msg("Opened circuit breaker, channel is unhealthy")
+	}
+	if handler != nil {
+		handler(label, err)
+	}
+}
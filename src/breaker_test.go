@@ -0,0 +1,124 @@
+package rtc_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+)
+
+var errBroken = errors.New("SCTP stream is closed")
+
+// A mock channel that calls onSend before every send, to observe the connection while a send is in progress
+type observedChannel struct {
+	*rtc.MockChannel
+	onSend func()
+}
+
+func (c *observedChannel) Send(b []byte) error {
+	c.onSend()
+	return c.MockChannel.Send(b)
+}
+
+// Returns the statistics of the data channel of the connection
+func dataStats(t *testing.T, r *rtc.RTC) rtc.DataChannelStats {
+	t.Helper()
+
+	stats, err := r.Stats()
+	if err != nil {
+		t.Fatalf("Cannot get statistics: %v", err)
+	}
+	return stats.Data
+}
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	r := newAnswerer(t, "rover")
+	data := &observedChannel{MockChannel: rtc.NewMockChannel(rtc.DataChannelLabel)}
+	var stateDuringSend rtc.BreakerState
+	data.onSend = func() { stateDuringSend = r.BreakerState(rtc.DataChannelLabel) }
+	r.SetDataChannel(data)
+	r.EnableCircuitBreaker(3, 50*time.Millisecond)
+	send := func() error { return r.SendDataBytes([]byte("telemetry")) }
+
+	data.FailSends(errBroken)
+	for i := 0; i < 3; i++ {
+		if err := send(); !errors.Is(err, errBroken) {
+			t.Fatalf("Expected send %d to fail with the error of the channel, got %v", i, err)
+		}
+	}
+	if state := dataStats(t, r).Breaker; state != rtc.BreakerOpen {
+		t.Fatalf("Expected the breaker to open after 3 failures, got %s", state)
+	}
+	stateDuringSend = rtc.BreakerClosed
+	if err := send(); !errors.Is(err, rtc.ErrChannelUnhealthy) {
+		t.Fatalf("Expected ErrChannelUnhealthy while the breaker is open, got %v", err)
+	}
+	if stateDuringSend != rtc.BreakerClosed {
+		t.Error("Expected the send to not be attempted while the breaker is open")
+	}
+
+	// A failing probe opens the breaker again
+	time.Sleep(60 * time.Millisecond)
+	if err := send(); !errors.Is(err, errBroken) {
+		t.Fatalf("Expected the probe to be sent, got %v", err)
+	}
+	if stateDuringSend != rtc.BreakerHalfOpen {
+		t.Errorf("Expected the breaker to be half-open during the probe, got %s", stateDuringSend)
+	}
+	if err := send(); !errors.Is(err, rtc.ErrChannelUnhealthy) {
+		t.Fatalf("Expected ErrChannelUnhealthy after a failed probe, got %v", err)
+	}
+
+	// A successful probe closes the breaker
+	data.FailSends(nil)
+	time.Sleep(60 * time.Millisecond)
+	if err := send(); err != nil {
+		t.Fatalf("Expected the probe to succeed, got %v", err)
+	}
+	stats := dataStats(t, r)
+	if stats.Breaker != rtc.BreakerClosed || stats.Failures != 0 {
+		t.Errorf("Expected a closed breaker without failures, got %s with %d failures", stats.Breaker, stats.Failures)
+	}
+	if err := send(); err != nil {
+		t.Errorf("Expected sends to go through once the breaker closed, got %v", err)
+	}
+	if sent := len(data.Sent()); sent != 2 {
+		t.Errorf("Expected 2 messages to be sent, got %d", sent)
+	}
+}
+
+func TestOnSendFailure(t *testing.T) {
+	r := rtc.NewRTC("rover")
+	data := rtc.NewMockChannel(rtc.DataChannelLabel)
+	r.SetDataChannel(data)
+	var reported []error
+	r.OnSendFailure(2, func(channel string, err error) {
+		if channel != rtc.DataChannelLabel {
+			t.Errorf("Expected a failure on the data channel, got %s", channel)
+		}
+		reported = append(reported, err)
+	})
+
+	data.FailSends(errBroken)
+	for i := 0; i < 5; i++ {
+		_ = r.SendDataBytes([]byte("telemetry"))
+	}
+	if len(reported) != 1 || !errors.Is(reported[0], errBroken) {
+		t.Fatalf("Expected a single report for the streak of failures, got %v", reported)
+	}
+	// Without circuit breaker, every send is attempted
+	if state := r.BreakerState(rtc.DataChannelLabel); state != rtc.BreakerClosed {
+		t.Errorf("Expected the breaker to stay closed when it is not enabled, got %s", state)
+	}
+
+	data.FailSends(nil)
+	_ = r.SendDataBytes([]byte("telemetry"))
+	data.FailSends(errBroken)
+	for i := 0; i < 2; i++ {
+		_ = r.SendDataBytes([]byte("telemetry"))
+	}
+	if len(reported) != 2 {
+		t.Errorf("Expected a new streak to be reported again, got %d reports", len(reported))
+	}
+}
@@ -0,0 +1,98 @@
+package rtc
+
+import (
+	"google.golang.org/protobuf/proto"
+)
+
+//
+// This file contains the helpers to send a message to all connections in an RTCMap at once
+//
+
+// Sends a message on the data channel of every connection in the map, marshalling it only once.
+// Connections that are not connected or have no open data channel are skipped.
+// Returns the errors of the connections that could not be sent to (id -> error)
+func (m *RTCMap) Broadcast(pb proto.Message) (map[string]error, error) {
+	return m.BroadcastExcept("", pb)
+}
+
+// Sends bytes on the data channel of every connection in the map.
+// Connections that are not connected or have no open data channel are skipped.
+// Returns the errors of the connections that could not be sent to (id -> error)
+func (m *RTCMap) BroadcastBytes(b []byte) map[string]error {
+	return m.BroadcastBytesExcept("", b)
+}
+
+// Same as Broadcast, but skips the connection with the given id (e.g. so that the messages of the car are not echoed back to it)
+func (m *RTCMap) BroadcastExcept(exceptId string, pb proto.Message) (map[string]error, error) {
+	buf, err := marshalPooled(pb)
+	if err != nil {
+		return nil, err
+	}
+	defer releaseBuffer(buf)
+
+	return m.BroadcastBytesExcept(exceptId, *buf), nil
+}
+
+// Same as BroadcastBytes, but skips the connection with the given id
+func (m *RTCMap) BroadcastBytesExcept(exceptId string, b []byte) map[string]error {
+	return m.broadcastBytes(b, func(id string, rtc *RTC) bool {
+		return id != exceptId
+	})
+}
+
+// Same as Broadcast, but only sends to the connections with the given role (e.g. to all spectators)
+func (m *RTCMap) BroadcastToRole(role Role, pb proto.Message) (map[string]error, error) {
+	buf, err := marshalPooled(pb)
+	if err != nil {
+		return nil, err
+	}
+	defer releaseBuffer(buf)
+
+	return m.BroadcastBytesToRole(role, *buf), nil
+}
+
+// Same as BroadcastBytes, but only sends to the connections with the given role
+func (m *RTCMap) BroadcastBytesToRole(role Role, b []byte) map[string]error {
+	return m.broadcastBytes(b, func(id string, rtc *RTC) bool {
+		return rtc.Role() == role
+	})
+}
+
+// Sends bytes on the data channel of the connections for which include returns true
+func (m *RTCMap) broadcastBytes(b []byte, include func(id string, rtc *RTC) bool) map[string]error {
+	failed := make(map[string]error)
+	if m.broadcastsPaused.Load() {
+		return failed
+	}
+
+	m.ForEach(func(id string, rtc *RTC) {
+		if !include(id, rtc) || !rtc.IsConnected() || !rtc.IsDataChannelOpen() {
+			return
+		}
+
+		if err := rtc.SendDataBytes(b); err != nil {
+			failed[id] = err
+		}
+	})
+	return failed
+}
+
+// Pause all broadcasts, e.g. during a configuration reload. While paused, the Broadcast* methods do not send anything,
+// but sending on a specific connection (e.g. with SendData or SendControlData) keeps working
+func (m *RTCMap) PauseBroadcasts() {
+	m.broadcastsPaused.Store(true)
+	log := getDefaultLogger()
+	log.Info().Msg("Paused broadcasts")
+}
+
+// Resume broadcasts after PauseBroadcasts
+func (m *RTCMap) ResumeBroadcasts() {
+	m.broadcastsPaused.Store(false)
+	log := getDefaultLogger()
+	log.Info().Msg("Resumed broadcasts")
+}
+
+// Returns whether broadcasts are currently paused
+func (m *RTCMap) BroadcastsPaused() bool {
+	return m.broadcastsPaused.Load()
+}
@@ -0,0 +1,77 @@
+package rtc_test
+
+import (
+	"testing"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestPauseBroadcasts(t *testing.T) {
+	m := rtc.NewRTCMap()
+	clients := connectToMap(t, m, "a", "b")
+	receivedA, receivedB := collectData(clients["a"]), collectData(clients["b"])
+
+	m.PauseBroadcasts()
+	if !m.BroadcastsPaused() {
+		t.Fatal("Expected broadcasts to be paused")
+	}
+	if failed := m.BroadcastBytes([]byte("paused")); len(failed) != 0 {
+		t.Errorf("Expected no failures while paused, got %v", failed)
+	}
+	expectNoMessage(t, receivedA)
+	expectNoMessage(t, receivedB)
+
+	// Sending to a single connection is not affected
+	if err := m.Get("a").SendDataBytes([]byte("direct")); err != nil {
+		t.Fatalf("Cannot send while broadcasts are paused: %v", err)
+	}
+	expectMessage(t, receivedA, []byte("direct"))
+
+	m.ResumeBroadcasts()
+	if m.BroadcastsPaused() {
+		t.Fatal("Expected broadcasts to be resumed")
+	}
+	if failed := m.BroadcastBytes([]byte("resumed")); len(failed) != 0 {
+		t.Errorf("Expected no failures, got %v", failed)
+	}
+	expectMessage(t, receivedA, []byte("resumed"))
+	expectMessage(t, receivedB, []byte("resumed"))
+}
+
+func TestBroadcastFanOut(t *testing.T) {
+	m := rtc.NewRTCMap()
+	clients := connectToMap(t, m, "car", "a", "b")
+	received := make(map[string]<-chan []byte)
+	for id, client := range clients {
+		received[id] = collectData(client)
+	}
+	// A connection that is not set up is skipped
+	if err := m.AddConnection("fresh", rtc.NewRTC("fresh")); err != nil {
+		t.Fatalf("Cannot add connection: %v", err)
+	}
+
+	msg := wrapperspb.String("telemetry")
+	failed, err := m.Broadcast(msg)
+	if err != nil {
+		t.Fatalf("Cannot broadcast: %v", err)
+	}
+	if len(failed) != 0 {
+		t.Errorf("Expected no failures, got %v", failed)
+	}
+	want, err := proto.Marshal(msg)
+	if err != nil {
+		t.Fatalf("Cannot marshal message: %v", err)
+	}
+	for id := range clients {
+		expectMessage(t, received[id], want)
+	}
+
+	if failed := m.BroadcastBytesExcept("car", []byte("not for the car")); len(failed) != 0 {
+		t.Errorf("Expected no failures, got %v", failed)
+	}
+	expectMessage(t, received["a"], []byte("not for the car"))
+	expectMessage(t, received["b"], []byte("not for the car"))
+	expectNoMessage(t, received["car"])
+}
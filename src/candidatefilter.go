@@ -0,0 +1,68 @@
+package rtc
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/pion/webrtc/v4"
+)
+
+//
+// This file contains the candidate policy of a connection. A candidate filter decides which ICE candidates are used, it is applied to the
+// local candidates before they are stored (and sent to the peer) and to the remote candidates before they are added to the connection.
+// On an isolated network (such as the rover's), restricting the candidates to host candidates on known interfaces speeds up connecting
+// and prevents picking the wrong interface
+//
+
+type filterFunc func(candidate webrtc.ICECandidateInit) bool
+
+// A filter that only keeps host candidates, dropping server reflexive, peer reflexive and relay candidates
+func HostOnlyFilter(candidate webrtc.ICECandidateInit) bool {
+	return candidateType(candidate) == webrtc.ICECandidateTypeHost
+}
+
+// Set the filter that decides which local and remote candidates are used (nil keeps all candidates). Candidates for which the filter
+// returns false are dropped and counted (see FilteredCandidates)
+func (r *RTC) SetCandidateFilter(filter func(candidate webrtc.ICECandidateInit) bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.candidateFilter = filter
+}
+
+// Only gather local candidates on the network interfaces with the given names (e.g. "wlan0"). Must be called before CreatePeerConnection
+func (r *RTC) SetInterfaceAllowlist(interfaces []string) error {
+	if r.peerConnection() != nil {
+		return fmt.Errorf("Cannot set interface allowlist. Connection already exists")
+	}
+
+	allowed := slices.Clone(interfaces)
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.settings.SetInterfaceFilter(func(name string) bool {
+		return slices.Contains(allowed, name)
+	})
+	return nil
+}
+
+// Returns the number of local and remote candidates that were dropped by the candidate filter
+func (r *RTC) FilteredCandidates() uint64 {
+	return r.filteredCandidates.Load()
+}
+
+// Whether a candidate passes the candidate filter, counting it if it does not
+func (r *RTC) allowCandidate(candidate webrtc.ICECandidateInit, direction string) bool {
+	r.lock.Lock()
+	filter := r.candidateFilter
+	r.lock.Unlock()
+
+	if filter == nil || filter(candidate) {
+		return true
+	}
+
+	r.filteredCandidates.Add(1)
+	log := r.Log()
+	log.Debug().Str("candidate", candidate.Candidate).Str("direction", direction).Msg("Dropped ICE candidate, it does not pass the candidate filter")
+	return false
+}
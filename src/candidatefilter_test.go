@@ -0,0 +1,88 @@
+package rtc_test
+
+import (
+	"fmt"
+	"testing"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/VU-ASE/roverrtc/src/rtctest"
+	"github.com/pion/webrtc/v4"
+)
+
+// Returns a candidate of the given type (host, srflx, prflx or relay)
+func candidateOfType(typ string, port int) webrtc.ICECandidateInit {
+	mid := "0"
+	candidate := fmt.Sprintf("candidate:1 1 udp 2130706431 192.0.2.1 %d typ %s", port, typ)
+	if typ != "host" {
+		candidate += " raddr 10.0.0.2 rport 50000"
+	}
+	return webrtc.ICECandidateInit{Candidate: candidate, SDPMid: &mid}
+}
+
+func TestHostOnlyFilter(t *testing.T) {
+	for typ, want := range map[string]bool{"host": true, "srflx": false, "prflx": false, "relay": false} {
+		if got := rtc.HostOnlyFilter(candidateOfType(typ, 50000)); got != want {
+			t.Errorf("Expected %s candidates to pass the filter: %t, got %t", typ, want, got)
+		}
+	}
+}
+
+func TestCandidateFilterOnLocalCandidates(t *testing.T) {
+	r := rtc.NewRTC("rover")
+	r.SetCandidateFilter(rtc.HostOnlyFilter)
+
+	host := candidateOfType("host", 50000)
+	r.AddLocalCandidate(host)
+	r.AddLocalCandidate(candidateOfType("srflx", 50001))
+	r.AddLocalCandidate(candidateOfType("relay", 50002))
+
+	candidates := r.GetAllLocalCandidates()
+	if len(candidates) != 1 || candidates[0].Candidate != host.Candidate {
+		t.Errorf("Expected only the host candidate to be kept, got %v", candidates)
+	}
+	if filtered := r.FilteredCandidates(); filtered != 2 {
+		t.Errorf("Expected 2 filtered candidates, got %d", filtered)
+	}
+	if dump := r.DumpState(); dump.FilteredCandidates != 2 {
+		t.Errorf("Expected 2 filtered candidates in the state dump, got %d", dump.FilteredCandidates)
+	}
+}
+
+func TestCandidateFilterOnRemoteCandidates(t *testing.T) {
+	client, offer, err := rtc.CreateOffer("client")
+	if err != nil {
+		t.Fatalf("Cannot create offer: %v", err)
+	}
+	t.Cleanup(func() { client.Destroy() })
+
+	server := newAnswerer(t, "server")
+	server.SetCandidateFilter(rtc.HostOnlyFilter)
+	if err := server.SetRemoteDescription(offer.Offer); err != nil {
+		t.Fatalf("Cannot set remote description: %v", err)
+	}
+	applied := countEvents(server, rtc.EventRemoteCandidate)
+
+	for _, candidate := range []webrtc.ICECandidateInit{candidateOfType("srflx", 50001), candidateOfType("host", 50000)} {
+		if err := server.AddRemoteCandidate(candidate); err != nil {
+			t.Fatalf("Cannot add remote candidate: %v", err)
+		}
+	}
+	if got := countEvents(server, rtc.EventRemoteCandidate) - applied; got != 1 {
+		t.Errorf("Expected only the host candidate to be applied, got %d candidates", got)
+	}
+	if filtered := server.FilteredCandidates(); filtered != 1 {
+		t.Errorf("Expected the srflx candidate to be filtered, got %d filtered candidates", filtered)
+	}
+}
+
+func TestHostOnlyConnection(t *testing.T) {
+	client, server := rtctest.NewConnectedPair(t, rtc.WithCandidateFilter(rtc.HostOnlyFilter))
+
+	for _, peer := range []*rtc.RTC{client, server} {
+		for _, candidate := range peer.GetAllLocalCandidates() {
+			if !rtc.HostOnlyFilter(candidate) {
+				t.Errorf("Expected only host candidates on %s, got %s", peer.Id, candidate.Candidate)
+			}
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package rtc
+
+import (
+	"fmt"
+
+	"github.com/pion/webrtc/v4"
+	"google.golang.org/protobuf/proto"
+)
+
+//
+// This file contains the named channels of a connection. Apart from the control and data channel, a connection can open additional channels
+// with their own delivery semantics (e.g. a low-latency channel for gamepad input that does not share its ordering with debug data).
+// The control and data channel are available as named channels as well, under the names "control" and "data"
+//
+
+// A named data channel of a connection
+type Channel struct {
+	Name string
+	dc   *webrtc.DataChannel
+	rtc  *RTC
+}
+
+// Create a channel with the given name and delivery semantics. The channel is announced to the peer in-band, which picks it up through
+// AcceptDataChannels (see OnNewChannel). Opening the "control" or "data" channel sets it up as ControlChannel or DataChannel
+func (r *RTC) OpenChannel(name string, config ChannelConfig) (*Channel, error) {
+	pc := r.peerConnection()
+	if pc == nil {
+		return nil, fmt.Errorf("Cannot open channel %s. Connection is nil", name)
+	}
+
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("Cannot open channel %s: %w", name, err)
+	}
+
+	dcInit := &webrtc.DataChannelInit{Ordered: &config.Ordered}
+	if config.Unreliable {
+		maxRetransmits := config.MaxRetransmits
+		dcInit.MaxRetransmits = &maxRetransmits
+	}
+	if config.MaxPacketLifeTime > 0 {
+		lifetime := uint16(config.MaxPacketLifeTime.Milliseconds())
+		dcInit.MaxPacketLifeTime = &lifetime
+	}
+	if config.Protocol != "" {
+		dcInit.Protocol = &config.Protocol
+	}
+	dc, err := pc.CreateDataChannel(name, dcInit)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.AddChannel(dc); err != nil {
+		// The channel is already announced to the peer, close it so that it does not stay open without being registered
+		if closeErr := dc.Close(); closeErr != nil {
+			log := r.Log()
+			log.Debug().Err(closeErr).Str("label", name).Msg("Cannot close rejected data channel")
+		}
+		return nil, err
+	}
+
+	switch name {
+	case ControlChannelLabel:
+		r.SetControlChannel(dc)
+	case DataChannelLabel:
+		r.SetDataChannel(dc)
+	}
+	return &Channel{Name: name, dc: dc, rtc: r}, nil
+}
+
+// Returns the registered channel with the given name, or nil if there is none
+func (r *RTC) Channel(name string) *Channel {
+	dc := r.GetChannel(name)
+	if dc == nil {
+		return nil
+	}
+	return &Channel{Name: name, dc: dc, rtc: r}
+}
+
+// Register a handler that is called for every channel the peer announces (after it is registered, see AcceptDataChannels),
+// including the control and data channel
+func (r *RTC) OnNewChannel(handler func(ch *Channel)) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.onNewChannel = handler
+}
+
+// Send bytes on the channel (through the writer if it is started). The control and data channel have their own send methods,
+// which apply their framing, so use SendControlBytes and SendDataBytes for those
+func (c *Channel) Send(b []byte) error {
+	if err := channelOpen(c.dc); err != nil {
+		return err
+	}
+	return c.rtc.send(c.dc, b, DefaultPriority)
+}
+
+// Marshal a message and send it on the channel
+func (c *Channel) SendProto(pb proto.Message) error {
+	buf, err := marshalPooled(pb)
+	if err != nil {
+		return err
+	}
+	defer releaseBuffer(buf)
+
+	return c.Send(*buf)
+}
+
+// Register a handler for messages received on the channel. Do not use this on the control and data channel, as it replaces
+// the package-owned receive path (use OnControlBytes and OnData instead)
+func (c *Channel) OnMessage(handler func(b []byte)) {
+	c.dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+		c.rtc.handleChannelMessage(c.Name, msg.Data)
+		handler(msg.Data)
+	})
+}
+
+// Whether the channel is open, so that messages can be sent on it
+func (c *Channel) IsOpen() bool {
+	return channelOpen(c.dc) == nil
+}
+
+// Returns the delivery semantics of the channel, as negotiated with the peer
+func (c *Channel) Config() ChannelConfig {
+	return channelConfig(c.dc)
+}
+
+// Returns the underlying webRTC data channel
+func (c *Channel) DataChannel() *webrtc.DataChannel {
+	return c.dc
+}
+
+// Close the channel. The channel is unregistered from the connection once it is closed
+func (c *Channel) Close() error {
+	return c.dc.Close()
+}
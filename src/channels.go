@@ -0,0 +1,281 @@
+package rtc
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+//
+// This file contains the bookkeeping of all data channels of a connection. Apart from the control and data channel,
+// a connection can carry additional channels (identified by their label), up to a configurable maximum
+//
+
+// The labels of the channels that are mapped to ControlChannel and DataChannel
+const (
+	ControlChannelLabel = "control"
+	DataChannelLabel    = "data"
+)
+
+// The delivery semantics of a data channel. The zero value is reliable (but unordered): messages are retransmitted until they are delivered,
+// unless Unreliable or MaxPacketLifeTime is set
+type ChannelConfig struct {
+	Ordered           bool          // whether messages are delivered in the order they were sent
+	Unreliable        bool          // whether messages are given up on after MaxRetransmits retransmissions
+	MaxRetransmits    uint16        // the maximum number of retransmissions of a message, only used if Unreliable is set
+	MaxPacketLifeTime time.Duration // how long a message is retransmitted before it is given up on (negotiated in milliseconds), 0 means no limit
+	Protocol          string        // the sub-protocol of the channel (e.g. to version the messages on it), see RequireChannelProtocol
+}
+
+var (
+	// Every message is delivered, in order (the webRTC default)
+	ReliableChannel = ChannelConfig{Ordered: true}
+	// Messages are sent once and delivered as soon as they arrive, so a lost message does not hold back the next ones (e.g. for high-rate telemetry)
+	UnreliableChannel = ChannelConfig{Ordered: false, Unreliable: true, MaxRetransmits: 0}
+)
+
+func (c ChannelConfig) String() string {
+	order := "unordered"
+	if c.Ordered {
+		order = "ordered"
+	}
+	if c.Protocol != "" {
+		order += fmt.Sprintf(", protocol %q", c.Protocol)
+	}
+	if c.MaxPacketLifeTime > 0 {
+		return fmt.Sprintf("partially reliable (max lifetime %s), %s", c.MaxPacketLifeTime, order)
+	}
+	if !c.Unreliable {
+		return "reliable, " + order
+	}
+	return fmt.Sprintf("unreliable (max %d retransmits), %s", c.MaxRetransmits, order)
+}
+
+// The default maximum number of data channels per connection, to prevent a peer from exhausting our resources
+const DefaultMaxChannels = 16
+
+var (
+	// A channel announced by the peer does not use the required sub-protocol
+	ErrProtocolMismatch = errors.New("Data channel protocol does not match the required protocol")
+	// The channel to send on is not set up on the connection
+	ErrChannelNotConfigured = errors.New("Channel is not configured")
+	// The channel to send on is set up, but not open (yet or anymore)
+	ErrChannelNotOpen = errors.New("Channel is not open")
+)
+
+// Register a data channel on this connection (by its label). Channels beyond MaxChannels are rejected and closed
+func (r *RTC) AddChannel(dc *webrtc.DataChannel) error {
+	log := r.Log()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	label := dc.Label()
+	if r.channels[label] != nil {
+		return fmt.Errorf("A channel with label %s is already registered", label)
+	}
+
+	if r.MaxChannels > 0 && len(r.channels) >= r.MaxChannels {
+		r.rejectedChannels.Add(1)
+		log.Warn().Str("label", label).Int("maxChannels", r.MaxChannels).Msg("Rejected data channel, maximum number of channels reached")
+		go func() {
+			if err := dc.Close(); err != nil {
+				log.Debug().Err(err).Str("label", label).Msg("Cannot close rejected data channel")
+			}
+		}()
+		return fmt.Errorf("Maximum number of channels reached")
+	}
+
+	r.channels[label] = dc
+	// Account for the messages on the channel until a handler is registered (see Channel.OnMessage), the control and data channel
+	// replace this with the package-owned receive path
+	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+		r.handleChannelMessage(label, msg.Data)
+	})
+	dc.OnOpen(func() {
+		r.recordEvent(EventChannelOpen, label)
+		r.lock.Lock()
+		r.signalStateChanged()
+		r.lock.Unlock()
+		r.checkChannelsOpen()
+	})
+	dc.OnClose(func() {
+		r.recordEvent(EventChannelClose, label)
+
+		r.lock.Lock()
+		defer r.lock.Unlock()
+
+		r.signalStateChanged()
+		// Free the slot, unless the label was taken over by another channel in the meantime
+		if r.channels[label] == dc {
+			delete(r.channels, label)
+		}
+	})
+
+	log.Debug().Str("label", label).Msg("Added data channel")
+	return nil
+}
+
+// Account for a message received on a channel other than the control and data channel, and pass it to the taps of the channel
+func (r *RTC) handleChannelMessage(label string, b []byte) {
+	r.throughput.add(false, len(b))
+	r.recordActivity(label, false)
+	r.recordTraffic(label, false, b)
+	r.tap(label, b)
+}
+
+// Returns the registered data channel with the given label, or nil if there is none
+func (r *RTC) GetChannel(label string) *webrtc.DataChannel {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.channels[label]
+}
+
+// Returns the number of channels that were rejected because the maximum number of channels was reached
+func (r *RTC) RejectedChannels() uint64 {
+	return r.rejectedChannels.Load()
+}
+
+// Register the OnDataChannel handler on the peer connection, so that channels announced by the peer are registered on this connection.
+// The "control" and "data" channels are set up as ControlChannel and DataChannel, other channels are available through GetChannel
+func (r *RTC) AcceptDataChannels() error {
+	pc := r.peerConnection()
+	if pc == nil {
+		return fmt.Errorf("Cannot accept data channels. Connection is nil")
+	}
+
+	pc.OnDataChannel(r.onDataChannel)
+	return nil
+}
+
+// Returns the sub-protocol of the data channel (e.g. used to version the data stream), or an empty string if there is no data channel
+func (r *RTC) DataChannelProtocol() string {
+	dc := r.DataChannel()
+	if dc == nil {
+		return ""
+	}
+	return dc.Protocol()
+}
+
+// Require channels announced by the peer to use the given sub-protocol. Channels with another protocol are rejected and closed,
+// and onMismatch (if not nil) is called with an error wrapping ErrProtocolMismatch. Pass an empty protocol to accept all channels
+func (r *RTC) RequireChannelProtocol(protocol string, onMismatch func(label string, err error)) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.requiredProtocol = protocol
+	r.onProtocolMismatch = onMismatch
+}
+
+// Handles a data channel announced by the peer
+func (r *RTC) onDataChannel(dc *webrtc.DataChannel) {
+	log := r.Log()
+
+	r.lock.Lock()
+	required := r.requiredProtocol
+	onMismatch := r.onProtocolMismatch
+	r.lock.Unlock()
+
+	if required != "" && dc.Protocol() != required {
+		err := fmt.Errorf("%w: channel %s uses protocol %q, expected %q", ErrProtocolMismatch, dc.Label(), dc.Protocol(), required)
+		log.Warn().Err(err).Msg("Rejected data channel")
+		if closeErr := dc.Close(); closeErr != nil {
+			log.Debug().Err(closeErr).Str("label", dc.Label()).Msg("Cannot close rejected data channel")
+		}
+		if onMismatch != nil {
+			onMismatch(dc.Label(), err)
+		}
+		return
+	}
+
+	if err := r.AddChannel(dc); err != nil {
+		return
+	}
+
+	switch dc.Label() {
+	case ControlChannelLabel:
+		r.SetControlChannel(dc)
+	case DataChannelLabel:
+		r.SetDataChannel(dc)
+	}
+
+	r.lock.Lock()
+	handler := r.onNewChannel
+	r.lock.Unlock()
+	if handler != nil {
+		handler(&Channel{Name: dc.Label(), dc: dc, rtc: r})
+	}
+}
+
+// Returns whether the data channel is set up and open, so that messages can be sent on it
+func (r *RTC) IsDataChannelOpen() bool {
+	return channelOpen(r.dataMessageChannel()) == nil
+}
+
+// Returns whether the control channel is set up and open, so that messages can be sent on it
+func (r *RTC) IsControlChannelOpen() bool {
+	return channelOpen(r.controlMessageChannel()) == nil
+}
+
+// Returns an error wrapping ErrChannelNotConfigured or ErrChannelNotOpen if messages cannot be sent on the channel
+func channelOpen(dc MessageChannel) error {
+	if dc == nil {
+		return ErrChannelNotConfigured
+	}
+	if state := dc.ReadyState(); state != webrtc.DataChannelStateOpen {
+		return fmt.Errorf("%w: channel %s is %s", ErrChannelNotOpen, dc.Label(), state)
+	}
+	return nil
+}
+
+// Check that the delivery semantics can be negotiated, a channel is limited either by retransmissions or by lifetime
+func (c ChannelConfig) validate() error {
+	if c.MaxPacketLifeTime < 0 || c.MaxPacketLifeTime > math.MaxUint16*time.Millisecond {
+		return fmt.Errorf("Max packet lifetime %s is out of range", c.MaxPacketLifeTime)
+	}
+	if c.MaxPacketLifeTime > 0 && c.Unreliable {
+		return fmt.Errorf("Cannot limit both the retransmissions and the lifetime of messages")
+	}
+	// A limit on the retransmissions of a reliable channel would silently not apply
+	if c.MaxRetransmits > 0 && !c.Unreliable {
+		return fmt.Errorf("Cannot limit the retransmissions of a reliable channel, set Unreliable to limit them to %d", c.MaxRetransmits)
+	}
+	return nil
+}
+
+// Create the data channel with the given delivery semantics and set it up as DataChannel. This is meant for the peer that creates
+// the offer, the answering peer receives the channel (with the same semantics) through AcceptDataChannels
+func (r *RTC) SetupDataChannel(config ChannelConfig) error {
+	_, err := r.OpenChannel(DataChannelLabel, config)
+	return err
+}
+
+// Returns the delivery semantics of the data channel, as negotiated with the peer. Returns ReliableChannel if there is no data channel
+func (r *RTC) DataChannelConfig() ChannelConfig {
+	dc := r.dataMessageChannel()
+	if dc == nil {
+		return ReliableChannel
+	}
+	return channelConfig(dc)
+}
+
+// Returns the delivery semantics of a channel, channels other than pion data channels (i.e. mocks) are reliable
+func channelConfig(channel MessageChannel) ChannelConfig {
+	dc, ok := channel.(*webrtc.DataChannel)
+	if !ok {
+		return ReliableChannel
+	}
+	config := ChannelConfig{Ordered: dc.Ordered(), Protocol: dc.Protocol()}
+	if maxRetransmits := dc.MaxRetransmits(); maxRetransmits != nil {
+		config.Unreliable = true
+		config.MaxRetransmits = *maxRetransmits
+	}
+	if lifetime := dc.MaxPacketLifeTime(); lifetime != nil {
+		config.MaxPacketLifeTime = time.Duration(*lifetime) * time.Millisecond
+	}
+	return config
+}
@@ -0,0 +1,285 @@
+package rtc_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/VU-ASE/roverrtc/src/rtctest"
+	"github.com/pion/webrtc/v4"
+)
+
+func TestUnreliableDataChannel(t *testing.T) {
+	client, server := rtctest.NewConnectedPair(t, rtc.WithDataChannelConfig(rtc.UnreliableChannel))
+
+	for _, peer := range []*rtc.RTC{client, server} {
+		if config := peer.DataChannelConfig(); config != rtc.UnreliableChannel {
+			t.Errorf("Expected %s to negotiate an unreliable data channel, got %s", peer.Id, config)
+		}
+		stats, err := peer.Stats()
+		if err != nil {
+			t.Fatalf("Cannot get statistics of %s: %v", peer.Id, err)
+		}
+		if stats.Data.Config != rtc.UnreliableChannel {
+			t.Errorf("Expected the statistics of %s to report an unreliable data channel, got %s", peer.Id, stats.Data.Config)
+		}
+	}
+
+	received := collectData(server)
+	if err := client.SendDataBytes([]byte("imu")); err != nil {
+		t.Fatalf("Cannot send on unreliable data channel: %v", err)
+	}
+	expectMessage(t, received, []byte("imu"))
+}
+
+func TestPartiallyReliableDataChannel(t *testing.T) {
+	want := rtc.ChannelConfig{Ordered: true, MaxPacketLifeTime: 100 * time.Millisecond}
+	client, server := rtctest.NewConnectedPair(t, rtc.WithDataChannelConfig(want))
+
+	for _, peer := range []*rtc.RTC{client, server} {
+		if config := peer.DataChannelConfig(); config != want {
+			t.Errorf("Expected %s to negotiate %s, got %s", peer.Id, want, config)
+		}
+	}
+}
+
+func TestSetupDataChannelRejectsInvalidConfig(t *testing.T) {
+	r := rtc.NewRTC("invalid")
+	if err := r.CreatePeerConnection(webrtc.Configuration{}); err != nil {
+		t.Fatalf("Cannot create peer connection: %v", err)
+	}
+	t.Cleanup(func() { r.Destroy() })
+
+	config := rtc.ChannelConfig{Unreliable: true, MaxRetransmits: 3, MaxPacketLifeTime: time.Second}
+	if err := r.SetupDataChannel(config); err == nil {
+		t.Error("Expected an error when limiting both the retransmissions and the lifetime of messages")
+	}
+	if err := r.SetupDataChannel(rtc.ChannelConfig{MaxRetransmits: 3}); err == nil {
+		t.Error("Expected an error when limiting the retransmissions of a reliable channel")
+	}
+}
+
+func TestZeroChannelConfigIsReliable(t *testing.T) {
+	client, server := rtctest.NewConnectedPair(t, rtc.WithDataChannelConfig(rtc.ChannelConfig{}))
+
+	for _, peer := range []*rtc.RTC{client, server} {
+		config := peer.DataChannelConfig()
+		if config != (rtc.ChannelConfig{}) || config.String() != "reliable, unordered" {
+			t.Errorf("Expected %s to negotiate a reliable unordered channel, got %s", peer.Id, config)
+		}
+		if dc := peer.DataChannel(); dc.MaxRetransmits() != nil || dc.MaxPacketLifeTime() != nil {
+			t.Errorf("Expected the data channel of %s to retransmit until delivered", peer.Id)
+		}
+	}
+}
+
+func TestChannelOpenedByAnsweringPeer(t *testing.T) {
+	client, server := rtctest.NewConnectedPair(t)
+	channels := collectChannels(client)
+
+	if _, err := server.OpenChannel("telemetry", rtc.ReliableChannel); err != nil {
+		t.Fatalf("Cannot open channel: %v", err)
+	}
+	select {
+	case name := <-channels:
+		if name != "telemetry" {
+			t.Errorf("Expected channel telemetry, got %s", name)
+		}
+	case <-time.After(receiveTimeout):
+		t.Fatal("Expected the client to accept the channel of the server")
+	}
+	if client.GetChannel("telemetry") == nil {
+		t.Error("Expected the channel to be registered on the client")
+	}
+}
+
+func TestRejectedChannelIsClosed(t *testing.T) {
+	client, _ := rtctest.NewConnectedPair(t)
+	if _, err := client.OpenChannel("telemetry", rtc.ReliableChannel); err != nil {
+		t.Fatalf("Cannot open channel: %v", err)
+	}
+	if _, err := client.OpenChannel("telemetry", rtc.ReliableChannel); err == nil {
+		t.Fatal("Expected an error when opening a channel with a label that is already registered")
+	}
+
+	// Only the registered channel stays open
+	deadline := time.Now().Add(receiveTimeout)
+	for {
+		open, closed := 0, 0
+		for _, stat := range client.Pc.GetStats() {
+			if dc, ok := stat.(webrtc.DataChannelStats); ok && dc.Label == "telemetry" {
+				switch dc.State {
+				case webrtc.DataChannelStateClosing, webrtc.DataChannelStateClosed:
+					closed++
+				default:
+					open++
+				}
+			}
+		}
+		if open == 1 && closed == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the rejected channel to be closed, got %d open and %d closed channels", open, closed)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if client.GetChannel("telemetry") == nil {
+		t.Error("Expected the first channel to stay registered")
+	}
+}
+
+func TestChannelProtocol(t *testing.T) {
+	client, server := rtctest.NewConnectedPair(t, rtc.WithChannelProtocol("v1"))
+	for _, peer := range []*rtc.RTC{client, server} {
+		if protocol := peer.DataChannelProtocol(); protocol != "v1" {
+			t.Errorf("Expected %s to use protocol v1 on the data channel, got %q", peer.Id, protocol)
+		}
+		if protocol := peer.ControlChannel().Protocol(); protocol != "v1" {
+			t.Errorf("Expected %s to use protocol v1 on the control channel, got %q", peer.Id, protocol)
+		}
+	}
+
+	// Channels opened later carry the protocol of their config
+	channels := collectChannels(server)
+	if _, err := client.OpenChannel("telemetry", rtc.ChannelConfig{Ordered: true, Protocol: "v1"}); err != nil {
+		t.Fatalf("Cannot open channel: %v", err)
+	}
+	select {
+	case name := <-channels:
+		if dc := server.GetChannel(name); dc == nil || dc.Protocol() != "v1" {
+			t.Errorf("Expected channel %s with protocol v1 on the server", name)
+		}
+	case <-time.After(receiveTimeout):
+		t.Fatal("Expected the server to accept a channel with the required protocol")
+	}
+}
+
+func TestChannelProtocolMismatch(t *testing.T) {
+	client, offer := newOffer(t, "client", rtc.WithChannelProtocol("v1"))
+	server, answer, err := rtc.AcceptOffer(offer)
+	if err != nil {
+		t.Fatalf("Cannot accept offer: %v", err)
+	}
+	t.Cleanup(func() { server.Destroy() })
+
+	// The channels are announced once the connection is established, after the answer is applied
+	mismatches := make(chan string, 4)
+	server.RequireChannelProtocol("v2", func(label string, err error) {
+		if !errors.Is(err, rtc.ErrProtocolMismatch) {
+			t.Errorf("Expected ErrProtocolMismatch for channel %s, got %v", label, err)
+		}
+		mismatches <- label
+	})
+	if err := client.ApplyAnswer(answer); err != nil {
+		t.Fatalf("Cannot apply answer: %v", err)
+	}
+
+	rejected := make(map[string]bool)
+	for len(rejected) < 2 {
+		select {
+		case label := <-mismatches:
+			rejected[label] = true
+		case <-time.After(receiveTimeout):
+			t.Fatalf("Expected the control and data channel to be rejected, got %v", rejected)
+		}
+	}
+	if !rejected[rtc.ControlChannelLabel] || !rejected[rtc.DataChannelLabel] {
+		t.Errorf("Expected the control and data channel to be rejected, got %v", rejected)
+	}
+	if server.ControlChannel() != nil || server.DataChannel() != nil {
+		t.Error("Expected the rejected channels not to be set up")
+	}
+}
+
+func TestMaxChannels(t *testing.T) {
+	client, offer := newOffer(t, "client")
+	server, answer, err := rtc.AcceptOffer(offer)
+	if err != nil {
+		t.Fatalf("Cannot accept offer: %v", err)
+	}
+	t.Cleanup(func() { server.Destroy() })
+	// Room for the control and data channel and one more
+	server.MaxChannels = 3
+	channels := collectChannels(server)
+	if err := client.ApplyAnswer(answer); err != nil {
+		t.Fatalf("Cannot apply answer: %v", err)
+	}
+	for _, label := range []string{rtc.ControlChannelLabel, rtc.DataChannelLabel} {
+		select {
+		case <-channels:
+		case <-time.After(receiveTimeout):
+			t.Fatalf("Expected the server to accept the %s channel", label)
+		}
+	}
+
+	if _, err := client.OpenChannel("telemetry", rtc.ReliableChannel); err != nil {
+		t.Fatalf("Cannot open channel: %v", err)
+	}
+	select {
+	case <-channels:
+	case <-time.After(receiveTimeout):
+		t.Fatal("Expected the server to accept the channel within the maximum")
+	}
+	if _, err := client.OpenChannel("video", rtc.ReliableChannel); err != nil {
+		t.Fatalf("Cannot open channel: %v", err)
+	}
+	deadline := time.Now().Add(receiveTimeout)
+	for server.RejectedChannels() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the channel beyond the maximum to be rejected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if rejected := server.RejectedChannels(); rejected != 1 {
+		t.Errorf("Expected 1 rejected channel, got %d", rejected)
+	}
+	if server.GetChannel("telemetry") == nil || server.GetChannel("video") != nil {
+		t.Error("Expected only the channel within the maximum to be registered")
+	}
+}
+
+func TestSendFailsFastWhenChannelIsNotOpen(t *testing.T) {
+	r := rtc.NewRTC("client")
+	send := map[string]func() error{
+		rtc.DataChannelLabel:    func() error { return r.SendDataBytes([]byte("telemetry")) },
+		rtc.ControlChannelLabel: func() error { return r.SendControlBytes([]byte("stop")) },
+	}
+	isOpen := map[string]func() bool{
+		rtc.DataChannelLabel:    r.IsDataChannelOpen,
+		rtc.ControlChannelLabel: r.IsControlChannelOpen,
+	}
+
+	for label := range send {
+		if err := send[label](); !errors.Is(err, rtc.ErrChannelNotConfigured) {
+			t.Errorf("Expected ErrChannelNotConfigured on the %s channel, got %v", label, err)
+		}
+	}
+
+	data, control := rtc.NewMockChannel(rtc.DataChannelLabel), rtc.NewMockChannel(rtc.ControlChannelLabel)
+	r.SetDataChannel(data)
+	r.SetControlChannel(control)
+	for label, dc := range map[string]*rtc.MockChannel{rtc.DataChannelLabel: data, rtc.ControlChannelLabel: control} {
+		for _, state := range []webrtc.DataChannelState{webrtc.DataChannelStateConnecting, webrtc.DataChannelStateClosed} {
+			dc.SetReadyState(state)
+			if err := send[label](); !errors.Is(err, rtc.ErrChannelNotOpen) {
+				t.Errorf("Expected ErrChannelNotOpen on the %s channel while it is %s, got %v", label, state, err)
+			}
+			if isOpen[label]() {
+				t.Errorf("Expected the %s channel to not be open while it is %s", label, state)
+			}
+		}
+		if sent := dc.Sent(); len(sent) != 0 {
+			t.Errorf("Expected nothing to be sent on the %s channel, got %d messages", label, len(sent))
+		}
+
+		dc.SetReadyState(webrtc.DataChannelStateOpen)
+		if err := send[label](); err != nil {
+			t.Errorf("Cannot send on the open %s channel: %v", label, err)
+		}
+		if !isOpen[label]() {
+			t.Errorf("Expected the %s channel to be open", label)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package rtc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+)
+
+//
+// This file contains the chunking of data messages that are larger than the (browser dependent) SCTP message size limit. A large message
+// is split into chunks that are sent as separate data messages, each with a header:
+//
+//	| message id (4 bytes, big endian) | chunk index (2 bytes, big endian) | total chunks (2 bytes, big endian) | payload |
+//
+// The receiver only reassembles a message when all of its chunks arrive in order, otherwise the message is dropped as a whole
+//
+
+const chunkHeaderSize = 8
+
+// The default size of a chunk (including its header), which is safe to send to all browsers
+const DefaultChunkSize = 16 * 1024
+
+// The maximum size of a reassembled message, to prevent a peer from exhausting our memory
+const maxReassembledSize = 64 * 1024 * 1024
+
+type reassembler struct {
+	lock      *sync.Mutex
+	messageId uint32
+	next      uint16 // the index of the next expected chunk, 0 if no message is being reassembled
+	total     uint16
+	buffer    []byte
+	dropped   bool // whether the message with messageId was dropped, so that its remaining chunks do not count it again
+}
+
+// Set the size of the chunks (including their header) sent by SendDataChunked
+func (r *RTC) SetChunkSize(size int) error {
+	if size <= chunkHeaderSize {
+		return fmt.Errorf("Chunk size must be larger than %d bytes", chunkHeaderSize)
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.chunkSize = size
+	return nil
+}
+
+// Send a message of any size on the data channel, split into chunks. The peer needs to use OnDataMessageReassembled to receive it
+func (r *RTC) SendDataChunked(b []byte) error {
+	r.lock.Lock()
+	chunkSize := r.chunkSize
+	r.lock.Unlock()
+
+	payloadSize := chunkSize - chunkHeaderSize
+	total := (len(b) + payloadSize - 1) / payloadSize
+	if total == 0 {
+		total = 1
+	}
+	if total > 0xFFFF {
+		return fmt.Errorf("Cannot send message of %d bytes. It does not fit in %d chunks", len(b), 0xFFFF)
+	}
+
+	messageId := r.chunkMessageId.Add(1)
+	for i := 0; i < total; i++ {
+		end := min((i+1)*payloadSize, len(b))
+		payload := b[i*payloadSize : end]
+
+		chunk := make([]byte, chunkHeaderSize+len(payload))
+		binary.BigEndian.PutUint32(chunk, messageId)
+		binary.BigEndian.PutUint16(chunk[4:], uint16(i))
+		binary.BigEndian.PutUint16(chunk[6:], uint16(total))
+		copy(chunk[chunkHeaderSize:], payload)
+
+		if err := r.SendDataBytes(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Marshal a message and send it on the data channel, split into chunks
+func (r *RTC) SendDataProtoChunked(pb proto.Message) error {
+	content, err := proto.Marshal(pb)
+	if err != nil {
+		return err
+	}
+
+	return r.SendDataChunked(content)
+}
+
+// Register a handler for messages sent with SendDataChunked, which receives every message once all of its chunks arrived.
+// This replaces the OnData handler. Messages of which chunks are lost or arrive out of order are dropped (see DroppedChunkedMessages)
+func (r *RTC) OnDataMessageReassembled(handler func(b []byte)) {
+	var lock sync.Mutex
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.reassembler = &reassembler{lock: &lock}
+	r.onData = handler
+}
+
+// Returns the number of chunked messages that were dropped because they could not be reassembled
+func (r *RTC) DroppedChunkedMessages() uint64 {
+	return r.droppedChunked.Load()
+}
+
+// Add a chunk to the message being reassembled, returns the message once it is complete
+func (r *RTC) reassemble(re *reassembler, chunk []byte) []byte {
+	log := r.Log()
+
+	if len(chunk) < chunkHeaderSize {
+		log.Warn().Int("length", len(chunk)).Msg("Dropped chunk, too short to contain a header")
+		return nil
+	}
+	messageId := binary.BigEndian.Uint32(chunk)
+	index := binary.BigEndian.Uint16(chunk[4:])
+	total := binary.BigEndian.Uint16(chunk[6:])
+	payload := chunk[chunkHeaderSize:]
+
+	re.lock.Lock()
+	defer re.lock.Unlock()
+
+	// A chunk that does not continue the current message means that chunks were lost or reordered
+	if re.next > 0 && (messageId != re.messageId || index != re.next || total != re.total) {
+		r.droppedChunked.Add(1)
+		log.Warn().Uint32("messageId", re.messageId).Uint16("received", re.next).Uint16("total", re.total).Msg("Dropped chunked message, chunks are missing")
+		re.next = 0
+		re.buffer = nil
+		re.dropped = true
+	}
+
+	if re.next == 0 {
+		if index != 0 || total == 0 {
+			// The start of this message was lost, so skip its remaining chunks
+			if index == total-1 && !(re.dropped && messageId == re.messageId) {
+				r.droppedChunked.Add(1)
+				log.Warn().Uint32("messageId", messageId).Msg("Dropped chunked message, chunks are missing")
+			}
+			return nil
+		}
+		re.messageId = messageId
+		re.dropped = false
+		re.total = total
+		re.buffer = make([]byte, 0, min(len(payload)*int(total), maxReassembledSize))
+	}
+
+	if len(re.buffer)+len(payload) > maxReassembledSize {
+		r.droppedChunked.Add(1)
+		log.Warn().Uint32("messageId", messageId).Msg("Dropped chunked message, it exceeds the maximum size")
+		re.next = 0
+		re.buffer = nil
+		return nil
+	}
+
+	re.buffer = append(re.buffer, payload...)
+	re.next = index + 1
+	if re.next < re.total {
+		return nil
+	}
+
+	msg := re.buffer
+	re.next = 0
+	re.buffer = nil
+	return msg
+}
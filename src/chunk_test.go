@@ -0,0 +1,95 @@
+package rtc_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/VU-ASE/roverrtc/src/rtctest"
+)
+
+func TestChunkedRoundTrip(t *testing.T) {
+	client, server := rtctest.NewConnectedPair(t)
+	received := make(chan []byte, 1)
+	server.OnDataMessageReassembled(func(b []byte) { received <- b })
+
+	payload := make([]byte, 1024*1024)
+	if _, err := rand.Read(payload); err != nil {
+		t.Fatalf("Cannot create payload: %v", err)
+	}
+	if err := client.SendDataChunked(payload); err != nil {
+		t.Fatalf("Cannot send chunked message: %v", err)
+	}
+
+	select {
+	case got := <-received:
+		if !bytes.Equal(got, payload) {
+			t.Fatalf("Reassembled message differs from the sent message (got %d bytes)", len(got))
+		}
+	case <-time.After(receiveTimeout):
+		t.Fatal("Chunked message did not arrive")
+	}
+}
+
+// Send a message chunked over a mock channel, and return the chunks as they are on the wire
+func chunksOf(t *testing.T, payload []byte, chunkSize int) [][]byte {
+	t.Helper()
+
+	sender := rtc.NewRTC("sender")
+	dc := rtc.NewMockChannel(rtc.DataChannelLabel)
+	sender.SetDataChannel(dc)
+	if err := sender.SetChunkSize(chunkSize); err != nil {
+		t.Fatalf("Cannot set chunk size: %v", err)
+	}
+	if err := sender.SendDataChunked(payload); err != nil {
+		t.Fatalf("Cannot send chunked message: %v", err)
+	}
+	return dc.Sent()
+}
+
+func TestChunkedMessageWithLostChunkIsDropped(t *testing.T) {
+	payload := bytes.Repeat([]byte("0123456789"), 10)
+	chunks := chunksOf(t, payload, 28)
+	if len(chunks) < 3 {
+		t.Fatalf("Expected at least 3 chunks, got %d", len(chunks))
+	}
+
+	receiver := rtc.NewRTC("receiver")
+	dc := rtc.NewMockChannel(rtc.DataChannelLabel)
+	receiver.SetDataChannel(dc)
+	var messages [][]byte
+	receiver.OnDataMessageReassembled(func(b []byte) { messages = append(messages, b) })
+
+	// Lose the second chunk
+	for i, chunk := range chunks {
+		if i != 1 {
+			dc.Inject(chunk)
+		}
+	}
+	if len(messages) != 0 {
+		t.Fatalf("Expected no message when a chunk is lost, got %d", len(messages))
+	}
+	if dropped := receiver.DroppedChunkedMessages(); dropped != 1 {
+		t.Errorf("Expected 1 dropped message, got %d", dropped)
+	}
+
+	// Chunks out of order
+	dc.Inject(chunks[1])
+	dc.Inject(chunks[0])
+	for _, chunk := range chunks[2:] {
+		dc.Inject(chunk)
+	}
+	if len(messages) != 0 {
+		t.Fatalf("Expected no message when chunks are reordered, got %d", len(messages))
+	}
+
+	// The next complete message is reassembled
+	for _, chunk := range chunks {
+		dc.Inject(chunk)
+	}
+	if len(messages) != 1 || !bytes.Equal(messages[0], payload) {
+		t.Errorf("Expected the complete message to be reassembled, got %q", messages)
+	}
+}
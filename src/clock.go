@@ -0,0 +1,100 @@
+package rtc
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"time"
+)
+
+//
+// This file contains the explicit clock synchronization, which uses the same ping/pong exchange as the heartbeat but takes the median
+// over several samples, so that a single delayed message does not skew TimestampOffset
+//
+
+// A single offset and round trip time measurement (in nanoseconds), taken from a pong
+type clockSample struct {
+	offset int64
+	rtt    int64
+}
+
+// Synchronize the clocks by exchanging the given number of ping/pong messages on the control channel, one at a time. TimestampOffset
+// and MeasuredRTT are set to the median of all samples. Can be called periodically to correct clock drift. The peer needs to use
+// SetControlChannel to answer pings
+func (r *RTC) SyncClock(ctx context.Context, samples int) error {
+	if samples <= 0 {
+		return fmt.Errorf("Cannot synchronize clock with %d samples", samples)
+	}
+
+	results := make(chan clockSample, 1)
+	r.lock.Lock()
+	if r.clockSamples != nil {
+		r.lock.Unlock()
+		return fmt.Errorf("Clock synchronization is already running")
+	}
+	r.clockSamples = results
+	r.lock.Unlock()
+	defer func() {
+		r.lock.Lock()
+		r.clockSamples = nil
+		r.lock.Unlock()
+	}()
+
+	offsets := make([]int64, 0, samples)
+	rtts := make([]int64, 0, samples)
+	for len(offsets) < samples {
+		sent := time.Now().UnixNano()
+		r.lock.Lock()
+		r.clockPing = sent
+		r.lock.Unlock()
+		payload := make([]byte, 8)
+		binary.BigEndian.PutUint64(payload, uint64(sent))
+		if err := r.SendControlFrame(controlTypePing, payload); err != nil {
+			return err
+		}
+
+		select {
+		case sample := <-results:
+			offsets = append(offsets, sample.offset)
+			rtts = append(rtts, sample.rtt)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	offset := median(offsets)
+	rtt := median(rtts)
+
+	r.lock.Lock()
+	r.TimestampOffset = offset / int64(time.Millisecond)
+	r.MeasuredRTT = time.Duration(rtt)
+	r.lock.Unlock()
+
+	log := r.Log()
+	log.Debug().Int64("offset", offset/int64(time.Millisecond)).Dur("rtt", time.Duration(rtt)).Int("samples", samples).Msg("Synchronized clock")
+	return nil
+}
+
+// Converts a timestamp (in milliseconds) from the clock of the peer to a local time, using the last known TimestampOffset
+func (r *RTC) GetAdjustedTime(remoteTs int64) time.Time {
+	return time.UnixMilli(r.AdjustTimestamp(remoteTs))
+}
+
+// Pass a sample to a running SyncClock, if any, when it was taken from the pong to the ping that SyncClock sent at the given time.
+// Pongs to other pings (e.g. of the keep-alive) are ignored, so that SyncClock only counts its own round trips. The caller must hold the lock
+func (r *RTC) reportClockSample(sent int64, sample clockSample) {
+	if r.clockSamples == nil || sent != r.clockPing {
+		return
+	}
+	select {
+	case r.clockSamples <- sample:
+	default:
+	}
+}
+
+// Returns the median of the values (sorting them in place)
+func median(values []int64) int64 {
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	return values[len(values)/2]
+}
@@ -0,0 +1,114 @@
+package rtc
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// A control channel that answers pings like a peer whose clock runs ahead by skew, and can be told to answer with other timestamps
+type skewedChannel struct {
+	*MockChannel
+	skew time.Duration
+}
+
+// Answer a ping with a pong, as the peer would after handling it
+func (c *skewedChannel) Send(b []byte) error {
+	if len(b) != controlFrameHeaderSize+8 || b[0] != controlFrameMarker || binary.BigEndian.Uint16(b[1:]) != controlTypePing {
+		return c.MockChannel.Send(b)
+	}
+	sent := int64(binary.BigEndian.Uint64(b[controlFrameHeaderSize:]))
+	go c.Inject(pongFrame(sent, sent+int64(c.skew)))
+	return nil
+}
+
+// Returns a framed pong to the ping sent at the given time, answered by the peer at the given time
+func pongFrame(sent, answered int64) []byte {
+	frame := make([]byte, controlFrameHeaderSize+16)
+	frame[0] = controlFrameMarker
+	binary.BigEndian.PutUint16(frame[1:], controlTypePong)
+	binary.BigEndian.PutUint64(frame[controlFrameHeaderSize:], uint64(sent))
+	binary.BigEndian.PutUint64(frame[controlFrameHeaderSize+8:], uint64(answered))
+	return frame
+}
+
+// Create a connection whose control channel is answered by a peer with a clock that runs ahead by skew
+func newSkewedConnection(skew time.Duration) (*RTC, *skewedChannel) {
+	r := NewRTC("skewed")
+	dc := &skewedChannel{MockChannel: NewMockChannel(ControlChannelLabel), skew: skew}
+	r.SetControlChannel(dc)
+	return r, dc
+}
+
+func TestSyncClockWithSkew(t *testing.T) {
+	skew := 5 * time.Second
+	r, _ := newSkewedConnection(skew)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := r.SyncClock(ctx, 5); err != nil {
+		t.Fatalf("Cannot synchronize clock: %v", err)
+	}
+
+	if offset := time.Duration(r.AdjustTimestamp(0)) * -time.Millisecond; (offset - skew).Abs() > 50*time.Millisecond {
+		t.Errorf("Expected an offset of about %s, got %s", skew, offset)
+	}
+	remoteNow := time.Now().Add(skew).UnixMilli()
+	if diff := time.Since(r.GetAdjustedTime(remoteNow)).Abs(); diff > 50*time.Millisecond {
+		t.Errorf("Expected the adjusted remote time to be about now, it is %s off", diff)
+	}
+}
+
+func TestSyncClockIgnoresOtherPongs(t *testing.T) {
+	r, dc := newSkewedConnection(time.Second)
+
+	// A pong to a ping that SyncClock did not send (e.g. of the keep-alive), with a wildly different offset
+	now := time.Now().UnixNano()
+	stale := pongFrame(now-1, now+int64(time.Hour))
+
+	done := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		done <- r.SyncClock(ctx, 3)
+	}()
+	for i := 0; i < 10; i++ {
+		dc.Inject(stale)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("Cannot synchronize clock: %v", err)
+	}
+
+	if offset := time.Duration(r.AdjustTimestamp(0)) * -time.Millisecond; (offset - time.Second).Abs() > 50*time.Millisecond {
+		t.Errorf("Expected an offset of about 1s, got %s", offset)
+	}
+}
+
+func TestSyncClockRejectsConcurrentCalls(t *testing.T) {
+	r := NewRTC("idle")
+	r.SetControlChannel(NewMockChannel(ControlChannelLabel))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- r.SyncClock(ctx, 1) }()
+
+	// The first call waits for a pong that never arrives
+	deadline := time.Now().Add(time.Second)
+	for {
+		r.lock.Lock()
+		running := r.clockSamples != nil
+		r.lock.Unlock()
+		if running || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := r.SyncClock(context.Background(), 1); err == nil {
+		t.Error("Expected an error when synchronizing twice at the same time")
+	}
+	cancel()
+	if err := <-done; err == nil {
+		t.Error("Expected the context error when no pong arrives")
+	}
+}
@@ -0,0 +1,71 @@
+package rtc
+
+import (
+	"time"
+)
+
+//
+// This file contains the graceful close handshake. Before closing, a peer sends a "closing" control message with the reason, so that
+// the other side can tell a clean shutdown apart from a dropped connection (and e.g. not retry aggressively). The peer acknowledges it
+// after passing the reason to its OnPeerClosing handler, so the reason arrives before the connection goes down
+//
+
+// Close the connection gracefully: tell the peer why the connection is closed, wait until it acknowledges this (or the timeout passes),
+// then close the data channels and the peer connection (see Destroy). Use Destroy to close the connection without telling the peer
+func (r *RTC) Close(reason string, timeout time.Duration) error {
+	log := r.Log()
+
+	if err := r.SendControlFrame(controlTypeClosing, []byte(reason)); err != nil {
+		log.Debug().Err(err).Msg("Cannot tell peer that the connection is closing")
+	} else {
+		timer := time.NewTimer(timeout)
+		select {
+		case <-r.closingAck:
+			log.Debug().Msg("Peer acknowledged that the connection is closing")
+		case <-timer.C:
+			log.Debug().Dur("timeout", timeout).Msg("Peer did not acknowledge that the connection is closing")
+		case <-r.closed:
+		}
+		timer.Stop()
+	}
+
+	log.Info().Str("reason", reason).Msg("Closing RTC connection")
+	return r.destroy(reason)
+}
+
+// Register a handler that is called with the reason when the peer closes the connection gracefully (see Close). The peer waits for
+// the handler to return (up to its timeout) before it closes the connection
+func (r *RTC) OnPeerClosing(handler func(reason string)) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.onPeerClosing = handler
+}
+
+// Pass the reason of the peer to the handler and acknowledge it
+func (r *RTC) handleClosing(payload []byte) {
+	log := r.Log()
+
+	reason := string(payload)
+	r.lock.Lock()
+	handler := r.onPeerClosing
+	r.lock.Unlock()
+
+	if handler != nil {
+		handler(reason)
+	} else {
+		log.Info().Str("reason", reason).Msg("Peer is closing the connection")
+	}
+
+	if err := r.SendControlFrame(controlTypeClosingAck, nil); err != nil {
+		log.Debug().Err(err).Msg("Cannot acknowledge that the connection is closing")
+	}
+}
+
+// Signal the waiting Close that the peer acknowledged the closing message
+func (r *RTC) handleClosingAck(payload []byte) {
+	select {
+	case r.closingAck <- struct{}{}:
+	default:
+	}
+}
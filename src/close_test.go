@@ -0,0 +1,67 @@
+package rtc_test
+
+import (
+	"testing"
+	"time"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/VU-ASE/roverrtc/src/rtctest"
+	"github.com/pion/webrtc/v4"
+)
+
+func TestCloseTellsPeerTheReason(t *testing.T) {
+	client, server := rtctest.NewConnectedPair(t)
+	type closing struct {
+		reason string
+		state  webrtc.PeerConnectionState
+	}
+	received := make(chan closing, 1)
+	client.OnPeerClosing(func(reason string) {
+		received <- closing{reason: reason, state: client.ConnectionState()}
+	})
+
+	const timeout = 2 * time.Second
+	start := time.Now()
+	if err := server.Close("server shutdown", timeout); err != nil {
+		t.Fatalf("Cannot close connection: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= timeout {
+		t.Errorf("Expected the peer to acknowledge before the timeout, closing took %s", elapsed)
+	}
+
+	select {
+	case c := <-received:
+		if c.reason != "server shutdown" {
+			t.Errorf("Expected reason %q, got %q", "server shutdown", c.reason)
+		}
+		if c.state != webrtc.PeerConnectionStateConnected {
+			t.Errorf("Expected the reason to arrive while the connection is still connected, it was %s", c.state)
+		}
+	default:
+		t.Fatal("Expected the reason to arrive before Close returned")
+	}
+	if state := server.ConnectionState(); state != webrtc.PeerConnectionStateClosed {
+		t.Errorf("Expected the closed connection to be closed, it is %s", state)
+	}
+}
+
+func TestCloseWithoutAcknowledgement(t *testing.T) {
+	r := rtc.NewRTC("rover")
+	control := rtc.NewMockChannel(rtc.ControlChannelLabel)
+	r.SetControlChannel(control)
+
+	const timeout = 100 * time.Millisecond
+	start := time.Now()
+	if err := r.Close("server shutdown", timeout); err != nil {
+		t.Fatalf("Cannot close connection: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < timeout {
+		t.Errorf("Expected Close to wait for the acknowledgement until the timeout, it returned after %s", elapsed)
+	}
+	if len(control.Sent()) != 1 {
+		t.Errorf("Expected the closing message to be sent, got %d messages", len(control.Sent()))
+	}
+	if state := control.ReadyState(); state != webrtc.DataChannelStateClosed {
+		t.Errorf("Expected the control channel to be closed, it is %s", state)
+	}
+}
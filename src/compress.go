@@ -0,0 +1,140 @@
+package rtc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+//
+// This file contains the (opt-in) compression of data messages. Messages above the configured size are compressed and prefixed with a one-byte
+// codec marker. Smaller messages are sent as-is, so that a peer without compression can still read them. A protobuf message never starts with
+// a byte below 0x08 (that would be field number 0), so the markers cannot be confused with the start of a message:
+//
+//	| codec (1 byte) | payload |
+//
+// Raw messages that do start with a byte below 0x08 (e.g. chunks) are prefixed with the raw marker (0x00)
+//
+
+// The compression applied to a data message
+type Codec byte
+
+const (
+	CodecNone Codec = 0x00 // the message is not compressed
+	CodecGzip Codec = 0x01 // the message is compressed with gzip
+)
+
+// Bytes below this value at the start of a message are codec markers
+const codecMarkerLimit = 0x08
+
+// Messages up to this size are not compressed, if no threshold is configured
+const DefaultCompressionThreshold = 1024
+
+type compression struct {
+	codec     Codec
+	threshold int // messages up to this size are not compressed
+}
+
+// Returns the name of the codec
+func (c Codec) String() string {
+	switch c {
+	case CodecNone:
+		return "none"
+	case CodecGzip:
+		return "gzip"
+	default:
+		return fmt.Sprintf("unknown (%d)", byte(c))
+	}
+}
+
+// Compress outgoing data messages larger than threshold bytes with the given codec, and decompress incoming data messages.
+// Pass CodecNone to disable compression. Both peers need to enable compression to exchange compressed messages
+func (r *RTC) EnableCompression(codec Codec, threshold int) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.compression = nil
+	if codec != CodecNone {
+		r.compression = &compression{codec: codec, threshold: threshold}
+	}
+}
+
+// Compress an outgoing message if compression is enabled and the message is large enough
+func (r *RTC) compress(b []byte) []byte {
+	r.lock.Lock()
+	c := r.compression
+	r.lock.Unlock()
+
+	if c == nil {
+		return b
+	}
+
+	if len(b) > c.threshold {
+		compressed, err := compressPayload(c.codec, b)
+		if err != nil {
+			log := r.Log()
+			log.Warn().Err(err).Stringer("codec", c.codec).Msg("Cannot compress data message, sending it uncompressed")
+		} else if len(compressed) < len(b) {
+			return compressed
+		}
+	}
+
+	if len(b) > 0 && b[0] >= codecMarkerLimit {
+		return b
+	}
+	return append([]byte{byte(CodecNone)}, b...)
+}
+
+// Decompress an incoming message if compression is enabled and the message starts with a codec marker
+func (r *RTC) decompress(b []byte) ([]byte, error) {
+	r.lock.Lock()
+	c := r.compression
+	r.lock.Unlock()
+
+	if c == nil || len(b) == 0 || b[0] >= codecMarkerLimit {
+		return b, nil
+	}
+
+	switch Codec(b[0]) {
+	case CodecNone:
+		return b[1:], nil
+	case CodecGzip:
+		reader, err := gzip.NewReader(bytes.NewReader(b[1:]))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+
+		// Guard against messages that decompress to an unreasonable size
+		decompressed, err := io.ReadAll(io.LimitReader(reader, maxReassembledSize+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(decompressed) > maxReassembledSize {
+			return nil, fmt.Errorf("Decompressed message exceeds %d bytes", maxReassembledSize)
+		}
+		return decompressed, nil
+	default:
+		return nil, fmt.Errorf("Unknown codec %s", Codec(b[0]))
+	}
+}
+
+// Compress a payload with the given codec, prefixed with its marker
+func compressPayload(codec Codec, b []byte) ([]byte, error) {
+	switch codec {
+	case CodecGzip:
+		var buf bytes.Buffer
+		buf.WriteByte(byte(CodecGzip))
+		writer := gzip.NewWriter(&buf)
+		if _, err := writer.Write(b); err != nil {
+			return nil, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("Unknown codec %s", codec)
+	}
+}
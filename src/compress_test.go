@@ -0,0 +1,119 @@
+package rtc_test
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+)
+
+// Create a connection on a mock data channel, compressing with the given codec
+func newCompressingConnection(codec rtc.Codec, threshold int) (*rtc.RTC, *rtc.MockChannel) {
+	r := rtc.NewRTC("rover")
+	dc := rtc.NewMockChannel(rtc.DataChannelLabel)
+	r.SetDataChannel(dc)
+	r.EnableCompression(codec, threshold)
+	return r, dc
+}
+
+// A (compressible) telemetry log line repeated to the given size
+func telemetryLog(size int) []byte {
+	var buf bytes.Buffer
+	for i := 0; buf.Len() < size; i++ {
+		fmt.Fprintf(&buf, "{\"seq\":%d,\"speed\":0.42,\"steering\":-0.1,\"battery\":11.8}\n", i)
+	}
+	return buf.Bytes()[:size]
+}
+
+func TestCompressionRoundTrip(t *testing.T) {
+	random := make([]byte, 4096)
+	rand.New(rand.NewSource(1)).Read(random)
+	random[0] = 0x2a
+
+	tests := []struct {
+		name    string
+		payload []byte
+		marker  int // the expected first byte on the wire, or -1 if the message is sent as-is
+	}{
+		{"compressible", telemetryLog(4096), int(rtc.CodecGzip)},
+		{"incompressible", random, -1},
+		{"below threshold", []byte("{\"speed\":0.42}"), -1},
+		{"starts with marker byte", []byte{0x01, 0x02, 0x03}, int(rtc.CodecNone)},
+		{"empty", []byte{}, int(rtc.CodecNone)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sender, sent := newCompressingConnection(rtc.CodecGzip, 256)
+			receiver, received := newCompressingConnection(rtc.CodecGzip, 256)
+			delivered := collectData(receiver)
+
+			if err := sender.SendDataBytes(tt.payload); err != nil {
+				t.Fatalf("Cannot send message: %v", err)
+			}
+			wire := sent.Sent()[0]
+			switch {
+			case tt.marker < 0 && !bytes.Equal(wire, tt.payload):
+				t.Errorf("Expected the message to be sent as-is, got %d bytes", len(wire))
+			case tt.marker >= 0 && (len(wire) == 0 || int(wire[0]) != tt.marker):
+				t.Errorf("Expected codec marker %d, got %v", tt.marker, wire[:min(len(wire), 1)])
+			}
+			if tt.marker == int(rtc.CodecGzip) && len(wire) >= len(tt.payload) {
+				t.Errorf("Expected the message to be smaller than %d bytes after compression, got %d", len(tt.payload), len(wire))
+			}
+
+			received.Inject(wire)
+			expectMessage(t, delivered, tt.payload)
+		})
+	}
+}
+
+func TestCompressionInteroperatesBelowThreshold(t *testing.T) {
+	sender, sent := newCompressingConnection(rtc.CodecGzip, 256)
+	// A peer without compression
+	receiver := rtc.NewRTC("operator")
+	received := rtc.NewMockChannel(rtc.DataChannelLabel)
+	receiver.SetDataChannel(received)
+	delivered := collectData(receiver)
+
+	msg := []byte("\x0a\x05hello")
+	if err := sender.SendDataBytes(msg); err != nil {
+		t.Fatalf("Cannot send message: %v", err)
+	}
+	received.Inject(sent.Sent()[0])
+	expectMessage(t, delivered, msg)
+}
+
+func TestCompressionRejectsUnknownCodec(t *testing.T) {
+	receiver, received := newCompressingConnection(rtc.CodecGzip, 256)
+	delivered := collectData(receiver)
+
+	received.Inject([]byte{0x07, 0x2a})
+	expectNoMessage(t, delivered)
+}
+
+func benchmarkCompression(b *testing.B, codec rtc.Codec) {
+	r := rtc.NewRTC("rover")
+	r.SetDataChannel(discardChannel{rtc.NewMockChannel(rtc.DataChannelLabel)})
+	r.EnableCompression(codec, rtc.DefaultCompressionThreshold)
+	payload := telemetryLog(16 * 1024)
+
+	b.SetBytes(int64(len(payload)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := r.SendDataBytes(payload); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSendCompressed(b *testing.B) {
+	benchmarkCompression(b, rtc.CodecGzip)
+}
+
+func BenchmarkSendRaw(b *testing.B) {
+	benchmarkCompression(b, rtc.CodecNone)
+}
@@ -0,0 +1,193 @@
+package rtc
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/pion/webrtc/v4"
+	"google.golang.org/protobuf/proto"
+)
+
+//
+// This file contains the framing used to multiplex typed messages (both from the package itself, such as heartbeats, and from the application)
+// over the control channel. A framed control message looks like this:
+//
+//	| 0xAF (1 byte) | type id (2 bytes, big endian) | payload |
+//
+// The 0xAF marker can never be the first byte of a valid protobuf message (it encodes the unused wire type 7), so framed messages
+// can be told apart from the raw messages sent using SendControlData and SendControlBytes. Those are passed to the OnControlBytes handler as-is.
+//
+
+const controlFrameMarker = 0xAF
+const controlFrameHeaderSize = 3
+
+// Type ids at or above this value are reserved for messages of the package itself
+const ControlTypeReserved uint16 = 0xFF00
+
+const (
+	controlTypePing uint16 = ControlTypeReserved + iota
+	controlTypePong
+	controlTypeProbe
+	controlTypeProbeEcho
+	controlTypeNack
+	controlTypeRequest
+	controlTypeResponse
+	controlTypeErrorResponse
+	controlTypeClosing
+	controlTypeClosingAck
+	controlTypeOffer
+	controlTypeAnswer
+	controlTypeCandidate
+	controlTypeStandbyOffer
+	controlTypeStandbyAnswer
+	controlTypeRestartOffer
+)
+
+// Sets the control channel and registers the package-owned receive path on it, so that framed control messages are dispatched
+// to their handlers (and pings from the peer are answered). Raw messages are passed to the OnControlBytes handler.
+// This is usually a pion data channel, tests can pass a MockChannel instead
+func (r *RTC) SetControlChannel(dc MessageChannel) {
+	r.lock.Lock()
+	r.controlChannel = dc
+	r.signalStateChanged()
+	r.lock.Unlock()
+	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+		r.handleControlMessage(msg.Data)
+	})
+	// The channel might have opened before it was set up
+	r.checkChannelsOpen()
+}
+
+// Register a handler for control messages that are not framed (i.e. sent using SendControlData or SendControlBytes)
+func (r *RTC) OnControlBytes(handler func(b []byte)) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.onControlBytes = handler
+}
+
+// Register a handler for framed control messages with the given type id. Type ids at or above ControlTypeReserved cannot be used
+func (r *RTC) HandleControl(typeID uint16, handler func(payload []byte)) error {
+	if typeID >= ControlTypeReserved {
+		return fmt.Errorf("Control type id %d is reserved", typeID)
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.controlHandlers[typeID] = handler
+	return nil
+}
+
+// Register a fallback handler for framed control messages of a type that has no handler (e.g. a type introduced by a newer peer).
+// Without it, such messages are dropped with a debug log
+func (r *RTC) OnUnhandledControl(handler func(typeID uint16, payload []byte)) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.onUnhandledControl = handler
+}
+
+// Register a protobuf message type for the given type id. Framed control messages with this type id are unmarshalled into a new
+// message created by newMessage and passed to the OnControlMessage handler. Messages of unregistered types go to OnUnhandledControl
+func (r *RTC) RegisterControlMessage(typeID uint16, newMessage func() proto.Message) error {
+	return r.HandleControl(typeID, func(payload []byte) {
+		log := r.Log()
+
+		msg := newMessage()
+		if err := proto.Unmarshal(payload, msg); err != nil {
+			log.Warn().Err(err).Uint16("type", typeID).Msg("Cannot unmarshal control message")
+			return
+		}
+
+		r.lock.Lock()
+		handler := r.onControlMessage
+		r.lock.Unlock()
+
+		if handler == nil {
+			log.Debug().Uint16("type", typeID).Msg("Dropped control message, no handler registered")
+			return
+		}
+		handler(msg, payload)
+	})
+}
+
+// Register a handler for control messages of the types registered with RegisterControlMessage. The handler receives the
+// unmarshalled message (which can be switched on by type) and the raw payload
+func (r *RTC) OnControlMessage(handler func(msg proto.Message, raw []byte)) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.onControlMessage = handler
+}
+
+// Marshal a message and send it as a framed control message with the given type id
+func (r *RTC) SendControlMessage(typeID uint16, pb proto.Message) error {
+	buf, err := marshalPooled(pb)
+	if err != nil {
+		return err
+	}
+	defer releaseBuffer(buf)
+
+	return r.SendControlFrame(typeID, *buf)
+}
+
+// Send a framed control message with the given type id
+func (r *RTC) SendControlFrame(typeID uint16, payload []byte) error {
+	return r.SendControlBytes(controlFrame(typeID, payload))
+}
+
+// Returns the framed control message with the given type id and payload
+func controlFrame(typeID uint16, payload []byte) []byte {
+	frame := make([]byte, controlFrameHeaderSize+len(payload))
+	frame[0] = controlFrameMarker
+	binary.BigEndian.PutUint16(frame[1:controlFrameHeaderSize], typeID)
+	copy(frame[controlFrameHeaderSize:], payload)
+	return frame
+}
+
+// Dispatch an incoming control message to the right handler
+func (r *RTC) handleControlMessage(b []byte) {
+	log := r.Log()
+
+	r.throughput.add(false, len(b))
+	r.recordActivity(ControlChannelLabel, false)
+	r.recordTraffic(ControlChannelLabel, false, b)
+	if len(b) < controlFrameHeaderSize || b[0] != controlFrameMarker {
+		if !r.CanControl() {
+			log.Debug().Stringer("role", r.Role()).Msg("Dropped raw control message, role is not allowed to control")
+			return
+		}
+
+		r.tap(ControlChannelLabel, b)
+		r.lock.Lock()
+		handler := r.onControlBytes
+		r.lock.Unlock()
+
+		if handler == nil {
+			log.Debug().Int("length", len(b)).Msg("Dropped raw control message, no handler registered")
+			return
+		}
+		handler(b)
+		return
+	}
+
+	typeID := binary.BigEndian.Uint16(b[1:controlFrameHeaderSize])
+	if typeID < ControlTypeReserved && !r.CanControl() {
+		log.Debug().Stringer("role", r.Role()).Uint16("type", typeID).Msg("Dropped control message, role is not allowed to control")
+		return
+	}
+
+	r.lock.Lock()
+	handler := r.controlHandlers[typeID]
+	unhandled := r.onUnhandledControl
+	r.lock.Unlock()
+
+	if handler != nil {
+		handler(b[controlFrameHeaderSize:])
+	} else if unhandled != nil {
+		unhandled(typeID, b[controlFrameHeaderSize:])
+	} else {
+		log.Debug().Uint16("type", typeID).Msg("Dropped control message, no handler registered for its type")
+	}
+}
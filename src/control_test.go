@@ -0,0 +1,148 @@
+package rtc_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/VU-ASE/roverrtc/src/rtctest"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// An unhandled control message, as reported to the OnUnhandledControl handler
+type unhandledControl struct {
+	typeID  uint16
+	payload string
+}
+
+// Returns the framed control message that a peer sends for the given type id and payload
+func controlFrame(t *testing.T, typeID uint16, payload []byte) []byte {
+	t.Helper()
+
+	sender := rtc.NewRTC("sender")
+	control := rtc.NewMockChannel(rtc.ControlChannelLabel)
+	sender.SetControlChannel(control)
+	if err := sender.SendControlFrame(typeID, payload); err != nil {
+		t.Fatalf("Cannot send control frame: %v", err)
+	}
+	return control.Sent()[0]
+}
+
+// Create a connection with a mock control channel, returns the channel and the unhandled control messages it reports
+func newControlReceiver() (*rtc.RTC, *rtc.MockChannel, *[]unhandledControl) {
+	r := rtc.NewRTC("receiver")
+	control := rtc.NewMockChannel(rtc.ControlChannelLabel)
+	r.SetControlChannel(control)
+	unhandled := &[]unhandledControl{}
+	r.OnUnhandledControl(func(typeID uint16, payload []byte) {
+		*unhandled = append(*unhandled, unhandledControl{typeID, string(payload)})
+	})
+	return r, control, unhandled
+}
+
+func TestUnhandledControl(t *testing.T) {
+	r, control, unhandled := newControlReceiver()
+	var handled [][]byte
+	if err := r.HandleControl(1, func(payload []byte) { handled = append(handled, payload) }); err != nil {
+		t.Fatalf("Cannot register handler: %v", err)
+	}
+
+	control.Inject(controlFrame(t, 1, []byte("stop")))
+	control.Inject(controlFrame(t, 42, []byte("from a newer client")))
+
+	if len(handled) != 1 || !bytes.Equal(handled[0], []byte("stop")) {
+		t.Errorf("Expected the registered handler to receive its message, got %q", handled)
+	}
+	want := unhandledControl{42, "from a newer client"}
+	if len(*unhandled) != 1 || (*unhandled)[0] != want {
+		t.Errorf("Expected the unhandled message %+v, got %+v", want, *unhandled)
+	}
+}
+
+func TestUnhandledControlFromSpectator(t *testing.T) {
+	r, control, unhandled := newControlReceiver()
+	r.SetRole(rtc.RoleSpectator)
+
+	// The message is dropped because of the role, so it is not reported as unhandled
+	control.Inject(controlFrame(t, 42, []byte("forward")))
+	if len(*unhandled) != 0 {
+		t.Errorf("Expected no unhandled messages from a spectator, got %+v", *unhandled)
+	}
+}
+
+func TestUnhandledControlWithoutHandler(t *testing.T) {
+	r := rtc.NewRTC("receiver")
+	control := rtc.NewMockChannel(rtc.ControlChannelLabel)
+	r.SetControlChannel(control)
+
+	// Dropped with a debug log
+	control.Inject(controlFrame(t, 42, []byte("from a newer client")))
+}
+
+func TestControlMessageDispatch(t *testing.T) {
+	client, server := rtctest.NewConnectedPair(t)
+	for typeID, newMessage := range map[uint16]func() proto.Message{
+		1: func() proto.Message { return &wrapperspb.StringValue{} },
+		2: func() proto.Message { return &wrapperspb.Int64Value{} },
+	} {
+		if err := server.RegisterControlMessage(typeID, newMessage); err != nil {
+			t.Fatalf("Cannot register control message %d: %v", typeID, err)
+		}
+	}
+	messages := make(chan string, 4)
+	server.OnControlMessage(func(msg proto.Message, raw []byte) {
+		switch msg := msg.(type) {
+		case *wrapperspb.StringValue:
+			messages <- "command " + msg.GetValue()
+		case *wrapperspb.Int64Value:
+			messages <- fmt.Sprintf("speed %d", msg.GetValue())
+		}
+	})
+	unhandled := make(chan uint16, 4)
+	server.OnUnhandledControl(func(typeID uint16, payload []byte) { unhandled <- typeID })
+	raw := collectControl(server)
+
+	sends := []error{
+		client.SendControlMessage(1, wrapperspb.String("forward")),
+		client.SendControlMessage(2, wrapperspb.Int64(42)),
+		client.SendControlMessage(3, wrapperspb.String("from a newer client")),
+		client.SendControlBytes([]byte("legacy")),
+	}
+	for i, err := range sends {
+		if err != nil {
+			t.Fatalf("Cannot send control message %d: %v", i, err)
+		}
+	}
+
+	// The control channel is ordered, so the messages arrive in the order they were sent
+	for _, want := range []string{"command forward", "speed 42"} {
+		select {
+		case got := <-messages:
+			if got != want {
+				t.Errorf("Expected %q, got %q", want, got)
+			}
+		case <-time.After(receiveTimeout):
+			t.Fatalf("Expected %q, got nothing", want)
+		}
+	}
+	select {
+	case typeID := <-unhandled:
+		if typeID != 3 {
+			t.Errorf("Expected type 3 to be unhandled, got %d", typeID)
+		}
+	case <-time.After(receiveTimeout):
+		t.Fatal("Expected the message of an unregistered type to be passed to the catch-all handler")
+	}
+	// Unframed control messages keep going to their own handler
+	expectMessage(t, raw, []byte("legacy"))
+}
+
+func TestRegisterReservedControlMessage(t *testing.T) {
+	r := rtc.NewRTC("client")
+	if err := r.RegisterControlMessage(rtc.ControlTypeReserved, func() proto.Message { return &wrapperspb.StringValue{} }); err == nil {
+		t.Error("Expected an error when registering a reserved type id")
+	}
+}
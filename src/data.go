@@ -0,0 +1,133 @@
+package rtc
+
+import (
+	"github.com/pion/webrtc/v4"
+)
+
+//
+// This file contains the package-owned send and receive path of the data channel. Outgoing messages are encoded and incoming messages
+// are decoded by the features that are enabled on the connection (e.g. the reorder buffer), so both peers need to enable the same features
+//
+
+// Sets the data channel and registers the package-owned receive path on it, so that incoming messages are decoded before they are
+// delivered to the OnData handler. This is usually a pion data channel, tests can pass a MockChannel instead
+func (r *RTC) SetDataChannel(dc MessageChannel) {
+	log := r.Log()
+
+	r.lock.Lock()
+	r.dataChannel = dc
+	r.signalStateChanged()
+	r.lock.Unlock()
+	log.Debug().Stringer("config", channelConfig(dc)).Msg("Set data channel")
+
+	if notifier, ok := dc.(bufferedAmountNotifier); ok {
+		r.lock.Lock()
+		notifier.SetBufferedAmountLowThreshold(r.maxBufferedAmount / 2)
+		r.lock.Unlock()
+		notifier.OnBufferedAmountLow(r.handleBufferedAmountLow)
+	}
+	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+		r.handleDataMessage(msg.Data)
+	})
+	// The channel might have opened before it was set up
+	r.checkChannelsOpen()
+}
+
+// Register a handler for (decoded) messages received on the data channel
+func (r *RTC) OnData(handler func(b []byte)) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.onData = handler
+}
+
+// Encode an outgoing message with the enabled features
+func (r *RTC) encodeData(b []byte) []byte {
+	r.lock.Lock()
+	sequenced := r.reorder != nil || r.sequencing != nil
+	r.lock.Unlock()
+
+	if sequenced {
+		b = appendSequenceNumber(r.sendSequence.Add(1)-1, b)
+	}
+	return b
+}
+
+// Decode an incoming message with the enabled features and deliver it
+func (r *RTC) handleDataMessage(b []byte) {
+	log := r.Log()
+
+	r.throughput.add(false, len(b))
+	r.recordActivity(DataChannelLabel, false)
+	r.recordTraffic(DataChannelLabel, false, b)
+	r.lock.Lock()
+	reorder := r.reorder
+	tracker := r.sequencing
+	r.lock.Unlock()
+
+	if reorder == nil && tracker == nil {
+		r.deliverData(b)
+		return
+	}
+
+	seq, payload, err := splitSequenceNumber(b)
+	if err != nil {
+		log.Debug().Err(err).Msg("Dropped data message")
+		return
+	}
+	if tracker != nil {
+		r.trackSequence(tracker, seq)
+	}
+	if reorder != nil {
+		reorder.push(seq, payload)
+		return
+	}
+	r.deliverData(payload)
+}
+
+// Pass a decoded message to the OnData handler, after splitting batches, reassembling chunks and dispatching streams if enabled
+func (r *RTC) deliverData(b []byte) {
+	r.lock.Lock()
+	batched := r.batcher != nil
+	r.lock.Unlock()
+
+	if batched {
+		r.deliverBatch(b)
+		return
+	}
+	r.deliverMessage(b)
+}
+
+// Pass a single (unbatched) message to the OnData handler, after decompressing it, reassembling chunks and dispatching streams if enabled
+func (r *RTC) deliverMessage(b []byte) {
+	b, err := r.decompress(b)
+	if err != nil {
+		log := r.Log()
+		log.Warn().Err(err).Msg("Dropped data message, cannot decompress it")
+		return
+	}
+
+	r.lock.Lock()
+	re := r.reassembler
+	streams := r.streamHandlers != nil
+	handler := r.onData
+	r.lock.Unlock()
+
+	if re != nil {
+		if b = r.reassemble(re, b); b == nil {
+			return
+		}
+	}
+	r.tap(DataChannelLabel, b)
+	if streams {
+		r.dispatchStream(b)
+		return
+	}
+
+	if handler == nil {
+		log := r.Log()
+		log.Debug().Int("length", len(b)).Msg("Dropped data message, no handler registered")
+		return
+	}
+	handler(b)
+}
@@ -0,0 +1,152 @@
+package rtc
+
+import (
+	"sync"
+	"time"
+)
+
+//
+// This file contains the event history of a connection: a bounded ring buffer of its lifecycle events (state changes, channels
+// that open and close, ICE candidates and failed sends), so that a dropped connection can be debugged after the fact without digging
+// through the interleaved logs of all connections
+//
+
+// The number of events kept per connection, if not configured otherwise
+const DefaultEventHistorySize = 64
+
+// The kind of a lifecycle event of a connection
+type ConnectionEventKind string
+
+const (
+	EventStateChange     ConnectionEventKind = "stateChange"     // the state of the peer connection changed
+	EventChannelOpen     ConnectionEventKind = "channelOpen"     // a data channel opened
+	EventChannelClose    ConnectionEventKind = "channelClose"    // a data channel closed
+	EventLocalCandidate  ConnectionEventKind = "localCandidate"  // a local ICE candidate was gathered
+	EventRemoteCandidate ConnectionEventKind = "remoteCandidate" // a remote ICE candidate was applied
+	EventSendFailed      ConnectionEventKind = "sendFailed"      // a message could not be sent
+)
+
+// A single lifecycle event of a connection
+type ConnectionEvent struct {
+	Time   time.Time           `json:"time"`
+	Kind   ConnectionEventKind `json:"kind"`
+	Detail string              `json:"detail,omitempty"` // e.g. the new state, the channel label or the send error
+}
+
+// A ring buffer of the most recent events
+type eventHistory struct {
+	lock   *sync.Mutex
+	events []ConnectionEvent
+	next   int  // the slot the next event is written to
+	full   bool // whether all slots hold an event
+}
+
+func newEventHistory(size int) *eventHistory {
+	var lock sync.Mutex
+	return &eventHistory{
+		lock:   &lock,
+		events: make([]ConnectionEvent, size),
+	}
+}
+
+// Keep the last size events of this connection (by default DefaultEventHistorySize). The events recorded so far are discarded
+func (r *RTC) SetEventHistorySize(size int) {
+	if size < 1 {
+		size = 1
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.events = newEventHistory(size)
+}
+
+// Returns the recorded events of this connection, oldest first
+func (r *RTC) Events() []ConnectionEvent {
+	r.lock.Lock()
+	history := r.events
+	r.lock.Unlock()
+
+	history.lock.Lock()
+	defer history.lock.Unlock()
+
+	if !history.full {
+		events := make([]ConnectionEvent, history.next)
+		copy(events, history.events[:history.next])
+		return events
+	}
+	events := make([]ConnectionEvent, 0, len(history.events))
+	events = append(events, history.events[history.next:]...)
+	return append(events, history.events[:history.next]...)
+}
+
+// Record an event, overwriting the oldest event if the history is full
+func (r *RTC) recordEvent(kind ConnectionEventKind, detail string) {
+	r.lock.Lock()
+	history := r.events
+	r.lock.Unlock()
+
+	history.lock.Lock()
+	defer history.lock.Unlock()
+
+	history.events[history.next] = ConnectionEvent{Time: time.Now(), Kind: kind, Detail: detail}
+	history.next++
+	if history.next == len(history.events) {
+		history.next = 0
+		history.full = true
+	}
+}
+
+// The state of a connection at a moment in time, for debugging (e.g. served as JSON by a debug endpoint)
+type ConnectionDump struct {
+	Id                 string            `json:"id"`
+	Role               string            `json:"role"`
+	ConnectionState    string            `json:"connectionState"`
+	ICEState           string            `json:"iceState"`
+	SignalingState     string            `json:"signalingState"`
+	LocalCandidates    int               `json:"localCandidates"`
+	RemoteCandidates   int               `json:"remoteCandidates"`   // the number of remote candidates applied
+	FilteredCandidates uint64            `json:"filteredCandidates"` // the number of local and remote candidates dropped by the candidate filter
+	Metadata           map[string]string `json:"metadata,omitempty"`
+	Setup              SetupTimings      `json:"setup"`
+	Stats              *Stats            `json:"stats,omitempty"` // nil if the connection is not set up
+	Events             []ConnectionEvent `json:"events"`
+}
+
+// Returns the state of the connection and its event history, which can be serialized to JSON
+func (r *RTC) DumpState() ConnectionDump {
+	dump := ConnectionDump{
+		Id:                 r.Id,
+		Role:               r.Role().String(),
+		ConnectionState:    r.ConnectionState().String(),
+		ICEState:           "unknown",
+		SignalingState:     "unknown",
+		LocalCandidates:    len(r.GetAllLocalCandidates()),
+		FilteredCandidates: r.FilteredCandidates(),
+		Metadata:           r.Metadata,
+		Setup:              r.SetupTimings(),
+		Events:             r.Events(),
+	}
+
+	r.lock.Lock()
+	dump.RemoteCandidates = len(r.appliedCandidates)
+	r.lock.Unlock()
+
+	if pc := r.peerConnection(); pc != nil {
+		dump.ICEState = pc.ICEConnectionState().String()
+		dump.SignalingState = pc.SignalingState().String()
+	}
+	if stats, err := r.Stats(); err == nil {
+		dump.Stats = &stats
+	}
+	return dump
+}
+
+// Returns the state of all connections in the map, by id (e.g. for a debug endpoint)
+func (m *RTCMap) DumpAll() map[string]ConnectionDump {
+	dumps := make(map[string]ConnectionDump)
+	m.ForEach(func(id string, rtc *RTC) {
+		dumps[id] = rtc.DumpState()
+	})
+	return dumps
+}
@@ -0,0 +1,88 @@
+package rtc_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/VU-ASE/roverrtc/src/rtctest"
+)
+
+func TestEventHistory(t *testing.T) {
+	_, server := rtctest.NewConnectedPair(t)
+
+	events := server.Events()
+	for _, kind := range []rtc.ConnectionEventKind{rtc.EventStateChange, rtc.EventChannelOpen, rtc.EventLocalCandidate} {
+		if countEvents(server, kind) == 0 {
+			t.Errorf("Expected a %s event, got %v", kind, events)
+		}
+	}
+	for i := 1; i < len(events); i++ {
+		if events[i].Time.Before(events[i-1].Time) {
+			t.Errorf("Expected the events oldest first, got %v before %v", events[i-1], events[i])
+		}
+	}
+}
+
+func TestEventHistoryIsBounded(t *testing.T) {
+	r, err := rtc.NewRTCWithOptions("rover", rtc.WithEventHistorySize(3))
+	if err != nil {
+		t.Fatalf("Cannot create connection: %v", err)
+	}
+	t.Cleanup(func() { r.Destroy() })
+	// Start from an empty history, the options only set its size
+	r.SetEventHistorySize(3)
+	if events := r.Events(); len(events) != 0 {
+		t.Fatalf("Expected no events, got %v", events)
+	}
+
+	for port := 50001; port <= 50005; port++ {
+		r.AddLocalCandidate(candidateOfType("host", port))
+	}
+	events := r.Events()
+	if len(events) != 3 {
+		t.Fatalf("Expected the last 3 events, got %d", len(events))
+	}
+	for i, port := range []int{50003, 50004, 50005} {
+		if want := candidateOfType("host", port).Candidate; events[i].Kind != rtc.EventLocalCandidate || events[i].Detail != want {
+			t.Errorf("Expected event %d to be candidate %q, got %v", i, want, events[i])
+		}
+	}
+}
+
+func TestDumpState(t *testing.T) {
+	plain := rtc.NewRTC("client").DumpState()
+	if plain.Id != "client" || plain.ICEState != "unknown" || plain.Stats != nil {
+		t.Errorf("Expected a dump without peer connection state, got %+v", plain)
+	}
+
+	m := rtc.NewRTCMap()
+	t.Cleanup(func() { m.DestroyAll() })
+	connectToMap(t, m, "rover", "viewer")
+	m.Get("rover").Metadata["version"] = "1.2.0"
+
+	dumps := m.DumpAll()
+	if len(dumps) != 2 {
+		t.Fatalf("Expected 2 dumps, got %d", len(dumps))
+	}
+	dump := dumps["rover"]
+	if dump.Id != m.Get("rover").Id || dump.ConnectionState != "connected" || dump.Metadata["version"] != "1.2.0" {
+		t.Errorf("Expected the dump of the connected rover, got %+v", dump)
+	}
+	if dump.Stats == nil || dump.LocalCandidates == 0 || len(dump.Events) == 0 {
+		t.Errorf("Expected stats, candidates and events in the dump, got %+v", dump)
+	}
+
+	// The dumps are served as JSON
+	b, err := json.Marshal(dumps)
+	if err != nil {
+		t.Fatalf("Cannot marshal dumps: %v", err)
+	}
+	var decoded map[string]rtc.ConnectionDump
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatalf("Cannot unmarshal dumps: %v", err)
+	}
+	if got := decoded["viewer"]; got.Id != dumps["viewer"].Id || len(got.Events) != len(dumps["viewer"].Events) {
+		t.Errorf("Expected the dump to survive a JSON round trip, got %+v", got)
+	}
+}
@@ -0,0 +1,60 @@
+package rtc
+
+import (
+	"fmt"
+	"time"
+)
+
+//
+// This file contains the lifetime-limited sends, for messages that are only useful if they arrive quickly (e.g. joystick input), without
+// making the whole data channel unreliable. SCTP limits the lifetime of messages per channel, not per message, so every combination of
+// a name and a lifetime gets its own (unordered) channel, which is created lazily on the first send. The peer picks it up like any other
+// channel (see OnNewChannel), under the label returned by ExpiringChannelLabel
+//
+
+// How often SendExpiring checks whether a channel it just created is open
+const expiringOpenPollInterval = 5 * time.Millisecond
+
+// Returns the label of the channel that SendExpiring uses for the given name and lifetime (e.g. "joystick@100ms")
+func ExpiringChannelLabel(name string, lifetime time.Duration) string {
+	return fmt.Sprintf("%s@%dms", name, lifetime.Milliseconds())
+}
+
+// Send bytes that are only retransmitted for the given lifetime (with millisecond precision), after which they are given up on.
+// The message is sent on the channel for this name and lifetime (see ExpiringChannelLabel), which is created if it does not exist yet.
+// A channel that was just created is waited for (up to the lifetime, as the message is useless after that), messages are delivered unordered
+func (r *RTC) SendExpiring(channelName string, b []byte, lifetime time.Duration) error {
+	if lifetime < time.Millisecond {
+		return fmt.Errorf("Cannot send on channel %s. Lifetime %s is shorter than a millisecond", channelName, lifetime)
+	}
+	deadline := time.Now().Add(lifetime)
+
+	ch, err := r.expiringChannel(channelName, lifetime)
+	if err != nil {
+		return err
+	}
+	for !ch.IsOpen() {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%w: channel %s did not open within the lifetime of the message", ErrChannelNotOpen, ch.Name)
+		}
+		select {
+		case <-time.After(expiringOpenPollInterval):
+		case <-r.closed:
+			return fmt.Errorf("Cannot send message. Connection is destroyed")
+		}
+	}
+	return ch.Send(b)
+}
+
+// Returns the channel for the given name and lifetime, and creates it if it does not exist yet
+func (r *RTC) expiringChannel(name string, lifetime time.Duration) (*Channel, error) {
+	r.expiringLock.Lock()
+	defer r.expiringLock.Unlock()
+
+	label := ExpiringChannelLabel(name, lifetime)
+	if ch := r.Channel(label); ch != nil {
+		return ch, nil
+	}
+	config := ChannelConfig{Ordered: false, MaxPacketLifeTime: lifetime.Truncate(time.Millisecond)}
+	return r.OpenChannel(label, config)
+}
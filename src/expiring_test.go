@@ -0,0 +1,53 @@
+package rtc_test
+
+import (
+	"testing"
+	"time"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/VU-ASE/roverrtc/src/rtctest"
+)
+
+func TestSendExpiring(t *testing.T) {
+	client, server := rtctest.NewConnectedPair(t)
+	announced := make(chan *rtc.Channel, 4)
+	received := make(chan []byte, 4)
+	server.OnNewChannel(func(ch *rtc.Channel) {
+		ch.OnMessage(func(b []byte) { received <- b })
+		announced <- ch
+	})
+
+	lifetime := 100 * time.Millisecond
+	for _, input := range []string{"left", "right"} {
+		if err := client.SendExpiring("joystick", []byte(input), lifetime); err != nil {
+			t.Fatalf("Cannot send expiring message: %v", err)
+		}
+		expectMessage(t, received, []byte(input))
+	}
+
+	want := rtc.ChannelConfig{Ordered: false, MaxPacketLifeTime: lifetime}
+	label := rtc.ExpiringChannelLabel("joystick", lifetime)
+	select {
+	case ch := <-announced:
+		if ch.Name != label || ch.Config() != want {
+			t.Errorf("Expected the server to negotiate channel %s as %s, got %s as %s", label, want, ch.Name, ch.Config())
+		}
+	case <-time.After(receiveTimeout):
+		t.Fatal("Expected the server to be announced the expiring channel")
+	}
+	if ch := client.Channel(label); ch == nil || ch.Config() != want {
+		t.Errorf("Expected the client to negotiate channel %s as %s", label, want)
+	}
+	select {
+	case ch := <-announced:
+		t.Errorf("Expected the channel to be reused for the same lifetime, got new channel %s", ch.Name)
+	default:
+	}
+}
+
+func TestSendExpiringRejectsShortLifetime(t *testing.T) {
+	r := rtc.NewRTC("rover")
+	if err := r.SendExpiring("joystick", []byte("left"), time.Microsecond); err == nil {
+		t.Error("Expected an error for a lifetime shorter than a millisecond")
+	}
+}
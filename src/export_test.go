@@ -0,0 +1,30 @@
+package rtc
+
+// Returns the number of calls that are waiting for a response
+func (r *RTC) PendingCalls() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return len(r.calls)
+}
+
+// Marks the map as closed without removing its connections, as happens when the context of the map is done while its connections are
+// still being destroyed
+func (m *RTCMap) MarkClosed() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.closed = true
+}
+
+// Returns the number of signaling requests in the replay cache of the map
+func (m *RTCMap) ReplayCacheSize() int {
+	return m.replay.len()
+}
+
+// Takes one of the gathering slots (see SetGatheringLimits), as a connection that is gathering does. Returns a function that frees it
+func OccupyGatheringSlot() func() {
+	slots, _ := getGatheringLimits()
+	slots <- struct{}{}
+	return func() { <-slots }
+}
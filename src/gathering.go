@@ -0,0 +1,118 @@
+package rtc
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+//
+// This file contains the package-wide limits on ICE candidate gathering. On a server that creates many connections at once
+// (e.g. when all rovers reconnect after a network blip), unbounded gathering can saturate the network and CPU, so at most
+// a configured number of connections gather at the same time, and each of them gives up after a timeout
+//
+
+var gatheringLock sync.RWMutex
+var gatheringSlots chan struct{} // one entry per connection that is gathering, nil means unlimited
+var gatheringTimeout time.Duration
+
+// Limit the number of connections that gather ICE candidates at the same time (0 means unlimited), and the time after which
+// a connection stops waiting for gathering to complete and continues with the candidates it has (0 means no timeout).
+// Applies to gathering started by SetLocalDescription after this call
+func SetGatheringLimits(maxConcurrent int, timeout time.Duration) {
+	gatheringLock.Lock()
+	defer gatheringLock.Unlock()
+
+	gatheringSlots = nil
+	if maxConcurrent > 0 {
+		gatheringSlots = make(chan struct{}, maxConcurrent)
+	}
+	gatheringTimeout = timeout
+}
+
+// Returns the current gathering limits
+func getGatheringLimits() (chan struct{}, time.Duration) {
+	gatheringLock.RLock()
+	defer gatheringLock.RUnlock()
+
+	return gatheringSlots, gatheringTimeout
+}
+
+// Wait until gathering completes, times out or the connection is destroyed, then free the gathering slot and mark gathering as done
+func (r *RTC) awaitGathering(gatherComplete <-chan struct{}, done chan struct{}, slots chan struct{}, timeout time.Duration) {
+	log := r.Log()
+
+	var timedOut <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timedOut = timer.C
+	}
+
+	select {
+	case <-gatherComplete:
+		log.Debug().Msg("ICE candidate gathering complete")
+	case <-timedOut:
+		log.Warn().Dur("timeout", timeout).Msg("ICE candidate gathering timed out, continuing with the candidates gathered so far")
+	case <-r.closed:
+	}
+
+	if slots != nil {
+		<-slots
+	}
+	close(done)
+
+	r.lock.Lock()
+	handler := r.onGatheringComplete
+	r.lock.Unlock()
+	if handler != nil {
+		handler(r.GetAllLocalCandidates())
+	}
+}
+
+// Blocks until ICE candidate gathering completed (or timed out, see SetGatheringLimits), so that GetAllLocalCandidates returns
+// all candidates, or returns the context error when ctx is done
+func (r *RTC) WaitForICEGathering(ctx context.Context) error {
+	r.lock.Lock()
+	var done <-chan struct{} = r.gatheringDone
+	r.lock.Unlock()
+
+	// The local description was not set through SetLocalDescription, so rely on pion directly
+	if done == nil {
+		pc := r.peerConnection()
+		if pc == nil {
+			return fmt.Errorf("Cannot wait for ICE gathering. Connection is nil")
+		}
+		done = webrtc.GatheringCompletePromise(pc)
+	}
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-r.closed:
+		return fmt.Errorf("Cannot wait for ICE gathering. Connection is destroyed")
+	}
+}
+
+// Register a handler that is called with all local candidates when ICE candidate gathering started by SetLocalDescription completed
+// (or timed out). If gathering already completed, the handler is called right away
+func (r *RTC) OnGatheringComplete(handler func(candidates []webrtc.ICECandidateInit)) {
+	r.lock.Lock()
+	r.onGatheringComplete = handler
+	done := r.gatheringDone
+	r.lock.Unlock()
+
+	if done == nil {
+		return
+	}
+	select {
+	case <-done:
+		handler(r.GetAllLocalCandidates())
+	default:
+	}
+}
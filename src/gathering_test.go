@@ -0,0 +1,222 @@
+package rtc_test
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/pion/webrtc/v4"
+)
+
+func TestAddLocalCandidateIgnoresDuplicates(t *testing.T) {
+	r := rtc.NewRTC("client")
+	host := webrtc.ICECandidateInit{Candidate: "candidate:1 1 udp 2130706431 192.168.1.10 50000 typ host"}
+	srflx := webrtc.ICECandidateInit{Candidate: "candidate:2 1 udp 1694498815 145.108.1.10 50000 typ srflx raddr 192.168.1.10 rport 50000"}
+
+	r.AddLocalCandidate(host)
+	r.AddLocalCandidate(srflx)
+	r.AddLocalCandidate(host)
+	if candidates := r.GetAllLocalCandidates(); len(candidates) != 2 {
+		t.Errorf("Expected 2 unique candidates, got %d: %v", len(candidates), candidates)
+	}
+}
+
+func TestWaitForICEGathering(t *testing.T) {
+	r, err := rtc.NewRTCWithOptions("client")
+	if err != nil {
+		t.Fatalf("Cannot create connection: %v", err)
+	}
+	t.Cleanup(func() { r.Destroy() })
+	completed := make(chan []webrtc.ICECandidateInit, 1)
+	r.OnGatheringComplete(func(candidates []webrtc.ICECandidateInit) { completed <- candidates })
+
+	offer, err := r.Pc.CreateOffer(nil)
+	if err != nil {
+		t.Fatalf("Cannot create offer: %v", err)
+	}
+	if err := r.SetLocalDescription(offer); err != nil {
+		t.Fatalf("Cannot set local description: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), receiveTimeout)
+	defer cancel()
+	if err := r.WaitForICEGathering(ctx); err != nil {
+		t.Fatalf("Cannot wait for ICE gathering: %v", err)
+	}
+	if state := r.Pc.ICEGatheringState(); state != webrtc.ICEGatheringStateComplete {
+		t.Errorf("Expected gathering to be complete, got %s", state)
+	}
+
+	candidates := r.GetAllLocalCandidates()
+	if len(candidates) == 0 {
+		t.Fatal("Expected local candidates after gathering completed")
+	}
+	if again := r.GetAllLocalCandidates(); !reflect.DeepEqual(candidates, again) {
+		t.Errorf("Expected the same candidates after gathering completed, got %v and %v", candidates, again)
+	}
+	select {
+	case reported := <-completed:
+		if !reflect.DeepEqual(reported, candidates) {
+			t.Errorf("Expected OnGatheringComplete to receive all candidates %v, got %v", candidates, reported)
+		}
+	case <-time.After(receiveTimeout):
+		t.Fatal("OnGatheringComplete was not called")
+	}
+
+	// A handler registered after gathering completed is called right away
+	late := make(chan []webrtc.ICECandidateInit, 1)
+	r.OnGatheringComplete(func(candidates []webrtc.ICECandidateInit) { late <- candidates })
+	select {
+	case <-late:
+	default:
+		t.Error("Expected a handler registered after gathering completed to be called right away")
+	}
+}
+
+func TestWaitForICEGatheringGivesUpWithContext(t *testing.T) {
+	r, err := rtc.NewRTCWithOptions("client")
+	if err != nil {
+		t.Fatalf("Cannot create connection: %v", err)
+	}
+	t.Cleanup(func() { r.Destroy() })
+
+	// Gathering never starts without a local description
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := r.WaitForICEGathering(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected the wait to give up with the context, got %v", err)
+	}
+}
+
+// Reset the package-wide gathering limits when the test is done
+func setGatheringLimits(t *testing.T, maxConcurrent int, timeout time.Duration) {
+	rtc.SetGatheringLimits(maxConcurrent, timeout)
+	t.Cleanup(func() { rtc.SetGatheringLimits(0, 0) })
+}
+
+// Set an offer as the local description in the background, returns the result
+func setLocalOffer(t *testing.T, r *rtc.RTC) <-chan error {
+	offer, err := r.Pc.CreateOffer(nil)
+	if err != nil {
+		t.Fatalf("Cannot create offer: %v", err)
+	}
+	result := make(chan error, 1)
+	go func() { result <- r.SetLocalDescription(offer) }()
+	return result
+}
+
+func TestGatheringLimitBlocks(t *testing.T) {
+	setGatheringLimits(t, 1, 0)
+	release := rtc.OccupyGatheringSlot()
+
+	first, err := rtc.NewRTCWithOptions("first")
+	if err != nil {
+		t.Fatalf("Cannot create connection: %v", err)
+	}
+	t.Cleanup(func() { first.Destroy() })
+	result := setLocalOffer(t, first)
+	select {
+	case err := <-result:
+		t.Fatalf("Expected the local description to wait for a gathering slot, got %v", err)
+	case <-time.After(silenceTimeout):
+	}
+
+	// Once the slot is free, gathering starts
+	release()
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Fatalf("Cannot set local description: %v", err)
+		}
+	case <-time.After(receiveTimeout):
+		t.Fatal("Expected the local description to be set once a gathering slot was free")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), receiveTimeout)
+	defer cancel()
+	if err := first.WaitForICEGathering(ctx); err != nil {
+		t.Fatalf("Cannot wait for ICE gathering: %v", err)
+	}
+
+	// The slot is freed when gathering completes
+	second, err := rtc.NewRTCWithOptions("second")
+	if err != nil {
+		t.Fatalf("Cannot create connection: %v", err)
+	}
+	t.Cleanup(func() { second.Destroy() })
+	select {
+	case err := <-setLocalOffer(t, second):
+		if err != nil {
+			t.Fatalf("Cannot set local description: %v", err)
+		}
+	case <-time.After(receiveTimeout):
+		t.Fatal("Expected the gathering slot to be freed after gathering completed")
+	}
+}
+
+func TestGatheringLimitGivesUpWhenDestroyed(t *testing.T) {
+	setGatheringLimits(t, 1, 0)
+	release := rtc.OccupyGatheringSlot()
+	defer release()
+
+	r, err := rtc.NewRTCWithOptions("client")
+	if err != nil {
+		t.Fatalf("Cannot create connection: %v", err)
+	}
+	result := setLocalOffer(t, r)
+	if err := r.Destroy(); err != nil {
+		t.Fatalf("Cannot destroy connection: %v", err)
+	}
+	select {
+	case err := <-result:
+		if err == nil {
+			t.Error("Expected an error when the connection is destroyed while waiting for a gathering slot")
+		}
+	case <-time.After(receiveTimeout):
+		t.Fatal("Expected the local description to give up when the connection is destroyed")
+	}
+}
+
+func TestGatheringTimeout(t *testing.T) {
+	// A STUN server that never answers keeps gathering busy
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Cannot listen: %v", err)
+	}
+	defer conn.Close()
+	timeout := 100 * time.Millisecond
+	setGatheringLimits(t, 1, timeout)
+
+	r, err := rtc.NewRTCWithOptions("client", rtc.WithICEServers([]webrtc.ICEServer{{URLs: []string{"stun:" + conn.LocalAddr().String()}}}))
+	if err != nil {
+		t.Fatalf("Cannot create connection: %v", err)
+	}
+	t.Cleanup(func() { r.Destroy() })
+	if err := <-setLocalOffer(t, r); err != nil {
+		t.Fatalf("Cannot set local description: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), receiveTimeout)
+	defer cancel()
+	start := time.Now()
+	if err := r.WaitForICEGathering(ctx); err != nil {
+		t.Fatalf("Cannot wait for ICE gathering: %v", err)
+	}
+	if waited := time.Since(start); waited > timeout+silenceTimeout {
+		t.Errorf("Expected the wait to give up after %v, got %v", timeout, waited)
+	}
+	if state := r.Pc.ICEGatheringState(); state != webrtc.ICEGatheringStateGathering {
+		t.Errorf("Expected gathering to still be in progress, got %s", state)
+	}
+
+	// The slot of the connection is freed after the timeout, even though gathering did not complete
+	occupied := make(chan func(), 1)
+	go func() { occupied <- rtc.OccupyGatheringSlot() }()
+	select {
+	case release := <-occupied:
+		release()
+	case <-time.After(receiveTimeout):
+		t.Fatal("Expected the gathering slot to be freed after the timeout")
+	}
+}
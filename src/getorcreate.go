@@ -0,0 +1,78 @@
+package rtc
+
+import (
+	"errors"
+)
+
+//
+// This file contains the race-free setup of a connection with a given id. Two concurrent offers with the same id would otherwise race between
+// Get and Add, creating two peer connections of which one is leaked. Creating a connection is slow (e.g. gathering ICE candidates), so the
+// factory is not called while holding the map lock. Instead, the first caller for an id registers a pending creation under the lock and calls
+// the factory after releasing it, while concurrent callers for the same id wait for that creation and share its result
+//
+
+// id -> creation of the connection with that id that is in progress
+type creations map[string]*pendingCreate
+
+// A creation of a connection that is in progress
+type pendingCreate struct {
+	done chan struct{} // closed when the creation finished
+	rtc  *RTC
+	err  error
+}
+
+// Returns the connection with the given id, or creates it with factory and adds it to the map if there is none (or the existing one is
+// dead, see Add). Returns whether the connection was created by this call. The factory is called outside of the map lock, at most once
+// at a time per id: concurrent calls for the same id wait for it and return its connection (or error)
+func (m *RTCMap) GetOrCreate(id string, factory func() (*RTC, error)) (*RTC, bool, error) {
+	m.lock.Lock()
+	if m.closed {
+		m.lock.Unlock()
+		return nil, false, ErrMapClosed
+	}
+	if existing := m.rtcMap[id]; existing != nil && isActive(existing) {
+		m.lock.Unlock()
+		return existing, false, nil
+	}
+	if pending := m.creating[id]; pending != nil {
+		m.lock.Unlock()
+		<-pending.done
+		return pending.rtc, false, pending.err
+	}
+	pending := &pendingCreate{done: make(chan struct{})}
+	m.creating[id] = pending
+	m.lock.Unlock()
+
+	rtc, created, err := m.create(id, factory)
+
+	m.lock.Lock()
+	delete(m.creating, id)
+	m.lock.Unlock()
+	pending.rtc, pending.err = rtc, err
+	close(pending.done)
+	return rtc, created, err
+}
+
+// Create a connection with factory and add it to the map. If another connection with this id was added in the meantime (e.g. with Add),
+// the created connection is destroyed and the existing one is returned
+func (m *RTCMap) create(id string, factory func() (*RTC, error)) (*RTC, bool, error) {
+	rtc, err := factory()
+	if err != nil {
+		return nil, false, err
+	}
+
+	m.lock.Lock()
+	err = m.add(id, rtc)
+	existing := m.rtcMap[id]
+	m.lock.Unlock()
+	m.notify()
+
+	if errors.Is(err, ErrConnectionExists) {
+		rtc.Destroy()
+		return existing, false, nil
+	} else if err != nil {
+		rtc.Destroy()
+		return nil, false, err
+	}
+	return rtc, true, nil
+}
@@ -0,0 +1,107 @@
+package rtc_test
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/pion/webrtc/v4"
+)
+
+// Returns a factory that creates a connection with a peer connection (slowly, like an answer that waits for gathering), and counts its calls
+func slowFactory(t *testing.T, id string, calls *atomic.Int32) func() (*rtc.RTC, error) {
+	return func() (*rtc.RTC, error) {
+		calls.Add(1)
+		r := rtc.NewRTC(id)
+		if err := r.CreatePeerConnection(webrtc.Configuration{}); err != nil {
+			return nil, err
+		}
+		time.Sleep(20 * time.Millisecond)
+		return r, nil
+	}
+}
+
+func TestGetOrCreateConcurrently(t *testing.T) {
+	m := rtc.NewRTCMap()
+	t.Cleanup(func() { m.DestroyAll() })
+
+	var calls, created atomic.Int32
+	results := make([]*rtc.RTC, 20)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r, isNew, err := m.GetOrCreate("rover", slowFactory(t, "rover", &calls))
+			if err != nil {
+				t.Errorf("Cannot get or create connection: %v", err)
+			}
+			if isNew {
+				created.Add(1)
+			}
+			results[i] = r
+		}()
+	}
+	wg.Wait()
+
+	if calls.Load() != 1 || created.Load() != 1 {
+		t.Errorf("Expected the factory to be called and create a connection once, got %d calls and %d created", calls.Load(), created.Load())
+	}
+	live := m.Get("rover")
+	if count := m.Count(); count != 1 || live == nil || live.Pc == nil {
+		t.Fatalf("Expected exactly one live connection, got %d", count)
+	}
+	for i, r := range results {
+		if r != live {
+			t.Errorf("Expected call %d to return the live connection", i)
+		}
+	}
+}
+
+func TestGetOrCreateReplacesDeadConnection(t *testing.T) {
+	m := rtc.NewRTCMap()
+	t.Cleanup(func() { m.DestroyAll() })
+	if err := m.AddConnection("rover", rtc.NewRTC("rover")); err != nil {
+		t.Fatalf("Cannot add connection: %v", err)
+	}
+
+	var calls atomic.Int32
+	r, isNew, err := m.GetOrCreate("rover", slowFactory(t, "rover", &calls))
+	if err != nil || !isNew || m.Get("rover") != r {
+		t.Fatalf("Expected the connection without peer connection to be replaced, got %v", err)
+	}
+	if again, isNew, err := m.GetOrCreate("rover", slowFactory(t, "rover", &calls)); err != nil || isNew || again != r {
+		t.Errorf("Expected the live connection to be returned, got %v", err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("Expected the factory to be called once, got %d calls", calls.Load())
+	}
+}
+
+func TestGetOrCreateFactoryError(t *testing.T) {
+	m := rtc.NewRTCMap()
+	errFactory := errors.New("Cannot gather candidates")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, err := m.GetOrCreate("rover", func() (*rtc.RTC, error) {
+				time.Sleep(20 * time.Millisecond)
+				return nil, errFactory
+			})
+			if !errors.Is(err, errFactory) {
+				t.Errorf("Expected the error of the factory, got %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if count := m.Count(); count != 0 {
+		t.Errorf("Expected no connections after a failed creation, got %d", count)
+	}
+}
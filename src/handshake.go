@@ -0,0 +1,191 @@
+package rtc
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+//
+// This file contains the complete signaling flows, so that the server and the client do not have to wire up the peer connection,
+// the channels and the gathering themselves
+//
+
+// How long AcceptOffer and CreateOffer wait for ICE gathering if no timeout is configured
+const DefaultGatheringTimeout = 10 * time.Second
+
+// Accept an offer from a client: create the connection with the given options, set the offer as the remote description, and create the answer.
+// The answer is returned once ICE gathering completed (or timed out, see WithGatheringTimeout), so it contains all local candidates. The control
+// and data channels announced by the client are set up as ControlChannel and DataChannel once they arrive. The returned connection can be added
+// to an RTCMap. The delivery semantics of the channels are chosen by the client, so the channel options have no effect here
+func AcceptOffer(req RequestSDP, opts ...Option) (*RTC, webrtc.SessionDescription, error) {
+	return acceptOffer(req, applyOptions(opts), defaultReplayCache, nil)
+}
+
+// Accept an offer (see AcceptOffer), rejecting it if it is in the replay cache. If set, precheck is called once the request is authenticated and valid, before the connection is
+// created, so that a request that cannot be served is rejected without setting up a peer connection
+func acceptOffer(req RequestSDP, o options, replay *replayCache, precheck func() error) (*RTC, webrtc.SessionDescription, error) {
+	// Authenticate first, so that unauthenticated requests cannot use up the rate limit of a client
+	if err := o.authenticate(req.Id, req.Token); err != nil {
+		return nil, webrtc.SessionDescription{}, err
+	}
+	if err := o.signalingLimiter.allowOffer(req.Id); err != nil {
+		return nil, webrtc.SessionDescription{}, err
+	}
+	if err := checkOffer(req, replay); err != nil {
+		return nil, webrtc.SessionDescription{}, err
+	}
+	if precheck != nil {
+		if err := precheck(); err != nil {
+			return nil, webrtc.SessionDescription{}, err
+		}
+	}
+
+	r, err := newPeer(req.Id, o)
+	if err != nil {
+		return nil, webrtc.SessionDescription{}, err
+	}
+	r.markSetup(setupOfferReceived)
+	r.token = req.Token
+	r.SetPolite(true)
+
+	answer, err := r.answer(req.Offer, o.gatheringTimeout)
+	if err != nil {
+		r.Destroy()
+		return nil, webrtc.SessionDescription{}, err
+	}
+	return r, answer, nil
+}
+
+// Create a connection to the server with the given options (including the control and data channel) and its offer. The offer is returned
+// once ICE gathering completed (or timed out, see WithGatheringTimeout), so it contains all local candidates. Send the offer to the server
+// and pass its answer to ApplyAnswer
+func CreateOffer(id string, opts ...Option) (*RTC, RequestSDP, error) {
+	o := applyOptions(opts)
+	r, err := NewRTCWithOptions(id, opts...)
+	if err != nil {
+		return nil, RequestSDP{}, err
+	}
+
+	offer, err := r.peerConnection().CreateOffer(nil)
+	if err != nil {
+		r.Destroy()
+		return nil, RequestSDP{}, err
+	}
+	if err := r.SetLocalDescription(offer); err != nil {
+		r.Destroy()
+		return nil, RequestSDP{}, err
+	}
+	offer, err = r.gatheredDescription(offer, o.gatheringTimeout)
+	if err != nil {
+		r.Destroy()
+		return nil, RequestSDP{}, err
+	}
+
+	req := RequestSDP{
+		Offer:     offer,
+		Id:        id,
+		Timestamp: time.Now().UnixMilli(),
+		Token:     o.token,
+	}
+	return r, req, nil
+}
+
+// Apply the answer of the server to a connection created with CreateOffer
+func (r *RTC) ApplyAnswer(answer webrtc.SessionDescription) error {
+	if answer.Type != webrtc.SDPTypeAnswer {
+		return fmt.Errorf("%w: expected an answer, got %s", ErrInvalidSDPType, answer.Type)
+	}
+	return r.SetRemoteDescription(answer)
+}
+
+// Accept the channels of the peer, and answer its offer once gathering completed or timed out
+func (r *RTC) answer(offer webrtc.SessionDescription, gatheringTimeout time.Duration) (webrtc.SessionDescription, error) {
+	answer, err := r.createAnswer(offer)
+	if err != nil {
+		return webrtc.SessionDescription{}, err
+	}
+	return r.gatheredDescription(answer, gatheringTimeout)
+}
+
+// Accept the channels of the peer, and answer its offer right away (the local candidates are trickled)
+func (r *RTC) createAnswer(offer webrtc.SessionDescription) (webrtc.SessionDescription, error) {
+	if err := r.AcceptDataChannels(); err != nil {
+		return webrtc.SessionDescription{}, err
+	}
+	// The offer parsed, but pion rejects it (e.g. it lacks a fingerprint), so it is invalid
+	if err := r.SetRemoteDescription(offer); err != nil {
+		return webrtc.SessionDescription{}, fmt.Errorf("%w: %w", ErrInvalidSDP, err)
+	}
+	pc := r.peerConnection()
+	if pc == nil {
+		return webrtc.SessionDescription{}, fmt.Errorf("Cannot create answer. Connection is nil")
+	}
+	answer, err := pc.CreateAnswer(nil)
+	if err != nil {
+		return webrtc.SessionDescription{}, err
+	}
+	if err := r.SetLocalDescription(answer); err != nil {
+		return webrtc.SessionDescription{}, err
+	}
+	return answer, nil
+}
+
+// The signaling request could not be authenticated
+var ErrUnauthorized = errors.New("Request is not authorized")
+
+// Verify the token of a signaling request, if authentication is configured
+func (o options) authenticate(id, token string) error {
+	if o.auth == nil {
+		return nil
+	}
+	if err := o.auth(id, token); err != nil {
+		return fmt.Errorf("%w: %w", ErrUnauthorized, err)
+	}
+	return nil
+}
+
+// Returns whether a token matches the token the connection was accepted with
+func (r *RTC) verifyToken(token string) bool {
+	return subtle.ConstantTimeCompare([]byte(r.token), []byte(token)) == 1
+}
+
+// Check that a request holds a valid offer that can be accepted, and that it is not in the replay cache
+func checkOffer(req RequestSDP, replay *replayCache) error {
+	if err := req.Validate(); err != nil {
+		return err
+	}
+	if req.Offer.Type != webrtc.SDPTypeOffer {
+		return fmt.Errorf("%w: expected an offer, got %s", ErrInvalidSDPType, req.Offer.Type)
+	}
+	return replay.check(req.Id, req.Timestamp, req.Offer.SDP)
+}
+
+// Wait for ICE gathering to complete or time out, and return the local description with the candidates gathered so far
+func (r *RTC) gatheredDescription(desc webrtc.SessionDescription, gatheringTimeout time.Duration) (webrtc.SessionDescription, error) {
+	log := r.Log()
+
+	ctx, cancel := context.WithTimeout(context.Background(), gatheringTimeout)
+	defer cancel()
+	if err := r.WaitForICEGathering(ctx); err != nil {
+		if !errors.Is(err, context.DeadlineExceeded) {
+			return webrtc.SessionDescription{}, err
+		}
+		log.Warn().Dur("timeout", gatheringTimeout).Msg("ICE candidate gathering timed out, continuing with the candidates gathered so far")
+	}
+
+	// The local description contains the candidates gathered so far
+	pc := r.peerConnection()
+	if pc == nil {
+		return webrtc.SessionDescription{}, fmt.Errorf("Cannot get local description. Connection is nil")
+	}
+	local := pc.LocalDescription()
+	if local == nil {
+		return desc, nil
+	}
+	return *local, nil
+}
@@ -0,0 +1,193 @@
+package rtc_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/pion/webrtc/v4"
+)
+
+// Create an offer of a new client that is destroyed when the test finishes
+func newOffer(t *testing.T, id string, opts ...rtc.Option) (*rtc.RTC, rtc.RequestSDP) {
+	t.Helper()
+
+	client, offer, err := rtc.CreateOffer(id, opts...)
+	if err != nil {
+		t.Fatalf("Cannot create offer: %v", err)
+	}
+	t.Cleanup(func() { client.Destroy() })
+	return client, offer
+}
+
+func TestAcceptOffer(t *testing.T) {
+	client, offer := newOffer(t, "client")
+
+	server, answer, err := rtc.AcceptOffer(offer)
+	if err != nil {
+		t.Fatalf("Cannot accept offer: %v", err)
+	}
+	t.Cleanup(func() { server.Destroy() })
+	if server.Id != "client" {
+		t.Errorf("Expected the connection to carry the id of the offer, got %s", server.Id)
+	}
+	if answer.Type != webrtc.SDPTypeAnswer {
+		t.Errorf("Expected an answer, got %s", answer.Type)
+	}
+	if err := client.ApplyAnswer(answer); err != nil {
+		t.Fatalf("Cannot apply answer: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), receiveTimeout)
+	defer cancel()
+	for _, peer := range []*rtc.RTC{client, server} {
+		if err := peer.WaitUntilConnected(ctx); err != nil {
+			t.Fatalf("Connection %s did not connect: %v", peer.Id, err)
+		}
+	}
+
+	// The channels of the client are set up on the server once they arrive
+	received := collectData(server)
+	for !client.IsDataChannelOpen() || !server.IsDataChannelOpen() {
+		select {
+		case <-ctx.Done():
+			t.Fatal("Data channels did not open")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if err := client.SendDataBytes([]byte("hello")); err != nil {
+		t.Fatalf("Cannot send data: %v", err)
+	}
+	expectMessage(t, received, []byte("hello"))
+
+	m := rtc.NewRTCMap()
+	if err := m.AddConnection(server.Id, server); err != nil {
+		t.Errorf("Cannot add accepted connection to a map: %v", err)
+	}
+}
+
+func TestAcceptOfferRejectsInvalidOffers(t *testing.T) {
+	_, offer := newOffer(t, "client")
+
+	emptySDP := offer
+	emptySDP.Offer.SDP = ""
+	if _, _, err := rtc.AcceptOffer(emptySDP); !errors.Is(err, rtc.ErrInvalidSDP) {
+		t.Errorf("Expected ErrInvalidSDP for an offer without SDP, got %v", err)
+	}
+
+	emptyId := offer
+	emptyId.Id = ""
+	if _, _, err := rtc.AcceptOffer(emptyId); !errors.Is(err, rtc.ErrEmptyID) {
+		t.Errorf("Expected ErrEmptyID for an offer without id, got %v", err)
+	}
+
+	answer := offer
+	answer.Offer.Type = webrtc.SDPTypeAnswer
+	if _, _, err := rtc.AcceptOffer(answer); !errors.Is(err, rtc.ErrInvalidSDPType) {
+		t.Errorf("Expected ErrInvalidSDPType for an answer, got %v", err)
+	}
+}
+
+func TestAcceptOfferGatheringTimeout(t *testing.T) {
+	_, offer := newOffer(t, "client")
+
+	start := time.Now()
+	server, answer, err := rtc.AcceptOffer(offer, rtc.WithGatheringTimeout(time.Nanosecond))
+	if err != nil {
+		t.Fatalf("Expected the answer to be returned when gathering times out, got %v", err)
+	}
+	t.Cleanup(func() { server.Destroy() })
+	if answer.Type != webrtc.SDPTypeAnswer {
+		t.Errorf("Expected an answer, got %s", answer.Type)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the gathering timeout to apply, accepting took %s", elapsed)
+	}
+}
+
+func TestCreateOfferAndApplyAnswer(t *testing.T) {
+	client, offer := newOffer(t, "client")
+	if offer.Id != "client" || offer.Offer.Type != webrtc.SDPTypeOffer {
+		t.Errorf("Expected an offer of client, got %s of %s", offer.Offer.Type, offer.Id)
+	}
+	if age := time.Since(time.UnixMilli(offer.Timestamp)); age < 0 || age > time.Minute {
+		t.Errorf("Expected the offer to carry the current time, it is %s old", age)
+	}
+
+	server, answer, err := rtc.AcceptOffer(offer)
+	if err != nil {
+		t.Fatalf("Cannot accept offer: %v", err)
+	}
+	t.Cleanup(func() { server.Destroy() })
+	if err := client.ApplyAnswer(offer.Offer); !errors.Is(err, rtc.ErrInvalidSDPType) {
+		t.Errorf("Expected ErrInvalidSDPType when applying an offer as answer, got %v", err)
+	}
+	if err := client.ApplyAnswer(answer); err != nil {
+		t.Fatalf("Cannot apply answer: %v", err)
+	}
+	// Exchange the candidates as they would be trickled, on top of the ones in the descriptions
+	if failed := client.AddRemoteCandidates(server.GetAllLocalCandidates()); len(failed) != 0 {
+		t.Fatalf("Cannot add candidates of the server: %v", failed)
+	}
+	if failed := server.AddRemoteCandidates(client.GetAllLocalCandidates()); len(failed) != 0 {
+		t.Fatalf("Cannot add candidates of the client: %v", failed)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), receiveTimeout)
+	defer cancel()
+	for _, peer := range []*rtc.RTC{client, server} {
+		if err := peer.WaitUntilConnected(ctx); err != nil {
+			t.Fatalf("Connection %s did not connect: %v", peer.Id, err)
+		}
+		if !peer.IsConnected() {
+			t.Errorf("Expected %s to be connected", peer.Id)
+		}
+	}
+	if client.ControlChannel() == nil || client.DataChannel() == nil {
+		t.Error("Expected the client to set up the control and data channel")
+	}
+}
+
+// Accepts the token "secret" only
+func checkSecret(id, token string) error {
+	if token != "secret" {
+		return fmt.Errorf("Token of %s is not valid", id)
+	}
+	return nil
+}
+
+func TestAcceptOfferAuthentication(t *testing.T) {
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"missing token", "", rtc.ErrUnauthorized},
+		{"wrong token", "guess", rtc.ErrUnauthorized},
+		{"valid token", "secret", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, offer := newOffer(t, "client", rtc.WithToken(test.token))
+			if offer.Token != test.token {
+				t.Fatalf("Expected the offer to carry token %q, got %q", test.token, offer.Token)
+			}
+
+			server, _, err := rtc.AcceptOffer(offer, rtc.WithAuthFunc(checkSecret))
+			if server != nil {
+				t.Cleanup(func() { server.Destroy() })
+			}
+			if test.want == nil && err != nil {
+				t.Errorf("Expected the offer to be accepted, got %v", err)
+			} else if !errors.Is(err, test.want) {
+				t.Errorf("Expected an error wrapping %v, got %v", test.want, err)
+			}
+			if test.want != nil && server != nil {
+				t.Error("Expected no connection to be created for an unauthorized offer")
+			}
+		})
+	}
+}
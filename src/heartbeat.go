@@ -0,0 +1,227 @@
+package rtc
+
+import (
+	"context"
+	"encoding/binary"
+	"slices"
+	"time"
+)
+
+//
+// This file contains the keep-alive heartbeat, which also keeps the clock synchronization (TimestampOffset) up to date.
+// A ping carries the sender's timestamp and the pong carries the original timestamp together with the responder's timestamp,
+// so that every round trip proves liveness and measures the RTT (NTP-style). All timestamps are in nanoseconds. Only the pongs
+// to the pings of the synced heartbeat refresh the offset, the pongs to keep-alive pings (see StartKeepalive) only measure the RTT.
+//
+
+// The number of consecutive intervals without a pong after which the peer is considered dead
+const heartbeatMaxMissed = 3
+
+// The number of round trip times kept for AverageRTT
+const rttHistorySize = 16
+
+// The number of recent heartbeat samples over which the median clock offset is taken, so that a single delayed pong does not skew it
+const heartbeatOffsetSamples = 5
+
+// The state of the synced heartbeat, guarded by the lock of the connection
+type syncedHeartbeat struct {
+	ping    int64   // the timestamp of the last ping, to recognize its pong
+	offsets []int64 // the recently measured clock offsets (in nanoseconds), oldest first
+}
+
+// Start sending keep-alive pings on the control channel every interval. Each pong refreshes TimestampOffset (the median over the
+// last few pongs) and MeasuredRTT.
+// If no pong was received for a few consecutive intervals, onDead is called (once) and the heartbeat stops.
+// The heartbeat also stops when the connection is destroyed. The peer needs to use SetControlChannel to answer pings.
+func (r *RTC) StartSyncedHeartbeat(interval time.Duration, onDead func()) {
+	r.lock.Lock()
+	r.lastPong = time.Now()
+	r.lock.Unlock()
+
+	go func() {
+		log := r.Log()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-r.closed:
+				return
+			case <-ticker.C:
+			}
+
+			r.lock.Lock()
+			sinceLastPong := time.Since(r.lastPong)
+			r.lock.Unlock()
+
+			if sinceLastPong > heartbeatMaxMissed*interval {
+				log.Warn().Dur("sinceLastPong", sinceLastPong).Msg("Heartbeat timed out, peer is considered dead")
+				if onDead != nil {
+					onDead()
+				}
+				return
+			}
+
+			r.updateQuality()
+			sent := time.Now().UnixNano()
+			r.lock.Lock()
+			r.heartbeat.ping = sent
+			r.lock.Unlock()
+			payload := make([]byte, 8)
+			binary.BigEndian.PutUint64(payload, uint64(sent))
+			if err := r.SendControlFrame(controlTypePing, payload); err != nil {
+				log.Debug().Err(err).Msg("Could not send heartbeat ping")
+			}
+		}
+	}()
+}
+
+// Start sending keep-alive pings on the control channel every interval, to measure the round trip time (see LastRTT and AverageRTT).
+// If more consecutive pings than configured (see SetKeepaliveMaxMissed) are not answered, the OnKeepaliveTimeout handler is called (once)
+// and the keep-alive stops. The keep-alive also stops when ctx is done or the connection is destroyed. The peer needs to use SetControlChannel
+// to answer pings
+func (r *RTC) StartKeepalive(ctx context.Context, interval time.Duration) {
+	go func() {
+		log := r.Log()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		var lastPing time.Time
+		missed := 0
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-r.closed:
+				return
+			case <-ticker.C:
+			}
+
+			r.lock.Lock()
+			answered := !r.lastPong.Before(lastPing)
+			maxMissed := r.keepaliveMaxMissed
+			handler := r.onKeepaliveTimeout
+			r.lock.Unlock()
+
+			if answered {
+				missed = 0
+			} else {
+				missed++
+			}
+			if missed > maxMissed {
+				log.Warn().Int("missed", missed).Msg("Keep-alive timed out")
+				if handler != nil {
+					handler()
+				}
+				return
+			}
+
+			r.updateQuality()
+			lastPing = time.Now()
+			payload := make([]byte, 8)
+			binary.BigEndian.PutUint64(payload, uint64(lastPing.UnixNano()))
+			if err := r.SendControlFrame(controlTypePing, payload); err != nil {
+				log.Debug().Err(err).Msg("Could not send keep-alive ping")
+			}
+		}
+	}()
+}
+
+// Set the number of consecutive keep-alive pings that may go unanswered before the keep-alive times out
+func (r *RTC) SetKeepaliveMaxMissed(maxMissed int) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.keepaliveMaxMissed = maxMissed
+}
+
+// Register a handler that is called when the keep-alive times out (e.g. to destroy the connection)
+func (r *RTC) OnKeepaliveTimeout(handler func()) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.onKeepaliveTimeout = handler
+}
+
+// Returns the last measured round trip time, or 0 if none was measured yet
+func (r *RTC) LastRTT() time.Duration {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if len(r.rttHistory) == 0 {
+		return 0
+	}
+	return r.rttHistory[len(r.rttHistory)-1]
+}
+
+// Returns the average of the recently measured round trip times, or 0 if none were measured yet
+func (r *RTC) AverageRTT() time.Duration {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if len(r.rttHistory) == 0 {
+		return 0
+	}
+	var total time.Duration
+	for _, rtt := range r.rttHistory {
+		total += rtt
+	}
+	return total / time.Duration(len(r.rttHistory))
+}
+
+// Converts a timestamp (in milliseconds) from the clock of the peer to the local clock, using the last known TimestampOffset
+func (r *RTC) AdjustTimestamp(remoteTs int64) int64 {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return remoteTs - r.TimestampOffset
+}
+
+// Answer a ping with a pong that carries the original timestamp and our own
+func (r *RTC) handlePing(payload []byte) {
+	if len(payload) != 8 {
+		return
+	}
+
+	pong := make([]byte, 16)
+	copy(pong, payload)
+	binary.BigEndian.PutUint64(pong[8:], uint64(time.Now().UnixNano()))
+	if err := r.SendControlFrame(controlTypePong, pong); err != nil {
+		log := r.Log()
+		log.Debug().Err(err).Msg("Could not answer heartbeat ping")
+	}
+}
+
+// Use a pong to refresh the liveness and the round trip time. The timestamp offset is only refreshed by the pongs to the pings of
+// the synced heartbeat, and the pongs to the pings of SyncClock are passed to it
+func (r *RTC) handlePong(payload []byte) {
+	if len(payload) != 16 {
+		return
+	}
+
+	received := time.Now().UnixNano()
+	sent := int64(binary.BigEndian.Uint64(payload))
+	remote := int64(binary.BigEndian.Uint64(payload[8:]))
+
+	rtt := received - sent
+	offset := remote - (sent+received)/2
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.lastPong = time.Now()
+	r.rttHistory = append(r.rttHistory, time.Duration(rtt))
+	if len(r.rttHistory) > rttHistorySize {
+		r.rttHistory = r.rttHistory[1:]
+	}
+	if sent == r.heartbeat.ping {
+		r.heartbeat.offsets = append(r.heartbeat.offsets, offset)
+		if len(r.heartbeat.offsets) > heartbeatOffsetSamples {
+			r.heartbeat.offsets = r.heartbeat.offsets[1:]
+		}
+		r.TimestampOffset = median(slices.Clone(r.heartbeat.offsets)) / int64(time.Millisecond)
+		r.MeasuredRTT = time.Duration(rtt)
+	}
+	r.reportClockSample(sent, clockSample{offset: offset, rtt: rtt})
+	recordKeepaliveRTT(time.Duration(rtt))
+}
@@ -0,0 +1,149 @@
+package rtc
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// Wait until the offset of the connection is about want, returns whether it was within timeout
+func waitForOffset(r *RTC, want time.Duration, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		offset := time.Duration(r.AdjustTimestamp(0)) * -time.Millisecond
+		if (offset - want).Abs() <= 50*time.Millisecond {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSyncedHeartbeatRefreshesOffset(t *testing.T) {
+	skew := 2 * time.Second
+	r, _ := newSkewedConnection(skew)
+	t.Cleanup(func() { r.Destroy() })
+
+	r.StartSyncedHeartbeat(10*time.Millisecond, nil)
+	if !waitForOffset(r, skew, 5*time.Second) {
+		t.Fatalf("Expected an offset of about %s, got %dms", skew, -r.AdjustTimestamp(0))
+	}
+	r.lock.Lock()
+	rtt := r.MeasuredRTT
+	r.lock.Unlock()
+	if rtt <= 0 {
+		t.Errorf("Expected the round trip time to be measured, got %s", rtt)
+	}
+	remote := time.Now().Add(skew).UnixMilli()
+	if diff := time.Duration(r.AdjustTimestamp(remote)-time.Now().UnixMilli()) * time.Millisecond; diff.Abs() > 50*time.Millisecond {
+		t.Errorf("Expected a remote timestamp to be adjusted to about now, it is %s off", diff)
+	}
+}
+
+func TestSyncedHeartbeatDetectsDeadPeer(t *testing.T) {
+	r := NewRTC("silent")
+	t.Cleanup(func() { r.Destroy() })
+	r.SetControlChannel(NewMockChannel(ControlChannelLabel))
+
+	dead := make(chan struct{})
+	r.StartSyncedHeartbeat(10*time.Millisecond, func() { close(dead) })
+	select {
+	case <-dead:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the peer to be considered dead when it does not answer pings")
+	}
+}
+
+func TestKeepaliveDoesNotRefreshOffset(t *testing.T) {
+	r, _ := newSkewedConnection(time.Hour)
+	t.Cleanup(func() { r.Destroy() })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r.StartKeepalive(ctx, 10*time.Millisecond)
+	deadline := time.Now().Add(5 * time.Second)
+	for r.LastRTT() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the keep-alive to measure the round trip time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if offset := r.AdjustTimestamp(0); offset != 0 {
+		t.Errorf("Expected the keep-alive to leave the offset alone, got %dms", -offset)
+	}
+}
+
+func TestKeepaliveMeasuresRTT(t *testing.T) {
+	r, dc := newSkewedConnection(0)
+	t.Cleanup(func() { r.Destroy() })
+	if r.LastRTT() != 0 || r.AverageRTT() != 0 {
+		t.Errorf("Expected no round trip time before the keep-alive started, got %s and %s", r.LastRTT(), r.AverageRTT())
+	}
+
+	// The pongs are handled by the keep-alive, the other control messages still reach the handlers of the application
+	commands := make(chan string, 4)
+	if err := r.HandleControl(1, func(payload []byte) { commands <- string(payload) }); err != nil {
+		t.Fatalf("Cannot register handler: %v", err)
+	}
+	unhandled := make(chan uint16, 16)
+	r.OnUnhandledControl(func(typeID uint16, payload []byte) { unhandled <- typeID })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r.StartKeepalive(ctx, 10*time.Millisecond)
+	dc.Inject(controlFrame(1, []byte("stop")))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for r.AverageRTT() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the keep-alive to measure the round trip time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if r.LastRTT() <= 0 {
+		t.Errorf("Expected the last round trip time to be measured, got %s", r.LastRTT())
+	}
+	select {
+	case command := <-commands:
+		if command != "stop" {
+			t.Errorf("Expected command stop, got %s", command)
+		}
+	default:
+		t.Error("Expected the control message of the application to reach its handler")
+	}
+	select {
+	case typeID := <-unhandled:
+		t.Errorf("Expected the keep-alive messages to be handled, got unhandled type %d", typeID)
+	default:
+	}
+}
+
+func TestKeepaliveTimeout(t *testing.T) {
+	r := NewRTC("silent")
+	t.Cleanup(func() { r.Destroy() })
+	dc := NewMockChannel(ControlChannelLabel)
+	r.SetControlChannel(dc)
+	r.SetKeepaliveMaxMissed(2)
+
+	timeouts := make(chan struct{}, 4)
+	r.OnKeepaliveTimeout(func() { timeouts <- struct{}{} })
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r.StartKeepalive(ctx, 10*time.Millisecond)
+
+	select {
+	case <-timeouts:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the keep-alive to time out when the peer does not answer pings")
+	}
+	// The keep-alive stops after timing out, after the allowed number of missed pings and the one that was missed too many
+	time.Sleep(100 * time.Millisecond)
+	if len(timeouts) != 0 {
+		t.Errorf("Expected the timeout handler to be called once, got %d more calls", len(timeouts))
+	}
+	if pings := len(dc.Sent()); pings != 3 {
+		t.Errorf("Expected 3 pings before the timeout, got %d", pings)
+	}
+}
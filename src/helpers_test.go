@@ -0,0 +1,76 @@
+package rtc_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/VU-ASE/roverrtc/src/rtctest"
+)
+
+// How long a test waits for a message that should arrive, and for a message that should not
+const (
+	receiveTimeout = 5 * time.Second
+	silenceTimeout = 200 * time.Millisecond
+)
+
+// Connect a client for every id, and add the server side of each connection to the map under that id. Returns the clients by id
+func connectToMap(t testing.TB, m *rtc.RTCMap, ids ...string) map[string]*rtc.RTC {
+	t.Helper()
+
+	clients := make(map[string]*rtc.RTC, len(ids))
+	for _, id := range ids {
+		client, server := rtctest.NewConnectedPair(t)
+		if err := m.AddConnection(id, server); err != nil {
+			t.Fatalf("Cannot add connection %s: %v", id, err)
+		}
+		clients[id] = client
+	}
+	return clients
+}
+
+// Returns a channel that receives every message delivered to the OnData handler of the connection
+func collectData(r *rtc.RTC) <-chan []byte {
+	received := make(chan []byte, 256)
+	r.OnData(func(b []byte) {
+		msg := make([]byte, len(b))
+		copy(msg, b)
+		received <- msg
+	})
+	return received
+}
+
+// Returns a channel that receives the name of every channel the peer opens on the connection
+func collectChannels(r *rtc.RTC) <-chan string {
+	channels := make(chan string, 16)
+	r.OnNewChannel(func(ch *rtc.Channel) {
+		channels <- ch.Name
+	})
+	return channels
+}
+
+// Fail the test if the next message is not want
+func expectMessage(t *testing.T, received <-chan []byte, want []byte) {
+	t.Helper()
+
+	select {
+	case got := <-received:
+		if !bytes.Equal(got, want) {
+			t.Fatalf("Expected message %q, got %q", want, got)
+		}
+	case <-time.After(receiveTimeout):
+		t.Fatalf("Expected message %q, got nothing", want)
+	}
+}
+
+// Fail the test if a message arrives within silenceTimeout
+func expectNoMessage(t *testing.T, received <-chan []byte) {
+	t.Helper()
+
+	select {
+	case got := <-received:
+		t.Fatalf("Expected no message, got %q", got)
+	case <-time.After(silenceTimeout):
+	}
+}
@@ -1,10 +1,166 @@
 package rtc
 
-import "github.com/pion/webrtc/v4"
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pion/webrtc/v4"
+)
 
 // The data format used by connecting clients (and the car) to send ICE candidates to the server
 type RequestICE struct {
 	Candidate webrtc.ICECandidateInit `json:"candidate"`
-	Id        string                  `json:"id"`        // to distinguish between clients
-	Timestamp int64                   `json:"timestamp"` // timestamp of the sender
+	Id        string                  `json:"id"`              // to distinguish between clients
+	Timestamp int64                   `json:"timestamp"`       // timestamp of the sender
+	Token     string                  `json:"token,omitempty"` // to authenticate the client, if the server requires it
+}
+
+// The data format used to send several ICE candidates to the server at once (e.g. the burst of candidates a browser gathers first)
+type RequestICEBatch struct {
+	Candidates []webrtc.ICECandidateInit `json:"candidates"`
+	Id         string                    `json:"id"`              // to distinguish between clients
+	Timestamp  int64                     `json:"timestamp"`       // timestamp of the sender
+	Token      string                    `json:"token,omitempty"` // to authenticate the client, if the server requires it
+}
+
+// Returns a copy of the local ICE candidates that were added after the first index candidates, and the index to pass to the next call
+// (e.g. for a signaling endpoint that is polled for new candidates). If index is beyond the candidates (because the connection was destroyed
+// in the meantime), all candidates are returned
+func (r *RTC) GetLocalCandidatesSince(index int) ([]webrtc.ICECandidateInit, int) {
+	r.CandidatesLock.Lock()
+	defer r.CandidatesLock.Unlock()
+
+	if index < 0 || index > len(r.Candidates) {
+		index = 0
+	}
+	candidates := make([]webrtc.ICECandidateInit, len(r.Candidates)-index)
+	copy(candidates, r.Candidates[index:])
+
+	return candidates, len(r.Candidates)
+}
+
+// Returns a channel that receives all local ICE candidates, the ones added so far and the ones that are added later, for push-style
+// trickle ICE. The channel is closed when ctx is done or the connection is destroyed
+func (r *RTC) SubscribeLocalCandidates(ctx context.Context) <-chan webrtc.ICECandidateInit {
+	out := make(chan webrtc.ICECandidateInit)
+
+	go func() {
+		defer close(out)
+
+		index := 0
+		for {
+			r.CandidatesLock.Lock()
+			added := r.candidatesAdded
+			r.CandidatesLock.Unlock()
+
+			var candidates []webrtc.ICECandidateInit
+			candidates, index = r.GetLocalCandidatesSince(index)
+			for _, candidate := range candidates {
+				select {
+				case out <- candidate:
+				case <-ctx.Done():
+					return
+				case <-r.closed:
+					return
+				}
+			}
+
+			select {
+			case <-added:
+			case <-ctx.Done():
+				return
+			case <-r.closed:
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// Add an ICE candidate received from the peer to the connection. Candidates that were already applied (e.g. because they were both
+// embedded in the SDP and trickled) are skipped. Candidates that arrive before the remote description is set (with SetRemoteDescription)
+// are queued, and applied once it is set. The same goes for the candidates of an ICE restart that arrive before its answer is set
+func (r *RTC) AddRemoteCandidate(candidate webrtc.ICECandidateInit) error {
+	r.recordSignaling(signalingIn, nil, &candidate)
+	if !r.allowCandidate(candidate, "remote") {
+		return nil
+	}
+
+	r.lock.Lock()
+	pc := r.Pc
+	if !r.remoteDescriptionSet && (pc == nil || pc.RemoteDescription() == nil || pc.SignalingState() == webrtc.SignalingStateHaveLocalOffer) {
+		for _, pending := range r.pendingCandidates {
+			if pending.Candidate == candidate.Candidate {
+				r.lock.Unlock()
+				return nil
+			}
+		}
+		r.pendingCandidates = append(r.pendingCandidates, candidate)
+		r.lock.Unlock()
+
+		log := r.Log()
+		log.Debug().Str("candidate", candidate.Candidate).Msg("Queued remote ICE candidate until the remote description is set")
+		return nil
+	}
+	r.lock.Unlock()
+
+	return r.applyRemoteCandidate(candidate)
+}
+
+// Add several ICE candidates received from the peer to the connection, in order (see AddRemoteCandidate). A candidate that cannot be added
+// does not stop the rest, returns the errors of the candidates that could not be added (index -> error)
+func (r *RTC) AddRemoteCandidates(candidates []webrtc.ICECandidateInit) map[int]error {
+	failed := make(map[int]error)
+	for i, candidate := range candidates {
+		if err := r.AddRemoteCandidate(candidate); err != nil {
+			failed[i] = err
+		}
+	}
+	return failed
+}
+
+// Apply a remote ICE candidate to the connection, unless it was already applied
+func (r *RTC) applyRemoteCandidate(candidate webrtc.ICECandidateInit) error {
+	log := r.Log()
+
+	pc := r.peerConnection()
+	if pc == nil {
+		return fmt.Errorf("Cannot add remote ICE candidate. Connection is nil")
+	}
+
+	r.lock.Lock()
+	_, applied := r.appliedCandidates[candidate.Candidate]
+	r.lock.Unlock()
+	if applied {
+		log.Debug().Str("candidate", candidate.Candidate).Msg("Skipped remote ICE candidate, it was already applied")
+		return nil
+	}
+
+	if err := pc.AddICECandidate(candidate); err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	r.appliedCandidates[candidate.Candidate] = struct{}{}
+	r.lock.Unlock()
+	r.recordEvent(EventRemoteCandidate, candidate.Candidate)
+	return nil
+}
+
+// Returns the type (host, srflx, prflx or relay) of an ICE candidate, parsed from its candidate string
+func candidateType(candidate webrtc.ICECandidateInit) webrtc.ICECandidateType {
+	fields := strings.Fields(candidate.Candidate)
+	for i := 0; i < len(fields)-1; i++ {
+		if fields[i] != "typ" {
+			continue
+		}
+
+		candidateType, err := webrtc.NewICECandidateType(fields[i+1])
+		if err != nil {
+			return webrtc.ICECandidateTypeUnknown
+		}
+		return candidateType
+	}
+	return webrtc.ICECandidateTypeUnknown
 }
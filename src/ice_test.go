@@ -0,0 +1,260 @@
+package rtc_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/pion/webrtc/v4"
+)
+
+// Returns the number of events of the given kind that the connection recorded
+func countEvents(r *rtc.RTC, kind rtc.ConnectionEventKind) int {
+	count := 0
+	for _, event := range r.Events() {
+		if event.Kind == kind {
+			count++
+		}
+	}
+	return count
+}
+
+func TestDuplicateRemoteCandidateIsAppliedOnce(t *testing.T) {
+	client, offer, err := rtc.CreateOffer("client")
+	if err != nil {
+		t.Fatalf("Cannot create offer: %v", err)
+	}
+	t.Cleanup(func() { client.Destroy() })
+
+	server := newAnswerer(t, "server")
+	if err := server.SetRemoteDescription(offer.Offer); err != nil {
+		t.Fatalf("Cannot set remote description: %v", err)
+	}
+
+	mid := "0"
+	candidate := webrtc.ICECandidateInit{Candidate: "candidate:1 1 udp 2130706431 127.0.0.1 50000 typ host", SDPMid: &mid}
+	for i := 0; i < 2; i++ {
+		if err := server.AddRemoteCandidate(candidate); err != nil {
+			t.Fatalf("Cannot add remote candidate (attempt %d): %v", i+1, err)
+		}
+	}
+	if applied := countEvents(server, rtc.EventRemoteCandidate); applied != 1 {
+		t.Errorf("Expected the candidate to be applied once, got %d", applied)
+	}
+}
+
+func TestRemoteCandidatesBeforeAndAfterDescription(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), receiveTimeout)
+	defer cancel()
+
+	// Create an offer without candidates, they are trickled to the server instead
+	client, err := rtc.NewRTCWithOptions("client")
+	if err != nil {
+		t.Fatalf("Cannot create connection: %v", err)
+	}
+	t.Cleanup(func() { client.Destroy() })
+	offer, err := client.Pc.CreateOffer(nil)
+	if err != nil {
+		t.Fatalf("Cannot create offer: %v", err)
+	}
+	if err := client.SetLocalDescription(offer); err != nil {
+		t.Fatalf("Cannot set local description: %v", err)
+	}
+	if err := client.WaitForICEGathering(ctx); err != nil {
+		t.Fatalf("Cannot wait for ICE gathering: %v", err)
+	}
+	candidates := client.GetAllLocalCandidates()
+	if len(candidates) == 0 {
+		t.Fatal("Expected the client to gather candidates")
+	}
+
+	server := newAnswerer(t, "server")
+	// Deliver the first candidate (twice) before the remote description, and the rest after it
+	for i := 0; i < 2; i++ {
+		if err := server.AddRemoteCandidate(candidates[0]); err != nil {
+			t.Fatalf("Cannot queue remote candidate: %v", err)
+		}
+	}
+	if applied := countEvents(server, rtc.EventRemoteCandidate); applied != 0 {
+		t.Errorf("Expected no candidates to be applied before the remote description is set, got %d", applied)
+	}
+	if err := server.SetRemoteDescription(offer); err != nil {
+		t.Fatalf("Cannot set remote description: %v", err)
+	}
+	if applied := countEvents(server, rtc.EventRemoteCandidate); applied != 1 {
+		t.Errorf("Expected the queued candidate to be applied once, got %d", applied)
+	}
+	if failed := server.AddRemoteCandidates(candidates[1:]); len(failed) != 0 {
+		t.Fatalf("Cannot add remote candidates: %v", failed)
+	}
+
+	answer, err := server.Pc.CreateAnswer(nil)
+	if err != nil {
+		t.Fatalf("Cannot create answer: %v", err)
+	}
+	if err := server.SetLocalDescription(answer); err != nil {
+		t.Fatalf("Cannot set local description: %v", err)
+	}
+	if err := server.WaitForICEGathering(ctx); err != nil {
+		t.Fatalf("Cannot wait for ICE gathering: %v", err)
+	}
+	if err := client.ApplyAnswer(*server.Pc.LocalDescription()); err != nil {
+		t.Fatalf("Cannot apply answer: %v", err)
+	}
+	for _, peer := range []*rtc.RTC{client, server} {
+		if err := peer.WaitUntilConnected(ctx); err != nil {
+			t.Fatalf("Connection %s did not connect: %v", peer.Id, err)
+		}
+	}
+
+	// A candidate that arrives late is handled gracefully
+	if err := server.AddRemoteCandidate(candidates[0]); err != nil {
+		t.Errorf("Expected a candidate after the connection was established to be skipped, got %v", err)
+	}
+}
+
+func TestCandidateInSDPIsNotAppliedAgain(t *testing.T) {
+	// The offer embeds the gathered candidates, which are trickled as well
+	client, offer, err := rtc.CreateOffer("client")
+	if err != nil {
+		t.Fatalf("Cannot create offer: %v", err)
+	}
+	t.Cleanup(func() { client.Destroy() })
+	candidates := client.GetAllLocalCandidates()
+	if len(candidates) == 0 {
+		t.Fatal("Expected the client to gather candidates")
+	}
+
+	server := newAnswerer(t, "server")
+	if err := server.SetRemoteDescription(offer.Offer); err != nil {
+		t.Fatalf("Cannot set remote description: %v", err)
+	}
+	if failed := server.AddRemoteCandidates(candidates); len(failed) != 0 {
+		t.Fatalf("Cannot add remote candidates: %v", failed)
+	}
+	if applied := countEvents(server, rtc.EventRemoteCandidate); applied != 0 {
+		t.Errorf("Expected the candidates embedded in the SDP to be skipped, got %d applied", applied)
+	}
+}
+
+func TestGetLocalCandidatesSince(t *testing.T) {
+	r := rtc.NewRTC("rover")
+	r.AddLocalCandidate(candidateOfType("host", 50001))
+	r.AddLocalCandidate(candidateOfType("host", 50002))
+
+	candidates, index := r.GetLocalCandidatesSince(0)
+	if len(candidates) != 2 || index != 2 {
+		t.Fatalf("Expected 2 candidates up to index 2, got %d up to index %d", len(candidates), index)
+	}
+	if candidates, index = r.GetLocalCandidatesSince(index); len(candidates) != 0 || index != 2 {
+		t.Errorf("Expected no new candidates, got %d up to index %d", len(candidates), index)
+	}
+
+	r.AddLocalCandidate(candidateOfType("host", 50003))
+	candidates, index = r.GetLocalCandidatesSince(index)
+	if len(candidates) != 1 || index != 3 || candidates[0].Candidate != candidateOfType("host", 50003).Candidate {
+		t.Errorf("Expected only the new candidate up to index 3, got %v up to index %d", candidates, index)
+	}
+
+	// An index beyond the candidates returns all of them
+	if candidates, index = r.GetLocalCandidatesSince(10); len(candidates) != 3 || index != 3 {
+		t.Errorf("Expected all 3 candidates, got %d up to index %d", len(candidates), index)
+	}
+}
+
+func TestGetLocalCandidatesSinceConcurrently(t *testing.T) {
+	r := rtc.NewRTC("rover")
+	const count = 100
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < count; i++ {
+			r.AddLocalCandidate(candidateOfType("host", 50000+i))
+		}
+	}()
+
+	// Polling while candidates are added returns every candidate exactly once
+	seen := make(map[string]int)
+	index := 0
+	deadline := time.Now().Add(receiveTimeout)
+	for len(seen) < count && time.Now().Before(deadline) {
+		var candidates []webrtc.ICECandidateInit
+		candidates, index = r.GetLocalCandidatesSince(index)
+		for _, candidate := range candidates {
+			seen[candidate.Candidate]++
+		}
+	}
+	wg.Wait()
+	if len(seen) != count {
+		t.Fatalf("Expected %d candidates, got %d", count, len(seen))
+	}
+	for candidate, n := range seen {
+		if n != 1 {
+			t.Errorf("Expected candidate %q once, got it %d times", candidate, n)
+		}
+	}
+}
+
+// Receive the next candidate from a subscription
+func expectCandidate(t *testing.T, candidates <-chan webrtc.ICECandidateInit, want webrtc.ICECandidateInit) {
+	t.Helper()
+
+	select {
+	case got, ok := <-candidates:
+		if !ok {
+			t.Fatal("Expected a candidate, the subscription was closed")
+		}
+		if got.Candidate != want.Candidate {
+			t.Errorf("Expected candidate %q, got %q", want.Candidate, got.Candidate)
+		}
+	case <-time.After(receiveTimeout):
+		t.Fatalf("Expected candidate %q, got none", want.Candidate)
+	}
+}
+
+// Wait until a subscription is closed
+func expectSubscriptionClosed(t *testing.T, candidates <-chan webrtc.ICECandidateInit) {
+	t.Helper()
+
+	select {
+	case got, ok := <-candidates:
+		if ok {
+			t.Errorf("Expected the subscription to be closed, got candidate %q", got.Candidate)
+		}
+	case <-time.After(receiveTimeout):
+		t.Error("Expected the subscription to be closed")
+	}
+}
+
+func TestSubscribeLocalCandidates(t *testing.T) {
+	r := rtc.NewRTC("rover")
+	t.Cleanup(func() { r.Destroy() })
+	r.AddLocalCandidate(candidateOfType("host", 50001))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	candidates := r.SubscribeLocalCandidates(ctx)
+	// Candidates that were added before subscribing are sent first
+	expectCandidate(t, candidates, candidateOfType("host", 50001))
+
+	r.AddLocalCandidate(candidateOfType("host", 50002))
+	r.AddLocalCandidate(candidateOfType("host", 50003))
+	expectCandidate(t, candidates, candidateOfType("host", 50002))
+	expectCandidate(t, candidates, candidateOfType("host", 50003))
+
+	cancel()
+	expectSubscriptionClosed(t, candidates)
+}
+
+func TestSubscribeLocalCandidatesClosedOnDestroy(t *testing.T) {
+	r := rtc.NewRTC("rover")
+	candidates := r.SubscribeLocalCandidates(context.Background())
+
+	if err := r.Destroy(); err != nil {
+		t.Fatalf("Cannot destroy connection: %v", err)
+	}
+	expectSubscriptionClosed(t, candidates)
+}
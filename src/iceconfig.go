@@ -0,0 +1,166 @@
+package rtc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+//
+// This file contains the configuration of the STUN/TURN servers used to gather ICE candidates, so that consumers do not have to hard-code them.
+// The configuration can be read from a JSON file or from the environment, and looks like this:
+//
+//	{ "iceServers": [ { "urls": ["turn:turn.example.com:3478"], "username": "1735689600:rover", "credential": "secret" } ] }
+//
+// Time-limited TURN credentials (as handed out by the TURN REST API) carry their expiry as a unix timestamp at the start of the username
+//
+
+// The environment variable that holds the complete configuration as JSON (see LoadICEConfigFromEnv)
+const EnvICEServers = "ROVERRTC_ICE_SERVERS"
+
+// The environment variables that describe a single server, used if EnvICEServers is not set. The urls are separated by commas
+const (
+	EnvICEURLs       = "ROVERRTC_ICE_URLS"
+	EnvICEUsername   = "ROVERRTC_ICE_USERNAME"
+	EnvICECredential = "ROVERRTC_ICE_CREDENTIAL"
+)
+
+var (
+	// No ICE configuration was found in the environment
+	ErrNoICEConfig = errors.New("No ICE configuration found in the environment")
+	// An ICE server url is malformed or does not use the stun:, turn: or turns: scheme
+	ErrInvalidICEURL = errors.New("ICE server url is invalid")
+	// A TURN server is configured without a username or credential
+	ErrMissingCredentials = errors.New("TURN server requires a username and credential")
+)
+
+// The STUN/TURN servers used to gather ICE candidates
+type ICEConfig struct {
+	Servers []ICEServerConfig `json:"iceServers"`
+}
+
+// A single STUN/TURN server, reachable on any of its urls
+type ICEServerConfig struct {
+	URLs           []string `json:"urls"`
+	Username       string   `json:"username,omitempty"`
+	Credential     string   `json:"credential,omitempty"`
+	CredentialType string   `json:"credentialType,omitempty"` // only "password" (the default) is supported
+}
+
+// Read and validate the configuration from the JSON file at path
+func LoadICEConfigFromFile(path string) (ICEConfig, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return ICEConfig{}, err
+	}
+	return parseICEConfig(content)
+}
+
+// Read and validate the configuration from the environment: either the JSON in EnvICEServers, or the single server described by
+// EnvICEURLs, EnvICEUsername and EnvICECredential. Returns ErrNoICEConfig if neither is set
+func LoadICEConfigFromEnv() (ICEConfig, error) {
+	if content := os.Getenv(EnvICEServers); content != "" {
+		return parseICEConfig([]byte(content))
+	}
+
+	urls := os.Getenv(EnvICEURLs)
+	if urls == "" {
+		return ICEConfig{}, ErrNoICEConfig
+	}
+	server := ICEServerConfig{
+		Username:   os.Getenv(EnvICEUsername),
+		Credential: os.Getenv(EnvICECredential),
+	}
+	for _, url := range strings.Split(urls, ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			server.URLs = append(server.URLs, url)
+		}
+	}
+
+	config := ICEConfig{Servers: []ICEServerConfig{server}}
+	if err := config.Validate(); err != nil {
+		return ICEConfig{}, err
+	}
+	return config, nil
+}
+
+// Parse and validate a configuration in JSON
+func parseICEConfig(content []byte) (ICEConfig, error) {
+	var config ICEConfig
+	if err := json.Unmarshal(content, &config); err != nil {
+		return ICEConfig{}, fmt.Errorf("Cannot parse ICE configuration: %w", err)
+	}
+	if err := config.Validate(); err != nil {
+		return ICEConfig{}, err
+	}
+	return config, nil
+}
+
+// Check that every server has at least one url with a stun:, turn: or turns: scheme, and that TURN servers have credentials
+func (c ICEConfig) Validate() error {
+	for _, server := range c.Servers {
+		if len(server.URLs) == 0 {
+			return fmt.Errorf("%w: server has no urls", ErrInvalidICEURL)
+		}
+		for _, url := range server.URLs {
+			scheme, host, found := strings.Cut(url, ":")
+			if !found || strings.Trim(host, "/") == "" {
+				return fmt.Errorf("%w: %q", ErrInvalidICEURL, url)
+			}
+
+			switch strings.ToLower(scheme) {
+			case "stun":
+			case "turn", "turns":
+				if server.Username == "" || server.Credential == "" {
+					return fmt.Errorf("%w: %q", ErrMissingCredentials, url)
+				}
+			default:
+				return fmt.Errorf("%w: unsupported scheme in %q", ErrInvalidICEURL, url)
+			}
+		}
+		if server.CredentialType != "" && server.CredentialType != "password" {
+			return fmt.Errorf("Credential type %q is not supported", server.CredentialType)
+		}
+	}
+	return nil
+}
+
+// Returns the expiry of a time-limited TURN credential, taken from the unix timestamp at the start of the username ("<expiry>:<user>")
+func (s ICEServerConfig) Expiry() (time.Time, bool) {
+	prefix, _, found := strings.Cut(s.Username, ":")
+	if !found {
+		return time.Time{}, false
+	}
+	expiry, err := strconv.ParseInt(prefix, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(expiry, 0), true
+}
+
+// Convert the configuration to the servers of a pion configuration. Servers with an expired time-limited credential are kept, but logged
+// as a warning, since gathering relay candidates through them will fail
+func (c ICEConfig) ToWebRTC() []webrtc.ICEServer {
+	log := getDefaultLogger()
+
+	servers := make([]webrtc.ICEServer, 0, len(c.Servers))
+	for _, server := range c.Servers {
+		if expiry, ok := server.Expiry(); ok && time.Now().After(expiry) {
+			log.Warn().Strs("urls", server.URLs).Time("expiry", expiry).Msg("TURN credential has expired")
+		}
+
+		servers = append(servers, webrtc.ICEServer{
+			URLs:           server.URLs,
+			Username:       server.Username,
+			Credential:     server.Credential,
+			CredentialType: webrtc.ICECredentialTypePassword,
+		})
+	}
+	return servers
+}
@@ -0,0 +1,131 @@
+package rtc_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/rs/zerolog"
+)
+
+func TestICEConfigValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		server rtc.ICEServerConfig
+		want   error
+	}{
+		{"stun", rtc.ICEServerConfig{URLs: []string{"stun:stun.example.com:3478"}}, nil},
+		{"turn with credentials", rtc.ICEServerConfig{URLs: []string{"turn:turn.example.com:3478"}, Username: "rover", Credential: "secret"}, nil},
+		{"turns with credentials", rtc.ICEServerConfig{URLs: []string{"TURNS:turn.example.com:5349"}, Username: "rover", Credential: "secret"}, nil},
+		{"no urls", rtc.ICEServerConfig{}, rtc.ErrInvalidICEURL},
+		{"no scheme", rtc.ICEServerConfig{URLs: []string{"stun.example.com"}}, rtc.ErrInvalidICEURL},
+		{"no host", rtc.ICEServerConfig{URLs: []string{"stun:"}}, rtc.ErrInvalidICEURL},
+		{"unsupported scheme", rtc.ICEServerConfig{URLs: []string{"http://stun.example.com"}}, rtc.ErrInvalidICEURL},
+		{"turn without username", rtc.ICEServerConfig{URLs: []string{"turn:turn.example.com"}, Credential: "secret"}, rtc.ErrMissingCredentials},
+		{"turn without credential", rtc.ICEServerConfig{URLs: []string{"turn:turn.example.com"}, Username: "rover"}, rtc.ErrMissingCredentials},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := rtc.ICEConfig{Servers: []rtc.ICEServerConfig{tt.server}}.Validate()
+			if tt.want == nil && err != nil {
+				t.Errorf("Expected the server to be valid, got %v", err)
+			} else if !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestLoadICEConfigFromEnv(t *testing.T) {
+	t.Run("json", func(t *testing.T) {
+		t.Setenv(rtc.EnvICEServers, `{"iceServers": [{"urls": ["stun:a.example.com"]}, {"urls": ["turn:b.example.com"], "username": "rover", "credential": "secret"}]}`)
+		config, err := rtc.LoadICEConfigFromEnv()
+		if err != nil {
+			t.Fatalf("Cannot load configuration: %v", err)
+		}
+		if len(config.Servers) != 2 || config.Servers[1].Username != "rover" {
+			t.Errorf("Expected both servers, got %+v", config.Servers)
+		}
+	})
+
+	t.Run("single server", func(t *testing.T) {
+		t.Setenv(rtc.EnvICEServers, "")
+		t.Setenv(rtc.EnvICEURLs, "turn:a.example.com:3478, turns:a.example.com:5349,")
+		t.Setenv(rtc.EnvICEUsername, "rover")
+		t.Setenv(rtc.EnvICECredential, "secret")
+		config, err := rtc.LoadICEConfigFromEnv()
+		if err != nil {
+			t.Fatalf("Cannot load configuration: %v", err)
+		}
+		want := []string{"turn:a.example.com:3478", "turns:a.example.com:5349"}
+		if len(config.Servers) != 1 || strings.Join(config.Servers[0].URLs, " ") != strings.Join(want, " ") {
+			t.Errorf("Expected one server with urls %v, got %+v", want, config.Servers)
+		}
+	})
+
+	t.Run("missing credentials", func(t *testing.T) {
+		t.Setenv(rtc.EnvICEServers, "")
+		t.Setenv(rtc.EnvICEURLs, "turn:a.example.com")
+		t.Setenv(rtc.EnvICEUsername, "")
+		t.Setenv(rtc.EnvICECredential, "")
+		if _, err := rtc.LoadICEConfigFromEnv(); !errors.Is(err, rtc.ErrMissingCredentials) {
+			t.Errorf("Expected %v, got %v", rtc.ErrMissingCredentials, err)
+		}
+	})
+
+	t.Run("malformed json", func(t *testing.T) {
+		t.Setenv(rtc.EnvICEServers, `{"iceServers": [`)
+		if _, err := rtc.LoadICEConfigFromEnv(); err == nil {
+			t.Error("Expected an error for malformed JSON")
+		}
+	})
+
+	t.Run("not set", func(t *testing.T) {
+		t.Setenv(rtc.EnvICEServers, "")
+		t.Setenv(rtc.EnvICEURLs, "")
+		if _, err := rtc.LoadICEConfigFromEnv(); !errors.Is(err, rtc.ErrNoICEConfig) {
+			t.Errorf("Expected %v, got %v", rtc.ErrNoICEConfig, err)
+		}
+	})
+}
+
+func TestLoadICEConfigFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ice.json")
+	if err := os.WriteFile(path, []byte(`{"iceServers": [{"urls": ["stun:a.example.com", "ftp:b.example.com"]}]}`), 0o600); err != nil {
+		t.Fatalf("Cannot write configuration: %v", err)
+	}
+	if _, err := rtc.LoadICEConfigFromFile(path); !errors.Is(err, rtc.ErrInvalidICEURL) {
+		t.Errorf("Expected %v, got %v", rtc.ErrInvalidICEURL, err)
+	}
+	if _, err := rtc.LoadICEConfigFromFile(filepath.Join(t.TempDir(), "missing.json")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected %v, got %v", os.ErrNotExist, err)
+	}
+}
+
+func TestICEConfigExpiredCredential(t *testing.T) {
+	logs := newLogBuffer()
+	rtc.SetLogger(zerolog.New(logs))
+	t.Cleanup(func() { rtc.SetLogger(zerolog.Nop()) })
+
+	expired := fmt.Sprintf("%d:rover", time.Now().Add(-time.Hour).Unix())
+	valid := fmt.Sprintf("%d:rover", time.Now().Add(time.Hour).Unix())
+	config := rtc.ICEConfig{Servers: []rtc.ICEServerConfig{
+		{URLs: []string{"turn:a.example.com"}, Username: valid, Credential: "secret"},
+		{URLs: []string{"turn:b.example.com"}, Username: expired, Credential: "secret"},
+		{URLs: []string{"stun:c.example.com"}},
+	}}
+
+	servers := config.ToWebRTC()
+	if len(servers) != 3 {
+		t.Errorf("Expected all servers to be kept, got %d", len(servers))
+	}
+	if output := logs.String(); strings.Count(output, "TURN credential has expired") != 1 || !strings.Contains(output, "b.example.com") {
+		t.Errorf("Expected a single warning for the expired credential, got %q", output)
+	}
+}
@@ -1,12 +1,16 @@
 package rtc
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	// Add zerolog
 	"github.com/rs/zerolog"
-	"github.com/rs/zerolog/log"
 	"google.golang.org/protobuf/proto"
 
 	"github.com/pion/webrtc/v4"
@@ -23,38 +27,205 @@ type RTC struct {
 	Candidates     []webrtc.ICECandidateInit // the **local** ICE candidates (that can be transmitted to the other peers)
 	CandidatesLock *sync.Mutex               // to make sure ICE candidates can be managed concurrently
 	// Communication channels
-	ControlChannel  *webrtc.DataChannel // the data channel used for the control protocol between server and client
-	DataChannel     *webrtc.DataChannel // the data channel used to send debugging information and tuning state
-	TimestampOffset int64               // the timestamp offset to calculate the time difference between the client and the server
+	controlChannel  MessageChannel    // the data channel used for the control protocol between server and client (see ControlChannel)
+	dataChannel     MessageChannel    // the data channel used to send debugging information and tuning state (see DataChannel)
+	TimestampOffset int64             // the timestamp offset to calculate the time difference between the client and the server
+	MeasuredRTT     time.Duration     // the round trip time measured during the last clock synchronization
+	MaxChannels     int               // the maximum number of data channels this connection accepts (0 means unlimited)
+	Metadata        map[string]string // application-defined information about the connection (e.g. the client version), set at construction
+	// Internal state, used by the package-owned receive path and background goroutines
+	lock                   *sync.Mutex                         // to make sure the internal state can be managed concurrently
+	controlHandlers        map[uint16]func(payload []byte)     // type id -> handler for framed control messages
+	onControlBytes         func(b []byte)                      // handler for control messages that are not framed
+	lastPong               time.Time                           // the time the last pong was received from the peer
+	channels               map[string]*webrtc.DataChannel      // label -> data channel, for all registered channels
+	rejectedChannels       atomic.Uint64                       // the number of channels rejected because MaxChannels was reached
+	signalingRecorder      *json.Encoder                       // records the signaling messages, if enabled
+	onData                 func(b []byte)                      // handler for decoded messages on the data channel
+	reorder                *reorderBuffer                      // reorders incoming data messages, if enabled
+	sendSequence           atomic.Uint32                       // the sequence number of the next outgoing data message
+	gatheringDone          chan struct{}                       // closed when the current ICE gathering completed or was given up on
+	settings               webrtc.SettingEngine                // the settings used by CreatePeerConnection
+	probes                 map[uint64]chan struct{}            // probe id -> channel that is closed when the probe is echoed
+	requiredProtocol       string                              // the sub-protocol that channels announced by the peer must use, if set
+	onProtocolMismatch     func(label string, err error)       // called when a channel is rejected because of its sub-protocol
+	writeQueue             *writeQueue                         // the queue of the writer goroutine, if started
+	nackEnabled            bool                                // whether to send nacks for messages that cannot be unmarshalled
+	onNack                 func(nack Nack)                     // handler for nacks received from the peer
+	corruptMessages        atomic.Uint64                       // the number of received messages that could not be unmarshalled
+	throughput             *throughputCounter                  // the bytes sent and received over recent time windows
+	appliedCandidates      map[string]struct{}                 // the candidate strings of the remote ICE candidates applied so far
+	transportBytesReceived uint64                              // the received byte counter of the ICE transport at the last sample
+	transportActivity      time.Time                           // the last time the received byte counter of the ICE transport changed
+	keepaliveConfig        KeepaliveConfig                     // the keep-alive parameters used by CreatePeerConnection
+	role                   atomic.Int32                        // the role of the connection, so that it can be read without the lock
+	onUnhandledControl     func(typeID uint16, payload []byte) // fallback handler for framed control messages without a handler
+	logger                 atomic.Pointer[zerolog.Logger]      // the logger of this connection, if it does not use the package logger
+	chunkSize              int                                 // the size of the chunks sent by SendDataChunked
+	chunkMessageId         atomic.Uint32                       // the id of the last message sent by SendDataChunked
+	droppedChunked         atomic.Uint64                       // the number of chunked messages that could not be reassembled
+	onControlMessage       func(msg proto.Message, raw []byte) // handler for control messages of registered types
+	clockSamples           chan clockSample                    // receives the samples of a running SyncClock, if any
+	stateHandlers          []func(webrtc.PeerConnectionState)  // the handlers registered with OnStateChange
+	stateHooked            *webrtc.PeerConnection              // the peer connection on which the state change handler is installed
+	stateChanged           chan struct{}                       // closed (and replaced) on every state change, to wake up waiters
+	rttHistory             []time.Duration                     // the recently measured round trip times, oldest first
+	keepaliveMaxMissed     int                                 // the number of keep-alive pings that may go unanswered
+	onKeepaliveTimeout     func()                              // called when the keep-alive times out
+	calls                  map[uint64]chan rpcResponse         // correlation id -> channel that receives the response of a call
+	callId                 atomic.Uint64                       // the correlation id of the last call
+	onRequest              func(req []byte) ([]byte, error)    // handler for requests from the peer
+	candidatePath          atomic.Pointer[string]              // the selected network path, once known
+	reassembler            *reassembler                        // reassembles chunked data messages, if enabled
+	streamHandlers         map[uint8]func(b []byte)            // stream id -> handler, once a stream handler is registered
+	unhandledStream        atomic.Uint64                       // the number of stream messages without a handler
+	maxBufferedAmount      uint64                              // the maximum number of bytes buffered on the data channel by the limited sends (0 means unlimited)
+	bufferDrained          chan struct{}                       // closed (and replaced) when the data channel buffer drains, to wake up blocked senders
+	onGatheringComplete    func([]webrtc.ICECandidateInit)     // called when ICE candidate gathering completed
+	candidatesAdded        chan struct{}                       // closed (and replaced) when a local candidate is added, guarded by CandidatesLock
+	pendingCandidates      []webrtc.ICECandidateInit           // remote candidates received before the remote description was set
+	remoteDescriptionSet   bool                                // whether the remote description was set with SetRemoteDescription
+	token                  string                              // the token the connection was accepted with, to verify later signaling requests
+	onPeerClosing          func(reason string)                 // called when the peer closes the connection gracefully
+	closingAck             chan struct{}                       // signalled when the peer acknowledges the closing message
+	negotiating            atomic.Bool                         // whether an offer/answer exchange over the control channel is in progress
+	negotiationAnswer      chan negotiationResult              // the answer of the peer to the offer sent over the control channel
+	standby                *standbyConnection                  // carries the signaling of an in-band ICE restart, if one is set up
+	standbyAnswer          chan webrtc.SessionDescription      // the answer of the peer to the offer of our standby connection
+	events                 *eventHistory                       // the recent lifecycle events of the connection
+	dataLimiter            *sendLimiter                        // the send rate limit of the data channel, if set
+	controlLimiter         *sendLimiter                        // the send rate limit of the control channel, if set
+	batcher                *batcher                            // coalesces outgoing data messages, if batching is enabled
+	compression            *compression                        // the compression of data messages, if enabled
+	onNewChannel           func(ch *Channel)                   // called for every channel announced by the peer
+	onRemoteTrack          remoteTrackFunc                     // called for every track of the peer
+	rtpSenders             []*webrtc.RTPSender                 // the senders of the local tracks, stopped on Destroy
+	signalingTransport     signalingTransport                  // sends offers to the peer, if not over the control channel
+	polite                 atomic.Bool                         // whether this peer yields when both peers send an offer at the same time
+	inBandTrickle          bool                                // whether local candidates are sent over the control channel once it is open
+	candidateFilter        filterFunc                          // decides which local and remote candidates are used, if set
+	filteredCandidates     atomic.Uint64                       // the number of candidates dropped by the candidate filter
+	interfacePriority      []string                            // the names of the interfaces to gather candidates on, in order of preference
+	quality                qualityTracker                      // classifies the link quality on every keep-alive tick
+	liveness               livenessPolicy                      // destroys the connection when it is disconnected for too long, and reports why it was destroyed
+	sequencing             *lossTracker                        // counts lost, reordered and duplicate data messages, if enabled
+	onGap                  func(expected, received uint32)     // called when a gap in the sequence numbers of the data channel is detected
+	clock                  func() time.Time                    // the clock of the activity accounting (replaced in tests)
+	createdAt              time.Time                           // when the connection was created
+	activity               map[string]*ChannelActivity         // label -> the last time a message was sent and received on the channel
+	trafficRecorder        *trafficRecorder                    // records the messages sent and received on the channels, if started
+	dataInterceptors       []SendInterceptor                   // see the messages sent on the data channel before they are sent
+	controlInterceptors    []SendInterceptor                   // see the messages sent on the control channel before they are sent
+	health                 sendHealth                          // the consecutive send failures per channel, and their circuit breakers
+	setup                  [setupMilestones]time.Time          // when each milestone of the connection setup was reached, zero if not (yet)
+	expiringLock           *sync.Mutex                         // serializes the lazy creation of the channels used by SendExpiring
+	taps                   receiveTaps                         // observe the messages received per channel, used by relays
+	heartbeat              syncedHeartbeat                     // the state of the synced heartbeat, see StartSyncedHeartbeat
+	clockPing              int64                               // the timestamp of the last ping of a running SyncClock, to recognize its pong
+	closed                 chan struct{}                       // closed when the connection is destroyed, to stop background goroutines
 }
 
-// Create an easy function to get a logger with the context and connection id already set
+// Create an easy function to get a logger with the context and connection id already set. It is based on the logger of the connection
+// (see WithLogger) if set, else on the package logger (see SetLogger), else on the zerolog global logger
 func (r *RTC) Log() zerolog.Logger {
-	logger := log.With().Str("context", "rtc").Str("connectionId", r.Id).Logger()
+	base := getDefaultLogger()
+	if l := r.logger.Load(); l != nil {
+		base = *l
+	}
+	ctx := base.With().Str("context", "rtc").Str("connectionId", r.Id).Stringer("role", r.Role())
+	if path := r.candidatePath.Load(); path != nil {
+		ctx = ctx.Str("candidatePair", *path)
+	}
+	logger := ctx.Logger()
 	return logger
 }
 
 func NewRTC(id string) *RTC {
 	var candidatesMux sync.Mutex
+	var lock sync.Mutex
+	var expiringLock sync.Mutex
 	candidates := make([]webrtc.ICECandidateInit, 0)
 
-	return &RTC{
-		Id:              id,
-		Candidates:      candidates,
-		CandidatesLock:  &candidatesMux,
-		TimestampOffset: 0,
+	r := &RTC{
+		Id:                 id,
+		Candidates:         candidates,
+		CandidatesLock:     &candidatesMux,
+		TimestampOffset:    0,
+		MaxChannels:        DefaultMaxChannels,
+		Metadata:           make(map[string]string),
+		lock:               &lock,
+		controlHandlers:    make(map[uint16]func(payload []byte)),
+		channels:           make(map[string]*webrtc.DataChannel),
+		probes:             make(map[uint64]chan struct{}),
+		throughput:         newThroughputCounter(),
+		keepaliveConfig:    DefaultKeepaliveConfig,
+		appliedCandidates:  make(map[string]struct{}),
+		chunkSize:          DefaultChunkSize,
+		stateChanged:       make(chan struct{}),
+		keepaliveMaxMissed: heartbeatMaxMissed,
+		calls:              make(map[uint64]chan rpcResponse),
+		bufferDrained:      make(chan struct{}),
+		candidatesAdded:    make(chan struct{}),
+		closingAck:         make(chan struct{}, 1),
+		negotiationAnswer:  make(chan negotiationResult, 1),
+		standbyAnswer:      make(chan webrtc.SessionDescription, 1),
+		events:             newEventHistory(DefaultEventHistorySize),
+		quality:            qualityTracker{thresholds: DefaultQualityThresholds},
+		clock:              time.Now,
+		createdAt:          time.Now(),
+		activity:           make(map[string]*ChannelActivity),
+		expiringLock:       &expiringLock,
+		closed:             make(chan struct{}),
 	}
+
+	// Always answer keep-alive pings and probes, so that the peer can run a heartbeat or connectivity check against us
+	r.controlHandlers[controlTypePing] = r.handlePing
+	r.controlHandlers[controlTypePong] = r.handlePong
+	r.controlHandlers[controlTypeProbe] = r.handleProbe
+	r.controlHandlers[controlTypeProbeEcho] = r.handleProbeEcho
+	r.controlHandlers[controlTypeNack] = r.handleNack
+	r.controlHandlers[controlTypeRequest] = r.handleRequest
+	r.controlHandlers[controlTypeResponse] = r.handleResponse
+	r.controlHandlers[controlTypeErrorResponse] = r.handleErrorResponse
+	r.controlHandlers[controlTypeClosing] = r.handleClosing
+	r.controlHandlers[controlTypeClosingAck] = r.handleClosingAck
+	r.controlHandlers[controlTypeOffer] = r.handleOffer
+	r.controlHandlers[controlTypeAnswer] = r.handleAnswer
+	r.controlHandlers[controlTypeCandidate] = r.handleCandidate
+	r.controlHandlers[controlTypeStandbyOffer] = r.handleStandbyOffer
+	r.controlHandlers[controlTypeStandbyAnswer] = r.handleStandbyAnswer
+	r.controlHandlers[controlTypeRestartOffer] = r.handleRestartOffer
+	return r
 }
 
-// Add a local ICE candidate to the list of candidates fetched so far
+// Add a local ICE candidate to the list of candidates fetched so far. Candidates that were already added (pion sometimes emits
+// equivalent candidates more than once) are ignored
 func (r *RTC) AddLocalCandidate(candidate webrtc.ICECandidateInit) {
 	log := r.Log()
 
+	if !r.allowCandidate(candidate, "local") {
+		return
+	}
+	candidate = r.prioritizeCandidate(candidate)
+
 	r.CandidatesLock.Lock()
-	defer r.CandidatesLock.Unlock()
+	for _, existing := range r.Candidates {
+		if existing.Candidate == candidate.Candidate {
+			r.CandidatesLock.Unlock()
+			log.Debug().Msg("Ignored duplicate local ICE candidate")
+			return
+		}
+	}
 
 	r.Candidates = append(r.Candidates, candidate)
+	close(r.candidatesAdded)
+	r.candidatesAdded = make(chan struct{})
+	r.CandidatesLock.Unlock()
 	log.Debug().Msg("Added local ICE candidate")
+	r.recordEvent(EventLocalCandidate, candidate.Candidate)
+
+	r.recordSignaling(signalingOut, nil, &candidate)
+	r.trickleInBand(candidate)
 }
 
 // Get a copy of all local ICE candidates (concurrency-safe)
@@ -69,30 +240,117 @@ func (r *RTC) GetAllLocalCandidates() []webrtc.ICECandidateInit {
 	return safeCandidates
 }
 
-// Destroy an RTC object and the underlying webRTC connection
-func (r *RTC) Destroy() {
+// Destroy an RTC object: stop the media tracks, close the control, data and named channels, then the underlying webRTC connection.
+// Returns the errors of closing them joined together. Destroying a connection that is already destroyed does nothing and returns nil
+func (r *RTC) Destroy() error {
+	return r.destroy(CloseReasonDestroyed)
+}
+
+// Destroy the connection and pass the reason to the OnClosed handlers
+func (r *RTC) destroy(reason string) error {
 	log := r.Log()
 
-	if r.Pc == nil {
-		log.Warn().Msg("Cannot destroy RTC connection. Connection is nil")
-		return
+	// Send the messages that are still waiting in the batch
+	r.flushBatch()
+
+	// Stop all background goroutines (e.g. the heartbeat), even if the connection was never set up
+	r.lock.Lock()
+	select {
+	case <-r.closed:
+		r.lock.Unlock()
+		log.Debug().Msg("RTC connection is already destroyed")
+		return nil
+	default:
+		close(r.closed)
+	}
+	if r.liveness.timer != nil {
+		r.liveness.timer.Stop()
+		r.liveness.timer = nil
+	}
+	pc := r.Pc
+	queue := r.writeQueue
+	senders := r.rtpSenders
+	r.rtpSenders = nil
+	channels := []MessageChannel{r.controlChannel, r.dataChannel}
+	for label, dc := range r.channels {
+		if label != ControlChannelLabel && label != DataChannelLabel {
+			channels = append(channels, dc)
+		}
 	}
+	standby := r.standby
+	r.Pc, r.controlChannel, r.dataChannel, r.standby = nil, nil, nil, nil
+	r.lock.Unlock()
 
-	if err := r.Pc.Close(); err != nil {
-		log.Err(err).Msg("Cannot close RTC connection")
+	// Discard the queue of the writer, so that nothing is sent on the channels while they are closed
+	if queue != nil {
+		if discarded := queue.discard(); discarded > 0 {
+			log.Debug().Int("messages", discarded).Msg("Discarded queued messages")
+		}
+	}
+
+	var errs []error
+	for _, sender := range senders {
+		if err := sender.Stop(); err != nil {
+			errs = append(errs, fmt.Errorf("Cannot stop RTP sender: %w", err))
+		}
+	}
+	for _, dc := range channels {
+		if dc == nil || dc.ReadyState() == webrtc.DataChannelStateClosed {
+			continue
+		}
+		if err := dc.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("Cannot close data channel %s: %w", dc.Label(), err))
+		}
+	}
+	if pc != nil {
+		if err := pc.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("Cannot close RTC connection: %w", err))
+		}
+	}
+	if standby != nil {
+		if err := standby.pc.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("Cannot close standby connection: %w", err))
+		}
 	}
 
 	r.CandidatesLock.Lock()
-	defer r.CandidatesLock.Unlock()
 	r.Candidates = make([]webrtc.ICECandidateInit, 0)
+	r.CandidatesLock.Unlock()
+
+	// Write the rest of the recording, so that it is complete once the connection is destroyed
+	if err := r.StopRecording(); err != nil {
+		errs = append(errs, fmt.Errorf("Cannot write recording: %w", err))
+	}
 
-	r.Pc = nil
-	log.Debug().Msg("Destroyed RTC connection")
+	err := errors.Join(errs...)
+	if err != nil {
+		log.Warn().Err(err).Msg("Destroyed RTC connection with errors")
+	} else {
+		log.Debug().Msg("Destroyed RTC connection")
+	}
+	r.notifyClosed(reason)
+	return err
 }
 
 // Utility function to check if the connection is still active
+// This is safe to call at any point in the lifecycle, also before the connection is set up or after it is destroyed
 func (r *RTC) IsConnected() bool {
-	return r.Pc.ConnectionState() == webrtc.PeerConnectionStateConnected
+	return r.ConnectionState() == webrtc.PeerConnectionStateConnected
+}
+
+// Returns the state of the connection. This is unknown if the connection is not set up yet, and closed if it is destroyed
+func (r *RTC) ConnectionState() webrtc.PeerConnectionState {
+	pc := r.peerConnection()
+	if pc != nil {
+		return pc.ConnectionState()
+	}
+
+	select {
+	case <-r.closed:
+		return webrtc.PeerConnectionStateClosed
+	default:
+		return webrtc.PeerConnectionStateUnknown
+	}
 }
 
 //
@@ -101,39 +359,56 @@ func (r *RTC) IsConnected() bool {
 
 // Sending on the data channel
 func (r *RTC) SendData(pb proto.Message) error {
-	content, err := proto.Marshal(pb)
+	buf, err := marshalPooled(pb)
 	if err != nil {
 		return err
 	}
+	defer releaseBuffer(buf)
 
-	return r.SendDataBytes(content)
+	return r.SendDataBytes(*buf)
 }
 func (r *RTC) SendDataBytes(b []byte) error {
-	log := r.Log()
+	dc := r.dataMessageChannel()
+	if err := channelOpen(dc); err != nil {
+		log := r.Log()
+		log.Warn().Err(err).Msg("Cannot send on data channel")
+		return err
+	}
+	if err := r.limitSend(context.Background(), r.getDataLimiter()); err != nil {
+		return err
+	}
+	b = r.compress(b)
 
-	if r.DataChannel == nil {
-		log.Warn().Msg("Cannot send on data channel. Data channel is not configured")
-		return fmt.Errorf("Data channel is not configured")
+	r.lock.Lock()
+	batcher := r.batcher
+	r.lock.Unlock()
+	if batcher != nil {
+		r.addToBatch(batcher, b)
+		return nil
 	}
-	return r.DataChannel.Send(b)
+	return r.send(dc, r.encodeData(b), DefaultPriority)
 }
 
 // Sending on the control channel
 func (r *RTC) SendControlData(pb proto.Message) error {
-	content, err := proto.Marshal(pb)
+	buf, err := marshalPooled(pb)
 	if err != nil {
 		return err
 	}
+	defer releaseBuffer(buf)
 
-	return r.SendControlBytes(content)
+	return r.SendControlBytes(*buf)
 }
 func (r *RTC) SendControlBytes(b []byte) error {
-	log := r.Log()
-
-	if r.ControlChannel == nil {
-		log.Warn().Msg("Cannot send control data. Control channel is not configured")
-		return fmt.Errorf("Control channel is not configured")
+	dc := r.controlMessageChannel()
+	if err := channelOpen(dc); err != nil {
+		log := r.Log()
+		log.Warn().Err(err).Msg("Cannot send control data")
+		return err
+	}
+	if err := r.limitSend(context.Background(), r.getControlLimiter()); err != nil {
+		return err
 	}
 
-	return r.ControlChannel.Send(b)
+	return r.send(dc, b, ControlPriority)
 }
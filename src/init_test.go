@@ -0,0 +1,126 @@
+package rtc_test
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/VU-ASE/roverrtc/src/rtctest"
+	"github.com/pion/webrtc/v4"
+	"github.com/rs/zerolog"
+)
+
+func TestConnectionStateWithoutPeerConnection(t *testing.T) {
+	r := rtc.NewRTC("fresh")
+	if r.IsConnected() {
+		t.Error("Expected a fresh connection to not be connected")
+	}
+	if state := r.ConnectionState(); state != webrtc.PeerConnectionStateUnknown {
+		t.Errorf("Expected state unknown, got %s", state)
+	}
+}
+
+func TestConnectionStateAfterDestroy(t *testing.T) {
+	client, _ := rtctest.NewConnectedPair(t)
+	if err := client.Destroy(); err != nil {
+		t.Fatalf("Cannot destroy connection: %v", err)
+	}
+	if client.IsConnected() {
+		t.Error("Expected a destroyed connection to not be connected")
+	}
+	if state := client.ConnectionState(); state != webrtc.PeerConnectionStateClosed {
+		t.Errorf("Expected state closed, got %s", state)
+	}
+}
+
+func TestConnectionStateConnected(t *testing.T) {
+	client, server := rtctest.NewConnectedPair(t)
+	for _, r := range []*rtc.RTC{client, server} {
+		if !r.IsConnected() {
+			t.Errorf("Expected %s to be connected", r.Id)
+		}
+		if state := r.ConnectionState(); state != webrtc.PeerConnectionStateConnected {
+			t.Errorf("Expected %s to be in state connected, got %s", r.Id, state)
+		}
+	}
+}
+
+func TestConnectionStateDuringDestroy(t *testing.T) {
+	client, _ := rtctest.NewConnectedPair(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_ = client.IsConnected()
+				_ = client.Summary()
+				_, _ = client.Stats()
+			}
+		}()
+	}
+	_ = client.Destroy()
+	wg.Wait()
+}
+
+// A mock channel that cannot be closed
+type unclosableChannel struct {
+	*rtc.MockChannel
+}
+
+func (c unclosableChannel) Close() error {
+	return errors.New("Channel is stuck")
+}
+
+func TestDestroyTwice(t *testing.T) {
+	client, _ := rtctest.NewConnectedPair(t)
+	if err := client.Destroy(); err != nil {
+		t.Fatalf("Cannot destroy connection: %v", err)
+	}
+	if client.Pc != nil || client.ControlChannel() != nil || client.DataChannel() != nil {
+		t.Error("Expected the peer connection and channels to be cleared")
+	}
+
+	logs := newLogBuffer()
+	rtc.SetLogger(zerolog.New(logs).Level(zerolog.InfoLevel))
+	t.Cleanup(func() { rtc.SetLogger(zerolog.Nop()) })
+	if err := client.Destroy(); err != nil {
+		t.Errorf("Expected destroying a destroyed connection to return nil, got %v", err)
+	}
+	if output := logs.String(); output != "" {
+		t.Errorf("Expected destroying a destroyed connection to log nothing above debug, got %q", output)
+	}
+}
+
+func TestDestroyWithoutChannels(t *testing.T) {
+	r := rtc.NewRTC("fresh")
+	if err := r.Destroy(); err != nil {
+		t.Errorf("Expected destroying a connection without channels to succeed, got %v", err)
+	}
+
+	control := rtc.NewMockChannel(rtc.ControlChannelLabel)
+	r = rtc.NewRTC("mocked")
+	r.SetControlChannel(control)
+	if err := r.Destroy(); err != nil {
+		t.Errorf("Expected destroying a connection with only a control channel to succeed, got %v", err)
+	}
+	if state := control.ReadyState(); state != webrtc.DataChannelStateClosed {
+		t.Errorf("Expected the control channel to be closed, it is %s", state)
+	}
+}
+
+func TestRemovePropagatesDestroyError(t *testing.T) {
+	m := rtc.NewRTCMap()
+	r := rtc.NewRTC("rover")
+	r.SetDataChannel(unclosableChannel{rtc.NewMockChannel(rtc.DataChannelLabel)})
+	if err := m.AddConnection("rover", r); err != nil {
+		t.Fatalf("Cannot add connection: %v", err)
+	}
+
+	if err := m.Remove("rover"); err == nil || !strings.Contains(err.Error(), "Channel is stuck") {
+		t.Errorf("Expected the error of closing the data channel, got %v", err)
+	}
+}
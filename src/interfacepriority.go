@@ -0,0 +1,106 @@
+package rtc
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pion/webrtc/v4"
+)
+
+//
+// This file contains the interface priority of a multi-homed connection (e.g. a rover with both an Ethernet tether and Wi-Fi). Candidates
+// are only gathered on the listed interfaces, and the local preference of the host candidates that are sent to the peer is rewritten so
+// that candidates on a higher priority interface rank above those on a lower priority interface. ICE pair priorities take the priorities
+// of both candidates into account, so the peer prefers the higher priority interface when it is the controlling agent (i.e. when it
+// created the offer). Candidates on the lower priority interfaces are still gathered, so the connection falls back on them when the
+// preferred interface has no candidates or cannot reach the peer
+//
+
+// The difference in local preference between two consecutive interfaces in the priority list
+const interfacePreferenceStep = 1024
+
+// Gather candidates only on the network interfaces with the given names, in order of preference (e.g. "eth0", "wlan0").
+// Must be called before CreatePeerConnection, replaces the interface allowlist (see SetInterfaceAllowlist)
+func (r *RTC) SetInterfacePriority(interfaces []string) error {
+	if err := r.SetInterfaceAllowlist(interfaces); err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.interfacePriority = slices.Clone(interfaces)
+	return nil
+}
+
+// Rewrite the local preference of a local host candidate to the rank of its interface in the interface priority, if set
+func (r *RTC) prioritizeCandidate(candidate webrtc.ICECandidateInit) webrtc.ICECandidateInit {
+	r.lock.Lock()
+	interfaces := r.interfacePriority
+	r.lock.Unlock()
+
+	if len(interfaces) == 0 || candidateType(candidate) != webrtc.ICECandidateTypeHost {
+		return candidate
+	}
+
+	// candidate:<foundation> <component> <protocol> <priority> <address> <port> typ <type> ...
+	fields := strings.Fields(candidate.Candidate)
+	if len(fields) < 6 {
+		return candidate
+	}
+	priority, err := strconv.ParseUint(fields[3], 10, 32)
+	if err != nil {
+		return candidate
+	}
+	rank := slices.Index(interfaces, interfaceOf(fields[4]))
+	if rank < 0 {
+		return candidate
+	}
+
+	// priority = type preference (8 bits) | local preference (16 bits) | 256 - component id (8 bits)
+	localPreference := uint64(max(0xFFFF-rank*interfacePreferenceStep, 0))
+	priority = priority&^(0xFFFF<<8) | localPreference<<8
+	fields[3] = strconv.FormatUint(priority, 10)
+	candidate.Candidate = strings.Join(fields, " ")
+	return candidate
+}
+
+// Returns the name of the local network interface that has the given address, or an empty string if there is none
+func interfaceOf(address string) string {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return ""
+	}
+
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return ""
+	}
+	for _, iface := range interfaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+				return iface.Name
+			}
+		}
+	}
+	return ""
+}
+
+// Returns the name of the local network interface of the selected network path (e.g. to verify which interface won)
+func (r *RTC) SelectedInterface() (string, error) {
+	pair, err := r.SelectedCandidatePair()
+	if err != nil {
+		return "", err
+	}
+	if pair.LocalInterface == "" {
+		return "", fmt.Errorf("Cannot find the interface of local address %s", pair.LocalAddress)
+	}
+	return pair.LocalInterface, nil
+}
@@ -0,0 +1,120 @@
+package rtc_test
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/VU-ASE/roverrtc/src/rtctest"
+	"github.com/pion/webrtc/v4"
+)
+
+// Returns the names and an IPv4 address of the network interfaces that are up, skips the test if there are fewer than want
+func localInterfaces(t *testing.T, want int, loopback bool) ([]string, []string) {
+	t.Helper()
+
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		t.Fatalf("Cannot list network interfaces: %v", err)
+	}
+	var names, addresses []string
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagUp == 0 || (!loopback && iface.Flags&net.FlagLoopback != 0) {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+				names = append(names, iface.Name)
+				addresses = append(addresses, ipNet.IP.String())
+				break
+			}
+		}
+	}
+	if len(names) < want {
+		t.Skipf("Expected %d network interfaces with an IPv4 address, got %d", want, len(names))
+	}
+	return names[:want], addresses[:want]
+}
+
+// Returns the priority of a candidate, parsed from its candidate string
+func candidatePriority(t *testing.T, candidate webrtc.ICECandidateInit) uint64 {
+	t.Helper()
+
+	fields := strings.Fields(candidate.Candidate)
+	priority, err := strconv.ParseUint(fields[3], 10, 32)
+	if err != nil {
+		t.Fatalf("Cannot parse priority of %s: %v", candidate.Candidate, err)
+	}
+	return priority
+}
+
+func TestInterfacePriorityRanksCandidates(t *testing.T) {
+	names, addresses := localInterfaces(t, 2, true)
+	mid := "0"
+
+	for _, order := range [][]int{{0, 1}, {1, 0}} {
+		r := rtc.NewRTC("rover")
+		if err := r.SetInterfacePriority([]string{names[order[0]], names[order[1]]}); err != nil {
+			t.Fatalf("Cannot set interface priority: %v", err)
+		}
+		for i, address := range addresses {
+			r.AddLocalCandidate(webrtc.ICECandidateInit{Candidate: fmt.Sprintf("candidate:%d 1 udp 2130706431 %s 50000 typ host", i, address), SDPMid: &mid})
+		}
+		// A candidate on an unknown address keeps its priority
+		r.AddLocalCandidate(webrtc.ICECandidateInit{Candidate: "candidate:9 1 udp 2130706431 198.51.100.1 50000 typ host", SDPMid: &mid})
+
+		candidates := r.GetAllLocalCandidates()
+		if len(candidates) != 3 {
+			t.Fatalf("Expected 3 candidates, got %d", len(candidates))
+		}
+		preferred, fallback := candidatePriority(t, candidates[order[0]]), candidatePriority(t, candidates[order[1]])
+		if preferred <= fallback {
+			t.Errorf("Expected the candidate on %s to rank above the one on %s, got priorities %d and %d", names[order[0]], names[order[1]], preferred, fallback)
+		}
+		if unknown := candidatePriority(t, candidates[2]); unknown != 2130706431 {
+			t.Errorf("Expected the candidate on an unknown interface to keep its priority, got %d", unknown)
+		}
+	}
+}
+
+func TestInterfaceAllowlistWithoutInterfaces(t *testing.T) {
+	client, _, err := rtc.CreateOffer("client", rtc.WithInterfaceAllowlist("missing0"))
+	if err != nil {
+		t.Fatalf("Cannot create offer: %v", err)
+	}
+	t.Cleanup(func() { client.Destroy() })
+
+	if candidates := client.GetAllLocalCandidates(); len(candidates) != 0 {
+		t.Errorf("Expected no candidates on interfaces that do not exist, got %v", candidates)
+	}
+}
+
+func TestInterfacePriorityFallback(t *testing.T) {
+	names, _ := localInterfaces(t, 1, false)
+
+	// The preferred interface does not exist, so the connection uses the next one
+	client, server := rtctest.NewConnectedPair(t, rtc.WithInterfacePriority([]string{"missing0", names[0]}))
+	for _, peer := range []*rtc.RTC{client, server} {
+		iface, err := peer.SelectedInterface()
+		if err != nil {
+			t.Fatalf("Cannot get selected interface of %s: %v", peer.Id, err)
+		}
+		if iface != names[0] {
+			t.Errorf("Expected %s to connect over %s, got %s", peer.Id, names[0], iface)
+		}
+	}
+}
+
+func TestInterfacePriorityAfterConnectionExists(t *testing.T) {
+	client, _ := rtctest.NewConnectedPair(t)
+	if err := client.SetInterfacePriority([]string{"eth0"}); err == nil {
+		t.Error("Expected an error when setting the interface priority of an existing connection")
+	}
+}
@@ -0,0 +1,66 @@
+package rtc
+
+import (
+	"context"
+	"time"
+)
+
+//
+// This file contains the context-based lifecycle of connections and maps. A connection bound to a context is closed gracefully (see Close)
+// once the context is done, and a map created with a context destroys all its connections and stops its reaper once the context is done.
+// This way, cancelling the application context (e.g. on SIGTERM) tears down every connection without tracking them by hand
+//
+
+// How long a connection bound to a context waits for the peer to acknowledge the close, once the context is done
+const ContextCloseTimeout = time.Second
+
+// Close the connection gracefully (see Close) with CloseReasonContextDone once ctx is done. Stops watching ctx when the connection is
+// destroyed in another way
+func (r *RTC) BindContext(ctx context.Context) {
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-r.closed:
+			return
+		}
+
+		log := r.Log()
+		log.Debug().Err(ctx.Err()).Msg("Context of RTC connection is done")
+		_ = r.Close(CloseReasonContextDone, ContextCloseTimeout)
+	}()
+}
+
+// Create a map (with the default limit) that destroys all its connections once ctx is done. The reaper of the map (see StartReaper)
+// stops then as well, and the map does not accept new connections anymore (see ErrMapClosed). The map stops watching ctx once it is
+// shut down or all its connections are destroyed (see Shutdown and DestroyAll), so that a map that is torn down by hand does not keep
+// a goroutine around for a ctx that is never done. Connections added after DestroyAll are then not destroyed when ctx is done
+func NewRTCMapWithContext(ctx context.Context) *RTCMap {
+	m := NewRTCMap()
+	m.done = ctx.Done()
+	unbind := make(chan struct{})
+	m.unbind = unbind
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-unbind:
+			return
+		}
+
+		log := getDefaultLogger()
+		log.Debug().Err(ctx.Err()).Msg("Context of RTC map is done, destroying all connections")
+		m.lock.Lock()
+		m.closed = true
+		m.lock.Unlock()
+		_ = m.destroyAll(CloseReasonContextDone)
+	}()
+	return m
+}
+
+// Stop watching the context of the map, if it is watched. The caller must hold the lock
+func (m *RTCMap) stopWatching() {
+	if m.unbind != nil {
+		close(m.unbind)
+		m.unbind = nil
+	}
+}
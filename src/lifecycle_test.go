@@ -0,0 +1,104 @@
+package rtc_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/VU-ASE/roverrtc/src/rtctest"
+	"github.com/pion/webrtc/v4"
+	"go.uber.org/goleak"
+)
+
+// Returns a channel that receives the reasons passed to the OnClosed handlers of the connection
+func closeReasons(r *rtc.RTC) <-chan string {
+	reasons := make(chan string, 4)
+	r.OnClosed(func(reason string) { reasons <- reason })
+	return reasons
+}
+
+// Fail the test unless the connection is closed with the given reason within receiveTimeout
+func expectClosed(t *testing.T, r *rtc.RTC, reasons <-chan string, want string) {
+	t.Helper()
+
+	select {
+	case reason := <-reasons:
+		if reason != want {
+			t.Errorf("Expected %s to be closed with reason %q, got %q", r.Id, want, reason)
+		}
+	case <-time.After(receiveTimeout):
+		t.Fatalf("Expected %s to be closed with reason %q", r.Id, want)
+	}
+	if state := r.ConnectionState(); state != webrtc.PeerConnectionStateClosed {
+		t.Errorf("Expected %s to report closed, got %s", r.Id, state)
+	}
+}
+
+func TestWithContextClosesConnections(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client, server := rtctest.NewConnectedPair(t, rtc.WithContext(ctx))
+	peers := map[*rtc.RTC]<-chan string{client: closeReasons(client), server: closeReasons(server)}
+	for peer := range peers {
+		peer.StartKeepalive(context.Background(), 10*time.Millisecond)
+	}
+
+	cancel()
+	for peer, reasons := range peers {
+		expectClosed(t, peer, reasons, rtc.CloseReasonContextDone)
+	}
+}
+
+func TestMapWithContextDestroysConnections(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m := rtc.NewRTCMapWithContext(ctx)
+	m.StartReaper(context.Background(), 10*time.Millisecond)
+	client, server := rtctest.NewConnectedPair(t)
+	peers := map[*rtc.RTC]<-chan string{client: closeReasons(client), server: closeReasons(server)}
+	for peer := range peers {
+		if err := m.AddConnection(peer.Id, peer); err != nil {
+			t.Fatalf("Cannot add %s: %v", peer.Id, err)
+		}
+	}
+
+	cancel()
+	for peer, reasons := range peers {
+		expectClosed(t, peer, reasons, rtc.CloseReasonContextDone)
+	}
+	if count := m.Count(); count != 0 {
+		t.Errorf("Expected an empty map, got %d connections", count)
+	}
+	if err := m.AddConnection("late", rtc.NewRTC("late")); !errors.Is(err, rtc.ErrMapClosed) {
+		t.Errorf("Expected ErrMapClosed after the context is done, got %v", err)
+	}
+}
+
+func TestMapWithContextStopsWatching(t *testing.T) {
+	tests := []struct {
+		name     string
+		teardown func(m *rtc.RTCMap) error
+	}{
+		{"shutdown", func(m *rtc.RTCMap) error { return m.Shutdown(context.Background(), "test") }},
+		{"destroy all", func(m *rtc.RTCMap) error { return m.DestroyAll() }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The context is only done after the check, so the map has to stop watching it once it is torn down
+			ctx, cancel := context.WithCancel(context.Background())
+			t.Cleanup(cancel)
+			defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+			m := rtc.NewRTCMapWithContext(ctx)
+			if err := tt.teardown(m); err != nil {
+				t.Fatalf("Cannot tear down map: %v", err)
+			}
+		})
+	}
+}
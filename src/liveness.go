@@ -0,0 +1,134 @@
+package rtc
+
+import (
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+//
+// This file contains the liveness policy of a connection, which destroys the connection by itself when it stays disconnected for too long
+// (or, with fail-fast, as soon as it fails), instead of leaving it until something else cleans it up. A connection that recovers before the
+// disconnect timeout passes is kept. Every way a connection is destroyed is reported to the OnClosed handlers with a reason, and a connection
+// that is destroyed while in an RTCMap is removed from the map (and reported to its OnRemove handlers)
+//
+
+// The reasons passed to the OnClosed handlers, besides the reason given to Close
+const (
+	CloseReasonDestroyed         = "destroyed"          // the connection was destroyed with Destroy
+	CloseReasonDisconnectTimeout = "disconnect timeout" // the connection was disconnected for longer than the disconnect timeout
+	CloseReasonFailed            = "failed"             // the connection failed and fail-fast is enabled
+	CloseReasonIdleTimeout       = "idle timeout"       // the connection was idle for longer than the idle timeout of its map
+	CloseReasonContextDone       = "context done"       // the context the connection or its map was bound to is done
+)
+
+type closedFunc func(reason string)
+
+// The liveness policy and its pending destroy, guarded by the lock of the connection
+type livenessPolicy struct {
+	disconnectTimeout time.Duration
+	failFast          bool
+	timer             *time.Timer // destroys the connection when the disconnect timeout passes, if pending
+	generation        uint64      // incremented whenever the pending destroy is cancelled, so that a timer that already fired does nothing
+	onClosed          []closedFunc
+}
+
+// Destroy the connection when it is disconnected for longer than timeout (0 disables this, which is the default)
+func (r *RTC) SetDisconnectTimeout(timeout time.Duration) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.liveness.disconnectTimeout = timeout
+}
+
+// Whether to destroy the connection as soon as it fails, instead of waiting for the disconnect timeout. Disabled by default
+func (r *RTC) SetFailFast(enabled bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.liveness.failFast = enabled
+}
+
+// Register a handler that is called with the reason (e.g. CloseReasonDisconnectTimeout, or the reason given to Close) once the connection
+// is destroyed
+func (r *RTC) OnClosed(handler func(reason string)) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.liveness.onClosed = append(r.liveness.onClosed, handler)
+}
+
+// Start or cancel the pending destroy of the connection on a state change
+func (r *RTC) applyLiveness(state webrtc.PeerConnectionState) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	policy := &r.liveness
+	switch state {
+	case webrtc.PeerConnectionStateDisconnected:
+		if policy.disconnectTimeout <= 0 || policy.timer != nil {
+			return
+		}
+		generation := policy.generation
+		policy.timer = time.AfterFunc(policy.disconnectTimeout, func() {
+			r.lock.Lock()
+			cancelled := r.liveness.generation != generation
+			r.liveness.timer = nil
+			r.lock.Unlock()
+			if !cancelled {
+				r.destroy(CloseReasonDisconnectTimeout)
+			}
+		})
+	case webrtc.PeerConnectionStateFailed:
+		if policy.failFast {
+			r.cancelPendingDestroy()
+			// Do not close the peer connection from within its own state change handler
+			go r.destroy(CloseReasonFailed)
+		}
+	default:
+		r.cancelPendingDestroy()
+	}
+}
+
+// Cancel the pending destroy of the connection, the caller must hold the lock
+func (r *RTC) cancelPendingDestroy() {
+	policy := &r.liveness
+	if policy.timer == nil {
+		return
+	}
+	policy.timer.Stop()
+	policy.timer = nil
+	policy.generation++
+
+	log := r.Log()
+	log.Debug().Msg("Cancelled pending destroy, connection is no longer disconnected")
+}
+
+// Pass the reason the connection was destroyed to the OnClosed handlers
+func (r *RTC) notifyClosed(reason string) {
+	r.lock.Lock()
+	handlers := make([]closedFunc, len(r.liveness.onClosed))
+	copy(handlers, r.liveness.onClosed)
+	r.lock.Unlock()
+
+	for _, handler := range handlers {
+		handler(reason)
+	}
+}
+
+// Remove a connection from the map once it is destroyed, unless it was removed or replaced in the meantime
+func (m *RTCMap) removeClosed(id string, rtc *RTC, reason string) {
+	m.lock.Lock()
+	remove := m.rtcMap[id] == rtc
+	if remove {
+		_ = m.remove(id)
+	}
+	m.lock.Unlock()
+	if !remove {
+		return
+	}
+	m.notify()
+
+	log := getDefaultLogger()
+	log.Info().Str("rtcId", id).Str("reason", reason).Msg("Removed closed RTC connection from map")
+}
@@ -0,0 +1,126 @@
+package rtc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// Returns a channel that receives the reasons passed to the OnClosed handlers of the connection
+func closeReasons(r *RTC) <-chan string {
+	reasons := make(chan string, 4)
+	r.OnClosed(func(reason string) { reasons <- reason })
+	return reasons
+}
+
+// Fail the test unless the connection is closed with the given reason within a second
+func expectClosed(t *testing.T, reasons <-chan string, want string) {
+	t.Helper()
+
+	select {
+	case reason := <-reasons:
+		if reason != want {
+			t.Errorf("Expected close reason %q, got %q", want, reason)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Expected the connection to be closed with reason %q", want)
+	}
+}
+
+// Fail the test if the connection is closed within the given time
+func expectNotClosed(t *testing.T, reasons <-chan string, wait time.Duration) {
+	t.Helper()
+
+	select {
+	case reason := <-reasons:
+		t.Errorf("Expected the connection to stay open, it was closed with reason %q", reason)
+	case <-time.After(wait):
+	}
+}
+
+func TestDisconnectTimeout(t *testing.T) {
+	r := NewRTC("rover")
+	r.SetDisconnectTimeout(20 * time.Millisecond)
+	reasons := closeReasons(r)
+
+	r.applyLiveness(webrtc.PeerConnectionStateDisconnected)
+	expectClosed(t, reasons, CloseReasonDisconnectTimeout)
+}
+
+func TestRecoveryCancelsDisconnectTimeout(t *testing.T) {
+	r := NewRTC("rover")
+	t.Cleanup(func() { r.Destroy() })
+	r.SetDisconnectTimeout(50 * time.Millisecond)
+	reasons := closeReasons(r)
+
+	r.applyLiveness(webrtc.PeerConnectionStateDisconnected)
+	r.applyLiveness(webrtc.PeerConnectionStateConnected)
+	expectNotClosed(t, reasons, 150*time.Millisecond)
+
+	// A later disconnect starts a new timeout
+	r.applyLiveness(webrtc.PeerConnectionStateDisconnected)
+	expectClosed(t, reasons, CloseReasonDisconnectTimeout)
+}
+
+func TestRecoveryWhileTimeoutFires(t *testing.T) {
+	r := NewRTC("rover")
+	t.Cleanup(func() { r.Destroy() })
+	r.SetDisconnectTimeout(10 * time.Millisecond)
+	reasons := closeReasons(r)
+
+	r.applyLiveness(webrtc.PeerConnectionStateDisconnected)
+	// The timer fires while the connection recovers, and waits for the lock that the state change holds
+	r.lock.Lock()
+	time.Sleep(50 * time.Millisecond)
+	r.cancelPendingDestroy()
+	r.lock.Unlock()
+
+	expectNotClosed(t, reasons, 100*time.Millisecond)
+}
+
+func TestFailFast(t *testing.T) {
+	r := NewRTC("rover")
+	t.Cleanup(func() { r.Destroy() })
+	r.SetDisconnectTimeout(time.Hour)
+	reasons := closeReasons(r)
+
+	// Without fail-fast a failed connection waits for the disconnect timeout
+	r.applyLiveness(webrtc.PeerConnectionStateFailed)
+	expectNotClosed(t, reasons, 50*time.Millisecond)
+
+	r.SetFailFast(true)
+	r.applyLiveness(webrtc.PeerConnectionStateDisconnected)
+	r.applyLiveness(webrtc.PeerConnectionStateFailed)
+	expectClosed(t, reasons, CloseReasonFailed)
+	// The pending disconnect timeout was cancelled, the connection is closed once
+	expectNotClosed(t, reasons, 50*time.Millisecond)
+}
+
+func TestDisconnectTimeoutRemovesFromMap(t *testing.T) {
+	m := NewRTCMap()
+	r := NewRTC("rover")
+	if err := r.CreatePeerConnection(webrtc.Configuration{}); err != nil {
+		t.Fatalf("Cannot create peer connection: %v", err)
+	}
+	t.Cleanup(func() { r.Destroy() })
+	r.SetDisconnectTimeout(20 * time.Millisecond)
+	if err := m.AddConnection("rover", r); err != nil {
+		t.Fatalf("Cannot add connection: %v", err)
+	}
+	removed := make(chan string, 1)
+	m.OnRemove(func(id string) { removed <- id })
+
+	r.applyLiveness(webrtc.PeerConnectionStateDisconnected)
+	select {
+	case id := <-removed:
+		if id != "rover" {
+			t.Errorf("Expected rover to be removed, got %s", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the destroyed connection to be removed from the map")
+	}
+	if m.Get("rover") != nil {
+		t.Error("Expected the map to no longer contain the connection")
+	}
+}
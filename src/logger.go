@@ -0,0 +1,40 @@
+package rtc
+
+import (
+	"sync"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+//
+// This file contains the base logger of the package, which can be replaced to redirect all RTC logging (e.g. into the logging pipeline of the application)
+//
+
+var defaultLoggerLock sync.RWMutex
+var defaultLogger *zerolog.Logger // nil means the zerolog global logger is used
+
+// Replace the package logger that is used by all connections and maps, instead of the zerolog global logger (e.g. to route RTC logs
+// to a separate file, or zerolog.Nop() to silence them in tests). A connection created with the WithLogger option uses its own logger instead
+func SetLogger(l zerolog.Logger) {
+	defaultLoggerLock.Lock()
+	defer defaultLoggerLock.Unlock()
+
+	defaultLogger = &l
+}
+
+// Deprecated: use SetLogger
+func SetDefaultLogger(l zerolog.Logger) {
+	SetLogger(l)
+}
+
+// Returns the base logger of the package
+func getDefaultLogger() zerolog.Logger {
+	defaultLoggerLock.RLock()
+	defer defaultLoggerLock.RUnlock()
+
+	if defaultLogger == nil {
+		return log.Logger
+	}
+	return *defaultLogger
+}
@@ -0,0 +1,100 @@
+package rtc_test
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// A buffer that loggers on several goroutines can write to
+type logBuffer struct {
+	lock *sync.Mutex
+	buf  bytes.Buffer
+}
+
+func newLogBuffer() *logBuffer {
+	var lock sync.Mutex
+	return &logBuffer{lock: &lock}
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.buf.String()
+}
+
+func TestLoggers(t *testing.T) {
+	global, pkg, instance := newLogBuffer(), newLogBuffer(), newLogBuffer()
+	previous := log.Logger
+	log.Logger = zerolog.New(global)
+	rtc.SetLogger(zerolog.New(pkg))
+	t.Cleanup(func() {
+		log.Logger = previous
+		rtc.SetLogger(zerolog.Nop())
+	})
+
+	m := rtc.NewRTCMap()
+	r, err := rtc.NewRTCWithOptions("rover", rtc.WithLogger(zerolog.New(instance)))
+	if err != nil {
+		t.Fatalf("Cannot create connection: %v", err)
+	}
+	if err := m.AddConnection("rover", r); err != nil {
+		t.Fatalf("Cannot add connection: %v", err)
+	}
+	if err := m.Remove("rover"); err != nil {
+		t.Fatalf("Cannot remove connection: %v", err)
+	}
+	fallback := rtc.NewRTC("spectator")
+	fallback.SetDataChannel(rtc.NewMockChannel(rtc.DataChannelLabel))
+	fallback.Destroy()
+
+	if !strings.Contains(instance.String(), `"connectionId":"rover"`) {
+		t.Errorf("Expected the connection to log to its own logger, got %q", instance.String())
+	}
+	if strings.Contains(pkg.String(), `"connectionId":"rover"`) {
+		t.Errorf("Expected the connection with its own logger to not log to the package logger, got %q", pkg.String())
+	}
+	if !strings.Contains(pkg.String(), `"connectionId":"spectator"`) {
+		t.Errorf("Expected the connection without its own logger to log to the package logger, got %q", pkg.String())
+	}
+	if !strings.Contains(pkg.String(), "Added RTC connection to map") {
+		t.Errorf("Expected the map to log to the package logger, got %q", pkg.String())
+	}
+	if output := global.String(); output != "" {
+		t.Errorf("Expected nothing to be written to the global logger, got %q", output)
+	}
+}
+
+func TestSetDefaultLoggerAppliesToExistingConnections(t *testing.T) {
+	first, second := newLogBuffer(), newLogBuffer()
+	t.Cleanup(func() { rtc.SetLogger(zerolog.Nop()) })
+
+	rtc.SetDefaultLogger(zerolog.New(first))
+	r := rtc.NewRTC("rover")
+	r.SetDataChannel(rtc.NewMockChannel(rtc.DataChannelLabel))
+
+	// Replacing the logger redirects the logs of connections that already exist
+	before := first.String()
+	rtc.SetDefaultLogger(zerolog.New(second))
+	r.Destroy()
+
+	if after := first.String(); after != before {
+		t.Errorf("Expected the replaced logger to no longer be used, got %q", strings.TrimPrefix(after, before))
+	}
+	if !strings.Contains(second.String(), `"connectionId":"rover"`) {
+		t.Errorf("Expected the existing connection to log to the new logger, got %q", second.String())
+	}
+}
@@ -0,0 +1,15 @@
+package rtc_test
+
+import (
+	"os"
+	"testing"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/rs/zerolog"
+)
+
+// Silence the logs of the package, tests that check the logs install their own logger
+func TestMain(m *testing.M) {
+	rtc.SetLogger(zerolog.Nop())
+	os.Exit(m.Run())
+}
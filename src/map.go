@@ -1,11 +1,14 @@
 package rtc
 
 import (
+	"context"
+	"errors"
 	"fmt"
-
-	"github.com/rs/zerolog/log"
-
+	"slices"
 	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
 
 	"github.com/pion/webrtc/v4"
 )
@@ -16,63 +19,236 @@ import (
 //
 
 type RTCMap struct {
-	rtcMap map[string]*RTC // id -> RTC
-	lock   *sync.RWMutex
+	rtcMap           map[string]*RTC // id -> RTC
+	lock             *sync.RWMutex
+	anonymousSeq     int             // the sequence number of the last generated anonymous id
+	broadcastsPaused atomic.Bool     // whether the Broadcast* methods are no-ops
+	draining         bool            // whether new (non-car) connections are rejected
+	drained          int             // the number of connections removed since draining started
+	acceptLimiter    *tokenBucket    // limits the rate at which new (non-car) connections are accepted, if set
+	limit            int             // the maximum number of connections, privileged connections can be added beyond it (0 means unlimited)
+	reaperGrace      time.Duration   // how long a connection may be dead before the reaper evicts it
+	onEvicted        func(id string) // called for every connection evicted by the reaper
+	onReconnected    reconnectedFunc // called when a connection is replaced by Replace
+	onAdd            []addFunc       // called for every connection added to the map
+	onRemove         []removeFunc    // called for every connection removed from the map
+	pendingEvents    []mapEvent      // the changes that are not yet passed to the OnAdd and OnRemove handlers
+	delivering       bool            // whether a goroutine is passing the pending changes to the handlers
+	creating         creations       // the creations in progress by GetOrCreate
+	replay           *replayCache    // the signaling requests recently accepted for this map
+	idleTimeout      time.Duration   // how long a (non-car) connection may be idle before the reaper closes it (0 means forever)
+	done             <-chan struct{} // closed when the context of the map is done, if created with one
+	unbind           chan struct{}   // closed to stop watching the context of the map (nil if there is none, or it is not watched anymore)
+	closed           bool            // whether the map was shut down, after which it does not accept new connections
+	changed          chan struct{}   // closed (and replaced) whenever connections are added or removed, to wake up WaitAll
 }
 
+// The maximum number of connections in a map created with NewRTCMap
+const DefaultMaxConnections = 20
+
+var (
+	// The map is draining and does not accept new connections
+	ErrDraining = errors.New("Map is draining, no new connections are accepted")
+	// New connections are accepted faster than the configured rate, the client should retry with backoff
+	ErrAcceptThrottled = errors.New("Too many new connections, try again later")
+	// The map holds the maximum number of connections
+	ErrMapFull = errors.New("Maximum number of connections reached")
+	// The map already holds an active connection with the same id
+	ErrConnectionExists = errors.New("An active connection with this id already exists")
+)
+
 func NewRTCMap() *RTCMap {
+	return NewRTCMapWithLimit(DefaultMaxConnections)
+}
+
+// Create a map that holds at most limit connections (0 means unlimited). Privileged connections (see Role) do not count towards the limit
+func NewRTCMapWithLimit(limit int) *RTCMap {
 	var lock sync.RWMutex
 	rtcMap := make(map[string]*RTC)
 
 	return &RTCMap{
-		rtcMap: rtcMap,
-		lock:   &lock,
+		rtcMap:      rtcMap,
+		lock:        &lock,
+		creating:    make(creations),
+		replay:      newReplayCache(),
+		limit:       limit,
+		reaperGrace: DefaultReaperGracePeriod,
+		changed:     make(chan struct{}),
 	}
 }
 
-// Remove an RTC connection from the map
+// Remove an RTC connection from the map and destroy it. Returns the error of Destroy, the connection is removed from the map regardless
 func (m *RTCMap) Remove(id string) error {
 	m.lock.Lock()
-	defer m.lock.Unlock()
+	conn := m.rtcMap[id]
+	err := m.remove(id)
+	m.lock.Unlock()
+
+	if err != nil {
+		return err
+	}
+	m.notify()
+	// Destroy outside of the lock, closing the connection can take a while
+	return conn.Destroy()
+}
 
+// Removes an RTC connection from the map without destroying it, the caller must hold the lock
+func (m *RTCMap) remove(id string) error {
 	conn := m.rtcMap[id]
 	if conn == nil {
 		return fmt.Errorf("Connection with id %s does not exist", id)
 	}
 
 	delete(m.rtcMap, id)
+	if m.draining {
+		m.drained++
+	}
+	m.recordRemoved(id, conn)
+	log := getDefaultLogger()
 	log.Debug().Str("rtcId", id).Msg("Removed RTC connection from map")
 	return nil
 }
 
+// Add an RTC connection to the map. If isCar is set, the connection gets the car role (see AddConnection). The role is only changed
+// if the connection is added
 func (m *RTCMap) Add(id string, rtc *RTC, isCar bool) error {
+	if !isCar {
+		return m.AddConnection(id, rtc)
+	}
+
+	// The role decides whether the connection is added, so it is set before adding and restored if that fails
+	role := rtc.Role()
+	rtc.SetRole(RoleCar)
+	if err := m.AddConnection(id, rtc); err != nil {
+		rtc.SetRole(role)
+		return err
+	}
+	return nil
+}
+
+// Add an RTC connection to the map. Whether it counts towards the limit, and can be added while draining or throttled, depends on its role
+func (m *RTCMap) AddConnection(id string, rtc *RTC) error {
 	m.lock.Lock()
-	defer m.lock.Unlock()
+	err := m.add(id, rtc)
+	m.lock.Unlock()
 
-	maxLength := 10
+	m.notify()
+	return err
+}
 
-	if len(m.rtcMap) >= maxLength && !isCar {
-		return fmt.Errorf("Maximum number of connections reached")
+// Adds an RTC connection to the map, the caller must hold the lock
+func (m *RTCMap) add(id string, rtc *RTC) error {
+	privileged := rtc.Role().Privileged()
+	if err := m.canAdd(id, privileged); err != nil {
+		return err
 	}
 
 	existingEntry := m.rtcMap[id]
-	if existingEntry != nil && existingEntry.Pc.ConnectionState() != webrtc.PeerConnectionStateClosed && existingEntry.Pc.ConnectionState() != webrtc.PeerConnectionStateDisconnected {
-		return fmt.Errorf("An active connection with id %s already exists.", id)
+	if m.acceptLimiter != nil && !privileged && !m.acceptLimiter.allow() {
+		return ErrAcceptThrottled
 	}
 
-	// Remove the entry (so that the connection is properly closed)
+	// Remove the entry and close its connection (in the background, as the caller holds the lock)
 	if existingEntry != nil {
-		err := m.Remove(id)
+		err := m.remove(id)
 		if err != nil {
 			return err
 		}
+		if existingEntry != rtc {
+			go existingEntry.Destroy()
+		}
 	}
 
 	m.rtcMap[id] = rtc
+	rtc.OnClosed(func(reason string) {
+		m.removeClosed(id, rtc, reason)
+	})
+	m.recordAdded(id, rtc)
+	log := getDefaultLogger()
 	log.Debug().Str("rtcId", id).Msg("Added RTC connection to map")
 	return nil
 }
 
+// Returns why a connection with the given id (and privileged role or not) cannot be added right now, or nil if it can. Nothing is added,
+// so that the signaling handler can reject an offer before setting up its connection
+func (m *RTCMap) checkAdd(id string, privileged bool) error {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return m.canAdd(id, privileged)
+}
+
+// Returns why a connection cannot be added, the caller must hold the lock. The accept limiter is not consulted, as that takes a token
+func (m *RTCMap) canAdd(id string, privileged bool) error {
+	if m.closed {
+		return ErrMapClosed
+	}
+	if m.draining && !privileged {
+		return ErrDraining
+	}
+	if m.limit > 0 && !privileged && m.countUnprivileged(id) >= m.limit {
+		return ErrMapFull
+	}
+	if existing := m.rtcMap[id]; existing != nil && isActive(existing) {
+		return fmt.Errorf("%w: %s", ErrConnectionExists, id)
+	}
+	return nil
+}
+
+// Returns the number of connections that count towards the limit, other than the one with the given id (which a new connection
+// with this id replaces). The caller must hold the lock
+func (m *RTCMap) countUnprivileged(id string) int {
+	count := 0
+	for otherId, rtc := range m.rtcMap {
+		if otherId != id && !rtc.Role().Privileged() {
+			count++
+		}
+	}
+	return count
+}
+
+// Whether an existing connection blocks a new connection with the same id. A connection without a peer connection (e.g. one
+// that is still in the signaling exchange) is not active, so that a client that quickly re-sends its offer can replace it
+func isActive(rtc *RTC) bool {
+	if rtc.peerConnection() == nil {
+		return false
+	}
+	state := rtc.ConnectionState()
+	return state != webrtc.PeerConnectionStateClosed && state != webrtc.PeerConnectionStateDisconnected
+}
+
+// Adds an RTC connection that did not provide an id (e.g. a spectator). A unique id is generated ("anonymous-1", "anonymous-2", ...),
+// checked against the map under the lock, and set on the connection. If isCar is set, the connection gets the car role. The id and role
+// are only changed if the connection is added
+func (m *RTCMap) AddAnonymous(rtc *RTC, isCar bool) (string, error) {
+	defer m.notify()
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var id string
+	for {
+		m.anonymousSeq++
+		id = fmt.Sprintf("anonymous-%d", m.anonymousSeq)
+		if m.rtcMap[id] == nil {
+			break
+		}
+	}
+
+	// The id is set before adding, so that the connection is never in the map under an id it does not know
+	oldId := rtc.Id
+	role := rtc.Role()
+	rtc.Id = id
+	if isCar {
+		rtc.SetRole(RoleCar)
+	}
+	if err := m.add(id, rtc); err != nil {
+		rtc.Id = oldId
+		rtc.SetRole(role)
+		return "", err
+	}
+	return id, nil
+}
+
 // Returns a pointer to the RTC connection with the given id (concurrency-safe)
 func (m *RTCMap) Get(id string) *RTC {
 	m.lock.RLock()
@@ -83,12 +259,12 @@ func (m *RTCMap) Get(id string) *RTC {
 	return rtc
 }
 
-// Returns a copy of all Ids in the map (concurrency-safe)
+// Returns a copy of all Ids in the map (concurrency-safe). The ids are in no particular order, use GetAllIdsSorted for a stable order
 func (m *RTCMap) GetAllIds() []string {
 	m.lock.RLock()
 	defer m.lock.RUnlock()
 
-	ids := make([]string, 0)
+	ids := make([]string, 0, len(m.rtcMap))
 	for id := range m.rtcMap {
 		ids = append(ids, id)
 	}
@@ -96,6 +272,13 @@ func (m *RTCMap) GetAllIds() []string {
 	return ids
 }
 
+// Returns a copy of all Ids in the map in lexicographic order (concurrency-safe)
+func (m *RTCMap) GetAllIdsSorted() []string {
+	ids := m.GetAllIds()
+	slices.Sort(ids)
+	return ids
+}
+
 // Returns a list of all RTC connections in the map. Locks when reading the map but returns a list of pointers.
 // If you want to execute a function for each RTC connection, use ForEach instead.
 func (m *RTCMap) UnsafeGetAll() []*RTC {
@@ -110,13 +293,209 @@ func (m *RTCMap) UnsafeGetAll() []*RTC {
 	return rtcList
 }
 
-// Executes a function for each RTC connection in the map
-// Because the RTCMap is read locked during execution, this is concurrency-safe
+// Executes a function for each RTC connection in the map, in no particular order (use ForEachOrdered for a stable order)
+// The function is executed on a snapshot of the map that is taken under the read lock, so it is concurrency-safe and
+// the function can safely modify the map (e.g. Remove the connection)
 func (m *RTCMap) ForEach(f func(id string, rtc *RTC)) {
 	m.lock.RLock()
-	defer m.lock.RUnlock()
-
+	snapshot := make(map[string]*RTC, len(m.rtcMap))
 	for id, rtc := range m.rtcMap {
+		snapshot[id] = rtc
+	}
+	m.lock.RUnlock()
+
+	for id, rtc := range snapshot {
 		f(id, rtc)
 	}
 }
+
+// Same as ForEach, but visits the connections in lexicographic order of their ids
+func (m *RTCMap) ForEachOrdered(f func(id string, rtc *RTC)) {
+	m.lock.RLock()
+	snapshot := make(map[string]*RTC, len(m.rtcMap))
+	for id, rtc := range m.rtcMap {
+		snapshot[id] = rtc
+	}
+	m.lock.RUnlock()
+
+	ids := make([]string, 0, len(snapshot))
+	for id := range snapshot {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	for _, id := range ids {
+		f(id, snapshot[id])
+	}
+}
+
+// Same as ForEach, but only executes the function for connections that are connected (skipping connections without a peer connection)
+func (m *RTCMap) ForEachConnected(f func(id string, rtc *RTC)) {
+	m.ForEach(func(id string, rtc *RTC) {
+		if rtc.IsConnected() {
+			f(id, rtc)
+		}
+	})
+}
+
+// Returns the number of connections in the map
+func (m *RTCMap) Count() int {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return len(m.rtcMap)
+}
+
+// Returns the number of connections in the map that are connected
+func (m *RTCMap) CountConnected() int {
+	count := 0
+	m.ForEachConnected(func(id string, rtc *RTC) {
+		count++
+	})
+	return count
+}
+
+// Destroy all RTC connections in the map and empty it (e.g. on shutdown). Returns the errors of destroying them joined together
+func (m *RTCMap) DestroyAll() error {
+	return m.destroyAll(CloseReasonDestroyed)
+}
+
+// Destroy all RTC connections in the map with the given reason (see OnClosed) and empty it
+func (m *RTCMap) destroyAll(reason string) error {
+	m.lock.Lock()
+	m.stopWatching()
+	conns := m.rtcMap
+	m.rtcMap = make(map[string]*RTC)
+	if m.draining {
+		m.drained += len(conns)
+	}
+	for id, rtc := range conns {
+		m.recordRemoved(id, rtc)
+	}
+	m.lock.Unlock()
+	m.notify()
+
+	var errs []error
+	for _, rtc := range conns {
+		if err := rtc.destroy(reason); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	log := getDefaultLogger()
+	log.Debug().Int("connections", len(conns)).Msg("Destroyed all RTC connections in map")
+	return errors.Join(errs...)
+}
+
+// Moves the RTC connection with the given id from one map to another (e.g. from a "lobby" to an "active" map), without a moment
+// in which the connection is in neither map. Both maps are locked in a consistent order, so concurrent migrations cannot deadlock.
+// The destination map applies the same rules as Add, so migrating fails if it is full or already holds an active connection with this id
+func MigrateConnection(from, to *RTCMap, id string) error {
+	if from == to {
+		return fmt.Errorf("Cannot migrate connection with id %s to the map it is already in", id)
+	}
+
+	defer to.notify()
+	defer from.notify()
+
+	first, second := from, to
+	if uintptr(unsafe.Pointer(second)) < uintptr(unsafe.Pointer(first)) {
+		first, second = second, first
+	}
+	first.lock.Lock()
+	defer first.lock.Unlock()
+	second.lock.Lock()
+	defer second.lock.Unlock()
+
+	rtc := from.rtcMap[id]
+	if rtc == nil {
+		return fmt.Errorf("Connection with id %s does not exist", id)
+	}
+
+	if err := to.add(id, rtc); err != nil {
+		return err
+	}
+	return from.remove(id)
+}
+
+// Blocks until every connection in the map satisfies pred (e.g. IsConnected), or returns the context error when ctx is done.
+// The predicate is checked against the connections that are in the map at the moment of each check: connections that are added
+// during the wait must satisfy it as well, and connections that are removed no longer have to. An empty map satisfies any predicate.
+// The predicate is checked again whenever connections are added or removed, or the first connection that does not satisfy it changes
+// its state (i.e. its connection state changes or one of its channels opens or closes), so it should only depend on those
+func (m *RTCMap) WaitAll(ctx context.Context, pred func(*RTC) bool) error {
+	for {
+		m.lock.RLock()
+		changed := m.changed
+		conns := make([]*RTC, 0, len(m.rtcMap))
+		for _, rtc := range m.rtcMap {
+			conns = append(conns, rtc)
+		}
+		m.lock.RUnlock()
+
+		// The state change signal is taken before the predicate is checked, so that a change in between is not missed
+		var unsatisfied <-chan struct{}
+		for _, rtc := range conns {
+			rtc.hookStateChange()
+			rtc.lock.Lock()
+			stateChanged := rtc.stateChanged
+			rtc.lock.Unlock()
+
+			if !pred(rtc) {
+				unsatisfied = stateChanged
+				break
+			}
+		}
+		if unsatisfied == nil {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-unsatisfied:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Start draining the map (e.g. before a rolling restart): Add rejects new non-car connections with ErrDraining,
+// while the existing connections and the car are left untouched until they close by themselves
+func (m *RTCMap) StartDraining() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.draining {
+		return
+	}
+	m.draining = true
+	m.drained = 0
+
+	log := getDefaultLogger()
+	log.Info().Int("connections", len(m.rtcMap)).Msg("Started draining RTC connections")
+}
+
+// Returns the number of connections that were removed since draining started, to monitor the progress of draining
+func (m *RTCMap) DrainedCount() int {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return m.drained
+}
+
+// Limit the rate at which Add accepts new connections to perSecond, with bursts of up to burst connections. Connections beyond the rate
+// are rejected with ErrAcceptThrottled, cars are never throttled. Pass a rate of 0 to disable throttling. A burst below 1 would reject
+// every connection, so it is raised to 1
+func (m *RTCMap) SetAcceptRate(perSecond float64, burst int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.acceptLimiter = nil
+	if perSecond > 0 {
+		if burst < 1 {
+			log := getDefaultLogger()
+			log.Warn().Int("burst", burst).Msg("Accept rate burst is below 1, using a burst of 1")
+			burst = 1
+		}
+		m.acceptLimiter = newTokenBucket(perSecond, burst)
+	}
+}
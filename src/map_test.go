@@ -0,0 +1,575 @@
+package rtc_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/pion/webrtc/v4"
+)
+
+func TestMapConcurrentAccess(t *testing.T) {
+	m := rtc.NewRTCMapWithLimit(0)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			id := fmt.Sprintf("client-%d", i%10)
+			for j := 0; j < 20; j++ {
+				_ = m.AddConnection(id, rtc.NewRTC(id))
+				_ = m.Get(id)
+				_ = m.GetAllIds()
+				_ = m.UnsafeGetAll()
+				m.ForEach(func(id string, r *rtc.RTC) {
+					if j%5 == 0 {
+						_ = m.Remove(id)
+					}
+				})
+				_ = m.Remove(id)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if count := m.Count(); count != 0 {
+		t.Errorf("Expected an empty map, got %d connections", count)
+	}
+}
+
+func TestAddReplacesConnectionWithoutPeerConnection(t *testing.T) {
+	m := rtc.NewRTCMap()
+	first := rtc.NewRTC("client")
+	if err := m.AddConnection("client", first); err != nil {
+		t.Fatalf("Cannot add first connection: %v", err)
+	}
+
+	second := rtc.NewRTC("client")
+	if err := m.AddConnection("client", second); err != nil {
+		t.Fatalf("Cannot replace connection without peer connection: %v", err)
+	}
+	if got := m.Get("client"); got != second {
+		t.Error("Expected the second connection to replace the first")
+	}
+	if count := m.Count(); count != 1 {
+		t.Errorf("Expected 1 connection, got %d", count)
+	}
+}
+
+func TestRemoveDestroysConnection(t *testing.T) {
+	m := rtc.NewRTCMap()
+	connectToMap(t, m, "a", "b", "c")
+	pc := m.Get("a").Pc
+
+	if err := m.Remove("a"); err != nil {
+		t.Fatalf("Cannot remove connection: %v", err)
+	}
+	if m.Get("a") != nil {
+		t.Error("Expected the connection to be removed from the map")
+	}
+	if state := pc.ConnectionState(); state != webrtc.PeerConnectionStateClosed {
+		t.Errorf("Expected the removed connection to be closed, got %s", state)
+	}
+}
+
+func TestDestroyAll(t *testing.T) {
+	m := rtc.NewRTCMap()
+	connectToMap(t, m, "a", "b", "c")
+	var pcs []*webrtc.PeerConnection
+	m.ForEach(func(id string, r *rtc.RTC) {
+		pcs = append(pcs, r.Pc)
+	})
+
+	if err := m.DestroyAll(); err != nil {
+		t.Fatalf("Cannot destroy all connections: %v", err)
+	}
+	if count := m.Count(); count != 0 {
+		t.Errorf("Expected an empty map, got %d connections", count)
+	}
+	for _, pc := range pcs {
+		if state := pc.ConnectionState(); state != webrtc.PeerConnectionStateClosed {
+			t.Errorf("Expected every connection to be closed, got %s", state)
+		}
+	}
+}
+
+func TestForEachRemovesInsideCallback(t *testing.T) {
+	m := rtc.NewRTCMapWithLimit(0)
+	for i := 0; i < 20; i++ {
+		id := fmt.Sprintf("client-%d", i)
+		if err := m.AddConnection(id, rtc.NewRTC(id)); err != nil {
+			t.Fatalf("Cannot add %s: %v", id, err)
+		}
+	}
+
+	visited := 0
+	m.ForEach(func(id string, r *rtc.RTC) {
+		visited++
+		if err := m.Remove(id); err != nil {
+			t.Errorf("Cannot remove %s inside the callback: %v", id, err)
+		}
+	})
+	if visited != 20 {
+		t.Errorf("Expected every connection of the snapshot to be visited, visited %d", visited)
+	}
+	if count := m.Count(); count != 0 {
+		t.Errorf("Expected an empty map, got %d connections", count)
+	}
+}
+
+func TestForEachConnected(t *testing.T) {
+	m := rtc.NewRTCMap()
+	connectToMap(t, m, "operator")
+	if err := m.AddConnection("fresh", rtc.NewRTC("fresh")); err != nil {
+		t.Fatalf("Cannot add connection without peer connection: %v", err)
+	}
+	pending := rtc.NewRTC("pending")
+	if err := pending.CreatePeerConnection(webrtc.Configuration{}); err != nil {
+		t.Fatalf("Cannot create peer connection: %v", err)
+	}
+	t.Cleanup(func() { pending.Destroy() })
+	if err := m.AddConnection("pending", pending); err != nil {
+		t.Fatalf("Cannot add pending connection: %v", err)
+	}
+
+	var visited []string
+	m.ForEachConnected(func(id string, r *rtc.RTC) {
+		visited = append(visited, id)
+	})
+	if len(visited) != 1 || visited[0] != "operator" {
+		t.Errorf("Expected only the connected connection to be visited, visited %v", visited)
+	}
+	if count := m.Count(); count != 3 {
+		t.Errorf("Expected 3 connections, got %d", count)
+	}
+	if count := m.CountConnected(); count != 1 {
+		t.Errorf("Expected 1 connected connection, got %d", count)
+	}
+}
+
+func TestOrderedIteration(t *testing.T) {
+	m := rtc.NewRTCMapWithLimit(0)
+	for _, id := range []string{"rover-2", "operator", "rover-10", "anonymous-1", "rover-1"} {
+		if err := m.AddConnection(id, rtc.NewRTC(id)); err != nil {
+			t.Fatalf("Cannot add %s: %v", id, err)
+		}
+	}
+	want := []string{"anonymous-1", "operator", "rover-1", "rover-10", "rover-2"}
+
+	if ids := m.GetAllIdsSorted(); !slices.Equal(ids, want) {
+		t.Errorf("Expected sorted ids %v, got %v", want, ids)
+	}
+	var visited []string
+	m.ForEachOrdered(func(id string, r *rtc.RTC) {
+		if r.Id != id {
+			t.Errorf("Expected connection %s, got %s", id, r.Id)
+		}
+		visited = append(visited, id)
+		// Removing inside the callback does not affect the order of the snapshot
+		_ = m.Remove(id)
+	})
+	if !slices.Equal(visited, want) {
+		t.Errorf("Expected the connections to be visited in order %v, got %v", want, visited)
+	}
+	if ids := m.GetAllIdsSorted(); len(ids) != 0 {
+		t.Errorf("Expected no ids after removing all connections, got %v", ids)
+	}
+}
+
+func TestFailedAddKeepsRole(t *testing.T) {
+	m := rtc.NewRTCMap()
+	connectToMap(t, m, "car")
+
+	// The id is taken by an active connection
+	r := rtc.NewRTC("car")
+	if err := m.Add("car", r, true); !errors.Is(err, rtc.ErrConnectionExists) {
+		t.Fatalf("Expected ErrConnectionExists, got %v", err)
+	}
+	if r.Role() != rtc.RoleOperator {
+		t.Errorf("Expected the role to be restored to %s, got %s", rtc.RoleOperator, r.Role())
+	}
+
+	// The map no longer accepts connections
+	if err := m.Shutdown(context.Background(), "test"); err != nil {
+		t.Fatalf("Cannot shut down map: %v", err)
+	}
+	anonymous := rtc.NewRTC("spectator")
+	anonymous.SetRole(rtc.RoleSpectator)
+	if _, err := m.AddAnonymous(anonymous, true); !errors.Is(err, rtc.ErrMapClosed) {
+		t.Fatalf("Expected ErrMapClosed, got %v", err)
+	}
+	if anonymous.Role() != rtc.RoleSpectator || anonymous.Id != "spectator" {
+		t.Errorf("Expected the role and id to be restored, got %s and %s", anonymous.Role(), anonymous.Id)
+	}
+}
+
+func TestReplaceOnClosedMap(t *testing.T) {
+	m := rtc.NewRTCMap()
+	old := rtc.NewRTC("client")
+	if err := m.AddConnection("client", old); err != nil {
+		t.Fatalf("Cannot add connection: %v", err)
+	}
+	m.MarkClosed()
+
+	replacement := rtc.NewRTC("client")
+	if err := m.Replace("client", replacement); !errors.Is(err, rtc.ErrMapClosed) {
+		t.Fatalf("Expected ErrMapClosed, got %v", err)
+	}
+	if m.Get("client") != old {
+		t.Error("Expected the existing connection to stay in the map")
+	}
+}
+
+func TestMigrateConnection(t *testing.T) {
+	lobby, active := rtc.NewRTCMap(), rtc.NewRTCMap()
+	connectToMap(t, lobby, "car")
+	server := lobby.Get("car")
+
+	if err := rtc.MigrateConnection(lobby, active, "car"); err != nil {
+		t.Fatalf("Cannot migrate connection: %v", err)
+	}
+	if lobby.Get("car") != nil {
+		t.Error("Expected the connection to be removed from the source map")
+	}
+	if active.Get("car") != server {
+		t.Error("Expected the connection to be in the destination map")
+	}
+	// Migrating does not destroy the connection
+	if !server.IsConnected() {
+		t.Error("Expected the migrated connection to stay connected")
+	}
+
+	// Once closed, the connection is removed from the map it was migrated to
+	removed := make(chan string, 1)
+	active.OnRemove(func(id string) { removed <- id })
+	if err := server.Destroy(); err != nil {
+		t.Fatalf("Cannot destroy connection: %v", err)
+	}
+	select {
+	case id := <-removed:
+		if id != "car" {
+			t.Errorf("Expected car to be removed, got %s", id)
+		}
+	case <-time.After(receiveTimeout):
+		t.Fatal("Expected the closed connection to be removed from the destination map")
+	}
+}
+
+func TestMigrateConnectionFails(t *testing.T) {
+	lobby, active := rtc.NewRTCMap(), rtc.NewRTCMapWithLimit(1)
+	connectToMap(t, lobby, "car", "operator")
+	connectToMap(t, active, "spectator")
+
+	if err := rtc.MigrateConnection(lobby, lobby, "car"); err == nil {
+		t.Error("Expected an error when migrating to the same map")
+	}
+	if err := rtc.MigrateConnection(lobby, active, "unknown"); err == nil {
+		t.Error("Expected an error when migrating an unknown connection")
+	}
+	// The destination map is full, so the connection stays where it was
+	car := lobby.Get("car")
+	if err := rtc.MigrateConnection(lobby, active, "car"); !errors.Is(err, rtc.ErrMapFull) {
+		t.Fatalf("Expected ErrMapFull, got %v", err)
+	}
+	if lobby.Get("car") != car || active.Get("car") != nil {
+		t.Error("Expected a failed migration to keep the connection in the source map")
+	}
+}
+
+func TestMigrateConnectionConcurrently(t *testing.T) {
+	a, b := rtc.NewRTCMapWithLimit(0), rtc.NewRTCMapWithLimit(0)
+	for i := 0; i < 10; i++ {
+		id := fmt.Sprintf("client-%d", i)
+		if err := a.AddConnection(id, rtc.NewRTC(id)); err != nil {
+			t.Fatalf("Cannot add connection %s: %v", id, err)
+		}
+	}
+
+	// Migrations in opposite directions lock the maps in the same order, so they cannot deadlock
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		id := fmt.Sprintf("client-%d", i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				_ = rtc.MigrateConnection(a, b, id)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				_ = rtc.MigrateConnection(b, a, id)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if count := a.Count() + b.Count(); count != 10 {
+		t.Errorf("Expected 10 connections across both maps, got %d", count)
+	}
+}
+
+func TestAddAnonymous(t *testing.T) {
+	m := rtc.NewRTCMapWithLimit(0)
+	// An id that looks generated is skipped
+	if err := m.AddConnection("anonymous-1", rtc.NewRTC("anonymous-1")); err != nil {
+		t.Fatalf("Cannot add connection: %v", err)
+	}
+
+	car := rtc.NewRTC("")
+	id, err := m.AddAnonymous(car, true)
+	if err != nil {
+		t.Fatalf("Cannot add anonymous connection: %v", err)
+	}
+	if id != "anonymous-2" {
+		t.Errorf("Expected id anonymous-2, got %s", id)
+	}
+	if car.Id != id || m.Get(id) != car {
+		t.Errorf("Expected the connection to be added under its generated id %s, got %s", id, car.Id)
+	}
+	if car.Role() != rtc.RoleCar {
+		t.Errorf("Expected role %s, got %s", rtc.RoleCar, car.Role())
+	}
+
+	// Concurrent callers all get a different id
+	var wg sync.WaitGroup
+	ids := make(chan string, 50)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := rtc.NewRTC("")
+			id, err := m.AddAnonymous(r, false)
+			if err != nil {
+				t.Errorf("Cannot add anonymous connection: %v", err)
+				return
+			}
+			if r.Id != id {
+				t.Errorf("Expected the connection to know its id %s, got %s", id, r.Id)
+			}
+			ids <- id
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	seen := make(map[string]bool)
+	for id := range ids {
+		if seen[id] {
+			t.Errorf("Expected unique ids, got %s twice", id)
+		}
+		seen[id] = true
+	}
+	if count := m.Count(); count != 52 {
+		t.Errorf("Expected 52 connections, got %d", count)
+	}
+}
+
+func TestWaitAll(t *testing.T) {
+	m := rtc.NewRTCMap()
+	ctx, cancel := context.WithTimeout(context.Background(), receiveTimeout)
+	defer cancel()
+	isConnected := func(r *rtc.RTC) bool { return r.IsConnected() }
+
+	// An empty map satisfies any predicate
+	if err := m.WaitAll(ctx, isConnected); err != nil {
+		t.Fatalf("Expected an empty map to satisfy the predicate, got %v", err)
+	}
+
+	client, offer, err := rtc.CreateOffer("client")
+	if err != nil {
+		t.Fatalf("Cannot create offer: %v", err)
+	}
+	t.Cleanup(func() { client.Destroy() })
+	offer.Id = "server"
+	server, answer, err := rtc.AcceptOffer(offer)
+	if err != nil {
+		t.Fatalf("Cannot accept offer: %v", err)
+	}
+	t.Cleanup(func() { server.Destroy() })
+	if err := m.AddConnection("server", server); err != nil {
+		t.Fatalf("Cannot add connection: %v", err)
+	}
+
+	short, cancelShort := context.WithTimeout(ctx, silenceTimeout)
+	defer cancelShort()
+	if err := m.WaitAll(short, isConnected); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the wait to give up while the connection is not connected, got %v", err)
+	}
+
+	// The wait wakes up when the connection connects
+	done := make(chan error, 1)
+	go func() { done <- m.WaitAll(ctx, isConnected) }()
+	if err := client.ApplyAnswer(answer); err != nil {
+		t.Fatalf("Cannot apply answer: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("Expected the wait to return once the connection connected, got %v", err)
+	}
+	if !server.IsConnected() {
+		t.Error("Expected the connection to be connected when the wait returned")
+	}
+}
+
+func TestWaitAllIgnoresRemovedConnections(t *testing.T) {
+	m := rtc.NewRTCMap()
+	if err := m.AddConnection("pending", rtc.NewRTC("pending")); err != nil {
+		t.Fatalf("Cannot add connection: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), receiveTimeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- m.WaitAll(ctx, func(r *rtc.RTC) bool { return r.IsConnected() }) }()
+	select {
+	case err := <-done:
+		t.Fatalf("Expected the wait to block while the connection is not connected, got %v", err)
+	case <-time.After(silenceTimeout):
+	}
+
+	// The connection that did not satisfy the predicate is gone
+	if err := m.Remove("pending"); err != nil {
+		t.Fatalf("Cannot remove connection: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Expected the wait to return once the connection was removed, got %v", err)
+	}
+}
+
+func TestDraining(t *testing.T) {
+	m := rtc.NewRTCMap()
+	for _, id := range []string{"operator", "spectator"} {
+		if err := m.AddConnection(id, rtc.NewRTC(id)); err != nil {
+			t.Fatalf("Cannot add connection %s: %v", id, err)
+		}
+	}
+
+	m.StartDraining()
+	if err := m.AddConnection("late", rtc.NewRTC("late")); !errors.Is(err, rtc.ErrDraining) {
+		t.Errorf("Expected ErrDraining, got %v", err)
+	}
+	// The car can still (re)connect
+	if err := m.Add("car", rtc.NewRTC("car"), true); err != nil {
+		t.Errorf("Expected the car to be accepted while draining, got %v", err)
+	}
+	if count := m.Count(); count != 3 {
+		t.Errorf("Expected the existing connections to be left untouched, got %d connections", count)
+	}
+
+	// Connections that are removed or close by themselves count towards the progress
+	if err := m.Remove("operator"); err != nil {
+		t.Fatalf("Cannot remove connection: %v", err)
+	}
+	if err := m.Get("spectator").Destroy(); err != nil {
+		t.Fatalf("Cannot destroy connection: %v", err)
+	}
+	if drained := m.DrainedCount(); drained != 2 {
+		t.Errorf("Expected 2 drained connections, got %d", drained)
+	}
+
+	// Starting to drain again does not reset the progress
+	m.StartDraining()
+	if drained := m.DrainedCount(); drained != 2 {
+		t.Errorf("Expected the progress to be kept, got %d drained connections", drained)
+	}
+}
+
+func TestAcceptRate(t *testing.T) {
+	m := rtc.NewRTCMapWithLimit(0)
+	m.SetAcceptRate(10, 2)
+
+	for i := 0; i < 2; i++ {
+		id := fmt.Sprintf("client-%d", i)
+		if err := m.AddConnection(id, rtc.NewRTC(id)); err != nil {
+			t.Fatalf("Expected connection %s within the burst to be accepted, got %v", id, err)
+		}
+	}
+	if err := m.AddConnection("client-2", rtc.NewRTC("client-2")); !errors.Is(err, rtc.ErrAcceptThrottled) {
+		t.Errorf("Expected ErrAcceptThrottled, got %v", err)
+	}
+	// The car is never throttled
+	if err := m.Add("car", rtc.NewRTC("car"), true); err != nil {
+		t.Errorf("Expected the car to be accepted, got %v", err)
+	}
+
+	// The rate refills the burst
+	time.Sleep(150 * time.Millisecond)
+	if err := m.AddConnection("client-2", rtc.NewRTC("client-2")); err != nil {
+		t.Errorf("Expected a connection to be accepted after waiting, got %v", err)
+	}
+
+	// Disabling throttling accepts every connection
+	m.SetAcceptRate(0, 0)
+	for i := 3; i < 10; i++ {
+		id := fmt.Sprintf("client-%d", i)
+		if err := m.AddConnection(id, rtc.NewRTC(id)); err != nil {
+			t.Fatalf("Expected connection %s to be accepted without throttling, got %v", id, err)
+		}
+	}
+}
+
+func TestAcceptRateRaisesBurst(t *testing.T) {
+	m := rtc.NewRTCMapWithLimit(0)
+	m.SetAcceptRate(0.1, 0)
+
+	if err := m.AddConnection("first", rtc.NewRTC("first")); err != nil {
+		t.Errorf("Expected a burst of 1 to accept a connection, got %v", err)
+	}
+	if err := m.AddConnection("second", rtc.NewRTC("second")); !errors.Is(err, rtc.ErrAcceptThrottled) {
+		t.Errorf("Expected ErrAcceptThrottled, got %v", err)
+	}
+}
+
+func TestConnectionLimit(t *testing.T) {
+	tests := []struct {
+		name  string
+		m     *rtc.RTCMap
+		limit int
+	}{
+		{"default", rtc.NewRTCMap(), rtc.DefaultMaxConnections},
+		{"two", rtc.NewRTCMapWithLimit(2), 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for i := 0; i < test.limit; i++ {
+				id := fmt.Sprintf("spectator-%d", i)
+				r := rtc.NewRTC(id)
+				r.SetRole(rtc.RoleSpectator)
+				if err := test.m.AddConnection(id, r); err != nil {
+					t.Fatalf("Cannot add connection %s below the limit: %v", id, err)
+				}
+			}
+			if err := test.m.AddConnection("operator", rtc.NewRTC("operator")); !errors.Is(err, rtc.ErrMapFull) {
+				t.Errorf("Expected ErrMapFull, got %v", err)
+			}
+			// The car does not count towards the limit
+			if err := test.m.Add("car", rtc.NewRTC("car"), true); err != nil {
+				t.Errorf("Expected the car to be added beyond the limit, got %v", err)
+			}
+			// A connection that replaces one with the same id does not take an extra place
+			if err := test.m.AddConnection("spectator-0", rtc.NewRTC("spectator-0")); err != nil {
+				t.Errorf("Expected a connection to replace one with the same id in a full map, got %v", err)
+			}
+			if count := test.m.Count(); count != test.limit+1 {
+				t.Errorf("Expected %d connections, got %d", test.limit+1, count)
+			}
+		})
+	}
+}
+
+func TestUnlimitedConnections(t *testing.T) {
+	m := rtc.NewRTCMapWithLimit(0)
+	for i := 0; i < 50; i++ {
+		id := fmt.Sprintf("spectator-%d", i)
+		if err := m.AddConnection(id, rtc.NewRTC(id)); err != nil {
+			t.Fatalf("Cannot add connection %s to an unlimited map: %v", id, err)
+		}
+	}
+}
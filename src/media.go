@@ -0,0 +1,90 @@
+package rtc
+
+import (
+	"errors"
+	"io"
+
+	"github.com/pion/webrtc/v4"
+)
+
+//
+// This file contains the media tracks of a connection (e.g. to stream the camera of the rover over the same peer connection instead of sending
+// frames over the data channel). Tracks added before the offer is created are part of the initial session, tracks added afterwards are
+// negotiated with the peer by the negotiation manager (see SetSignalingTransport)
+//
+
+type remoteTrackFunc func(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver)
+
+// Add a video track with the given codec (e.g. webrtc.MimeTypeVP8 or webrtc.MimeTypeH264) to the connection. Write samples to the returned
+// track to send them to the peer
+func (r *RTC) AddVideoTrack(mimeType string, id string) (*webrtc.TrackLocalStaticSample, error) {
+	return r.addTrack(mimeType, id)
+}
+
+// Add an audio track with the given codec (e.g. webrtc.MimeTypeOpus) to the connection. Write samples to the returned track to send them to the peer
+func (r *RTC) AddAudioTrack(mimeType string, id string) (*webrtc.TrackLocalStaticSample, error) {
+	return r.addTrack(mimeType, id)
+}
+
+// Register a handler that is called for every track the peer sends
+func (r *RTC) OnRemoteTrack(handler func(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver)) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.onRemoteTrack = handler
+}
+
+// Create a track and add it to the peer connection. If the session is already set up, adding the track triggers a renegotiation
+// (see SetSignalingTransport)
+func (r *RTC) addTrack(mimeType string, id string) (*webrtc.TrackLocalStaticSample, error) {
+	log := r.Log()
+
+	pc := r.peerConnection()
+	if pc == nil {
+		return nil, errors.New("Cannot add track. Connection is nil")
+	}
+
+	track, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: mimeType}, id, r.Id)
+	if err != nil {
+		return nil, err
+	}
+	sender, err := pc.AddTrack(track)
+	if err != nil {
+		return nil, err
+	}
+
+	r.lock.Lock()
+	r.rtpSenders = append(r.rtpSenders, sender)
+	r.lock.Unlock()
+
+	// Read the RTCP packets of the peer, so that the interceptors (e.g. NACK) can process them
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			if _, _, err := sender.Read(buf); err != nil {
+				if !errors.Is(err, io.EOF) {
+					log.Debug().Err(err).Str("track", id).Msg("Stopped reading RTCP")
+				}
+				return
+			}
+		}
+	}()
+
+	log.Info().Str("track", id).Str("codec", mimeType).Msg("Added media track")
+	return track, nil
+}
+
+// Pass a track of the peer to the handler
+func (r *RTC) handleRemoteTrack(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
+	log := r.Log()
+
+	r.lock.Lock()
+	handler := r.onRemoteTrack
+	r.lock.Unlock()
+
+	if handler == nil {
+		log.Debug().Str("track", track.ID()).Msg("Ignored remote track, no handler registered")
+		return
+	}
+	handler(track, receiver)
+}
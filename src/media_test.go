@@ -0,0 +1,64 @@
+package rtc_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/VU-ASE/roverrtc/src/rtctest"
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+)
+
+func TestVideoTrackAfterConnect(t *testing.T) {
+	client, server := rtctest.NewConnectedPair(t)
+
+	packets := make(chan string, 16)
+	stopped := make(chan struct{})
+	server.OnRemoteTrack(func(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
+		defer close(stopped)
+		for {
+			if _, _, err := track.ReadRTP(); err != nil {
+				return
+			}
+			select {
+			case packets <- track.ID():
+			default:
+			}
+		}
+	})
+
+	// The track is added to a connected session, so it is negotiated over the control channel
+	track, err := client.AddVideoTrack(webrtc.MimeTypeVP8, "camera")
+	if err != nil {
+		t.Fatalf("Cannot add video track: %v", err)
+	}
+
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+	timeout := time.After(receiveTimeout)
+	for arrived := false; !arrived; {
+		select {
+		case id := <-packets:
+			if id != "camera" {
+				t.Errorf("Expected a packet of track camera, got track %s", id)
+			}
+			arrived = true
+		case <-ticker.C:
+			if err := track.WriteSample(media.Sample{Data: []byte{0x10, 0x02, 0x00, 0x9d, 0x01, 0x2a}, Duration: 20 * time.Millisecond}); err != nil {
+				t.Fatalf("Cannot write sample: %v", err)
+			}
+		case <-timeout:
+			t.Fatal("Expected the samples to arrive on the remote track")
+		}
+	}
+
+	// Destroying the sender stops the track, which ends the stream on the receiving side
+	if err := client.Destroy(); err != nil {
+		t.Fatalf("Cannot destroy connection: %v", err)
+	}
+	select {
+	case <-stopped:
+	case <-time.After(receiveTimeout):
+		t.Error("Expected the remote track to end after the sender was destroyed")
+	}
+}
@@ -0,0 +1,101 @@
+package rtc
+
+//
+// This file contains the membership events of an RTCMap, so that the application can react when connections are added to or removed
+// from the map (e.g. to update a list of connected operators) instead of polling it. The changes are recorded while the map is locked,
+// and passed to the subscribers once the lock is released, so that subscribers can safely use the map themselves. Only one goroutine
+// passes changes to the subscribers at a time, so that they see the changes one by one and in order, even if the map is changed concurrently
+//
+
+type addFunc func(id string, r *RTC)
+type removeFunc func(id string)
+
+// A change of the members of the map, waiting to be passed to the subscribers
+type mapEvent struct {
+	id    string
+	rtc   *RTC
+	added bool
+}
+
+// Register a handler that is called whenever a connection is added to the map (by Add, AddConnection, AddAnonymous, Replace or
+// MigrateConnection). Multiple handlers can be registered. The handlers are called after the map is unlocked, one at a time and in the
+// order of the changes. They are called synchronously by the goroutine that changed the map, unless another goroutine is still passing
+// earlier changes to the handlers: that goroutine passes the new changes as well (so the change may not be handled yet when the method
+// that made it returns). A handler that changes the map itself is called for that change once it returns
+func (m *RTCMap) OnAdd(handler func(id string, r *RTC)) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.onAdd = append(m.onAdd, handler)
+}
+
+// Register a handler that is called whenever a connection is removed from the map (by Remove, DestroyAll, Replace, MigrateConnection
+// or the reaper). Multiple handlers can be registered. The handlers are called like the OnAdd handlers
+func (m *RTCMap) OnRemove(handler func(id string)) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.onRemove = append(m.onRemove, handler)
+}
+
+// Record that a connection was added, the caller must hold the lock
+func (m *RTCMap) recordAdded(id string, rtc *RTC) {
+	recordConnections(rtc.Role(), 1)
+	m.pendingEvents = append(m.pendingEvents, mapEvent{id: id, rtc: rtc, added: true})
+}
+
+// Record that a connection was removed, the caller must hold the lock
+func (m *RTCMap) recordRemoved(id string, rtc *RTC) {
+	recordConnections(rtc.Role(), -1)
+	m.pendingEvents = append(m.pendingEvents, mapEvent{id: id})
+}
+
+// Pass the recorded changes to the subscribers, the caller must not hold the lock. If another goroutine is passing changes already,
+// it passes these as well
+func (m *RTCMap) notify() {
+	m.lock.Lock()
+	if len(m.pendingEvents) > 0 {
+		close(m.changed)
+		m.changed = make(chan struct{})
+	}
+	if m.delivering {
+		m.lock.Unlock()
+		return
+	}
+	m.delivering = true
+
+	for len(m.pendingEvents) > 0 {
+		events := m.pendingEvents
+		m.pendingEvents = nil
+		onAdd := m.onAdd
+		onRemove := m.onRemove
+		m.lock.Unlock()
+
+		for _, event := range events {
+			if event.added {
+				for _, handler := range onAdd {
+					callSubscriber(func() { handler(event.id, event.rtc) })
+				}
+			} else {
+				for _, handler := range onRemove {
+					callSubscriber(func() { handler(event.id) })
+				}
+			}
+		}
+		m.lock.Lock()
+	}
+	m.delivering = false
+	m.lock.Unlock()
+}
+
+// Call a subscriber of the map. A panic is logged, so that a panicking subscriber does not take down the goroutine that changed the map
+// (which has already unlocked it) or keep the other subscribers from being called
+func callSubscriber(f func()) {
+	defer func() {
+		if p := recover(); p != nil {
+			log := getDefaultLogger()
+			log.Error().Interface("panic", p).Msg("Recovered from panic in RTCMap subscriber")
+		}
+	}()
+	f()
+}
@@ -0,0 +1,157 @@
+package rtc_test
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+)
+
+// Records the membership events of a map in order
+type membershipLog struct {
+	lock   *sync.Mutex
+	events []string
+}
+
+func subscribe(m *rtc.RTCMap) *membershipLog {
+	var lock sync.Mutex
+	l := &membershipLog{lock: &lock}
+	m.OnAdd(func(id string, r *rtc.RTC) { l.record("add " + id) })
+	m.OnRemove(func(id string) { l.record("remove " + id) })
+	return l
+}
+
+func (l *membershipLog) record(event string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.events = append(l.events, event)
+}
+
+func (l *membershipLog) Events() []string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return append([]string(nil), l.events...)
+}
+
+func TestMembershipEventOrder(t *testing.T) {
+	m := rtc.NewRTCMap()
+	first, second := subscribe(m), subscribe(m)
+
+	if err := m.AddConnection("a", rtc.NewRTC("a")); err != nil {
+		t.Fatalf("Cannot add a: %v", err)
+	}
+	if err := m.AddConnection("b", rtc.NewRTC("b")); err != nil {
+		t.Fatalf("Cannot add b: %v", err)
+	}
+	if err := m.Remove("a"); err != nil {
+		t.Fatalf("Cannot remove a: %v", err)
+	}
+	if err := m.Replace("b", rtc.NewRTC("b")); err != nil {
+		t.Fatalf("Cannot replace b: %v", err)
+	}
+	if err := m.DestroyAll(); err != nil {
+		t.Fatalf("Cannot destroy all: %v", err)
+	}
+
+	want := []string{"add a", "add b", "remove a", "remove b", "add b", "remove b"}
+	if got := first.Events(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected events %v, got %v", want, got)
+	}
+	if got := second.Events(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected every subscriber to receive %v, got %v", want, got)
+	}
+}
+
+func TestMembershipCallbackUsesMap(t *testing.T) {
+	m := rtc.NewRTCMap()
+	found := make(chan bool, 1)
+	m.OnAdd(func(id string, r *rtc.RTC) {
+		// The map is not locked while the callback runs
+		found <- m.Get(id) == r && m.Count() == 1
+	})
+
+	if err := m.AddConnection("a", rtc.NewRTC("a")); err != nil {
+		t.Fatalf("Cannot add a: %v", err)
+	}
+	if !<-found {
+		t.Error("Expected the callback to see the added connection in the map")
+	}
+}
+
+func TestMembershipPanickingCallback(t *testing.T) {
+	m := rtc.NewRTCMap()
+	m.OnAdd(func(id string, r *rtc.RTC) { panic("subscriber bug") })
+	l := subscribe(m)
+
+	if err := m.AddConnection("a", rtc.NewRTC("a")); err != nil {
+		t.Fatalf("Cannot add a: %v", err)
+	}
+	if err := m.AddConnection("b", rtc.NewRTC("b")); err != nil {
+		t.Fatalf("Cannot add b after a subscriber panicked: %v", err)
+	}
+	if err := m.Remove("a"); err != nil {
+		t.Fatalf("Cannot remove a after a subscriber panicked: %v", err)
+	}
+
+	if ids := m.GetAllIdsSorted(); !reflect.DeepEqual(ids, []string{"b"}) {
+		t.Errorf("Expected only b in the map, got %v", ids)
+	}
+	want := []string{"add a", "add b", "remove a"}
+	if got := l.Events(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected the other subscribers to receive %v, got %v", want, got)
+	}
+}
+
+func TestMembershipConcurrentChanges(t *testing.T) {
+	m := rtc.NewRTCMapWithLimit(0)
+	var inflight, overlaps atomic.Int32
+	events := make(map[string][]bool) // id -> added (true) or removed (false), in the order the events were received
+	record := func(id string, added bool) {
+		if inflight.Add(1) > 1 {
+			overlaps.Add(1)
+		}
+		// Give a concurrent delivery the chance to overlap
+		time.Sleep(time.Microsecond)
+		events[id] = append(events[id], added)
+		inflight.Add(-1)
+	}
+	m.OnAdd(func(id string, r *rtc.RTC) { record(id, true) })
+	m.OnRemove(func(id string) { record(id, false) })
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			id := fmt.Sprintf("client-%d", i%4)
+			for j := 0; j < 25; j++ {
+				_ = m.AddConnection(id, rtc.NewRTC(id))
+				if j%2 == 0 {
+					_ = m.Remove(id)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := overlaps.Load(); n > 0 {
+		t.Errorf("Expected the handlers to be called one at a time, %d calls overlapped", n)
+	}
+	// Every id is added and removed in turns, so events that are delivered out of order break the alternation
+	for id, changes := range events {
+		for i, added := range changes {
+			if added != (i%2 == 0) {
+				t.Fatalf("Expected the events of %s to alternate between add and remove, got %v", id, changes)
+			}
+		}
+		if inMap := m.Get(id) != nil; inMap != changes[len(changes)-1] {
+			t.Errorf("Expected the last event of %s to match the map (in map: %t), got %v", id, inMap, changes)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package rtc
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/pion/webrtc/v4"
+)
+
+//
+// This file contains the abstraction over the control and data channel of a connection. The connection only needs a few methods of a
+// data channel to send and receive, so application code can test its send logic with a MockChannel instead of setting up real
+// peer connections (see SetControlChannel and SetDataChannel). Features that need more than these methods (e.g. the delivery semantics or
+// the buffered amount low event) are only available on pion data channels
+//
+
+// The methods of a data channel that the connection uses to send and receive, implemented by *webrtc.DataChannel and MockChannel
+type MessageChannel interface {
+	Label() string
+	Send(b []byte) error
+	ReadyState() webrtc.DataChannelState
+	BufferedAmount() uint64
+	OnMessage(handler func(msg webrtc.DataChannelMessage))
+	Close() error
+}
+
+var _ MessageChannel = (*webrtc.DataChannel)(nil)
+var _ MessageChannel = (*MockChannel)(nil)
+
+// Implemented by channels that can signal that their buffer drained (i.e. pion data channels)
+type bufferedAmountNotifier interface {
+	SetBufferedAmountLowThreshold(threshold uint64)
+	OnBufferedAmountLow(handler func())
+}
+
+// Returns the control channel if it is a pion data channel, or nil if there is no control channel or it is mocked
+func (r *RTC) ControlChannel() *webrtc.DataChannel {
+	dc, _ := r.controlMessageChannel().(*webrtc.DataChannel)
+	return dc
+}
+
+// Returns the data channel if it is a pion data channel, or nil if there is no data channel or it is mocked
+func (r *RTC) DataChannel() *webrtc.DataChannel {
+	dc, _ := r.dataMessageChannel().(*webrtc.DataChannel)
+	return dc
+}
+
+// Returns the control channel, or nil if it is not set up or the connection is destroyed. The channel is set and cleared under the lock
+// (see SetControlChannel and Destroy), so read it through this method
+func (r *RTC) controlMessageChannel() MessageChannel {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.controlChannel
+}
+
+// Returns the data channel, or nil if it is not set up or the connection is destroyed (see controlMessageChannel)
+func (r *RTC) dataMessageChannel() MessageChannel {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.dataChannel
+}
+
+// An in-memory channel for tests. It records the messages sent on it, and messages can be injected as if they were received from the peer.
+// It is open until it is closed (or its state is changed with SetReadyState)
+type MockChannel struct {
+	lock      *sync.Mutex
+	label     string
+	state     webrtc.DataChannelState
+	buffered  uint64
+	sendErr   error
+	sent      [][]byte
+	onMessage func(msg webrtc.DataChannelMessage)
+}
+
+// Create an open mock channel with the given label (e.g. ControlChannelLabel or DataChannelLabel)
+func NewMockChannel(label string) *MockChannel {
+	var lock sync.Mutex
+	return &MockChannel{
+		lock:  &lock,
+		label: label,
+		state: webrtc.DataChannelStateOpen,
+	}
+}
+
+func (m *MockChannel) Label() string {
+	return m.label
+}
+
+// Records a copy of the message, unless the channel is not open or sending was made to fail with FailSends
+func (m *MockChannel) Send(b []byte) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.sendErr != nil {
+		return m.sendErr
+	}
+	if m.state != webrtc.DataChannelStateOpen {
+		return fmt.Errorf("Cannot send on mock channel %s, it is %s", m.label, m.state)
+	}
+	payload := make([]byte, len(b))
+	copy(payload, b)
+	m.sent = append(m.sent, payload)
+	return nil
+}
+
+func (m *MockChannel) ReadyState() webrtc.DataChannelState {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.state
+}
+
+func (m *MockChannel) BufferedAmount() uint64 {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.buffered
+}
+
+func (m *MockChannel) OnMessage(handler func(msg webrtc.DataChannelMessage)) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.onMessage = handler
+}
+
+func (m *MockChannel) Close() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.state = webrtc.DataChannelStateClosed
+	return nil
+}
+
+// Returns the messages sent on the channel so far, oldest first (as they are on the wire, i.e. encoded by the connection)
+func (m *MockChannel) Sent() [][]byte {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	sent := make([][]byte, len(m.sent))
+	copy(sent, m.sent)
+	return sent
+}
+
+// Forget the messages sent so far
+func (m *MockChannel) Reset() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.sent = nil
+}
+
+// Pass a message to the OnMessage handler, as if it was received from the peer. Does nothing if there is no handler
+func (m *MockChannel) Inject(b []byte) {
+	m.lock.Lock()
+	handler := m.onMessage
+	m.lock.Unlock()
+
+	if handler != nil {
+		handler(webrtc.DataChannelMessage{Data: b})
+	}
+}
+
+// Set the state of the channel (e.g. to test sending on a channel that is still connecting)
+func (m *MockChannel) SetReadyState(state webrtc.DataChannelState) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.state = state
+}
+
+// Set the buffered amount reported by the channel (e.g. to test backpressure)
+func (m *MockChannel) SetBufferedAmount(amount uint64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.buffered = amount
+}
+
+// Make every following send fail with err, pass nil to let sends succeed again
+func (m *MockChannel) FailSends(err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.sendErr = err
+}
@@ -0,0 +1,99 @@
+package rtc
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+//
+// This file contains the (opt-in) Prometheus metrics of the package: the number of connections in RTCMaps per role, the messages and
+// bytes sent (and send errors) per channel, and the round trip times measured by the keep-alive. Until EnableMetrics is called,
+// the only cost on the send path is a single atomic load
+//
+
+type packageMetrics struct {
+	connections  *prometheus.GaugeVec
+	messagesSent *prometheus.CounterVec
+	bytesSent    *prometheus.CounterVec
+	sendErrors   *prometheus.CounterVec
+	keepaliveRTT prometheus.Histogram
+}
+
+var activeMetrics atomic.Pointer[packageMetrics] // nil means metrics are disabled
+
+// Register the metrics of the package with reg and start updating them. Connections that are in an RTCMap before this call are not counted
+func EnableMetrics(reg prometheus.Registerer) error {
+	m := &packageMetrics{
+		connections: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "roverrtc",
+			Name:      "connections",
+			Help:      "The number of connections in RTC maps",
+		}, []string{"role"}),
+		messagesSent: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "roverrtc",
+			Name:      "messages_sent_total",
+			Help:      "The number of messages sent",
+		}, []string{"channel"}),
+		bytesSent: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "roverrtc",
+			Name:      "bytes_sent_total",
+			Help:      "The number of bytes sent",
+		}, []string{"channel"}),
+		sendErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "roverrtc",
+			Name:      "send_errors_total",
+			Help:      "The number of messages that could not be sent",
+		}, []string{"channel"}),
+		keepaliveRTT: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: "roverrtc",
+			Name:      "keepalive_rtt_seconds",
+			Help:      "The round trip times measured by the keep-alive",
+			Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+		}),
+	}
+
+	for _, c := range []prometheus.Collector{m.connections, m.messagesSent, m.bytesSent, m.sendErrors, m.keepaliveRTT} {
+		if err := reg.Register(c); err != nil {
+			return err
+		}
+	}
+	activeMetrics.Store(m)
+	return nil
+}
+
+// Count a message sent on the channel with the given label
+func recordSend(label string, length int, err error) {
+	m := activeMetrics.Load()
+	if m == nil {
+		return
+	}
+
+	if err != nil {
+		m.sendErrors.WithLabelValues(label).Inc()
+		return
+	}
+	m.messagesSent.WithLabelValues(label).Inc()
+	m.bytesSent.WithLabelValues(label).Add(float64(length))
+}
+
+// Count a connection with the given role that was added to (delta 1) or removed from (delta -1) a map
+func recordConnections(role Role, delta float64) {
+	m := activeMetrics.Load()
+	if m == nil {
+		return
+	}
+
+	m.connections.WithLabelValues(role.String()).Add(delta)
+}
+
+// Record a round trip time measured by the keep-alive
+func recordKeepaliveRTT(rtt time.Duration) {
+	m := activeMetrics.Load()
+	if m == nil {
+		return
+	}
+
+	m.keepaliveRTT.Observe(rtt.Seconds())
+}
@@ -0,0 +1,79 @@
+package rtc_test
+
+import (
+	"errors"
+	"testing"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Returns the value of the counter or gauge with the given name and label in the registry, or 0 if it was not recorded
+func metricValue(t *testing.T, reg *prometheus.Registry, name, label, value string) float64 {
+	t.Helper()
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Cannot gather metrics: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, pair := range metric.GetLabel() {
+				if pair.GetName() == label && pair.GetValue() == value {
+					if counter := metric.GetCounter(); counter != nil {
+						return counter.GetValue()
+					}
+					return metric.GetGauge().GetValue()
+				}
+			}
+		}
+	}
+	return 0
+}
+
+func TestMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	if err := rtc.EnableMetrics(reg); err != nil {
+		t.Fatalf("Cannot enable metrics: %v", err)
+	}
+
+	r := rtc.NewRTC("rover")
+	dc := rtc.NewMockChannel(rtc.DataChannelLabel)
+	r.SetDataChannel(dc)
+	for i := 0; i < 3; i++ {
+		if err := r.SendDataBytes([]byte("imu")); err != nil {
+			t.Fatalf("Cannot send message: %v", err)
+		}
+	}
+	if sent := metricValue(t, reg, "roverrtc_messages_sent_total", "channel", rtc.DataChannelLabel); sent != 3 {
+		t.Errorf("Expected 3 messages sent, got %v", sent)
+	}
+	if bytes := metricValue(t, reg, "roverrtc_bytes_sent_total", "channel", rtc.DataChannelLabel); bytes < 9 {
+		t.Errorf("Expected at least 9 bytes sent, got %v", bytes)
+	}
+
+	dc.FailSends(errors.New("Link is down"))
+	if err := r.SendDataBytes([]byte("imu")); err == nil {
+		t.Fatal("Expected the send to fail")
+	}
+	if failed := metricValue(t, reg, "roverrtc_send_errors_total", "channel", rtc.DataChannelLabel); failed != 1 {
+		t.Errorf("Expected 1 send error, got %v", failed)
+	}
+
+	m := rtc.NewRTCMap()
+	if err := m.AddConnection("rover", r); err != nil {
+		t.Fatalf("Cannot add connection: %v", err)
+	}
+	if connections := metricValue(t, reg, "roverrtc_connections", "role", r.Role().String()); connections != 1 {
+		t.Errorf("Expected 1 connection, got %v", connections)
+	}
+	if err := m.Remove("rover"); err != nil {
+		t.Fatalf("Cannot remove connection: %v", err)
+	}
+	if connections := metricValue(t, reg, "roverrtc_connections", "role", r.Role().String()); connections != 0 {
+		t.Errorf("Expected no connections, got %v", connections)
+	}
+}
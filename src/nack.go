@@ -0,0 +1,107 @@
+package rtc
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+
+	"google.golang.org/protobuf/proto"
+)
+
+//
+// This file contains the feedback on malformed inbound data. When an incoming data message cannot be unmarshalled, the receiver can
+// (opt-in) send a "nack" control message back to the sender, identifying the bad message by its checksum (CRC-32, IEEE) and length.
+// The nack payload looks like this:
+//
+//	| checksum (4 bytes, big endian) | length (4 bytes, big endian) | reason (utf-8) |
+//
+
+const nackHeaderSize = 8
+
+// A nack received from the peer, describing a message it could not unmarshal
+type Nack struct {
+	Checksum uint32 // the CRC-32 (IEEE) checksum of the bad message, as sent by us
+	Length   int    // the length of the bad message
+	Reason   string // why the message could not be unmarshalled
+}
+
+// Register a handler that unmarshals every message received on the data channel into a new message created by newMessage.
+// Messages that cannot be unmarshalled are counted (see CorruptMessages) and, if enabled, reported to the peer with a nack
+func (r *RTC) OnDataProto(newMessage func() proto.Message, handler func(msg proto.Message)) {
+	r.OnData(func(b []byte) {
+		msg := newMessage()
+		if err := proto.Unmarshal(b, msg); err != nil {
+			r.reportCorruptMessage(b, err)
+			return
+		}
+		handler(msg)
+	})
+}
+
+// Enable or disable sending nacks to the peer for messages that cannot be unmarshalled. Disabled by default
+func (r *RTC) EnableNack(enabled bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.nackEnabled = enabled
+}
+
+// Register a handler for nacks received from the peer
+func (r *RTC) OnNack(handler func(nack Nack)) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.onNack = handler
+}
+
+// Returns the number of received messages that could not be unmarshalled
+func (r *RTC) CorruptMessages() uint64 {
+	return r.corruptMessages.Load()
+}
+
+// Count a message that could not be unmarshalled and send a nack for it, if enabled
+func (r *RTC) reportCorruptMessage(b []byte, err error) {
+	log := r.Log()
+
+	r.corruptMessages.Add(1)
+	log.Warn().Err(err).Int("length", len(b)).Msg("Cannot unmarshal data message")
+
+	r.lock.Lock()
+	enabled := r.nackEnabled
+	r.lock.Unlock()
+	if !enabled {
+		return
+	}
+
+	reason := err.Error()
+	payload := make([]byte, nackHeaderSize+len(reason))
+	binary.BigEndian.PutUint32(payload, crc32.ChecksumIEEE(b))
+	binary.BigEndian.PutUint32(payload[4:], uint32(len(b)))
+	copy(payload[nackHeaderSize:], reason)
+	if err := r.SendControlFrame(controlTypeNack, payload); err != nil {
+		log.Debug().Err(err).Msg("Could not send nack")
+	}
+}
+
+// Pass a nack from the peer to the handler
+func (r *RTC) handleNack(payload []byte) {
+	log := r.Log()
+
+	if len(payload) < nackHeaderSize {
+		return
+	}
+	nack := Nack{
+		Checksum: binary.BigEndian.Uint32(payload),
+		Length:   int(binary.BigEndian.Uint32(payload[4:])),
+		Reason:   string(payload[nackHeaderSize:]),
+	}
+
+	r.lock.Lock()
+	handler := r.onNack
+	r.lock.Unlock()
+
+	if handler == nil {
+		log.Debug().Uint32("checksum", nack.Checksum).Str("reason", nack.Reason).Msg("Peer could not unmarshal a message")
+		return
+	}
+	handler(nack)
+}
@@ -0,0 +1,93 @@
+package rtc_test
+
+import (
+	"hash/crc32"
+	"testing"
+	"time"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/VU-ASE/roverrtc/src/rtctest"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// A message that cannot be unmarshalled (it ends in the middle of a varint)
+var malformed = []byte{0xff, 0xff}
+
+// Returns a channel that receives every message the connection unmarshals from the data channel
+func collectStrings(r *rtc.RTC) <-chan string {
+	received := make(chan string, 16)
+	r.OnDataProto(func() proto.Message { return &wrapperspb.StringValue{} }, func(msg proto.Message) {
+		received <- msg.(*wrapperspb.StringValue).GetValue()
+	})
+	return received
+}
+
+// Fail the test unless the connection counts want corrupt messages within receiveTimeout
+func expectCorruptMessages(t *testing.T, r *rtc.RTC, want uint64) {
+	t.Helper()
+
+	deadline := time.Now().Add(receiveTimeout)
+	for r.CorruptMessages() < want && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if count := r.CorruptMessages(); count != want {
+		t.Errorf("Expected %d corrupt messages, got %d", want, count)
+	}
+}
+
+func TestNackForMalformedMessage(t *testing.T) {
+	client, server := rtctest.NewConnectedPair(t)
+	server.EnableNack(true)
+	received := collectStrings(server)
+	nacks := make(chan rtc.Nack, 4)
+	client.OnNack(func(nack rtc.Nack) { nacks <- nack })
+
+	if err := client.SendDataBytes(malformed); err != nil {
+		t.Fatalf("Cannot send message: %v", err)
+	}
+	select {
+	case nack := <-nacks:
+		if nack.Checksum != crc32.ChecksumIEEE(malformed) || nack.Length != len(malformed) {
+			t.Errorf("Expected a nack for checksum %d and length %d, got %+v", crc32.ChecksumIEEE(malformed), len(malformed), nack)
+		}
+		if nack.Reason == "" {
+			t.Error("Expected the nack to give a reason")
+		}
+	case <-time.After(receiveTimeout):
+		t.Fatal("Expected a nack for the malformed message")
+	}
+	expectCorruptMessages(t, server, 1)
+
+	// Messages that can be unmarshalled are passed to the handler
+	if err := client.SendData(wrapperspb.String("telemetry")); err != nil {
+		t.Fatalf("Cannot send message: %v", err)
+	}
+	select {
+	case value := <-received:
+		if value != "telemetry" {
+			t.Errorf("Expected message telemetry, got %s", value)
+		}
+	case <-time.After(receiveTimeout):
+		t.Fatal("Expected the valid message to be passed to the handler")
+	}
+}
+
+func TestNackDisabledByDefault(t *testing.T) {
+	client, server := rtctest.NewConnectedPair(t)
+	received := collectStrings(server)
+	nacks := make(chan rtc.Nack, 4)
+	client.OnNack(func(nack rtc.Nack) { nacks <- nack })
+
+	if err := client.SendDataBytes(malformed); err != nil {
+		t.Fatalf("Cannot send message: %v", err)
+	}
+	expectCorruptMessages(t, server, 1)
+	select {
+	case nack := <-nacks:
+		t.Errorf("Expected no nack, got %+v", nack)
+	case value := <-received:
+		t.Errorf("Expected the malformed message to not be passed to the handler, got %q", value)
+	case <-time.After(silenceTimeout):
+	}
+}
@@ -0,0 +1,122 @@
+package rtc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/pion/webrtc/v4"
+)
+
+//
+// This file contains the negotiation manager, which renegotiates the session when it changes after the initial handshake (e.g. when a track
+// or the first data channel is added). When pion signals that negotiation is needed, a new offer is sent to the peer through the signaling
+// transport (by default the control channel) and its answer is applied. When both peers send an offer at the same time, the "perfect
+// negotiation" pattern resolves the collision: the polite peer withdraws its own offer and answers the offer of the peer, while the
+// impolite peer ignores the offer of the peer and waits for its own answer. Pion cannot roll back a local description, so the polite
+// peer only sets its offer once it is answered
+//
+
+// The offer of the peer was ignored, because it collided with our own offer and we are the impolite peer
+var ErrOfferIgnored = errors.New("Offer ignored, it collides with our own offer")
+
+// The offer we sent was withdrawn, because it collided with the offer of the peer and we are the polite peer
+var ErrOfferRolledBack = errors.New("Offer withdrawn, it collides with the offer of the peer")
+
+type negotiationResult struct {
+	answer webrtc.SessionDescription
+	err    error
+}
+
+type signalingTransport func(offer RequestSDP) (webrtc.SessionDescription, error)
+
+// Send the offers of renegotiations and ICE restarts through the given transport (e.g. over HTTP) instead of the control channel. The transport
+// delivers the offer to the peer and returns its answer. The peer answers the offer with AnswerRenegotiation. Pass nil to use the control channel
+// (ICE restarts always need a transport, see RestartICE)
+func (r *RTC) SetSignalingTransport(transport func(offer RequestSDP) (webrtc.SessionDescription, error)) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.signalingTransport = transport
+}
+
+// Set whether this peer is the polite peer, which yields when both peers send an offer at the same time. Exactly one of the peers should be polite,
+// by default this is the peer that accepted the offer (see AcceptOffer)
+func (r *RTC) SetPolite(polite bool) {
+	r.polite.Store(polite)
+}
+
+// Answer an offer of the peer (e.g. to renegotiate or restart ICE). The answer is returned once ICE gathering completed (or ctx is done).
+// If the offer collides with our own offer, it is answered after withdrawing our offer if we are the polite peer, and ignored with
+// ErrOfferIgnored otherwise. An offer that restarts ICE cannot be withdrawn, a colliding offer is ignored in that case
+func (r *RTC) AnswerRenegotiation(ctx context.Context, offer webrtc.SessionDescription) (webrtc.SessionDescription, error) {
+	answer, err := r.answerOffer(offer)
+	if err != nil {
+		return webrtc.SessionDescription{}, err
+	}
+	return r.gatheredLocalDescription(ctx, answer)
+}
+
+// Answer an offer of the peer (see AnswerRenegotiation) right away, the local candidates are not gathered yet
+func (r *RTC) answerOffer(offer webrtc.SessionDescription) (webrtc.SessionDescription, error) {
+	log := r.Log()
+
+	if offer.Type != webrtc.SDPTypeOffer {
+		return webrtc.SessionDescription{}, fmt.Errorf("%w: expected an offer, got %s", ErrInvalidSDPType, offer.Type)
+	}
+	pc := r.peerConnection()
+	if pc == nil {
+		return webrtc.SessionDescription{}, fmt.Errorf("Cannot answer offer. Connection is nil")
+	}
+
+	collision := r.negotiating.Load() || pc.SignalingState() != webrtc.SignalingStateStable
+	if collision {
+		if !r.polite.Load() {
+			return webrtc.SessionDescription{}, ErrOfferIgnored
+		}
+
+		// The offer of a renegotiation is not set yet (see Renegotiate), the offer of an ICE restart is and cannot be rolled back
+		if pc.SignalingState() != webrtc.SignalingStateStable {
+			return webrtc.SessionDescription{}, ErrOfferIgnored
+		}
+		log.Debug().Msg("Offer collides with our own offer, withdrawing it")
+		select {
+		case r.negotiationAnswer <- negotiationResult{err: ErrOfferRolledBack}:
+		default:
+		}
+	}
+
+	if err := r.SetRemoteDescription(offer); err != nil {
+		return webrtc.SessionDescription{}, err
+	}
+	answer, err := pc.CreateAnswer(nil)
+	if err != nil {
+		return webrtc.SessionDescription{}, err
+	}
+	if err := r.SetLocalDescription(answer); err != nil {
+		return webrtc.SessionDescription{}, err
+	}
+	return answer, nil
+}
+
+// Renegotiate when pion signals that the session changed. Before the initial handshake completed, the change is part of the initial offer
+func (r *RTC) handleNegotiationNeeded() {
+	r.lock.Lock()
+	negotiated := r.remoteDescriptionSet
+	r.lock.Unlock()
+	if !negotiated {
+		return
+	}
+
+	go func() {
+		log := r.Log()
+
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultGatheringTimeout)
+		defer cancel()
+		if err := r.Renegotiate(ctx); err != nil {
+			log.Warn().Err(err).Msg("Cannot renegotiate")
+			return
+		}
+		log.Debug().Msg("Renegotiated session")
+	}()
+}
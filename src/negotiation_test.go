@@ -0,0 +1,109 @@
+package rtc_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/VU-ASE/roverrtc/src/rtctest"
+	"github.com/pion/webrtc/v4"
+)
+
+// Fail the test unless both peers are stable and use each other's descriptions
+func expectConverged(t *testing.T, client, server *rtc.RTC) {
+	t.Helper()
+
+	for _, peer := range []*rtc.RTC{client, server} {
+		if state := peer.Pc.SignalingState(); state != webrtc.SignalingStateStable {
+			t.Errorf("Expected %s to be stable, got %s", peer.Id, state)
+		}
+	}
+	if client.Pc.RemoteDescription().SDP != server.Pc.LocalDescription().SDP {
+		t.Error("Expected the client to use the description of the server")
+	}
+	if server.Pc.RemoteDescription().SDP != client.Pc.LocalDescription().SDP {
+		t.Error("Expected the server to use the description of the client")
+	}
+}
+
+func TestRenegotiateAfterAddingChannel(t *testing.T) {
+	tests := []struct {
+		name      string
+		polite    bool // whether the (polite) server offers instead of the client
+		transport bool
+	}{
+		{"over control channel", false, false},
+		{"over signaling transport", false, true},
+		{"by polite peer", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := rtctest.NewConnectedPair(t)
+			offerer, answerer := client, server
+			if tt.polite {
+				offerer, answerer = server, client
+			}
+			if tt.transport {
+				offerer.SetSignalingTransport(func(offer rtc.RequestSDP) (webrtc.SessionDescription, error) {
+					ctx, cancel := context.WithTimeout(context.Background(), receiveTimeout)
+					defer cancel()
+					return answerer.AnswerRenegotiation(ctx, offer.Offer)
+				})
+			}
+			channels := collectChannels(answerer)
+
+			if _, err := offerer.OpenChannel("telemetry", rtc.ReliableChannel); err != nil {
+				t.Fatalf("Cannot open channel: %v", err)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), receiveTimeout)
+			defer cancel()
+			if err := offerer.Renegotiate(ctx); err != nil {
+				t.Fatalf("Cannot renegotiate: %v", err)
+			}
+			expectConverged(t, client, server)
+
+			select {
+			case name := <-channels:
+				if name != "telemetry" {
+					t.Errorf("Expected channel telemetry, got %s", name)
+				}
+			case <-time.After(receiveTimeout):
+				t.Errorf("Expected %s to receive the new channel", answerer.Id)
+			}
+		})
+	}
+}
+
+func TestRenegotiateCollision(t *testing.T) {
+	client, server := rtctest.NewConnectedPair(t)
+	// The server accepted the offer, so it is the polite peer and yields to the client
+	ctx, cancel := context.WithTimeout(context.Background(), receiveTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	errs := make(map[string]error, 2)
+	var lock sync.Mutex
+	for _, peer := range []*rtc.RTC{client, server} {
+		wg.Add(1)
+		go func(peer *rtc.RTC) {
+			defer wg.Done()
+			err := peer.Renegotiate(ctx)
+			lock.Lock()
+			errs[peer.Id] = err
+			lock.Unlock()
+		}(peer)
+	}
+	wg.Wait()
+
+	if err := errs["client"]; err != nil {
+		t.Errorf("Expected the offer of the impolite client to succeed, got %v", err)
+	}
+	if err := errs["server"]; err != nil && !errors.Is(err, rtc.ErrOfferRolledBack) {
+		t.Errorf("Expected the offer of the polite server to succeed or be withdrawn, got %v", err)
+	}
+	expectConverged(t, client, server)
+}
@@ -0,0 +1,406 @@
+package rtc
+
+import (
+	"context"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/rs/zerolog"
+)
+
+//
+// This file contains the functional options of NewRTCWithOptions, which sets up the complete connection (peer connection, channels and
+// candidate collection) instead of leaving that to the caller
+//
+
+// Configures a connection created with NewRTCWithOptions
+type Option func(o *options)
+
+type options struct {
+	iceServers        []webrtc.ICEServer
+	orderedControl    bool
+	channelProtocol   string
+	dataConfig        ChannelConfig
+	logger            *zerolog.Logger
+	maxBufferedAmount uint64
+	gatheringTimeout  time.Duration
+	auth              func(id, token string) error
+	token             string
+	role              Role
+	metadata          map[string]string
+	autoICERestart    bool
+	iceRestartDelay   time.Duration
+	eventHistorySize  int
+	sendRate          float64
+	sendBurst         int
+	sendPolicy        RateLimitPolicy
+	codec             Codec
+	codecThreshold    int
+	inBandTrickle     bool
+	candidateFilter   func(candidate webrtc.ICECandidateInit) bool
+	interfaces        []string
+	interfacePriority []string
+	disconnectTimeout time.Duration
+	failFast          bool
+	signalingLimiter  *SignalingLimiter
+	interceptors      []SendInterceptor
+	breakerThreshold  int
+	breakerInterval   time.Duration
+	ctx               context.Context
+	sendQueue         bool // whether WithSendQueue was passed
+	queueSize         int
+	queuePolicy       QueuePolicy
+}
+
+// Use the given STUN/TURN servers to gather ICE candidates
+func WithICEServers(servers []webrtc.ICEServer) Option {
+	return func(o *options) {
+		o.iceServers = servers
+	}
+}
+
+// Use the STUN/TURN servers of the given configuration (see LoadICEConfigFromEnv and LoadICEConfigFromFile)
+func WithICEConfig(config ICEConfig) Option {
+	return func(o *options) {
+		o.iceServers = config.ToWebRTC()
+	}
+}
+
+// Only use the ICE candidates for which filter returns true, such as HostOnlyFilter (see SetCandidateFilter)
+func WithCandidateFilter(filter func(candidate webrtc.ICECandidateInit) bool) Option {
+	return func(o *options) {
+		o.candidateFilter = filter
+	}
+}
+
+// Only gather local candidates on the network interfaces with the given names (see SetInterfaceAllowlist)
+func WithInterfaceAllowlist(interfaces ...string) Option {
+	return func(o *options) {
+		o.interfaces = interfaces
+	}
+}
+
+// Only gather local candidates on the network interfaces with the given names, and prefer them in the given order (see SetInterfacePriority)
+func WithInterfacePriority(interfaces []string) Option {
+	return func(o *options) {
+		o.interfacePriority = interfaces
+	}
+}
+
+// Whether messages on the control channel are delivered in order (default true)
+func WithOrderedControlChannel(ordered bool) Option {
+	return func(o *options) {
+		o.orderedControl = ordered
+	}
+}
+
+// Use the given sub-protocol (e.g. to version the messages) for the control and data channel, unless the data channel config sets its own,
+// and require it on the channels announced by the peer (see RequireChannelProtocol). Channels opened with OpenChannel use the protocol of their config
+func WithChannelProtocol(protocol string) Option {
+	return func(o *options) {
+		o.channelProtocol = protocol
+	}
+}
+
+// Limit the number of retransmissions of a message on the data channel, making it partially reliable (by default it is fully reliable)
+func WithDataChannelMaxRetransmits(maxRetransmits uint16) Option {
+	return func(o *options) {
+		o.dataConfig.Unreliable = true
+		o.dataConfig.MaxRetransmits = maxRetransmits
+	}
+}
+
+// Set the delivery semantics of the data channel (by default ReliableChannel)
+func WithDataChannelConfig(config ChannelConfig) Option {
+	return func(o *options) {
+		o.dataConfig = config
+	}
+}
+
+// Limit the number of bytes buffered on the data channel (see SetMaxBufferedAmount)
+func WithMaxBufferedAmount(max uint64) Option {
+	return func(o *options) {
+		o.maxBufferedAmount = max
+	}
+}
+
+// How long AcceptOffer and CreateOffer wait for ICE gathering before they continue with the candidates gathered so far (by default DefaultGatheringTimeout)
+func WithGatheringTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.gatheringTimeout = timeout
+	}
+}
+
+// Verify the token of every signaling request with auth (used by AcceptOffer and the signaling handlers), before a connection is created.
+// Requests for which auth returns an error are refused with an error wrapping ErrUnauthorized
+func WithAuthFunc(auth func(id, token string) error) Option {
+	return func(o *options) {
+		o.auth = auth
+	}
+}
+
+// Send the given token with the signaling requests of CreateOffer and DialSignalingWS, to authenticate with the server
+func WithToken(token string) Option {
+	return func(o *options) {
+		o.token = token
+	}
+}
+
+// Give the connection the given role (by default RoleOperator)
+func WithRole(role Role) Option {
+	return func(o *options) {
+		o.role = role
+	}
+}
+
+// Attach application-defined information to the connection (see Metadata)
+func WithMetadata(metadata map[string]string) Option {
+	return func(o *options) {
+		o.metadata = metadata
+	}
+}
+
+// Restart ICE automatically when the connection is disconnected for longer than the restart delay (see WithICERestartDelay
+// and RestartICE, which needs a signaling transport). Only the peer that creates the offer restarts ICE, so this has no effect on a connection
+// created by AcceptOffer
+func WithAutoICERestart(enabled bool) Option {
+	return func(o *options) {
+		o.autoICERestart = enabled
+	}
+}
+
+// Set how long the connection has to be disconnected before ICE is restarted automatically (by default DefaultICERestartDelay)
+func WithICERestartDelay(delay time.Duration) Option {
+	return func(o *options) {
+		o.iceRestartDelay = delay
+	}
+}
+
+// Keep the last size lifecycle events of the connection (see SetEventHistorySize)
+func WithEventHistorySize(size int) Option {
+	return func(o *options) {
+		o.eventHistorySize = size
+	}
+}
+
+// Limit the messages sent on the data channel to perSecond, with bursts of up to burst messages (see SetSendRateLimit).
+// By default, messages beyond the rate are delayed, use WithSendRateLimitPolicy to drop them instead
+func WithSendRateLimit(perSecond float64, burst int) Option {
+	return func(o *options) {
+		o.sendRate = perSecond
+		o.sendBurst = burst
+	}
+}
+
+// Set what happens to messages beyond the rate limit of WithSendRateLimit (by default RateLimitBlock)
+func WithSendRateLimitPolicy(policy RateLimitPolicy) Option {
+	return func(o *options) {
+		o.sendPolicy = policy
+	}
+}
+
+// Compress data messages larger than the compression threshold with the given codec (see EnableCompression)
+func WithCompression(codec Codec) Option {
+	return func(o *options) {
+		o.codec = codec
+	}
+}
+
+// Set the size above which data messages are compressed (by default DefaultCompressionThreshold)
+func WithCompressionThreshold(threshold int) Option {
+	return func(o *options) {
+		o.codecThreshold = threshold
+	}
+}
+
+// Send local candidates that are gathered after the control channel opened to the peer over the control channel (see EnableInBandTrickle)
+func WithInBandTrickle(enabled bool) Option {
+	return func(o *options) {
+		o.inBandTrickle = enabled
+	}
+}
+
+// Destroy the connection when it is disconnected for longer than timeout (see SetDisconnectTimeout)
+func WithDisconnectTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.disconnectTimeout = timeout
+	}
+}
+
+// Destroy the connection as soon as it fails (see SetFailFast)
+func WithFailFast(enabled bool) Option {
+	return func(o *options) {
+		o.failFast = enabled
+	}
+}
+
+// Limit the rate of the signaling requests per id with the given limiter (see NewSignalingLimiter). Only applies to the signaling helpers
+// (AcceptOffer, NewSignalingHandler and ServeSignalingWS)
+func WithSignalingLimiter(limiter *SignalingLimiter) Option {
+	return func(o *options) {
+		o.signalingLimiter = limiter
+	}
+}
+
+// Pass the messages sent on the data channel through the given interceptor, e.g. SimulateLatency or SimulateLoss (see AddSendInterceptor).
+// Can be given multiple times, the interceptors are applied in order
+func WithSendInterceptor(interceptor func(b []byte) ([]byte, bool)) Option {
+	return func(o *options) {
+		o.interceptors = append(o.interceptors, interceptor)
+	}
+}
+
+// Open the circuit breaker of a channel once it failed threshold sends in a row (see EnableCircuitBreaker)
+func WithCircuitBreaker(threshold int, probeInterval time.Duration) Option {
+	return func(o *options) {
+		o.breakerThreshold = threshold
+		o.breakerInterval = probeInterval
+	}
+}
+
+// Start the writer with a queue that holds up to size messages per channel, and the given policy for a channel whose queue is full
+// (see StartWriterWithPolicy). Creating the connection fails if size is not positive
+func WithSendQueue(size int, policy QueuePolicy) Option {
+	return func(o *options) {
+		o.sendQueue = true
+		o.queueSize = size
+		o.queuePolicy = policy
+	}
+}
+
+// Close the connection gracefully once ctx is done (see BindContext)
+func WithContext(ctx context.Context) Option {
+	return func(o *options) {
+		o.ctx = ctx
+	}
+}
+
+// Use the given logger for this connection, instead of the package logger (see SetLogger)
+func WithLogger(l zerolog.Logger) Option {
+	return func(o *options) {
+		o.logger = &l
+	}
+}
+
+// Create a connection with the given options, including the peer connection and the control and data channels. Local ICE candidates are
+// collected automatically (see GetAllLocalCandidates). The channels are created in-band, so this is meant for the peer that creates the offer,
+// the answering peer uses AcceptDataChannels to pick them up. Channels that the answering peer opens later are accepted as well
+func NewRTCWithOptions(id string, opts ...Option) (*RTC, error) {
+	o := applyOptions(opts)
+	r, err := newPeer(id, o)
+	if err != nil {
+		return nil, err
+	}
+
+	controlInit := &webrtc.DataChannelInit{Ordered: &o.orderedControl}
+	if o.channelProtocol != "" {
+		controlInit.Protocol = &o.channelProtocol
+	}
+	controlChannel, err := r.peerConnection().CreateDataChannel(ControlChannelLabel, controlInit)
+	if err != nil {
+		r.Destroy()
+		return nil, err
+	}
+	if err := r.AddChannel(controlChannel); err != nil {
+		r.Destroy()
+		return nil, err
+	}
+	r.SetControlChannel(controlChannel)
+
+	dataConfig := o.dataConfig
+	if dataConfig.Protocol == "" {
+		dataConfig.Protocol = o.channelProtocol
+	}
+	if err := r.SetupDataChannel(dataConfig); err != nil {
+		r.Destroy()
+		return nil, err
+	}
+	if err := r.AcceptDataChannels(); err != nil {
+		r.Destroy()
+		return nil, err
+	}
+
+	if o.autoICERestart {
+		r.enableAutoICERestart(o.iceRestartDelay)
+	}
+
+	return r, nil
+}
+
+// Returns the options with the defaults filled in
+func applyOptions(opts []Option) options {
+	o := options{
+		orderedControl:   true,
+		dataConfig:       ReliableChannel,
+		gatheringTimeout: DefaultGatheringTimeout,
+		iceRestartDelay:  DefaultICERestartDelay,
+		codecThreshold:   DefaultCompressionThreshold,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// Create a connection and its peer connection with the given options, collecting local ICE candidates automatically
+func newPeer(id string, o options) (*RTC, error) {
+	r := NewRTC(id)
+	if o.logger != nil {
+		r.logger.Store(o.logger)
+	}
+	r.SetMaxBufferedAmount(o.maxBufferedAmount)
+	r.SetRole(o.role)
+	r.SetSendRateLimit(o.sendRate, o.sendBurst, o.sendPolicy)
+	r.EnableCompression(o.codec, o.codecThreshold)
+	r.EnableInBandTrickle(o.inBandTrickle)
+	r.SetCandidateFilter(o.candidateFilter)
+	if o.channelProtocol != "" {
+		r.RequireChannelProtocol(o.channelProtocol, nil)
+	}
+	r.SetDisconnectTimeout(o.disconnectTimeout)
+	r.SetFailFast(o.failFast)
+	r.EnableCircuitBreaker(o.breakerThreshold, o.breakerInterval)
+	for _, interceptor := range o.interceptors {
+		r.AddSendInterceptor(interceptor)
+	}
+	if len(o.interfaces) > 0 {
+		if err := r.SetInterfaceAllowlist(o.interfaces); err != nil {
+			return nil, err
+		}
+	}
+	if len(o.interfacePriority) > 0 {
+		if err := r.SetInterfacePriority(o.interfacePriority); err != nil {
+			return nil, err
+		}
+	}
+	if o.eventHistorySize > 0 {
+		r.SetEventHistorySize(o.eventHistorySize)
+	}
+	for key, value := range o.metadata {
+		r.Metadata[key] = value
+	}
+
+	err := r.CreatePeerConnection(webrtc.Configuration{ICEServers: o.iceServers})
+	if err != nil {
+		return nil, err
+	}
+
+	r.peerConnection().OnICECandidate(func(candidate *webrtc.ICECandidate) {
+		// A nil candidate signals the end of gathering
+		if candidate == nil {
+			return
+		}
+		r.AddLocalCandidate(candidate.ToJSON())
+	})
+	// The writer and the context binding run goroutines, so they are started last to not leak them when an earlier step fails
+	if o.sendQueue {
+		if err := r.StartWriterWithPolicy(o.queueSize, o.queuePolicy); err != nil {
+			r.Destroy()
+			return nil, err
+		}
+	}
+	if o.ctx != nil {
+		r.BindContext(o.ctx)
+	}
+	return r, nil
+}
@@ -0,0 +1,69 @@
+package rtc_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/pion/webrtc/v4"
+)
+
+func TestNewRTCWithOptionsDefaults(t *testing.T) {
+	r, err := rtc.NewRTCWithOptions("client")
+	if err != nil {
+		t.Fatalf("Cannot create connection: %v", err)
+	}
+	t.Cleanup(func() { r.Destroy() })
+
+	if r.Pc == nil {
+		t.Fatal("Expected the peer connection to be created")
+	}
+	if servers := r.Pc.GetConfiguration().ICEServers; len(servers) != 0 {
+		t.Errorf("Expected no ICE servers, got %v", servers)
+	}
+	if control := r.ControlChannel(); control == nil || !control.Ordered() {
+		t.Error("Expected an ordered control channel")
+	}
+	if data := r.DataChannel(); data == nil || data.MaxRetransmits() != nil || data.MaxPacketLifeTime() != nil {
+		t.Error("Expected a reliable data channel")
+	}
+
+	// The plain constructor does not set anything up
+	if plain := rtc.NewRTC("client"); plain.Pc != nil || plain.ControlChannel() != nil || plain.DataChannel() != nil {
+		t.Error("Expected NewRTC to not create a peer connection or channels")
+	}
+}
+
+func TestNewRTCWithOptions(t *testing.T) {
+	servers := []webrtc.ICEServer{{URLs: []string{"stun:stun.example.com:3478"}}}
+	r, err := rtc.NewRTCWithOptions("client",
+		rtc.WithICEServers(servers),
+		rtc.WithOrderedControlChannel(false),
+		rtc.WithDataChannelMaxRetransmits(3),
+	)
+	if err != nil {
+		t.Fatalf("Cannot create connection: %v", err)
+	}
+	t.Cleanup(func() { r.Destroy() })
+
+	if got := r.Pc.GetConfiguration().ICEServers; !reflect.DeepEqual(got, servers) {
+		t.Errorf("Expected ICE servers %v, got %v", servers, got)
+	}
+	if r.ControlChannel().Ordered() {
+		t.Error("Expected an unordered control channel")
+	}
+	if retransmits := r.DataChannel().MaxRetransmits(); retransmits == nil || *retransmits != 3 {
+		t.Errorf("Expected the data channel to retransmit at most 3 times, got %v", retransmits)
+	}
+}
+
+func TestNewRTCWithInvalidOptions(t *testing.T) {
+	invalid := rtc.ChannelConfig{Unreliable: true, MaxRetransmits: 3, MaxPacketLifeTime: time.Second}
+	if _, err := rtc.NewRTCWithOptions("client", rtc.WithDataChannelConfig(invalid)); err == nil {
+		t.Error("Expected an error for an invalid data channel configuration")
+	}
+	if _, err := rtc.NewRTCWithOptions("client", rtc.WithSendQueue(0, rtc.QueueBlock)); err == nil {
+		t.Error("Expected an error for a send queue without space")
+	}
+}
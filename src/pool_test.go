@@ -0,0 +1,129 @@
+package rtc_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// A mock channel that drops every message, so that benchmarks measure the send path only
+type discardChannel struct {
+	*rtc.MockChannel
+}
+
+func (discardChannel) Send(b []byte) error {
+	return nil
+}
+
+// A telemetry message of a realistic size
+func telemetry(tb testing.TB) proto.Message {
+	tb.Helper()
+
+	return wrapperspb.Bytes(bytes.Repeat([]byte{0x2a}, 256))
+}
+
+func TestSendDataMarshalsMessage(t *testing.T) {
+	r := rtc.NewRTC("rover")
+	dc := rtc.NewMockChannel(rtc.DataChannelLabel)
+	r.SetDataChannel(dc)
+	msg := telemetry(t)
+
+	// The pooled buffers are reused, every message is sent as it is marshalled
+	for i := 0; i < 3; i++ {
+		if err := r.SendData(msg); err != nil {
+			t.Fatalf("Cannot send message: %v", err)
+		}
+	}
+	for i, sent := range dc.Sent() {
+		var got wrapperspb.BytesValue
+		if err := proto.Unmarshal(sent, &got); err != nil {
+			t.Fatalf("Cannot unmarshal message %d: %v", i, err)
+		}
+		if !proto.Equal(&got, msg) {
+			t.Errorf("Message %d differs from the sent message", i)
+		}
+	}
+}
+
+func BenchmarkSendData(b *testing.B) {
+	r := rtc.NewRTC("rover")
+	r.SetDataChannel(discardChannel{rtc.NewMockChannel(rtc.DataChannelLabel)})
+	msg := telemetry(b)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := r.SendData(msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// The send path without pooling, as a baseline for BenchmarkSendData
+func BenchmarkSendDataUnpooled(b *testing.B) {
+	r := rtc.NewRTC("rover")
+	r.SetDataChannel(discardChannel{rtc.NewMockChannel(rtc.DataChannelLabel)})
+	msg := telemetry(b)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		content, err := proto.Marshal(msg)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := r.SendDataBytes(content); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// A map with ten connected connections (broadcasts skip connections that are not connected)
+func newBroadcastMap(b *testing.B) *rtc.RTCMap {
+	b.Helper()
+
+	m := rtc.NewRTCMap()
+	ids := make([]string, 10)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("client-%d", i)
+	}
+	connectToMap(b, m, ids...)
+	return m
+}
+
+func BenchmarkBroadcast(b *testing.B) {
+	m := newBroadcastMap(b)
+	msg := telemetry(b)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := m.Broadcast(msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Marshalling the message for every connection without pooling, as a baseline for BenchmarkBroadcast
+func BenchmarkBroadcastUnpooled(b *testing.B) {
+	m := newBroadcastMap(b)
+	msg := telemetry(b)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.ForEach(func(id string, r *rtc.RTC) {
+			content, err := proto.Marshal(msg)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if err := r.SendDataBytes(content); err != nil {
+				b.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package rtc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+//
+// This file contains the bidirectional connectivity probe. A connection can report to be connected while data only flows in one direction
+// (e.g. because of an asymmetric NAT or firewall), which is only detected by sending a probe and requiring the peer to echo it back
+//
+
+var (
+	// The connection (or its control channel) is down
+	ErrNotConnected = errors.New("Connection is not established")
+	// The connection is up, but the peer did not echo the probe in time, so data does not flow in both directions
+	ErrNoEcho = errors.New("Peer did not echo the probe, connectivity is one-way")
+)
+
+// Verify that data flows in both directions by sending a probe on the control channel and waiting for the peer to echo it, until ctx is done.
+// Returns ErrNotConnected if the connection is down and ErrNoEcho if the probe was not echoed. The peer needs to use SetControlChannel to echo probes
+func (r *RTC) VerifyBidirectional(ctx context.Context) error {
+	if r.peerConnection() == nil || !r.IsConnected() || channelOpen(r.controlMessageChannel()) != nil {
+		return ErrNotConnected
+	}
+
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	id := binary.BigEndian.Uint64(nonce)
+
+	echoed := make(chan struct{})
+	r.lock.Lock()
+	r.probes[id] = echoed
+	r.lock.Unlock()
+	defer func() {
+		r.lock.Lock()
+		delete(r.probes, id)
+		r.lock.Unlock()
+	}()
+
+	if err := r.SendControlFrame(controlTypeProbe, nonce); err != nil {
+		return fmt.Errorf("%w: %w", ErrNotConnected, err)
+	}
+
+	select {
+	case <-echoed:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%w: %w", ErrNoEcho, ctx.Err())
+	}
+}
+
+// Echo a probe back to the peer
+func (r *RTC) handleProbe(payload []byte) {
+	if err := r.SendControlFrame(controlTypeProbeEcho, payload); err != nil {
+		log := r.Log()
+		log.Debug().Err(err).Msg("Could not echo probe")
+	}
+}
+
+// Mark the probe as echoed
+func (r *RTC) handleProbeEcho(payload []byte) {
+	if len(payload) != 8 {
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if echoed, ok := r.probes[binary.BigEndian.Uint64(payload)]; ok {
+		close(echoed)
+		delete(r.probes, binary.BigEndian.Uint64(payload))
+	}
+}
@@ -0,0 +1,47 @@
+package rtc_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/VU-ASE/roverrtc/src/rtctest"
+)
+
+func TestVerifyBidirectional(t *testing.T) {
+	client, server := rtctest.NewConnectedPair(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), receiveTimeout)
+	defer cancel()
+	for _, peer := range []*rtc.RTC{client, server} {
+		if err := peer.VerifyBidirectional(ctx); err != nil {
+			t.Errorf("Expected %s to verify connectivity, got %v", peer.Id, err)
+		}
+	}
+}
+
+func TestVerifyBidirectionalOneWay(t *testing.T) {
+	client, server := rtctest.NewConnectedPair(t)
+	// Nothing the server sends on the control channel arrives, so the probe is never echoed
+	server.AddControlSendInterceptor(rtc.SimulateLoss(1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), silenceTimeout)
+	defer cancel()
+	if err := client.VerifyBidirectional(ctx); !errors.Is(err, rtc.ErrNoEcho) {
+		t.Errorf("Expected ErrNoEcho, got %v", err)
+	}
+}
+
+func TestVerifyBidirectionalNotConnected(t *testing.T) {
+	client, _ := rtctest.NewConnectedPair(t)
+	if err := client.Destroy(); err != nil {
+		t.Fatalf("Cannot destroy connection: %v", err)
+	}
+
+	for _, r := range []*rtc.RTC{rtc.NewRTC("client"), client} {
+		if err := r.VerifyBidirectional(context.Background()); !errors.Is(err, rtc.ErrNotConnected) {
+			t.Errorf("Expected ErrNotConnected, got %v", err)
+		}
+	}
+}
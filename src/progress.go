@@ -0,0 +1,36 @@
+package rtc
+
+import "github.com/pion/webrtc/v4"
+
+// The progress of ICE candidate gathering, e.g. to drive a "finding connectivity options..." indicator
+type GatheringStats struct {
+	Host  int                      // the number of host candidates gathered so far
+	Srflx int                      // the number of server reflexive candidates gathered so far
+	Prflx int                      // the number of peer reflexive candidates gathered so far
+	Relay int                      // the number of relay candidates gathered so far
+	State webrtc.ICEGatheringState // the current gathering state (unknown if the connection is nil)
+}
+
+// Returns the number of local ICE candidates gathered so far (by type) and the current gathering state
+func (r *RTC) GatheringProgress() GatheringStats {
+	stats := GatheringStats{
+		State: webrtc.ICEGatheringStateUnknown,
+	}
+	if pc := r.peerConnection(); pc != nil {
+		stats.State = pc.ICEGatheringState()
+	}
+
+	for _, candidate := range r.GetAllLocalCandidates() {
+		switch candidateType(candidate) {
+		case webrtc.ICECandidateTypeHost:
+			stats.Host++
+		case webrtc.ICECandidateTypeSrflx:
+			stats.Srflx++
+		case webrtc.ICECandidateTypePrflx:
+			stats.Prflx++
+		case webrtc.ICECandidateTypeRelay:
+			stats.Relay++
+		}
+	}
+	return stats
+}
@@ -0,0 +1,53 @@
+package rtc_test
+
+import (
+	"context"
+	"testing"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/pion/webrtc/v4"
+)
+
+func TestGatheringProgressCountsByType(t *testing.T) {
+	r := rtc.NewRTC("client")
+	for port, typ := range map[int]string{50000: "host", 50001: "host", 50002: "srflx", 50003: "prflx", 50004: "relay"} {
+		r.AddLocalCandidate(candidateOfType(typ, port))
+	}
+
+	want := rtc.GatheringStats{Host: 2, Srflx: 1, Prflx: 1, Relay: 1, State: webrtc.ICEGatheringStateUnknown}
+	if progress := r.GatheringProgress(); progress != want {
+		t.Errorf("Expected %+v, got %+v", want, progress)
+	}
+}
+
+func TestGatheringProgress(t *testing.T) {
+	r, err := rtc.NewRTCWithOptions("client")
+	if err != nil {
+		t.Fatalf("Cannot create connection: %v", err)
+	}
+	t.Cleanup(func() { r.Destroy() })
+	if progress := r.GatheringProgress(); progress.State != webrtc.ICEGatheringStateNew || progress.Host != 0 {
+		t.Errorf("Expected no progress before gathering started, got %+v", progress)
+	}
+
+	offer, err := r.Pc.CreateOffer(nil)
+	if err != nil {
+		t.Fatalf("Cannot create offer: %v", err)
+	}
+	if err := r.SetLocalDescription(offer); err != nil {
+		t.Fatalf("Cannot set local description: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), receiveTimeout)
+	defer cancel()
+	if err := r.WaitForICEGathering(ctx); err != nil {
+		t.Fatalf("Cannot wait for ICE gathering: %v", err)
+	}
+
+	progress := r.GatheringProgress()
+	if progress.State != webrtc.ICEGatheringStateComplete {
+		t.Errorf("Expected gathering to be complete, got %s", progress.State)
+	}
+	if progress.Host == 0 || progress.Host != len(r.GetAllLocalCandidates()) {
+		t.Errorf("Expected all %d local candidates to be host candidates, got %+v", len(r.GetAllLocalCandidates()), progress)
+	}
+}
@@ -0,0 +1,166 @@
+package rtc
+
+import (
+	"math"
+	"time"
+)
+
+//
+// This file contains the classification of the link quality (good, degraded or bad), for operators that need a simple indicator rather
+// than raw statistics. The link is classified on every keep-alive tick (see StartKeepalive and StartSyncedHeartbeat) from the recent round
+// trip times, their variation and the growth of the buffered amount of the data channel. A new classification only takes effect once it was
+// observed on several consecutive ticks, so that the quality does not flap on a single outlier
+//
+
+// The quality of the link
+type Quality int
+
+const (
+	QualityUnknown Quality = iota // no round trip time was measured yet
+	QualityGood
+	QualityDegraded
+	QualityBad
+)
+
+func (q Quality) String() string {
+	switch q {
+	case QualityGood:
+		return "good"
+	case QualityDegraded:
+		return "degraded"
+	case QualityBad:
+		return "bad"
+	default:
+		return "unknown"
+	}
+}
+
+// The thresholds at which the link is classified as degraded or bad. A threshold of 0 disables the check
+type QualityThresholds struct {
+	DegradedRTT      time.Duration // the average round trip time above which the link is degraded
+	BadRTT           time.Duration // the average round trip time above which the link is bad
+	DegradedJitter   time.Duration // the standard deviation of the round trip times above which the link is degraded
+	BadJitter        time.Duration // the standard deviation of the round trip times above which the link is bad
+	DegradedBuffered uint64        // the buffered amount of the data channel above which the link is degraded, if it grew since the last tick
+	BadBuffered      uint64        // the buffered amount of the data channel above which the link is bad, if it grew since the last tick
+	Hysteresis       int           // the number of consecutive ticks a new classification must be observed on before it takes effect
+}
+
+// The thresholds used when none are configured
+var DefaultQualityThresholds = QualityThresholds{
+	DegradedRTT:      150 * time.Millisecond,
+	BadRTT:           500 * time.Millisecond,
+	DegradedJitter:   50 * time.Millisecond,
+	BadJitter:        200 * time.Millisecond,
+	DegradedBuffered: 256 * 1024,
+	BadBuffered:      1024 * 1024,
+	Hysteresis:       3,
+}
+
+type qualityFunc func(old, new Quality)
+
+// The classification state of a connection, guarded by the lock of the connection
+type qualityTracker struct {
+	thresholds   QualityThresholds
+	current      Quality
+	pending      Quality // the classification that is observed, but did not take effect yet
+	streak       int     // the number of consecutive ticks pending was observed on
+	lastBuffered uint64  // the buffered amount of the data channel at the last tick
+	onChange     qualityFunc
+}
+
+// Set the thresholds used to classify the link quality
+func (r *RTC) SetQualityThresholds(thresholds QualityThresholds) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.quality.thresholds = thresholds
+}
+
+// Returns the current classification of the link quality. The link is only classified while a keep-alive is running
+func (r *RTC) Quality() Quality {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.quality.current
+}
+
+// Register a handler that is called when the classification of the link quality changes
+func (r *RTC) OnQualityChange(handler func(old, new Quality)) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.quality.onChange = handler
+}
+
+// Classify the link from the recent round trip times and the buffered amount, and apply the classification once it is stable
+func (r *RTC) updateQuality() {
+	var buffered uint64
+	if dc := r.dataMessageChannel(); dc != nil {
+		buffered = dc.BufferedAmount()
+	}
+
+	r.lock.Lock()
+	q := &r.quality
+	observed := classifyQuality(q.thresholds, r.rttHistory, buffered > q.lastBuffered, buffered)
+	q.lastBuffered = buffered
+
+	if observed == q.current {
+		q.streak = 0
+		r.lock.Unlock()
+		return
+	}
+	if observed != q.pending {
+		q.pending = observed
+		q.streak = 0
+	}
+	q.streak++
+	// Leaving the unknown state does not need to wait, there is no classification to flap from
+	if q.streak < q.thresholds.Hysteresis && q.current != QualityUnknown {
+		r.lock.Unlock()
+		return
+	}
+
+	old := q.current
+	q.current = observed
+	q.streak = 0
+	handler := q.onChange
+	r.lock.Unlock()
+
+	log := r.Log()
+	log.Info().Stringer("old", old).Stringer("new", observed).Msg("Link quality changed")
+	if handler != nil {
+		handler(old, observed)
+	}
+}
+
+// Classify the link as the worst of the classifications of the round trip times, their variation and the buffered amount
+func classifyQuality(t QualityThresholds, rtts []time.Duration, growing bool, buffered uint64) Quality {
+	if len(rtts) == 0 {
+		return QualityUnknown
+	}
+
+	var total time.Duration
+	for _, rtt := range rtts {
+		total += rtt
+	}
+	mean := total / time.Duration(len(rtts))
+	var variance float64
+	for _, rtt := range rtts {
+		diff := float64(rtt - mean)
+		variance += diff * diff
+	}
+	jitter := time.Duration(math.Sqrt(variance / float64(len(rtts))))
+
+	exceeds := func(value, threshold time.Duration) bool {
+		return threshold > 0 && value > threshold
+	}
+	switch {
+	case exceeds(mean, t.BadRTT), exceeds(jitter, t.BadJitter), growing && t.BadBuffered > 0 && buffered > t.BadBuffered:
+		return QualityBad
+	case exceeds(mean, t.DegradedRTT), exceeds(jitter, t.DegradedJitter), growing && t.DegradedBuffered > 0 && buffered > t.DegradedBuffered:
+		return QualityDegraded
+	default:
+		return QualityGood
+	}
+}
@@ -0,0 +1,98 @@
+package rtc
+
+import (
+	"testing"
+	"time"
+)
+
+// Classify the link of the connection as if the given round trip times were the recent measurements
+func observe(r *RTC, rtts ...time.Duration) {
+	r.lock.Lock()
+	r.rttHistory = rtts
+	r.lock.Unlock()
+	r.updateQuality()
+}
+
+func TestQualityTransitions(t *testing.T) {
+	r := NewRTC("rover")
+	r.SetQualityThresholds(QualityThresholds{DegradedRTT: 100 * time.Millisecond, BadRTT: 300 * time.Millisecond, Hysteresis: 3})
+	var changes []string
+	r.OnQualityChange(func(old, new Quality) {
+		changes = append(changes, old.String()+"->"+new.String())
+	})
+
+	steps := []struct {
+		rtt  time.Duration
+		want Quality
+	}{
+		// The first measurement is applied right away
+		{20 * time.Millisecond, QualityGood},
+		// A degraded link is only reported once it is observed three times in a row
+		{200 * time.Millisecond, QualityGood},
+		{200 * time.Millisecond, QualityGood},
+		{200 * time.Millisecond, QualityDegraded},
+		// A single outlier does not change the classification, and starts over the count
+		{500 * time.Millisecond, QualityDegraded},
+		{200 * time.Millisecond, QualityDegraded},
+		{500 * time.Millisecond, QualityDegraded},
+		{500 * time.Millisecond, QualityDegraded},
+		{500 * time.Millisecond, QualityBad},
+		{20 * time.Millisecond, QualityBad},
+		{20 * time.Millisecond, QualityBad},
+		{20 * time.Millisecond, QualityGood},
+	}
+	for i, step := range steps {
+		observe(r, step.rtt)
+		if got := r.Quality(); got != step.want {
+			t.Fatalf("Expected quality %s after step %d (rtt %s), got %s", step.want, i, step.rtt, got)
+		}
+	}
+
+	want := []string{"unknown->good", "good->degraded", "degraded->bad", "bad->good"}
+	if len(changes) != len(want) {
+		t.Fatalf("Expected changes %v, got %v", want, changes)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("Expected change %d to be %s, got %s", i, want[i], changes[i])
+		}
+	}
+}
+
+func TestClassifyQuality(t *testing.T) {
+	thresholds := QualityThresholds{
+		DegradedRTT:      100 * time.Millisecond,
+		BadRTT:           300 * time.Millisecond,
+		DegradedJitter:   50 * time.Millisecond,
+		BadJitter:        200 * time.Millisecond,
+		DegradedBuffered: 1000,
+		BadBuffered:      10000,
+	}
+	ms := time.Millisecond
+
+	tests := []struct {
+		name     string
+		rtts     []time.Duration
+		growing  bool
+		buffered uint64
+		want     Quality
+	}{
+		{"no measurements", nil, false, 0, QualityUnknown},
+		{"fast", []time.Duration{20 * ms, 30 * ms, 25 * ms}, false, 0, QualityGood},
+		{"slow on average", []time.Duration{50 * ms, 150 * ms, 200 * ms}, false, 0, QualityDegraded},
+		{"very slow", []time.Duration{400 * ms, 350 * ms}, false, 0, QualityBad},
+		{"jittery", []time.Duration{10 * ms, 170 * ms, 10 * ms, 170 * ms}, false, 0, QualityDegraded},
+		{"very jittery", []time.Duration{0, 500 * ms, 0, 500 * ms}, false, 0, QualityBad},
+		{"buffer growing", []time.Duration{20 * ms}, true, 5000, QualityDegraded},
+		{"buffer growing fast", []time.Duration{20 * ms}, true, 20000, QualityBad},
+		{"buffer full but draining", []time.Duration{20 * ms}, false, 20000, QualityGood},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyQuality(thresholds, tt.rtts, tt.growing, tt.buffered); got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
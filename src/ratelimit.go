@@ -0,0 +1,62 @@
+package rtc
+
+import (
+	"sync"
+	"time"
+)
+
+//
+// This file contains a simple token bucket, used to limit the rate of events (e.g. accepted connections)
+//
+
+type tokenBucket struct {
+	lock   *sync.Mutex
+	rate   float64 // tokens added per second
+	burst  float64 // the maximum number of tokens
+	tokens float64
+	last   time.Time // the last time tokens were added
+}
+
+// Creates a full bucket. A bucket that holds less than one token never allows anything, so the burst is at least 1
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	burst = max(burst, 1)
+	var lock sync.Mutex
+	return &tokenBucket{
+		lock:   &lock,
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Takes a token if one is available, returns whether it was taken
+func (b *tokenBucket) allow() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Returns how long it takes until the next token is available
+func (b *tokenBucket) untilNext() time.Duration {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	missing := 1 - b.tokens - time.Since(b.last).Seconds()*b.rate
+	if missing <= 0 {
+		return 0
+	}
+	return time.Duration(missing / b.rate * float64(time.Second))
+}
@@ -0,0 +1,132 @@
+package rtc
+
+import (
+	"context"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+//
+// This file contains the reaper, which prunes connections that are dead (e.g. a browser that closed without saying goodbye)
+// from an RTCMap, so that they do not linger until the client reconnects with the same id
+//
+
+// How long a connection may be disconnected, failed or closed before the reaper evicts it, if not configured otherwise
+const DefaultReaperGracePeriod = 30 * time.Second
+
+// Set how long a connection may be disconnected, failed or closed before the reaper evicts it. A disconnected connection can still recover
+// by itself, so the grace period should be longer than the disconnected timeout of the connections
+func (m *RTCMap) SetReaperGracePeriod(grace time.Duration) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.reaperGrace = grace
+}
+
+// Register a handler that is called with the id of every connection that is evicted by the reaper (e.g. to clean up state kept per client)
+func (m *RTCMap) OnEvicted(handler func(id string)) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.onEvicted = handler
+}
+
+// Start a goroutine that checks the connections in the map every interval, and destroys and removes the connections that have been dead
+// for longer than the grace period (see SetReaperGracePeriod) or idle for longer than the idle timeout (see SetIdleTimeout). The reaper
+// stops when ctx is done, or when the context of the map is done (see NewRTCMapWithContext)
+func (m *RTCMap) StartReaper(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		deadSince := make(map[*RTC]time.Time)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-m.done:
+				return
+			case <-ticker.C:
+			}
+
+			m.reap(deadSince)
+		}
+	}()
+}
+
+// Evict the connections that have been dead for longer than the grace period, deadSince keeps track of when connections were first seen dead
+func (m *RTCMap) reap(deadSince map[*RTC]time.Time) {
+	log := getDefaultLogger()
+
+	m.lock.RLock()
+	grace := m.reaperGrace
+	idleTimeout := m.idleTimeout
+	onEvicted := m.onEvicted
+	m.lock.RUnlock()
+
+	now := time.Now()
+	seen := make(map[*RTC]bool)
+	m.ForEach(func(id string, rtc *RTC) {
+		seen[rtc] = true
+
+		if idleTimeout > 0 && rtc.Role() != RoleCar {
+			if idle := rtc.IdleFor(); idle > idleTimeout {
+				delete(deadSince, rtc)
+				if m.evict(id, rtc, CloseReasonIdleTimeout, onEvicted) {
+					log.Info().Str("rtcId", id).Dur("idleFor", idle).Msg("Closed idle RTC connection")
+				}
+				return
+			}
+		}
+
+		switch rtc.ConnectionState() {
+		case webrtc.PeerConnectionStateDisconnected, webrtc.PeerConnectionStateFailed, webrtc.PeerConnectionStateClosed:
+		default:
+			delete(deadSince, rtc)
+			return
+		}
+
+		since, ok := deadSince[rtc]
+		if !ok {
+			deadSince[rtc] = now
+			return
+		}
+		if now.Sub(since) < grace {
+			return
+		}
+
+		delete(deadSince, rtc)
+		if m.evict(id, rtc, CloseReasonDestroyed, onEvicted) {
+			log.Info().Str("rtcId", id).Dur("deadFor", now.Sub(since)).Msg("Evicted dead RTC connection")
+		}
+	})
+
+	// Forget the connections that are no longer in the map
+	for rtc := range deadSince {
+		if !seen[rtc] {
+			delete(deadSince, rtc)
+		}
+	}
+}
+
+// Remove a connection from the map and destroy it with the given reason, then pass its id to onEvicted. Returns false if the connection
+// was removed or replaced in the meantime
+func (m *RTCMap) evict(id string, rtc *RTC, reason string, onEvicted func(id string)) bool {
+	m.lock.Lock()
+	evict := m.rtcMap[id] == rtc
+	if evict {
+		_ = m.remove(id)
+	}
+	m.lock.Unlock()
+	if !evict {
+		return false
+	}
+	m.notify()
+
+	rtc.destroy(reason)
+	if onEvicted != nil {
+		onEvicted(id)
+	}
+	return true
+}
@@ -0,0 +1,80 @@
+package rtc_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/pion/webrtc/v4"
+)
+
+// Add a connection whose peer connection is closed without destroying the connection, like a peer that went away
+func addDeadConnection(t *testing.T, m *rtc.RTCMap, id string) {
+	t.Helper()
+
+	r := rtc.NewRTC(id)
+	if err := r.CreatePeerConnection(webrtc.Configuration{}); err != nil {
+		t.Fatalf("Cannot create peer connection: %v", err)
+	}
+	t.Cleanup(func() { r.Destroy() })
+	if err := m.AddConnection(id, r); err != nil {
+		t.Fatalf("Cannot add connection: %v", err)
+	}
+	if err := r.Pc.Close(); err != nil {
+		t.Fatalf("Cannot close peer connection: %v", err)
+	}
+}
+
+func TestReaperEvictsDeadConnections(t *testing.T) {
+	m := rtc.NewRTCMap()
+	connectToMap(t, m, "alive")
+	grace := 200 * time.Millisecond
+	m.SetReaperGracePeriod(grace)
+	evicted := make(chan string, 1)
+	m.OnEvicted(func(id string) { evicted <- id })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	addDeadConnection(t, m, "dead")
+	deadAt := time.Now()
+	m.StartReaper(ctx, 20*time.Millisecond)
+
+	select {
+	case id := <-evicted:
+		if id != "dead" {
+			t.Errorf("Expected the dead connection to be evicted, got %s", id)
+		}
+		if elapsed := time.Since(deadAt); elapsed < grace {
+			t.Errorf("Expected the connection to be evicted after the grace period of %s, it was evicted after %s", grace, elapsed)
+		}
+	case <-time.After(receiveTimeout):
+		t.Fatal("Dead connection was not evicted")
+	}
+	if m.Get("dead") != nil {
+		t.Error("Expected the dead connection to be removed from the map")
+	}
+	if m.Get("alive") == nil {
+		t.Error("Expected the connected connection to stay in the map")
+	}
+}
+
+func TestReaperStopsWithContext(t *testing.T) {
+	m := rtc.NewRTCMap()
+	m.SetReaperGracePeriod(0)
+	evicted := make(chan string, 1)
+	m.OnEvicted(func(id string) { evicted <- id })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.StartReaper(ctx, 10*time.Millisecond)
+	cancel()
+	// Let the reaper see the cancellation before there is anything to evict
+	time.Sleep(50 * time.Millisecond)
+	addDeadConnection(t, m, "dead")
+
+	select {
+	case id := <-evicted:
+		t.Fatalf("Expected the stopped reaper to not evict anything, it evicted %s", id)
+	case <-time.After(silenceTimeout):
+	}
+}
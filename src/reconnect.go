@@ -0,0 +1,70 @@
+package rtc
+
+//
+// This file contains the handoff of a connection to its successor when a client reconnects under the same id (e.g. after a crash),
+// so that the state the application attached to the old connection is not lost
+//
+
+type reconnectedFunc func(id string, old *RTC, new *RTC)
+
+// Register a handler that is called when a connection is replaced by Replace, with the old and the new connection (e.g. to re-attach
+// subscriptions or handlers to the new connection). The old connection is being destroyed in the background when the handler is called
+func (m *RTCMap) OnReconnected(handler func(id string, old *RTC, new *RTC)) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.onReconnected = handler
+}
+
+// Replace the connection with the given id by a new connection of the same client. The role, metadata (keys that are not set on the new
+// connection) and timestamp offset of the old connection are carried over, the old connection is destroyed in the background (so that
+// the signaling handler is not blocked) and the OnReconnected handler is called. The old connection may already be destroyed. If there is
+// no connection with this id, the new connection is added like with AddConnection and the handler is not called. Like adding, replacing
+// fails with ErrMapClosed once the map is shut down
+func (m *RTCMap) Replace(id string, newRTC *RTC) error {
+	m.lock.Lock()
+	if m.closed {
+		m.lock.Unlock()
+		return ErrMapClosed
+	}
+	old := m.rtcMap[id]
+	if old == nil || old == newRTC {
+		err := m.add(id, newRTC)
+		m.lock.Unlock()
+		m.notify()
+		return err
+	}
+
+	newRTC.SetRole(old.Role())
+	for key, value := range old.Metadata {
+		if _, ok := newRTC.Metadata[key]; !ok {
+			newRTC.Metadata[key] = value
+		}
+	}
+	old.lock.Lock()
+	offset := old.TimestampOffset
+	old.lock.Unlock()
+	newRTC.lock.Lock()
+	newRTC.TimestampOffset = offset
+	newRTC.lock.Unlock()
+
+	// The client already holds a place in the map, so the limit, draining and throttling do not apply
+	m.rtcMap[id] = newRTC
+	newRTC.OnClosed(func(reason string) {
+		m.removeClosed(id, newRTC, reason)
+	})
+	m.recordRemoved(id, old)
+	m.recordAdded(id, newRTC)
+	handler := m.onReconnected
+	m.lock.Unlock()
+	m.notify()
+
+	go old.Destroy()
+
+	log := getDefaultLogger()
+	log.Debug().Str("rtcId", id).Msg("Replaced RTC connection in map")
+	if handler != nil {
+		handler(id, old, newRTC)
+	}
+	return nil
+}
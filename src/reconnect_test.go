@@ -0,0 +1,101 @@
+package rtc_test
+
+import (
+	"testing"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/VU-ASE/roverrtc/src/rtctest"
+)
+
+// A call of the OnReconnected handler
+type reconnection struct {
+	id       string
+	old, new *rtc.RTC
+}
+
+// Returns a channel that receives every call of the OnReconnected handler of the map
+func collectReconnections(m *rtc.RTCMap) <-chan reconnection {
+	reconnections := make(chan reconnection, 4)
+	m.OnReconnected(func(id string, old *rtc.RTC, new *rtc.RTC) { reconnections <- reconnection{id, old, new} })
+	return reconnections
+}
+
+func TestReplace(t *testing.T) {
+	m := rtc.NewRTCMapWithLimit(1)
+	t.Cleanup(func() { m.DestroyAll() })
+	connectToMap(t, m, "viewer")
+	old := m.Get("viewer")
+	if err := m.ChangeRole("viewer", rtc.RoleSpectator); err != nil {
+		t.Fatalf("Cannot change role: %v", err)
+	}
+	old.Metadata["version"] = "1.2.0"
+	old.Metadata["screen"] = "1080p"
+	old.TimestampOffset = 42
+	reasons := closeReasons(old)
+	reconnections := collectReconnections(m)
+
+	// The client already holds the only place in the map
+	_, replacement := rtctest.NewConnectedPair(t)
+	replacement.Metadata["version"] = "1.3.0"
+	if err := m.Replace("viewer", replacement); err != nil {
+		t.Fatalf("Cannot replace connection: %v", err)
+	}
+	if got := m.Get("viewer"); got != replacement {
+		t.Fatal("Expected the new connection to be in the map")
+	}
+	if replacement.Role() != rtc.RoleSpectator {
+		t.Errorf("Expected role %s to be carried over, got %s", rtc.RoleSpectator, replacement.Role())
+	}
+	if replacement.Metadata["version"] != "1.3.0" || replacement.Metadata["screen"] != "1080p" {
+		t.Errorf("Expected the missing metadata to be carried over, got %v", replacement.Metadata)
+	}
+	if replacement.TimestampOffset != 42 {
+		t.Errorf("Expected timestamp offset 42 to be carried over, got %d", replacement.TimestampOffset)
+	}
+
+	select {
+	case got := <-reconnections:
+		if got.id != "viewer" || got.old != old || got.new != replacement {
+			t.Errorf("Expected the handler to be called with the old and new connection of viewer, got %s", got.id)
+		}
+	default:
+		t.Error("Expected the OnReconnected handler to be called")
+	}
+	expectClosed(t, old, reasons, rtc.CloseReasonDestroyed)
+	if got := m.Get("viewer"); got != replacement {
+		t.Error("Expected closing the old connection to keep the new connection in the map")
+	}
+}
+
+func TestReplaceWithoutConnection(t *testing.T) {
+	m := rtc.NewRTCMap()
+	reconnections := collectReconnections(m)
+
+	r := rtc.NewRTC("rover")
+	if err := m.Replace("rover", r); err != nil {
+		t.Fatalf("Cannot replace connection: %v", err)
+	}
+	if m.Get("rover") != r {
+		t.Error("Expected the connection to be added")
+	}
+	if len(reconnections) != 0 {
+		t.Error("Expected the OnReconnected handler not to be called without an old connection")
+	}
+}
+
+func TestReplaceDestroyedConnection(t *testing.T) {
+	m := rtc.NewRTCMap()
+	t.Cleanup(func() { m.DestroyAll() })
+	connectToMap(t, m, "rover")
+	if err := m.Get("rover").Destroy(); err != nil {
+		t.Fatalf("Cannot destroy connection: %v", err)
+	}
+
+	_, replacement := rtctest.NewConnectedPair(t)
+	if err := m.Replace("rover", replacement); err != nil {
+		t.Fatalf("Cannot replace connection: %v", err)
+	}
+	if m.Get("rover") != replacement {
+		t.Error("Expected the new connection to be in the map")
+	}
+}
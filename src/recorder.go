@@ -0,0 +1,113 @@
+package rtc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+//
+// This file contains the signaling recorder, which captures the SDP/ICE exchange of a connection so that failed connections
+// from the field can be replayed and debugged locally. Records are written as JSON lines, one per offer, answer or candidate.
+//
+
+// The direction of a recorded signaling message, seen from the recording connection
+const (
+	signalingIn  = "in"
+	signalingOut = "out"
+)
+
+// A single recorded signaling message. Exactly one of Description and Candidate is set
+type SignalingRecord struct {
+	Time        int64                      `json:"time"`      // unix timestamp (in milliseconds) of the moment the message was recorded
+	Direction   string                     `json:"direction"` // "in" for messages received from the peer, "out" for messages sent to the peer
+	Description *webrtc.SessionDescription `json:"description,omitempty"`
+	Candidate   *webrtc.ICECandidateInit   `json:"candidate,omitempty"`
+}
+
+// Record every offer, answer and candidate (incoming and outgoing) that passes through SetLocalDescription, SetRemoteDescription,
+// AddLocalCandidate and AddRemoteCandidate to w. Pass nil to stop recording
+func (r *RTC) RecordSignaling(w io.Writer) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if w == nil {
+		r.signalingRecorder = nil
+		return
+	}
+	r.signalingRecorder = json.NewEncoder(w)
+}
+
+// Feed a recorded signaling session into this (fresh) connection. Incoming descriptions and candidates are applied, and an incoming offer
+// is answered with a newly created answer. Outgoing messages are skipped, as they are produced by the connection itself
+func (r *RTC) ReplaySignaling(src io.Reader) error {
+	log := r.Log()
+
+	pc := r.peerConnection()
+	if pc == nil {
+		return fmt.Errorf("Cannot replay signaling. Connection is nil")
+	}
+
+	decoder := json.NewDecoder(src)
+	for {
+		var record SignalingRecord
+		err := decoder.Decode(&record)
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("Cannot decode signaling record: %w", err)
+		}
+
+		if record.Direction != signalingIn {
+			continue
+		}
+
+		switch {
+		case record.Description != nil:
+			if err := r.SetRemoteDescription(*record.Description); err != nil {
+				return fmt.Errorf("Cannot replay remote description: %w", err)
+			}
+			if record.Description.Type != webrtc.SDPTypeOffer {
+				continue
+			}
+
+			answer, err := pc.CreateAnswer(nil)
+			if err != nil {
+				return fmt.Errorf("Cannot create answer for replayed offer: %w", err)
+			}
+			if err := r.SetLocalDescription(answer); err != nil {
+				return fmt.Errorf("Cannot set answer for replayed offer: %w", err)
+			}
+		case record.Candidate != nil:
+			if err := r.AddRemoteCandidate(*record.Candidate); err != nil {
+				return fmt.Errorf("Cannot replay remote ICE candidate: %w", err)
+			}
+		}
+		log.Debug().Int64("recordedAt", record.Time).Msg("Replayed signaling record")
+	}
+}
+
+// Write a signaling message to the recorder, if recording is enabled
+func (r *RTC) recordSignaling(direction string, desc *webrtc.SessionDescription, candidate *webrtc.ICECandidateInit) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.signalingRecorder == nil {
+		return
+	}
+
+	record := SignalingRecord{
+		Time:        time.Now().UnixMilli(),
+		Direction:   direction,
+		Description: desc,
+		Candidate:   candidate,
+	}
+	if err := r.signalingRecorder.Encode(record); err != nil {
+		log := r.Log()
+		log.Warn().Err(err).Msg("Cannot record signaling message")
+	}
+}
@@ -0,0 +1,85 @@
+package rtc_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/pion/webrtc/v4"
+)
+
+// Create a connection with a peer connection that answers offers, like the server side of the handshake
+func newAnswerer(t *testing.T, id string) *rtc.RTC {
+	t.Helper()
+
+	r := rtc.NewRTC(id)
+	if err := r.CreatePeerConnection(webrtc.Configuration{}); err != nil {
+		t.Fatalf("Cannot create peer connection: %v", err)
+	}
+	if err := r.AcceptDataChannels(); err != nil {
+		t.Fatalf("Cannot accept data channels: %v", err)
+	}
+	t.Cleanup(func() { r.Destroy() })
+	return r
+}
+
+func TestRecordAndReplaySignaling(t *testing.T) {
+	client, offer, err := rtc.CreateOffer("client")
+	if err != nil {
+		t.Fatalf("Cannot create offer: %v", err)
+	}
+	t.Cleanup(func() { client.Destroy() })
+
+	var recording bytes.Buffer
+	server := newAnswerer(t, "server")
+	server.RecordSignaling(&recording)
+	if err := server.SetRemoteDescription(offer.Offer); err != nil {
+		t.Fatalf("Cannot set remote description: %v", err)
+	}
+	answer, err := server.Pc.CreateAnswer(nil)
+	if err != nil {
+		t.Fatalf("Cannot create answer: %v", err)
+	}
+	if err := server.SetLocalDescription(answer); err != nil {
+		t.Fatalf("Cannot set local description: %v", err)
+	}
+	server.RecordSignaling(nil)
+
+	var records []rtc.SignalingRecord
+	decoder := json.NewDecoder(bytes.NewReader(recording.Bytes()))
+	for decoder.More() {
+		var record rtc.SignalingRecord
+		if err := decoder.Decode(&record); err != nil {
+			t.Fatalf("Cannot decode record: %v", err)
+		}
+		records = append(records, record)
+	}
+	if len(records) < 2 {
+		t.Fatalf("Expected at least the offer and the answer to be recorded, got %d records", len(records))
+	}
+	if records[0].Direction != "in" || records[0].Description == nil || records[0].Description.Type != webrtc.SDPTypeOffer {
+		t.Errorf("Expected the incoming offer first, got %+v", records[0])
+	}
+	if records[1].Direction != "out" || records[1].Description == nil || records[1].Description.Type != webrtc.SDPTypeAnswer {
+		t.Errorf("Expected the outgoing answer second, got %+v", records[1])
+	}
+
+	replayed := newAnswerer(t, "replayed")
+	if err := replayed.ReplaySignaling(bytes.NewReader(recording.Bytes())); err != nil {
+		t.Fatalf("Cannot replay signaling: %v", err)
+	}
+	if remote := replayed.Pc.RemoteDescription(); remote == nil || remote.Type != webrtc.SDPTypeOffer {
+		t.Errorf("Expected the replayed offer as remote description, got %v", remote)
+	}
+	if local := replayed.Pc.LocalDescription(); local == nil || local.Type != webrtc.SDPTypeAnswer {
+		t.Errorf("Expected a new answer as local description, got %v", local)
+	}
+}
+
+func TestReplaySignalingWithoutConnection(t *testing.T) {
+	r := rtc.NewRTC("fresh")
+	if err := r.ReplaySignaling(bytes.NewReader(nil)); err == nil {
+		t.Error("Expected an error when replaying into a connection without peer connection")
+	}
+}
@@ -0,0 +1,231 @@
+package rtc
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+//
+// This file contains the relay, which forwards every message the source connection (e.g. the car) receives on a channel to all other
+// connections in the map (e.g. the operators), on the same channel. The sinks are looked up for every message, so connections that are
+// added to the map while the relay runs receive the messages from then on. Sinks that are not connected, whose channel is not open or
+// whose circuit breaker is open are skipped. The relay observes the received messages next to the handlers of the source (e.g. OnData),
+// so those keep working. The messages are forwarded by a goroutine per relay, so that slow sinks do not hold up the receive path of the
+// source. Messages that arrive while the queue of the relay is full are dropped
+//
+
+// The number of messages a relay holds while they wait to be forwarded, messages beyond it are dropped
+const RelayQueueSize = 256
+
+// A receive tap observes the (decoded) messages received on a channel of a connection
+type receiveTap func(b []byte)
+
+// The receive taps of a connection, guarded by the lock of the connection
+type receiveTaps struct {
+	next    uint64                           // the id of the next tap
+	byLabel map[string]map[uint64]receiveTap // label -> tap id -> tap
+}
+
+// A running relay, see RTCMap.Relay
+type RelayHandle struct {
+	relay *relay
+}
+
+type relay struct {
+	source     *RTC
+	label      string
+	tapId      uint64
+	queue      chan []byte   // the messages waiting to be forwarded
+	stopped    chan struct{} // closed when the relay is stopped
+	stop       sync.Once
+	relayed    atomic.Uint64 // the number of messages delivered to a sink
+	dropped    atomic.Uint64 // the number of messages not delivered to a sink, because it was unhealthy or the send failed
+	filtered   atomic.Uint64 // the number of messages the filter rejected
+	overflowed atomic.Uint64 // the number of messages dropped because the queue was full
+}
+
+// Forward every message the connection with id fromId receives on the channel with the given label (e.g. DataChannelLabel) to all other
+// connections in the map, on the channel with the same label. Raw messages on the control channel are relayed, framed messages are not.
+// Messages for which filter returns false are not relayed, pass a nil filter to relay all messages. The relay is bound to the source
+// connection, so it stops relaying when that is replaced or destroyed. Stop the relay with Stop on the returned handle
+func (m *RTCMap) Relay(fromId string, channel string, filter func([]byte) bool) (RelayHandle, error) {
+	source := m.Get(fromId)
+	if source == nil {
+		return RelayHandle{}, fmt.Errorf("Cannot relay from connection with id %s. Connection does not exist", fromId)
+	}
+
+	rel := &relay{
+		source:  source,
+		label:   channel,
+		queue:   make(chan []byte, RelayQueueSize),
+		stopped: make(chan struct{}),
+	}
+	rel.tapId = source.addTap(channel, func(b []byte) {
+		if filter != nil && !filter(b) {
+			rel.filtered.Add(1)
+			return
+		}
+		// The source may reuse its buffer once the tap returns
+		msg := make([]byte, len(b))
+		copy(msg, b)
+		select {
+		case rel.queue <- msg:
+		default:
+			rel.overflowed.Add(1)
+		}
+	})
+	go rel.run(m)
+
+	log := source.Log()
+	log.Info().Str("label", channel).Msg("Started relay")
+	return RelayHandle{relay: rel}, nil
+}
+
+// Forward the queued messages to the other connections in the map, until the relay is stopped or the source is destroyed
+func (rel *relay) run(m *RTCMap) {
+	for {
+		select {
+		case b := <-rel.queue:
+			rel.forward(m, b)
+		case <-rel.stopped:
+			return
+		case <-rel.source.closed:
+			return
+		}
+	}
+}
+
+// Send a message to every healthy connection in the map other than the source
+func (rel *relay) forward(m *RTCMap, b []byte) {
+	m.ForEach(func(id string, sink *RTC) {
+		if sink == rel.source {
+			return
+		}
+		if !sink.relayHealthy(rel.label) || sink.sendOnLabel(rel.label, b) != nil {
+			rel.dropped.Add(1)
+			return
+		}
+		rel.relayed.Add(1)
+	})
+}
+
+// Stop the relay. The message that is being forwarded is still delivered, messages that wait in the queue are not. Stopping a relay
+// more than once does nothing
+func (h RelayHandle) Stop() {
+	if h.relay == nil {
+		return
+	}
+	h.relay.stop.Do(func() {
+		h.relay.source.removeTap(h.relay.label, h.relay.tapId)
+		close(h.relay.stopped)
+
+		log := h.relay.source.Log()
+		log.Info().Str("label", h.relay.label).Uint64("relayed", h.relay.relayed.Load()).Uint64("dropped", h.relay.dropped.Load()).Uint64("overflowed", h.relay.overflowed.Load()).Msg("Stopped relay")
+	})
+}
+
+// Returns the number of messages delivered to a sink (a message relayed to three sinks counts three times)
+func (h RelayHandle) Relayed() uint64 {
+	if h.relay == nil {
+		return 0
+	}
+	return h.relay.relayed.Load()
+}
+
+// Returns the number of messages that were not delivered to a sink, because it was unhealthy or the send failed
+func (h RelayHandle) Dropped() uint64 {
+	if h.relay == nil {
+		return 0
+	}
+	return h.relay.dropped.Load()
+}
+
+// Returns the number of messages that were not relayed because the queue of the relay was full (see RelayQueueSize)
+func (h RelayHandle) Overflowed() uint64 {
+	if h.relay == nil {
+		return 0
+	}
+	return h.relay.overflowed.Load()
+}
+
+// Returns the number of messages that were not relayed because the filter rejected them
+func (h RelayHandle) Filtered() uint64 {
+	if h.relay == nil {
+		return 0
+	}
+	return h.relay.filtered.Load()
+}
+
+// Whether a message can be relayed to this connection on the channel with the given label
+func (r *RTC) relayHealthy(label string) bool {
+	if !r.IsConnected() || r.BreakerState(label) != BreakerClosed {
+		return false
+	}
+	switch label {
+	case ControlChannelLabel:
+		return r.IsControlChannelOpen()
+	case DataChannelLabel:
+		return r.IsDataChannelOpen()
+	default:
+		ch := r.Channel(label)
+		return ch != nil && ch.IsOpen()
+	}
+}
+
+// Send bytes on the channel with the given label, using the send method of the control and data channel
+func (r *RTC) sendOnLabel(label string, b []byte) error {
+	switch label {
+	case ControlChannelLabel:
+		return r.SendControlBytes(b)
+	case DataChannelLabel:
+		return r.SendDataBytes(b)
+	default:
+		ch := r.Channel(label)
+		if ch == nil {
+			return ErrChannelNotConfigured
+		}
+		return ch.Send(b)
+	}
+}
+
+// Register a tap for the messages received on the channel with the given label, returns its id to remove it with removeTap
+func (r *RTC) addTap(label string, tap receiveTap) uint64 {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.taps.byLabel == nil {
+		r.taps.byLabel = make(map[string]map[uint64]receiveTap)
+	}
+	if r.taps.byLabel[label] == nil {
+		r.taps.byLabel[label] = make(map[uint64]receiveTap)
+	}
+	r.taps.next++
+	r.taps.byLabel[label][r.taps.next] = tap
+	return r.taps.next
+}
+
+// Remove a tap registered with addTap
+func (r *RTC) removeTap(label string, id uint64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	delete(r.taps.byLabel[label], id)
+	if len(r.taps.byLabel[label]) == 0 {
+		delete(r.taps.byLabel, label)
+	}
+}
+
+// Pass a received message to the taps of its channel
+func (r *RTC) tap(label string, b []byte) {
+	r.lock.Lock()
+	taps := make([]receiveTap, 0, len(r.taps.byLabel[label]))
+	for _, tap := range r.taps.byLabel[label] {
+		taps = append(taps, tap)
+	}
+	r.lock.Unlock()
+
+	for _, tap := range taps {
+		tap(b)
+	}
+}
@@ -0,0 +1,84 @@
+package rtc_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+)
+
+// Fail the test unless the counter reaches want within receiveTimeout (counters are updated right after the message is sent)
+func expectCount(t *testing.T, name string, counter func() uint64, want uint64) {
+	t.Helper()
+
+	deadline := time.Now().Add(receiveTimeout)
+	for counter() != want {
+		if time.Now().After(deadline) {
+			t.Errorf("Expected %d %s messages, got %d", want, name, counter())
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRelayToOperators(t *testing.T) {
+	m := rtc.NewRTCMap()
+	clients := connectToMap(t, m, "car", "operator-1", "operator-2", "operator-3")
+	received := make(map[string]<-chan []byte)
+	for id, client := range clients {
+		received[id] = collectData(client)
+	}
+	// A connection that is not set up is skipped
+	if err := m.AddConnection("fresh", rtc.NewRTC("fresh")); err != nil {
+		t.Fatalf("Cannot add connection: %v", err)
+	}
+
+	handle, err := m.Relay("car", rtc.DataChannelLabel, func(b []byte) bool {
+		return !strings.HasPrefix(string(b), "debug")
+	})
+	if err != nil {
+		t.Fatalf("Cannot start relay: %v", err)
+	}
+	t.Cleanup(handle.Stop)
+
+	car := clients["car"]
+	for _, msg := range []string{"debug: battery", "telemetry"} {
+		if err := car.SendDataBytes([]byte(msg)); err != nil {
+			t.Fatalf("Cannot send from the car: %v", err)
+		}
+	}
+	for _, id := range []string{"operator-1", "operator-2", "operator-3"} {
+		expectMessage(t, received[id], []byte("telemetry"))
+	}
+	expectNoMessage(t, received["car"])
+	expectCount(t, "relayed", handle.Relayed, 3)
+	expectCount(t, "dropped", handle.Dropped, 1)
+	expectCount(t, "filtered", handle.Filtered, 1)
+
+	// An operator that connects while the relay runs receives the messages from then on
+	received["operator-4"] = collectData(connectToMap(t, m, "operator-4")["operator-4"])
+	if err := car.SendDataBytes([]byte("position")); err != nil {
+		t.Fatalf("Cannot send from the car: %v", err)
+	}
+	for _, id := range []string{"operator-1", "operator-2", "operator-3", "operator-4"} {
+		expectMessage(t, received[id], []byte("position"))
+	}
+	expectCount(t, "relayed", handle.Relayed, 7)
+
+	handle.Stop()
+	if err := car.SendDataBytes([]byte("after stop")); err != nil {
+		t.Fatalf("Cannot send from the car: %v", err)
+	}
+	expectNoMessage(t, received["operator-1"])
+	if overflowed := handle.Overflowed(); overflowed != 0 {
+		t.Errorf("Expected no overflowed messages, got %d", overflowed)
+	}
+}
+
+func TestRelayFromUnknownConnection(t *testing.T) {
+	m := rtc.NewRTCMap()
+	if _, err := m.Relay("car", rtc.DataChannelLabel, nil); err == nil {
+		t.Error("Expected an error when relaying from a connection that does not exist")
+	}
+}
@@ -0,0 +1,149 @@
+package rtc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+)
+
+//
+// This file contains the reorder buffer, a middle ground between an ordered and an unordered data channel. Messages are sent over
+// an unordered channel prefixed with a sequence number (4 bytes, big endian), and the receiver holds back messages that arrive early
+// for at most the configured window, waiting for the missing ones. Messages that arrive after their turn has passed are dropped.
+//
+
+const sequenceNumberSize = 4
+
+type reorderBuffer struct {
+	lock    *sync.Mutex
+	window  time.Duration            // how long a message may be held back waiting for earlier messages
+	started bool                     // whether the first message was received (which determines the first expected sequence number)
+	next    uint32                   // the next expected sequence number
+	pending map[uint32]reorderedItem // sequence number -> message that arrived early
+	timer   *time.Timer              // fires when the oldest pending message has waited for the window
+	deliver func(b []byte)
+}
+
+type reorderedItem struct {
+	payload []byte
+	arrived time.Time
+}
+
+// Enable the reorder buffer with the given window (e.g. 50ms). Outgoing data messages are prefixed with a sequence number, and incoming
+// messages are delivered to the OnData handler in order, skipping messages that did not arrive within the window.
+// Both peers need to enable the reorder buffer, and the data channel should be unordered for this to be useful
+func (r *RTC) EnableReorderBuffer(window time.Duration) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var lock sync.Mutex
+	r.reorder = &reorderBuffer{
+		lock:    &lock,
+		window:  window,
+		pending: make(map[uint32]reorderedItem),
+		deliver: r.deliverData,
+	}
+}
+
+// Add a received message to the buffer, delivering all messages that are now in order.
+// Messages are delivered while holding the buffer lock, to preserve the order between the receive path and the timer
+func (b *reorderBuffer) push(seq uint32, payload []byte) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if !b.started {
+		b.started = true
+		b.next = seq
+	}
+
+	// Compare in signed space, so that the wraparound of the sequence number is handled
+	distance := int32(seq - b.next)
+	switch {
+	case distance < 0:
+		// Too late (or a duplicate), its turn has passed
+		return
+	case distance == 0:
+		b.deliver(payload)
+		b.next++
+		b.flush()
+	default:
+		if _, ok := b.pending[seq]; !ok {
+			b.pending[seq] = reorderedItem{payload: payload, arrived: time.Now()}
+		}
+	}
+	b.schedule()
+}
+
+// Deliver all pending messages that are in order
+func (b *reorderBuffer) flush() {
+	for {
+		item, ok := b.pending[b.next]
+		if !ok {
+			return
+		}
+		delete(b.pending, b.next)
+		b.deliver(item.payload)
+		b.next++
+	}
+}
+
+// Skip the gaps in front of all messages that have waited for the full window
+func (b *reorderBuffer) expire() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.timer = nil
+	for len(b.pending) > 0 && time.Since(b.oldestArrival()) >= b.window {
+		// Give up on the missing messages in front of the first pending message
+		b.next = b.earliest()
+		b.flush()
+	}
+	b.schedule()
+}
+
+// Arm the timer for the oldest pending message, if it is not armed yet
+func (b *reorderBuffer) schedule() {
+	if b.timer != nil || len(b.pending) == 0 {
+		return
+	}
+	b.timer = time.AfterFunc(b.window-time.Since(b.oldestArrival()), b.expire)
+}
+
+// Returns the arrival time of the message that has been pending the longest
+func (b *reorderBuffer) oldestArrival() time.Time {
+	oldest := time.Now()
+	for _, item := range b.pending {
+		if item.arrived.Before(oldest) {
+			oldest = item.arrived
+		}
+	}
+	return oldest
+}
+
+// Returns the lowest pending sequence number (relative to the next expected one)
+func (b *reorderBuffer) earliest() uint32 {
+	earliest := b.next - 1
+	for seq := range b.pending {
+		if seq-b.next < earliest-b.next {
+			earliest = seq
+		}
+	}
+	return earliest
+}
+
+// Prefix a payload with its sequence number
+func appendSequenceNumber(seq uint32, payload []byte) []byte {
+	b := make([]byte, sequenceNumberSize+len(payload))
+	binary.BigEndian.PutUint32(b, seq)
+	copy(b[sequenceNumberSize:], payload)
+	return b
+}
+
+// Split a message in its sequence number and payload
+func splitSequenceNumber(b []byte) (uint32, []byte, error) {
+	if len(b) < sequenceNumberSize {
+		return 0, nil, fmt.Errorf("Message is too short to contain a sequence number")
+	}
+	return binary.BigEndian.Uint32(b), b[sequenceNumberSize:], nil
+}
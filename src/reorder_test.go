@@ -0,0 +1,101 @@
+package rtc_test
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"time"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+)
+
+// Create a connection with a reorder buffer on a mock data channel, returns the channel and the messages it delivers
+func newReorderingReceiver(window time.Duration) (*rtc.MockChannel, <-chan []byte) {
+	r := rtc.NewRTC("operator")
+	dc := rtc.NewMockChannel(rtc.DataChannelLabel)
+	r.SetDataChannel(dc)
+	r.EnableReorderBuffer(window)
+	return dc, collectData(r)
+}
+
+func TestReorderBufferDeliversInOrder(t *testing.T) {
+	dc, received := newReorderingReceiver(time.Minute)
+
+	for _, seq := range []uint32{10, 13, 12, 11, 14} {
+		dc.Inject(sequenced(seq, string(rune('a'+seq-10))))
+	}
+	for _, want := range []string{"a", "b", "c", "d", "e"} {
+		expectMessage(t, received, []byte(want))
+	}
+	expectNoMessage(t, received)
+}
+
+func TestReorderBufferDropsLateMessages(t *testing.T) {
+	dc, received := newReorderingReceiver(time.Minute)
+
+	dc.Inject(sequenced(0, "first"))
+	dc.Inject(sequenced(1, "second"))
+	// A duplicate and a message that arrives after its turn has passed
+	dc.Inject(sequenced(1, "duplicate"))
+	dc.Inject(sequenced(0, "late"))
+
+	expectMessage(t, received, []byte("first"))
+	expectMessage(t, received, []byte("second"))
+	expectNoMessage(t, received)
+}
+
+func TestReorderBufferSkipsMissingMessages(t *testing.T) {
+	window := 50 * time.Millisecond
+	dc, received := newReorderingReceiver(window)
+
+	dc.Inject(sequenced(0, "first"))
+	expectMessage(t, received, []byte("first"))
+
+	// Message 1 never arrives, so message 2 is held back for the window
+	start := time.Now()
+	dc.Inject(sequenced(2, "third"))
+	expectMessage(t, received, []byte("third"))
+	if waited := time.Since(start); waited < window {
+		t.Errorf("Expected the message to be held back for %v, got %v", window, waited)
+	}
+
+	// Once the gap was skipped, the missing message is too late
+	dc.Inject(sequenced(1, "second"))
+	dc.Inject(sequenced(3, "fourth"))
+	expectMessage(t, received, []byte("fourth"))
+	expectNoMessage(t, received)
+}
+
+func TestReorderBufferWraparound(t *testing.T) {
+	dc, received := newReorderingReceiver(time.Minute)
+
+	for _, seq := range []uint32{math.MaxUint32 - 1, 0, math.MaxUint32, 1} {
+		dc.Inject(sequenced(seq, "telemetry"))
+	}
+	for i := 0; i < 4; i++ {
+		expectMessage(t, received, []byte("telemetry"))
+	}
+	expectNoMessage(t, received)
+}
+
+func TestReorderBufferOutgoing(t *testing.T) {
+	r := rtc.NewRTC("rover")
+	dc := rtc.NewMockChannel(rtc.DataChannelLabel)
+	r.SetDataChannel(dc)
+	r.EnableReorderBuffer(time.Minute)
+
+	for i := 0; i < 3; i++ {
+		if err := r.SendDataBytes([]byte("telemetry")); err != nil {
+			t.Fatalf("Cannot send message: %v", err)
+		}
+	}
+	sent := dc.Sent()
+	if len(sent) != 3 {
+		t.Fatalf("Expected 3 messages, got %d", len(sent))
+	}
+	for i, b := range sent {
+		if want := sequenced(uint32(i), "telemetry"); !bytes.Equal(b, want) {
+			t.Errorf("Expected message %d to be %v, got %v", i, want, b)
+		}
+	}
+}
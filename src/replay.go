@@ -0,0 +1,138 @@
+package rtc
+
+import (
+	"crypto/sha256"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+//
+// This file contains the replay protection of signaling requests. Besides the timestamp of a request having to be within the allowed clock skew
+// (see SetTimestampSkew), the signaling helpers remember the requests they recently accepted per id, so that a captured request (e.g. an offer,
+// to hijack an id) cannot be replayed while its timestamp is still valid. A request is identified by its id, timestamp and content. Every map
+// has its own cache, so that the signaling of one map does not contend with (or evict the requests of) another
+//
+
+// The request was accepted before, it is replayed
+var ErrReplayedRequest = errors.New("Request was already received")
+
+// The maximum number of requests a replay cache remembers. Requests are normally forgotten once their timestamp cannot pass the check
+// anymore, this bounds the cache if timestamps are not checked (see SetTimestampSkew)
+const replayCacheCapacity = 4096
+
+type replayEntry struct {
+	id        string
+	hash      [sha256.Size]byte
+	timestamp int64     // in milliseconds, on the local clock
+	received  time.Time // on the local clock
+}
+
+// The requests recently accepted by the signaling helpers of a map (or by AcceptOffer outside of a map), so that a replayed request
+// is found without scanning the requests of other ids, and old requests are forgotten in the order they were received
+type replayCache struct {
+	lock     *sync.Mutex
+	requests map[string][]*replayEntry // id -> requests with that id, in the order they were received
+	order    []*replayEntry            // all requests, in the order they were received
+}
+
+func newReplayCache() *replayCache {
+	var lock sync.Mutex
+	return &replayCache{
+		lock:     &lock,
+		requests: make(map[string][]*replayEntry),
+	}
+}
+
+// The requests accepted by AcceptOffer, which is not bound to a map
+var defaultReplayCache = newReplayCache()
+
+// Limits the rate at which rejected requests are logged, so that a replay attack does not flood the log
+var replayLogLimiter = newTokenBucket(1, 5)
+
+// Check that a request with the given id, timestamp (in milliseconds) and content was not accepted before, and remember it
+func (c *replayCache) check(id string, timestamp int64, content ...string) error {
+	hasher := sha256.New()
+	hasher.Write([]byte(id))
+	for _, part := range content {
+		hasher.Write([]byte{0})
+		hasher.Write([]byte(part))
+	}
+	entry := &replayEntry{id: id, timestamp: timestamp, received: time.Now()}
+	hasher.Sum(entry.hash[:0])
+
+	timestampSkewLock.RLock()
+	skew := timestampSkew
+	timestampSkewLock.RUnlock()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	// A request is at most skew ahead of the local clock when it is received, and is rejected as stale once it is skew behind, so it
+	// cannot pass the timestamp check anymore after twice the skew
+	if skew > 0 {
+		oldest := entry.received.Add(-2 * skew)
+		for len(c.order) > 0 && c.order[0].received.Before(oldest) {
+			c.forgetOldest()
+		}
+	}
+
+	for _, e := range c.requests[id] {
+		if e.hash == entry.hash && e.timestamp == entry.timestamp {
+			if replayLogLimiter.allow() {
+				log := getDefaultLogger()
+				log.Warn().Str("rtcId", id).Int64("timestamp", timestamp).Msg("Rejected replayed signaling request")
+			}
+			return ErrReplayedRequest
+		}
+	}
+	if len(c.order) >= replayCacheCapacity {
+		c.forgetOldest()
+	}
+	c.order = append(c.order, entry)
+	c.requests[id] = append(c.requests[id], entry)
+	return nil
+}
+
+// Forget the request that was received first, the caller must hold the lock. It is also the first request with its id
+func (c *replayCache) forgetOldest() {
+	oldest := c.order[0]
+	c.order[0] = nil
+	c.order = c.order[1:]
+
+	requests := c.requests[oldest.id][1:]
+	if len(requests) == 0 {
+		delete(c.requests, oldest.id)
+	} else {
+		c.requests[oldest.id] = requests
+	}
+}
+
+// Returns the number of requests in the cache
+func (c *replayCache) len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return len(c.order)
+}
+
+// Check that a signaling request for this connection is recent and not replayed (in the given cache). The timestamp is converted to the local clock
+// using the known TimestampOffset (see StartSyncedHeartbeat and SyncClock)
+func (r *RTC) checkFresh(replay *replayCache, timestamp int64, content ...string) error {
+	local := r.AdjustTimestamp(timestamp)
+	if err := validateTimestamp(local); err != nil {
+		return err
+	}
+	return replay.check(r.Id, local, content...)
+}
+
+// Returns the candidate strings of a list of candidates, to identify a request
+func candidateStrings(candidates []webrtc.ICECandidateInit) []string {
+	content := make([]string, len(candidates))
+	for i, candidate := range candidates {
+		content[i] = candidate.Candidate
+	}
+	return content
+}
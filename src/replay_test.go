@@ -0,0 +1,138 @@
+package rtc_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+)
+
+// Allow the given clock skew for the duration of the test
+func withTimestampSkew(t *testing.T, skew time.Duration) {
+	t.Helper()
+
+	rtc.SetTimestampSkew(skew)
+	t.Cleanup(func() { rtc.SetTimestampSkew(rtc.DefaultTimestampSkew) })
+}
+
+func TestReplayedOffer(t *testing.T) {
+	_, offer := newOffer(t, "replayed-offer")
+
+	server, _, err := rtc.AcceptOffer(offer)
+	if err != nil {
+		t.Fatalf("Cannot accept offer: %v", err)
+	}
+	t.Cleanup(func() { server.Destroy() })
+
+	if _, _, err := rtc.AcceptOffer(offer); !errors.Is(err, rtc.ErrReplayedRequest) {
+		t.Errorf("Expected ErrReplayedRequest for the same offer, got %v", err)
+	}
+}
+
+func TestStaleOffer(t *testing.T) {
+	withTimestampSkew(t, 30*time.Second)
+	_, offer := newOffer(t, "stale-offer")
+
+	offer.Timestamp = time.Now().Add(-time.Minute).UnixMilli()
+	if _, _, err := rtc.AcceptOffer(offer); !errors.Is(err, rtc.ErrStaleTimestamp) {
+		t.Errorf("Expected ErrStaleTimestamp for an old offer, got %v", err)
+	}
+	offer.Timestamp = time.Now().Add(time.Minute).UnixMilli()
+	if _, _, err := rtc.AcceptOffer(offer); !errors.Is(err, rtc.ErrStaleTimestamp) {
+		t.Errorf("Expected ErrStaleTimestamp for an offer from the future, got %v", err)
+	}
+}
+
+func TestReplayedCandidates(t *testing.T) {
+	withTimestampSkew(t, 30*time.Second)
+	m := rtc.NewRTCMap()
+	t.Cleanup(func() { m.DestroyAll() })
+	handler := rtc.NewSignalingHandler(m)
+
+	id := "replayed-candidates"
+	client, offer := newOffer(t, id)
+	if w := postSignaling(t, handler, "/sdp", offer); w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body)
+	}
+	server := m.Get(id)
+	// The clock of the client runs a minute ahead, which the server learned from the heartbeat
+	server.TimestampOffset = time.Minute.Milliseconds()
+
+	candidates := client.GetAllLocalCandidates()
+	if len(candidates) < 2 {
+		t.Fatalf("Expected the client to gather at least two candidates, got %d", len(candidates))
+	}
+	skewed := time.Now().Add(time.Minute).UnixMilli()
+	ice := rtc.RequestICE{Candidate: candidates[0], Id: id, Timestamp: skewed}
+	if w := postSignaling(t, handler, "/ice", ice); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected a skewed but valid request to be accepted, got %d: %s", w.Code, w.Body)
+	}
+
+	w := postSignaling(t, handler, "/ice", ice)
+	expectSignalingError(t, w, http.StatusBadRequest)
+	var body struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Error != rtc.ErrReplayedRequest.Error() {
+		t.Errorf("Expected the replayed request to be rejected with %q, got %q", rtc.ErrReplayedRequest, body.Error)
+	}
+
+	// A candidate with a local timestamp is a minute old on the clock of the client
+	ice = rtc.RequestICE{Candidate: candidates[1], Id: id, Timestamp: time.Now().UnixMilli()}
+	expectSignalingError(t, postSignaling(t, handler, "/ice", ice), http.StatusBadRequest)
+	ice.Timestamp = skewed
+	if w := postSignaling(t, handler, "/ice", ice); w.Code != http.StatusNoContent {
+		t.Errorf("Expected another candidate with the same timestamp to be accepted, got %d: %s", w.Code, w.Body)
+	}
+}
+
+// Returns a map that is shut down, so that its signaling handler checks offers for replays but accepts none of them
+func closedMapHandler(t *testing.T) (*rtc.RTCMap, http.Handler) {
+	t.Helper()
+
+	m := rtc.NewRTCMap()
+	if err := m.Shutdown(context.Background(), "test"); err != nil {
+		t.Fatalf("Cannot shut down map: %v", err)
+	}
+	return m, rtc.NewSignalingHandler(m)
+}
+
+func TestReplayCachePerMap(t *testing.T) {
+	_, first := closedMapHandler(t)
+	_, second := closedMapHandler(t)
+	_, offer := newOffer(t, "rover")
+
+	expectSignalingError(t, postSignaling(t, first, "/sdp", offer), http.StatusServiceUnavailable)
+	expectSignalingError(t, postSignaling(t, first, "/sdp", offer), http.StatusBadRequest)
+	// The other map did not see the offer before
+	expectSignalingError(t, postSignaling(t, second, "/sdp", offer), http.StatusServiceUnavailable)
+}
+
+func TestReplayCacheForgetsOldRequests(t *testing.T) {
+	skew := 50 * time.Millisecond
+	withTimestampSkew(t, skew)
+	m, handler := closedMapHandler(t)
+	_, first := newOffer(t, "first")
+	_, second := newOffer(t, "second")
+	_, third := newOffer(t, "third")
+
+	for _, offer := range []rtc.RequestSDP{first, second} {
+		offer.Timestamp = time.Now().UnixMilli()
+		expectSignalingError(t, postSignaling(t, handler, "/sdp", offer), http.StatusServiceUnavailable)
+	}
+	if size := m.ReplayCacheSize(); size != 2 {
+		t.Fatalf("Expected 2 requests in the replay cache, got %d", size)
+	}
+
+	// Once the requests cannot pass the timestamp check anymore, they are forgotten when the next request arrives
+	time.Sleep(2*skew + 10*time.Millisecond)
+	third.Timestamp = time.Now().UnixMilli()
+	expectSignalingError(t, postSignaling(t, handler, "/sdp", third), http.StatusServiceUnavailable)
+	if size := m.ReplayCacheSize(); size != 1 {
+		t.Errorf("Expected only the new request in the replay cache, got %d", size)
+	}
+}
@@ -0,0 +1,278 @@
+package rtc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+//
+// This file contains the ICE restart, to recover a connection after a network change (e.g. when the rover switches access points) without
+// tearing it down. The offering peer creates a new offer with fresh ICE credentials and sends it out-of-band (through the signaling transport,
+// see SetSignalingTransport), the other peer answers it, and the connection continues on the new network path. Creating the offer resets the
+// local ICE agent, so the control channel cannot carry it. With in-band trickle, the restart is signaled over a standby connection instead
+// (see standby.go). The session is renegotiated (e.g. after adding a track) with the same exchange,
+// which can use the control channel. The offer and answer are then sent as JSON encoded session descriptions in framed control messages
+//
+
+// How long a connection created with WithAutoICERestart has to be disconnected before ICE is restarted, if no delay is configured
+const DefaultICERestartDelay = 5 * time.Second
+
+// Another offer/answer exchange (e.g. an ICE restart) of this connection is in progress
+var ErrNegotiationInProgress = errors.New("Negotiation already in progress")
+
+// ICE cannot be restarted without out-of-band signaling (see SetSignalingTransport) or in-band trickle (see EnableInBandTrickle)
+var ErrNoSignalingTransport = errors.New("No signaling transport set")
+
+// Restart ICE through the signaling transport (see SetSignalingTransport): create an offer that restarts ICE, send it to the peer, and apply
+// its answer, until ctx is done. Without a signaling transport, but with in-band trickle enabled (see EnableInBandTrickle), the restart is
+// signaled over a standby connection that is set up over the control channel, which needs the connection to still be up. Otherwise, returns
+// ErrNoSignalingTransport without touching the connection. Use CreateICERestartOffer to restart ICE through other out-of-band signaling instead
+func (r *RTC) RestartICE(ctx context.Context) error {
+	// Creating the offer resets the local ICE agent, after which nothing can be sent on the control channel until the peer answered
+	r.lock.Lock()
+	transport := r.signalingTransport
+	inBand := r.inBandTrickle
+	r.lock.Unlock()
+	if transport == nil && inBand {
+		return r.restartICEInBand(ctx)
+	}
+	if transport == nil {
+		return fmt.Errorf("Cannot restart ICE over the control channel: %w", ErrNoSignalingTransport)
+	}
+
+	return r.exchangeOffer(ctx, r.CreateICERestartOffer)
+}
+
+// Renegotiate the session over the control channel (e.g. after adding a track): create a new offer, send it to the peer, and apply
+// its answer, until ctx is done
+func (r *RTC) Renegotiate(ctx context.Context) error {
+	return r.exchangeOffer(ctx, func(ctx context.Context) (webrtc.SessionDescription, error) {
+		pc := r.peerConnection()
+		if pc == nil {
+			return webrtc.SessionDescription{}, fmt.Errorf("Cannot renegotiate. Connection is nil")
+		}
+		offer, err := pc.CreateOffer(nil)
+		if err != nil {
+			return webrtc.SessionDescription{}, err
+		}
+		// Pion cannot roll back a local description, so the polite peer sets its offer once it is answered. Until then it can still
+		// answer a colliding offer of the peer (see AnswerRenegotiation). The offer contains the candidates gathered earlier
+		if r.polite.Load() {
+			return offer, nil
+		}
+		if err := r.SetLocalDescription(offer); err != nil {
+			return webrtc.SessionDescription{}, err
+		}
+		return r.gatheredLocalDescription(ctx, offer)
+	})
+}
+
+// Send an offer created by createOffer to the peer (through the signaling transport if one is set, otherwise over the control channel)
+// and apply its answer, until ctx is done
+func (r *RTC) exchangeOffer(ctx context.Context, createOffer func(ctx context.Context) (webrtc.SessionDescription, error)) error {
+	if !r.negotiating.CompareAndSwap(false, true) {
+		return ErrNegotiationInProgress
+	}
+	defer r.negotiating.Store(false)
+
+	// Drop an answer to an earlier offer that arrived too late
+	select {
+	case <-r.negotiationAnswer:
+	default:
+	}
+
+	offer, err := createOffer(ctx)
+	if err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	transport := r.signalingTransport
+	r.lock.Unlock()
+	if transport != nil {
+		answer, err := transport(RequestSDP{Offer: offer, Id: r.Id, Timestamp: time.Now().UnixMilli(), Token: r.token})
+		if err != nil {
+			return err
+		}
+		return r.applyAnswerTo(offer, answer)
+	}
+
+	content, err := json.Marshal(offer)
+	if err != nil {
+		return err
+	}
+	if err := r.SendControlFrame(controlTypeOffer, content); err != nil {
+		return fmt.Errorf("%w: %w", ErrNotConnected, err)
+	}
+
+	select {
+	case result := <-r.negotiationAnswer:
+		if result.err != nil {
+			return result.err
+		}
+		return r.applyAnswerTo(offer, result.answer)
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-r.closed:
+		return fmt.Errorf("Cannot negotiate. Connection is destroyed")
+	}
+}
+
+// Apply the answer of the peer to our offer, after setting the offer if that was postponed until it was answered (see Renegotiate)
+func (r *RTC) applyAnswerTo(offer webrtc.SessionDescription, answer webrtc.SessionDescription) error {
+	if pc := r.peerConnection(); pc != nil && pc.SignalingState() == webrtc.SignalingStateStable {
+		if err := r.SetLocalDescription(offer); err != nil {
+			return err
+		}
+	}
+	return r.ApplyAnswer(answer)
+}
+
+// Create an offer that restarts ICE, for out-of-band signaling. The offer is returned once ICE gathering completed (or ctx is done),
+// so it contains the local candidates gathered so far. Send it to the peer, which answers it with AnswerICERestart, and pass the
+// answer to ApplyAnswer
+func (r *RTC) CreateICERestartOffer(ctx context.Context) (webrtc.SessionDescription, error) {
+	pc := r.peerConnection()
+	if pc == nil {
+		return webrtc.SessionDescription{}, fmt.Errorf("Cannot restart ICE. Connection is nil")
+	}
+
+	offer, err := pc.CreateOffer(&webrtc.OfferOptions{ICERestart: true})
+	if err != nil {
+		return webrtc.SessionDescription{}, err
+	}
+	if err := r.setICERestartOffer(offer); err != nil {
+		return webrtc.SessionDescription{}, err
+	}
+	return r.gatheredLocalDescription(ctx, offer)
+}
+
+// Set an offer that restarts ICE as the local description, which starts gathering the candidates of the new ICE session
+func (r *RTC) setICERestartOffer(offer webrtc.SessionDescription) error {
+	if err := r.SetLocalDescription(offer); err != nil {
+		return err
+	}
+
+	// The candidates of the peer are applied to the new ICE session once its answer is set, the ones applied before belong to the old one
+	r.lock.Lock()
+	r.remoteDescriptionSet = false
+	r.appliedCandidates = make(map[string]struct{})
+	r.pendingCandidates = nil
+	r.lock.Unlock()
+
+	log := r.Log()
+	log.Info().Msg("Restarting ICE")
+	return nil
+}
+
+// Answer an offer of the peer that restarts ICE (see CreateICERestartOffer). The answer is returned once ICE gathering completed
+// (or ctx is done)
+func (r *RTC) AnswerICERestart(ctx context.Context, offer webrtc.SessionDescription) (webrtc.SessionDescription, error) {
+	return r.AnswerRenegotiation(ctx, offer)
+}
+
+// Wait for ICE gathering until ctx is done, and return the local description with the candidates gathered so far
+func (r *RTC) gatheredLocalDescription(ctx context.Context, desc webrtc.SessionDescription) (webrtc.SessionDescription, error) {
+	if err := r.WaitForICEGathering(ctx); err != nil && ctx.Err() == nil {
+		return webrtc.SessionDescription{}, err
+	}
+
+	pc := r.peerConnection()
+	if pc == nil {
+		return webrtc.SessionDescription{}, fmt.Errorf("Cannot get local description. Connection is nil")
+	}
+	if local := pc.LocalDescription(); local != nil {
+		return *local, nil
+	}
+	return desc, nil
+}
+
+// Answer an offer that the peer sent over the control channel (to renegotiate)
+func (r *RTC) handleOffer(payload []byte) {
+	log := r.Log()
+
+	var offer webrtc.SessionDescription
+	if err := json.Unmarshal(payload, &offer); err != nil {
+		log.Warn().Err(err).Msg("Cannot unmarshal offer")
+		return
+	}
+
+	// Gathering can take a while, so do not block the receive path of the control channel
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultGatheringTimeout)
+		defer cancel()
+
+		answer, err := r.AnswerRenegotiation(ctx, offer)
+		if errors.Is(err, ErrOfferIgnored) {
+			log.Debug().Msg("Ignored offer, it collides with our own offer")
+			return
+		} else if err != nil {
+			log.Warn().Err(err).Msg("Cannot answer offer")
+			return
+		}
+		content, err := json.Marshal(answer)
+		if err != nil {
+			log.Warn().Err(err).Msg("Cannot marshal answer")
+			return
+		}
+		if err := r.SendControlFrame(controlTypeAnswer, content); err != nil {
+			log.Warn().Err(err).Msg("Cannot send answer")
+		}
+	}()
+}
+
+// Pass the answer of the peer to the waiting RestartICE or Renegotiate
+func (r *RTC) handleAnswer(payload []byte) {
+	log := r.Log()
+
+	var answer webrtc.SessionDescription
+	if err := json.Unmarshal(payload, &answer); err != nil {
+		log.Warn().Err(err).Msg("Cannot unmarshal answer")
+		return
+	}
+	select {
+	case r.negotiationAnswer <- negotiationResult{answer: answer}:
+	default:
+		log.Debug().Msg("Dropped answer, no negotiation is waiting for it")
+	}
+}
+
+// Restart ICE automatically when the connection is disconnected (or failed) for longer than delay
+func (r *RTC) enableAutoICERestart(delay time.Duration) {
+	r.OnStateChange(func(state webrtc.PeerConnectionState) {
+		if state == webrtc.PeerConnectionStateDisconnected {
+			go r.restartICEAfter(delay)
+		}
+	})
+}
+
+// Restart ICE if the connection did not recover by itself after delay
+func (r *RTC) restartICEAfter(delay time.Duration) {
+	log := r.Log()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-r.closed:
+		return
+	}
+
+	state := r.ConnectionState()
+	if state != webrtc.PeerConnectionStateDisconnected && state != webrtc.PeerConnectionStateFailed {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultGatheringTimeout)
+	defer cancel()
+	if err := r.RestartICE(ctx); err != nil {
+		log.Warn().Err(err).Dur("disconnectedFor", delay).Msg("Cannot restart ICE automatically")
+		return
+	}
+	log.Info().Dur("disconnectedFor", delay).Msg("Restarted ICE automatically")
+}
@@ -0,0 +1,214 @@
+package rtc_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/VU-ASE/roverrtc/src/rtctest"
+	"github.com/pion/webrtc/v4"
+)
+
+// Returns the ICE username fragment of a session description
+func iceUfrag(t *testing.T, desc webrtc.SessionDescription) string {
+	t.Helper()
+
+	for _, line := range strings.Split(desc.SDP, "\r\n") {
+		if ufrag, found := strings.CutPrefix(line, "a=ice-ufrag:"); found {
+			return ufrag
+		}
+	}
+	t.Fatalf("Session description has no ICE username fragment")
+	return ""
+}
+
+// Deliver the offers of the client to the server directly, as a signaling server would
+func signalDirectly(client, server *rtc.RTC) {
+	client.SetSignalingTransport(func(offer rtc.RequestSDP) (webrtc.SessionDescription, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), receiveTimeout)
+		defer cancel()
+		return server.AnswerICERestart(ctx, offer.Offer)
+	})
+}
+
+func TestRestartICE(t *testing.T) {
+	client, server := rtctest.NewConnectedPair(t)
+	signalDirectly(client, server)
+	before := iceUfrag(t, *client.Pc.LocalDescription())
+
+	ctx, cancel := context.WithTimeout(context.Background(), receiveTimeout)
+	defer cancel()
+	if err := client.RestartICE(ctx); err != nil {
+		t.Fatalf("Cannot restart ICE: %v", err)
+	}
+	if after := iceUfrag(t, *client.Pc.LocalDescription()); after == before {
+		t.Error("Expected the restart to use new ICE credentials")
+	}
+	if err := client.WaitUntilConnected(ctx); err != nil {
+		t.Fatalf("Connection did not recover after restarting ICE: %v", err)
+	}
+
+	received := collectData(server)
+	if err := client.SendDataBytes([]byte("after restart")); err != nil {
+		t.Fatalf("Cannot send after restarting ICE: %v", err)
+	}
+	expectMessage(t, received, []byte("after restart"))
+}
+
+func TestRestartICEWithoutTransport(t *testing.T) {
+	client, server := rtctest.NewConnectedPair(t)
+	before := iceUfrag(t, *client.Pc.LocalDescription())
+
+	ctx, cancel := context.WithTimeout(context.Background(), receiveTimeout)
+	defer cancel()
+	if err := client.RestartICE(ctx); !errors.Is(err, rtc.ErrNoSignalingTransport) {
+		t.Fatalf("Expected ErrNoSignalingTransport, got %v", err)
+	}
+	if after := iceUfrag(t, *client.Pc.LocalDescription()); after != before {
+		t.Error("Expected the connection to be left untouched")
+	}
+
+	received := collectData(server)
+	if err := client.SendDataBytes([]byte("still connected")); err != nil {
+		t.Fatalf("Cannot send after a refused restart: %v", err)
+	}
+	expectMessage(t, received, []byte("still connected"))
+}
+
+func TestICERestartOutOfBand(t *testing.T) {
+	client, server := rtctest.NewConnectedPair(t)
+	before := iceUfrag(t, *client.Pc.LocalDescription())
+
+	ctx, cancel := context.WithTimeout(context.Background(), receiveTimeout)
+	defer cancel()
+	offer, err := client.CreateICERestartOffer(ctx)
+	if err != nil {
+		t.Fatalf("Cannot create ICE restart offer: %v", err)
+	}
+	if offer.Type != webrtc.SDPTypeOffer || iceUfrag(t, offer) == before {
+		t.Fatalf("Expected an offer with new ICE credentials, got %s with %s", offer.Type, iceUfrag(t, offer))
+	}
+	answer, err := server.AnswerICERestart(ctx, offer)
+	if err != nil {
+		t.Fatalf("Cannot answer ICE restart: %v", err)
+	}
+	if err := client.ApplyAnswer(answer); err != nil {
+		t.Fatalf("Cannot apply answer: %v", err)
+	}
+	if err := client.WaitUntilConnected(ctx); err != nil {
+		t.Fatalf("Connection did not recover after restarting ICE: %v", err)
+	}
+}
+
+func TestAutoICERestart(t *testing.T) {
+	client, server := rtctest.NewConnectedPair(t, rtc.WithAutoICERestart(true), rtc.WithICERestartDelay(50*time.Millisecond))
+	before := iceUfrag(t, *client.Pc.LocalDescription())
+	offers := make(chan rtc.RequestSDP, 1)
+	client.SetSignalingTransport(func(offer rtc.RequestSDP) (webrtc.SessionDescription, error) {
+		select {
+		case offers <- offer:
+		default:
+		}
+		return webrtc.SessionDescription{}, errors.New("Peer is gone")
+	})
+
+	// The network path disappears without the connection being closed, pion reports the client disconnected after a few seconds
+	if err := server.Pc.SCTP().Transport().ICETransport().Stop(); err != nil {
+		t.Fatalf("Cannot stop ICE transport of the server: %v", err)
+	}
+	select {
+	case offer := <-offers:
+		if iceUfrag(t, offer.Offer) == before {
+			t.Error("Expected the automatic restart offer to use new ICE credentials")
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatalf("Expected ICE to be restarted automatically, the connection is %s", client.ConnectionState())
+	}
+}
+
+func TestICERestartResetsRemoteCandidates(t *testing.T) {
+	client, server := rtctest.NewConnectedPair(t)
+	if err := server.AddRemoteCandidate(lateCandidate()); err != nil {
+		t.Fatalf("Cannot add remote candidate: %v", err)
+	}
+	applied := countEvents(server, rtc.EventRemoteCandidate)
+
+	ctx, cancel := context.WithTimeout(context.Background(), receiveTimeout)
+	defer cancel()
+	offer, err := client.CreateICERestartOffer(ctx)
+	if err != nil {
+		t.Fatalf("Cannot create ICE restart offer: %v", err)
+	}
+
+	// A candidate of the new ICE session that arrives before the answer waits for it
+	if err := client.AddRemoteCandidate(lateCandidate()); err != nil {
+		t.Fatalf("Cannot add remote candidate: %v", err)
+	}
+	queued := countEvents(client, rtc.EventRemoteCandidate)
+	answer, err := server.AnswerICERestart(ctx, offer)
+	if err != nil {
+		t.Fatalf("Cannot answer ICE restart: %v", err)
+	}
+	if countEvents(client, rtc.EventRemoteCandidate) != queued {
+		t.Error("Expected the candidate to be queued until the answer is applied")
+	}
+	if err := client.ApplyAnswer(answer); err != nil {
+		t.Fatalf("Cannot apply answer: %v", err)
+	}
+	if got := countEvents(client, rtc.EventRemoteCandidate); got != queued+1 {
+		t.Errorf("Expected the queued candidate to be applied with the answer, got %d new candidates", got-queued)
+	}
+
+	// The candidate was applied to the old ICE session, so it is applied again to the new one
+	if err := server.AddRemoteCandidate(lateCandidate()); err != nil {
+		t.Fatalf("Cannot add remote candidate: %v", err)
+	}
+	if got := countEvents(server, rtc.EventRemoteCandidate); got != applied+1 {
+		t.Errorf("Expected the candidate to be applied again after the restart, got %d new candidates", got-applied)
+	}
+	if err := client.WaitUntilConnected(ctx); err != nil {
+		t.Fatalf("Connection did not recover after restarting ICE: %v", err)
+	}
+}
+
+func TestRestartICEInBand(t *testing.T) {
+	client, server := rtctest.NewConnectedPair(t, rtc.WithInBandTrickle(true))
+	before := iceUfrag(t, *client.Pc.LocalDescription())
+	applied := countEvents(server, rtc.EventRemoteCandidate)
+
+	// There is no signaling transport, the restart is signaled over a standby connection
+	ctx, cancel := context.WithTimeout(context.Background(), receiveTimeout)
+	defer cancel()
+	if err := client.RestartICE(ctx); err != nil {
+		t.Fatalf("Cannot restart ICE in-band: %v", err)
+	}
+	after := iceUfrag(t, *client.Pc.LocalDescription())
+	if after == before {
+		t.Error("Expected the restart to use new ICE credentials")
+	}
+	if remote := iceUfrag(t, *server.Pc.RemoteDescription()); remote != after {
+		t.Errorf("Expected the server to apply the restart offer with %s, got %s", after, remote)
+	}
+
+	// The descriptions carry no candidates, all candidates of the new ICE session are trickled in-band
+	for _, desc := range []*webrtc.SessionDescription{server.Pc.RemoteDescription(), client.Pc.RemoteDescription()} {
+		if strings.Contains(desc.SDP, "a=candidate:") {
+			t.Errorf("Expected the %s to carry no candidates", desc.Type)
+		}
+	}
+	if countEvents(server, rtc.EventRemoteCandidate) == applied {
+		t.Error("Expected the server to apply candidates trickled in-band")
+	}
+
+	if err := client.WaitUntilConnected(ctx); err != nil {
+		t.Fatalf("Connection did not recover after restarting ICE: %v", err)
+	}
+	received := collectData(server)
+	if err := client.SendDataBytes([]byte("after restart")); err != nil {
+		t.Fatalf("Cannot send after restarting ICE: %v", err)
+	}
+	expectMessage(t, received, []byte("after restart"))
+}
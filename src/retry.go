@@ -0,0 +1,104 @@
+package rtc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+//
+// This file contains the retrying send, for the failures that go away by themselves (e.g. right after the data channel is created, while it
+// is still connecting). Only transient failures are retried, with an exponential backoff. Failures that will not go away (e.g. the channel
+// is not configured, is closed, or its circuit breaker is open) are returned right away
+//
+
+// How often and how long a send is retried
+type RetryPolicy struct {
+	MaxAttempts  int           // the maximum number of attempts, including the first one
+	InitialDelay time.Duration // the delay before the first retry, doubled for every next retry
+	MaxDelay     time.Duration // the maximum delay between two attempts
+	Jitter       float64       // the fraction of the delay that is randomized (e.g. 0.2 for up to 20% shorter or longer), to spread out retries
+}
+
+// Retries for up to about half a second, which covers a data channel that is still connecting
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:  5,
+	InitialDelay: 20 * time.Millisecond,
+	MaxDelay:     200 * time.Millisecond,
+	Jitter:       0.2,
+}
+
+// Same as SendDataBytesCtx, but retries transient failures (see RetryPolicy) until the message is sent, the attempts are used up
+// or ctx is done. Returns the error of the last attempt, or the context error when ctx is done. Returns an error without sending
+// if the policy is invalid (see RetryPolicy.Validate)
+func (r *RTC) SendDataBytesRetry(ctx context.Context, b []byte, policy RetryPolicy) error {
+	log := r.Log()
+
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+
+	delay := policy.InitialDelay
+	for attempt := 1; ; attempt++ {
+		err := r.SendDataBytesCtx(ctx, b)
+		if err == nil || attempt >= policy.MaxAttempts || !r.isTransient(err) {
+			return err
+		}
+
+		wait := policy.jittered(delay)
+		log.Debug().Err(err).Int("attempt", attempt).Dur("delay", wait).Msg("Send failed, retrying")
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-r.closed:
+			timer.Stop()
+			return fmt.Errorf("Cannot send message. Connection is destroyed")
+		}
+		delay = min(2*delay, policy.MaxDelay)
+	}
+}
+
+// Check that the policy makes at least one attempt and that its delays grow towards a positive maximum
+func (p RetryPolicy) Validate() error {
+	switch {
+	case p.MaxAttempts < 1:
+		return fmt.Errorf("Invalid retry policy. Max attempts %d must be at least 1", p.MaxAttempts)
+	case p.InitialDelay <= 0:
+		return fmt.Errorf("Invalid retry policy. Initial delay %s must be positive", p.InitialDelay)
+	case p.MaxDelay < p.InitialDelay:
+		return fmt.Errorf("Invalid retry policy. Max delay %s must be at least the initial delay %s", p.MaxDelay, p.InitialDelay)
+	case p.Jitter < 0 || p.Jitter > 1:
+		return fmt.Errorf("Invalid retry policy. Jitter %v must be between 0 and 1", p.Jitter)
+	}
+	return nil
+}
+
+// Whether a send on the data channel failed for a reason that can go away by itself
+func (r *RTC) isTransient(err error) bool {
+	switch {
+	case errors.Is(err, ErrChannelNotConfigured), errors.Is(err, ErrChannelUnhealthy):
+		return false
+	case errors.Is(err, ErrChannelNotOpen):
+		// A closing or closed channel does not open again
+		dc := r.dataMessageChannel()
+		return dc != nil && dc.ReadyState() == webrtc.DataChannelStateConnecting
+	}
+
+	var temporary interface{ Temporary() bool }
+	return errors.As(err, &temporary) && temporary.Temporary()
+}
+
+// Returns the delay with the jitter of the policy applied
+func (p RetryPolicy) jittered(delay time.Duration) time.Duration {
+	if p.Jitter <= 0 || delay <= 0 {
+		return delay
+	}
+	return delay + time.Duration((rand.Float64()*2-1)*p.Jitter*float64(delay))
+}
@@ -0,0 +1,121 @@
+package rtc_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/pion/webrtc/v4"
+)
+
+// A send error that goes away by itself, like a temporary SCTP error
+type temporaryError struct{}
+
+func (temporaryError) Error() string   { return "Temporary SCTP error" }
+func (temporaryError) Temporary() bool { return true }
+
+// A retry policy without jitter that retries quickly
+var fastRetry = rtc.RetryPolicy{MaxAttempts: 4, InitialDelay: 5 * time.Millisecond, MaxDelay: 20 * time.Millisecond}
+
+// Create a connection with a data channel that fails sends with err until failures attempts were made, returns the attempt counter
+func newFlakyConnection(err error, failures int32) (*rtc.RTC, *observedChannel, *atomic.Int32) {
+	r := rtc.NewRTC("rover")
+	data := &observedChannel{MockChannel: rtc.NewMockChannel(rtc.DataChannelLabel)}
+	var attempts atomic.Int32
+	data.FailSends(err)
+	data.onSend = func() {
+		if attempts.Add(1) > failures {
+			data.FailSends(nil)
+		}
+	}
+	r.SetDataChannel(data)
+	return r, data, &attempts
+}
+
+func TestSendRetryTransientFailures(t *testing.T) {
+	r, data, attempts := newFlakyConnection(temporaryError{}, 2)
+
+	if err := r.SendDataBytesRetry(context.Background(), []byte("telemetry"), fastRetry); err != nil {
+		t.Fatalf("Expected the send to succeed after retrying, got %v", err)
+	}
+	if attempts.Load() != 3 || len(data.Sent()) != 1 {
+		t.Errorf("Expected the message to be sent on the third attempt, got %d attempts and %d messages", attempts.Load(), len(data.Sent()))
+	}
+}
+
+func TestSendRetryGivesUp(t *testing.T) {
+	r, _, attempts := newFlakyConnection(temporaryError{}, 100)
+
+	if err := r.SendDataBytesRetry(context.Background(), []byte("telemetry"), fastRetry); !errors.As(err, &temporaryError{}) {
+		t.Errorf("Expected the error of the last attempt, got %v", err)
+	}
+	if attempts.Load() != int32(fastRetry.MaxAttempts) {
+		t.Errorf("Expected %d attempts, got %d", fastRetry.MaxAttempts, attempts.Load())
+	}
+}
+
+func TestSendRetryWhileConnecting(t *testing.T) {
+	r, data, _ := newFlakyConnection(nil, 0)
+	data.SetReadyState(webrtc.DataChannelStateConnecting)
+	time.AfterFunc(10*time.Millisecond, func() { data.SetReadyState(webrtc.DataChannelStateOpen) })
+
+	if err := r.SendDataBytesRetry(context.Background(), []byte("telemetry"), fastRetry); err != nil {
+		t.Errorf("Expected the send to succeed once the channel opened, got %v", err)
+	}
+}
+
+func TestSendRetryPermanentFailures(t *testing.T) {
+	policy := rtc.RetryPolicy{MaxAttempts: 3, InitialDelay: time.Second, MaxDelay: time.Second}
+
+	r := rtc.NewRTC("rover")
+	start := time.Now()
+	if err := r.SendDataBytesRetry(context.Background(), []byte("telemetry"), policy); !errors.Is(err, rtc.ErrChannelNotConfigured) {
+		t.Errorf("Expected ErrChannelNotConfigured, got %v", err)
+	}
+
+	r, data, attempts := newFlakyConnection(errors.New("Stream closed"), 100)
+	if err := r.SendDataBytesRetry(context.Background(), []byte("telemetry"), policy); err == nil || attempts.Load() != 1 {
+		t.Errorf("Expected a failure that is not temporary to not be retried, got %v after %d attempts", err, attempts.Load())
+	}
+	data.SetReadyState(webrtc.DataChannelStateClosed)
+	if err := r.SendDataBytesRetry(context.Background(), []byte("telemetry"), policy); !errors.Is(err, rtc.ErrChannelNotOpen) {
+		t.Errorf("Expected ErrChannelNotOpen for a closed channel, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > policy.InitialDelay/2 {
+		t.Errorf("Expected permanent failures to be returned right away, took %s", elapsed)
+	}
+}
+
+func TestSendRetryRespectsContext(t *testing.T) {
+	r, _, _ := newFlakyConnection(temporaryError{}, 100)
+	policy := rtc.RetryPolicy{MaxAttempts: 3, InitialDelay: time.Second, MaxDelay: time.Second}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if err := r.SendDataBytesRetry(ctx, []byte("telemetry"), policy); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the context error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > policy.InitialDelay/2 {
+		t.Errorf("Expected the retry to stop when the context is done, took %s", elapsed)
+	}
+}
+
+func TestRetryPolicyValidate(t *testing.T) {
+	if err := rtc.DefaultRetryPolicy.Validate(); err != nil {
+		t.Errorf("Expected the default policy to be valid, got %v", err)
+	}
+	for _, policy := range []rtc.RetryPolicy{
+		{MaxAttempts: 0, InitialDelay: time.Millisecond, MaxDelay: time.Millisecond},
+		{MaxAttempts: 1, InitialDelay: 0, MaxDelay: time.Millisecond},
+		{MaxAttempts: 1, InitialDelay: time.Second, MaxDelay: time.Millisecond},
+		{MaxAttempts: 1, InitialDelay: time.Millisecond, MaxDelay: time.Millisecond, Jitter: 2},
+	} {
+		if err := policy.Validate(); err == nil {
+			t.Errorf("Expected policy %+v to be invalid", policy)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package rtc
+
+import "fmt"
+
+// The role of a connection, which determines how it is counted and what it is allowed to do
+type Role int
+
+const (
+	RoleOperator  Role = iota // a client that is allowed to control the car (the default)
+	RoleSpectator             // a client that can only watch, its control messages are dropped
+	RoleCar                   // the car itself, which is exempt from the connection limit
+)
+
+// Returns whether connections with this role are exempt from the connection limit, draining and throttling of an RTCMap
+func (role Role) Privileged() bool {
+	return role == RoleCar
+}
+
+func (role Role) String() string {
+	switch role {
+	case RoleOperator:
+		return "operator"
+	case RoleSpectator:
+		return "spectator"
+	case RoleCar:
+		return "car"
+	default:
+		return fmt.Sprintf("role(%d)", int(role))
+	}
+}
+
+// Returns the role of the connection
+func (r *RTC) Role() Role {
+	return Role(r.role.Load())
+}
+
+// Set the role of the connection, before it is added to an RTCMap (or use the WithRole option). To change the role of a connection
+// in a map, use RTCMap.ChangeRole
+func (r *RTC) SetRole(role Role) {
+	r.role.Store(int32(role))
+}
+
+// Returns whether the connection is allowed to send (application) control messages, based on its role
+func (r *RTC) CanControl() bool {
+	return r.Role() != RoleSpectator
+}
+
+// Returns all connections in the map with the given role
+func (m *RTCMap) GetByRole(role Role) []*RTC {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	rtcList := make([]*RTC, 0)
+	for _, rtc := range m.rtcMap {
+		if rtc.Role() == role {
+			rtcList = append(rtcList, rtc)
+		}
+	}
+	return rtcList
+}
+
+// Returns the connection of the car, or nil if the car is not in the map
+func (m *RTCMap) GetCar() *RTC {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	for _, rtc := range m.rtcMap {
+		if rtc.Role() == RoleCar {
+			return rtc
+		}
+	}
+	return nil
+}
+
+// Change the role of the connection with the given id without reconnecting (e.g. to promote a spectator to an operator).
+// The new role applies immediately to everything that depends on it, such as the connection limit and the control permissions
+func (m *RTCMap) ChangeRole(id string, newRole Role) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	rtc := m.rtcMap[id]
+	if rtc == nil {
+		return fmt.Errorf("Connection with id %s does not exist", id)
+	}
+
+	// A privileged connection might have been admitted beyond the connection limit, which is not allowed for other roles
+	oldRole := rtc.Role()
+	if oldRole.Privileged() && !newRole.Privileged() && m.limit > 0 && m.countUnprivileged(id) >= m.limit {
+		return ErrMapFull
+	}
+
+	rtc.SetRole(newRole)
+	recordConnections(oldRole, -1)
+	recordConnections(newRole, 1)
+
+	log := rtc.Log()
+	log.Info().Stringer("oldRole", oldRole).Stringer("newRole", newRole).Msg("Changed role of RTC connection")
+	return nil
+}
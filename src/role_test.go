@@ -0,0 +1,155 @@
+package rtc_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/rs/zerolog"
+)
+
+// Returns a channel that receives every raw control message delivered to the connection
+func collectControl(r *rtc.RTC) <-chan []byte {
+	received := make(chan []byte, 16)
+	r.OnControlBytes(func(b []byte) {
+		msg := make([]byte, len(b))
+		copy(msg, b)
+		received <- msg
+	})
+	return received
+}
+
+func TestChangeRolePromotesSpectator(t *testing.T) {
+	m := rtc.NewRTCMap()
+	clients := connectToMap(t, m, "viewer", "driver")
+	if err := m.ChangeRole("viewer", rtc.RoleSpectator); err != nil {
+		t.Fatalf("Cannot change role: %v", err)
+	}
+	viewer := m.Get("viewer")
+	received := collectControl(viewer)
+
+	// The control messages of a spectator are dropped
+	if err := clients["viewer"].SendControlBytes([]byte("forward")); err != nil {
+		t.Fatalf("Cannot send control message: %v", err)
+	}
+	expectNoMessage(t, received)
+
+	if err := m.ChangeRole("viewer", rtc.RoleOperator); err != nil {
+		t.Fatalf("Cannot change role: %v", err)
+	}
+	if err := clients["viewer"].SendControlBytes([]byte("forward")); err != nil {
+		t.Fatalf("Cannot send control message: %v", err)
+	}
+	expectMessage(t, received, []byte("forward"))
+
+	// Broadcasts and lookups by role use the new role right away
+	if operators := m.GetByRole(rtc.RoleOperator); len(operators) != 2 {
+		t.Errorf("Expected 2 operators, got %d", len(operators))
+	}
+	telemetry := collectData(clients["viewer"])
+	if failed := m.BroadcastBytesToRole(rtc.RoleSpectator, []byte("spectators")); len(failed) != 0 {
+		t.Fatalf("Cannot broadcast: %v", failed)
+	}
+	if failed := m.BroadcastBytesToRole(rtc.RoleOperator, []byte("operators")); len(failed) != 0 {
+		t.Fatalf("Cannot broadcast: %v", failed)
+	}
+	expectMessage(t, telemetry, []byte("operators"))
+	expectNoMessage(t, telemetry)
+}
+
+func TestChangeRoleRespectsLimit(t *testing.T) {
+	m := rtc.NewRTCMapWithLimit(1)
+	if err := m.AddConnection("operator", rtc.NewRTC("operator")); err != nil {
+		t.Fatalf("Cannot add connection: %v", err)
+	}
+	car := rtc.NewRTC("car")
+	if err := m.Add("car", car, true); err != nil {
+		t.Fatalf("Cannot add car: %v", err)
+	}
+
+	// The car was admitted beyond the limit, so it cannot lose its privilege
+	if err := m.ChangeRole("car", rtc.RoleOperator); !errors.Is(err, rtc.ErrMapFull) {
+		t.Errorf("Expected ErrMapFull, got %v", err)
+	}
+	if car.Role() != rtc.RoleCar {
+		t.Errorf("Expected the role to be kept, got %s", car.Role())
+	}
+	// Demoting the operator frees the space
+	if err := m.ChangeRole("operator", rtc.RoleCar); err != nil {
+		t.Fatalf("Cannot change role: %v", err)
+	}
+	if err := m.ChangeRole("car", rtc.RoleSpectator); err != nil {
+		t.Errorf("Expected the role change to succeed below the limit, got %v", err)
+	}
+
+	if err := m.ChangeRole("unknown", rtc.RoleOperator); err == nil {
+		t.Error("Expected an error for an unknown connection")
+	}
+}
+
+func TestRoleAndMetadataOptions(t *testing.T) {
+	metadata := map[string]string{"version": "1.2.0"}
+	r, err := rtc.NewRTCWithOptions("viewer", rtc.WithRole(rtc.RoleSpectator), rtc.WithMetadata(metadata))
+	if err != nil {
+		t.Fatalf("Cannot create connection: %v", err)
+	}
+	t.Cleanup(func() { r.Destroy() })
+
+	if r.Role() != rtc.RoleSpectator {
+		t.Errorf("Expected role %s, got %s", rtc.RoleSpectator, r.Role())
+	}
+	// The metadata is copied at construction
+	metadata["version"] = "2.0.0"
+	if version := r.Metadata["version"]; version != "1.2.0" {
+		t.Errorf("Expected version 1.2.0, got %s", version)
+	}
+
+	// The role is part of the log context
+	logs := newLogBuffer()
+	log := r.Log().Output(logs).Level(zerolog.InfoLevel)
+	log.Info().Msg("connected")
+	if !strings.Contains(logs.String(), `"role":"`+rtc.RoleSpectator.String()+`"`) {
+		t.Errorf("Expected the role in the log context, got %s", logs)
+	}
+
+	if plain := rtc.NewRTC("driver"); plain.Role() != rtc.RoleOperator || plain.Metadata == nil {
+		t.Errorf("Expected role %s and empty metadata by default, got %s and %v", rtc.RoleOperator, plain.Role(), plain.Metadata)
+	}
+}
+
+func TestGetByRole(t *testing.T) {
+	m := rtc.NewRTCMap()
+	if car := m.GetCar(); car != nil {
+		t.Errorf("Expected no car, got %s", car.Id)
+	}
+
+	car := rtc.NewRTC("car")
+	if err := m.Add("car", car, true); err != nil {
+		t.Fatalf("Cannot add car: %v", err)
+	}
+	for _, id := range []string{"driver", "viewer-1", "viewer-2"} {
+		r := rtc.NewRTC(id)
+		if strings.HasPrefix(id, "viewer") {
+			r.SetRole(rtc.RoleSpectator)
+		}
+		if err := m.AddConnection(id, r); err != nil {
+			t.Fatalf("Cannot add connection: %v", err)
+		}
+	}
+
+	if got := m.GetCar(); got != car {
+		t.Errorf("Expected the car, got %v", got)
+	}
+	for role, want := range map[rtc.Role]int{rtc.RoleCar: 1, rtc.RoleOperator: 1, rtc.RoleSpectator: 2} {
+		connections := m.GetByRole(role)
+		if len(connections) != want {
+			t.Errorf("Expected %d connections with role %s, got %d", want, role, len(connections))
+		}
+		for _, r := range connections {
+			if r.Role() != role {
+				t.Errorf("Expected connection %s to have role %s, got %s", r.Id, role, r.Role())
+			}
+		}
+	}
+}
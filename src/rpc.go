@@ -0,0 +1,152 @@
+package rtc
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+)
+
+//
+// This file contains the request/response layer on top of the control channel. Requests and responses are framed control messages
+// that carry a correlation id, so that concurrent calls each receive their own response:
+//
+//	| correlation id (8 bytes, big endian) | payload |
+//
+// For an error response, the payload is the error message
+//
+
+const rpcHeaderSize = 8
+
+// The request handler of the peer returned an error (or the peer has no request handler)
+var ErrRequestFailed = errors.New("Request failed")
+
+type rpcResponse struct {
+	payload []byte
+	err     error
+}
+
+// Send a request to the peer and wait for its response, until ctx is done. An error returned by the request handler of the peer is
+// returned as an error wrapping ErrRequestFailed. The peer needs to register a handler with OnRequest
+func (r *RTC) Call(ctx context.Context, req proto.Message) ([]byte, error) {
+	content, err := proto.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	id := r.callId.Add(1)
+	done := make(chan rpcResponse, 1)
+	r.lock.Lock()
+	r.calls[id] = done
+	r.lock.Unlock()
+	defer func() {
+		r.lock.Lock()
+		delete(r.calls, id)
+		r.lock.Unlock()
+	}()
+
+	if err := r.SendControlFrame(controlTypeRequest, appendCorrelationId(id, content)); err != nil {
+		return nil, err
+	}
+
+	select {
+	case resp := <-done:
+		return resp.payload, resp.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-r.closed:
+		return nil, fmt.Errorf("Cannot complete call. Connection is destroyed")
+	}
+}
+
+// Register a handler for requests from the peer (sent with Call). The returned bytes are sent back as the response, a returned error
+// is sent back as an error response. Requests are handled concurrently, and requests from spectators are refused
+func (r *RTC) OnRequest(handler func(req []byte) ([]byte, error)) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.onRequest = handler
+}
+
+// Handle a request from the peer in the background and send back the response
+func (r *RTC) handleRequest(payload []byte) {
+	if len(payload) < rpcHeaderSize {
+		return
+	}
+	id := binary.BigEndian.Uint64(payload)
+	req := payload[rpcHeaderSize:]
+
+	r.lock.Lock()
+	handler := r.onRequest
+	r.lock.Unlock()
+
+	go func() {
+		log := r.Log()
+
+		var resp []byte
+		var err error
+		switch {
+		case !r.CanControl():
+			err = fmt.Errorf("Role %s is not allowed to send requests", r.Role())
+		case handler == nil:
+			err = fmt.Errorf("No request handler registered")
+		default:
+			resp, err = handler(req)
+		}
+
+		if err != nil {
+			err = r.SendControlFrame(controlTypeErrorResponse, appendCorrelationId(id, []byte(err.Error())))
+		} else {
+			err = r.SendControlFrame(controlTypeResponse, appendCorrelationId(id, resp))
+		}
+		if err != nil {
+			log.Debug().Err(err).Uint64("correlationId", id).Msg("Could not send response")
+		}
+	}()
+}
+
+// Pass a response to the call that is waiting for it, if it did not give up yet
+func (r *RTC) handleResponse(payload []byte) {
+	r.deliverResponse(payload, false)
+}
+
+// Pass an error response to the call that is waiting for it, if it did not give up yet
+func (r *RTC) handleErrorResponse(payload []byte) {
+	r.deliverResponse(payload, true)
+}
+
+// Pass a (error) response to the call with the matching correlation id
+func (r *RTC) deliverResponse(payload []byte, failed bool) {
+	if len(payload) < rpcHeaderSize {
+		return
+	}
+	id := binary.BigEndian.Uint64(payload)
+	body := payload[rpcHeaderSize:]
+
+	r.lock.Lock()
+	done := r.calls[id]
+	delete(r.calls, id)
+	r.lock.Unlock()
+
+	if done == nil {
+		log := r.Log()
+		log.Debug().Uint64("correlationId", id).Msg("Dropped response, no call is waiting for it")
+		return
+	}
+
+	resp := rpcResponse{payload: body}
+	if failed {
+		resp = rpcResponse{err: fmt.Errorf("%w: %s", ErrRequestFailed, body)}
+	}
+	done <- resp
+}
+
+// Prefix a payload with a correlation id
+func appendCorrelationId(id uint64, payload []byte) []byte {
+	b := make([]byte, rpcHeaderSize+len(payload))
+	binary.BigEndian.PutUint64(b, id)
+	copy(b[rpcHeaderSize:], payload)
+	return b
+}
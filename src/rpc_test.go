@@ -0,0 +1,109 @@
+package rtc_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/VU-ASE/roverrtc/src/rtctest"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestCallConcurrent(t *testing.T) {
+	client, server := rtctest.NewConnectedPair(t)
+	// Answer with the request itself, after a delay that makes responses arrive out of order
+	server.OnRequest(func(req []byte) ([]byte, error) {
+		var value wrapperspb.UInt32Value
+		if err := proto.Unmarshal(req, &value); err != nil {
+			return nil, err
+		}
+		time.Sleep(time.Duration(value.Value%5) * 10 * time.Millisecond)
+		return req, nil
+	})
+
+	const calls = 50
+	var wg sync.WaitGroup
+	errs := make(chan error, calls)
+	for i := uint32(0); i < calls; i++ {
+		wg.Add(1)
+		go func(i uint32) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), receiveTimeout)
+			defer cancel()
+			resp, err := client.Call(ctx, wrapperspb.UInt32(i))
+			if err != nil {
+				errs <- fmt.Errorf("Call %d failed: %w", i, err)
+				return
+			}
+			var value wrapperspb.UInt32Value
+			if err := proto.Unmarshal(resp, &value); err != nil {
+				errs <- fmt.Errorf("Cannot unmarshal response of call %d: %w", i, err)
+				return
+			}
+			if value.Value != i {
+				errs <- fmt.Errorf("Call %d received the response of call %d", i, value.Value)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if pending := client.PendingCalls(); pending != 0 {
+		t.Errorf("Expected no pending calls, got %d", pending)
+	}
+}
+
+func TestCallTimeout(t *testing.T) {
+	client, server := rtctest.NewConnectedPair(t)
+	release := make(chan struct{})
+	defer close(release)
+	server.OnRequest(func(req []byte) ([]byte, error) {
+		<-release
+		return req, nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.Call(ctx, wrapperspb.String("slow")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the call to time out, got %v", err)
+	}
+	if pending := client.PendingCalls(); pending != 0 {
+		t.Errorf("Expected the timed out call to not leave a waiter behind, got %d pending calls", pending)
+	}
+}
+
+func TestCallHandlerError(t *testing.T) {
+	client, server := rtctest.NewConnectedPair(t)
+	server.OnRequest(func(req []byte) ([]byte, error) {
+		return nil, fmt.Errorf("Pipeline is not running")
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), receiveTimeout)
+	defer cancel()
+	_, err := client.Call(ctx, wrapperspb.String("status"))
+	if !errors.Is(err, rtc.ErrRequestFailed) {
+		t.Fatalf("Expected an error wrapping ErrRequestFailed, got %v", err)
+	}
+	if want := "Pipeline is not running"; !strings.Contains(err.Error(), want) {
+		t.Errorf("Expected the error of the handler (%q) to be propagated, got %q", want, err)
+	}
+}
+
+func TestCallWithoutHandler(t *testing.T) {
+	client, _ := rtctest.NewConnectedPair(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), receiveTimeout)
+	defer cancel()
+	if _, err := client.Call(ctx, wrapperspb.String("status")); !errors.Is(err, rtc.ErrRequestFailed) {
+		t.Fatalf("Expected an error wrapping ErrRequestFailed, got %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+// Package rtctest contains helpers to test code that uses the rtc package, without a signaling server or network setup
+package rtctest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+)
+
+//
+// This file contains the in-memory connected pair: two connections on the local machine that performed the offer/answer exchange in-process
+// (with the candidates embedded in the descriptions), so that a test can start sending right away
+//
+
+// How long NewConnectedPair waits for the pair to connect and open its channels
+const ConnectTimeout = 10 * time.Second
+
+// How often NewConnectedPair checks whether the channels are open
+const pollInterval = 10 * time.Millisecond
+
+// Create two connected connections: a client that created the offer (with id "client") and a server that accepted it (with id "server").
+// The options are passed to both constructors (see rtc.CreateOffer and rtc.AcceptOffer), so the delivery semantics of the channels can be
+// chosen like in production. Returns once both connections are connected and their control and data channels are open, and fails the test
+// if that does not happen within ConnectTimeout. Both connections are destroyed when the test finishes
+func NewConnectedPair(t testing.TB, opts ...rtc.Option) (*rtc.RTC, *rtc.RTC) {
+	t.Helper()
+
+	client, server, err := connectPair(opts)
+	if err != nil {
+		t.Fatalf("Cannot create connected pair: %v", err)
+	}
+	t.Cleanup(func() {
+		client.Destroy()
+		server.Destroy()
+	})
+	return client, server
+}
+
+// Perform the offer/answer exchange between a new client and server, and wait until both are connected with open channels
+func connectPair(opts []rtc.Option) (*rtc.RTC, *rtc.RTC, error) {
+	client, offer, err := rtc.CreateOffer("client", opts...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Cannot create offer: %w", err)
+	}
+	offer.Id = "server"
+
+	server, answer, err := rtc.AcceptOffer(offer, opts...)
+	if err != nil {
+		client.Destroy()
+		return nil, nil, fmt.Errorf("Cannot accept offer: %w", err)
+	}
+	if err := client.ApplyAnswer(answer); err != nil {
+		client.Destroy()
+		server.Destroy()
+		return nil, nil, fmt.Errorf("Cannot apply answer: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ConnectTimeout)
+	defer cancel()
+	if err := waitUntilReady(ctx, client, server); err != nil {
+		client.Destroy()
+		server.Destroy()
+		return nil, nil, err
+	}
+	return client, server, nil
+}
+
+// Block until both connections are connected and their control and data channels are open
+func waitUntilReady(ctx context.Context, peers ...*rtc.RTC) error {
+	for _, peer := range peers {
+		if err := peer.WaitUntilConnected(ctx); err != nil {
+			return fmt.Errorf("Connection %s did not connect: %w", peer.Id, err)
+		}
+	}
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		ready := true
+		for _, peer := range peers {
+			if !peer.IsControlChannelOpen() || !peer.IsDataChannelOpen() {
+				ready = false
+			}
+		}
+		if ready {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("Channels did not open: %w", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
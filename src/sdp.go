@@ -1,10 +1,103 @@
 package rtc
 
-import "github.com/pion/webrtc/v4"
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pion/webrtc/v4"
+)
 
 // The data format used for SDP requests
 type RequestSDP struct {
 	Offer     webrtc.SessionDescription `json:"offer"`
-	Id        string                    `json:"id"`        // to distinguish between clients
-	Timestamp int64                     `json:"timestamp"` // timestamp of the sender
+	Id        string                    `json:"id"`              // to distinguish between clients
+	Timestamp int64                     `json:"timestamp"`       // timestamp of the sender
+	Token     string                    `json:"token,omitempty"` // to authenticate the client, if the server requires it
+}
+
+// Set the local description (i.e. the offer or answer that is sent to the peer), which also starts ICE gathering.
+// Blocks while the maximum number of connections that gather at the same time is reached (see SetGatheringLimits)
+func (r *RTC) SetLocalDescription(desc webrtc.SessionDescription) error {
+	pc := r.peerConnection()
+	if pc == nil {
+		return fmt.Errorf("Cannot set local description. Connection is nil")
+	}
+
+	slots, timeout := getGatheringLimits()
+	if slots != nil {
+		select {
+		case slots <- struct{}{}:
+		case <-r.closed:
+			return fmt.Errorf("Cannot set local description. Connection is destroyed")
+		}
+	}
+
+	gatherComplete := webrtc.GatheringCompletePromise(pc)
+	if err := pc.SetLocalDescription(desc); err != nil {
+		if slots != nil {
+			<-slots
+		}
+		return err
+	}
+
+	done := make(chan struct{})
+	r.lock.Lock()
+	r.gatheringDone = done
+	r.lock.Unlock()
+	go r.awaitGathering(gatherComplete, done, slots, timeout)
+
+	r.recordSignaling(signalingOut, &desc, nil)
+	return nil
+}
+
+// Set the remote description (i.e. the offer or answer received from the peer)
+func (r *RTC) SetRemoteDescription(desc webrtc.SessionDescription) error {
+	r.recordSignaling(signalingIn, &desc, nil)
+
+	pc := r.peerConnection()
+	if pc == nil {
+		return fmt.Errorf("Cannot set remote description. Connection is nil")
+	}
+
+	previous := pc.RemoteDescription()
+	if err := pc.SetRemoteDescription(desc); err != nil {
+		return err
+	}
+	r.markSetup(setupRemoteDescription)
+
+	r.lock.Lock()
+	// New ICE credentials restart ICE (see AnswerICERestart), the candidates applied before belong to the old ICE session
+	if previous != nil && iceUfrag(previous.SDP) != iceUfrag(desc.SDP) {
+		r.appliedCandidates = make(map[string]struct{})
+	}
+	// Candidates embedded in the SDP are applied as well, so that they are skipped when they are trickled again
+	for _, line := range strings.Split(desc.SDP, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "a=candidate:") {
+			r.appliedCandidates[strings.TrimPrefix(line, "a=")] = struct{}{}
+		}
+	}
+	r.remoteDescriptionSet = true
+	pending := r.pendingCandidates
+	r.pendingCandidates = nil
+	r.lock.Unlock()
+
+	// Apply the candidates that arrived before the remote description
+	log := r.Log()
+	for _, candidate := range pending {
+		if err := r.applyRemoteCandidate(candidate); err != nil {
+			log.Warn().Err(err).Str("candidate", candidate.Candidate).Msg("Cannot apply queued remote ICE candidate")
+		}
+	}
+	return nil
+}
+
+// Returns the ICE username fragment of a session description, or an empty string if it has none
+func iceUfrag(sdp string) string {
+	for _, line := range strings.Split(sdp, "\n") {
+		if ufrag, found := strings.CutPrefix(strings.TrimSpace(line), "a=ice-ufrag:"); found {
+			return ufrag
+		}
+	}
+	return ""
 }
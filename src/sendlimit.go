@@ -0,0 +1,116 @@
+package rtc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+//
+// This file contains the (opt-in) rate limits on outgoing messages of a connection, so that a single misbehaving sender cannot flood
+// a channel. The data channel and the control channel have independent limits, so a flood of data does not starve the control messages
+//
+
+// What happens to a message that exceeds the rate limit
+type RateLimitPolicy int
+
+const (
+	RateLimitBlock RateLimitPolicy = iota // wait until the message is allowed
+	RateLimitDrop                         // drop the message and return ErrRateLimited
+)
+
+// The message was dropped because the send rate limit of the channel was exceeded
+var ErrRateLimited = errors.New("Send rate limit exceeded")
+
+type sendLimiter struct {
+	bucket  *tokenBucket
+	policy  RateLimitPolicy
+	dropped uint64 // the number of messages dropped by the limit, guarded by the lock of the connection
+}
+
+// Limit the messages sent on the data channel (by SendDataBytes and the methods built on it) to perSecond, with bursts of up to burst
+// messages (at least 1). Messages beyond the rate are delayed or dropped, depending on the policy. Pass a rate of 0 to remove the limit
+func (r *RTC) SetSendRateLimit(perSecond float64, burst int, policy RateLimitPolicy) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.dataLimiter = newSendLimiter(perSecond, burst, policy)
+}
+
+// Limit the messages sent on the control channel, independently of the data channel (see SetSendRateLimit). This also applies to
+// the messages of the package itself (e.g. keep-alive pings), so the limit should leave room for those
+func (r *RTC) SetControlRateLimit(perSecond float64, burst int, policy RateLimitPolicy) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.controlLimiter = newSendLimiter(perSecond, burst, policy)
+}
+
+func newSendLimiter(perSecond float64, burst int, policy RateLimitPolicy) *sendLimiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	return &sendLimiter{
+		bucket: newTokenBucket(perSecond, burst),
+		policy: policy,
+	}
+}
+
+// Apply a rate limit to a message that is about to be sent. Blocks until the message is allowed (or ctx is done), or returns
+// ErrRateLimited, depending on the policy. A nil limiter allows every message
+func (r *RTC) limitSend(ctx context.Context, limiter *sendLimiter) error {
+	if limiter == nil || limiter.bucket.allow() {
+		return nil
+	}
+
+	if limiter.policy == RateLimitDrop {
+		r.lock.Lock()
+		limiter.dropped++
+		r.lock.Unlock()
+		return ErrRateLimited
+	}
+
+	for {
+		select {
+		case <-time.After(limiter.bucket.untilNext()):
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-r.closed:
+			return fmt.Errorf("Cannot send message. Connection is destroyed")
+		}
+		if limiter.bucket.allow() {
+			return nil
+		}
+	}
+}
+
+// Returns the rate limit of the data channel
+func (r *RTC) getDataLimiter() *sendLimiter {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.dataLimiter
+}
+
+// Returns the rate limit of the control channel
+func (r *RTC) getControlLimiter() *sendLimiter {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.controlLimiter
+}
+
+// Returns the number of messages dropped by the rate limits of the control and data channel
+func (r *RTC) rateLimitedMessages() (control uint64, data uint64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.controlLimiter != nil {
+		control = r.controlLimiter.dropped
+	}
+	if r.dataLimiter != nil {
+		data = r.dataLimiter.dropped
+	}
+	return control, data
+}
@@ -0,0 +1,106 @@
+package rtc_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/pion/webrtc/v4"
+)
+
+// Create a connection with a peer connection (for its statistics) and mock control and data channels
+func newLimitedConnection(t *testing.T) (*rtc.RTC, *rtc.MockChannel, *rtc.MockChannel) {
+	t.Helper()
+
+	r := rtc.NewRTC("rover")
+	if err := r.CreatePeerConnection(webrtc.Configuration{}); err != nil {
+		t.Fatalf("Cannot create peer connection: %v", err)
+	}
+	t.Cleanup(func() { r.Destroy() })
+	control, data := rtc.NewMockChannel(rtc.ControlChannelLabel), rtc.NewMockChannel(rtc.DataChannelLabel)
+	r.SetControlChannel(control)
+	r.SetDataChannel(data)
+	return r, control, data
+}
+
+func TestSendRateLimitDrop(t *testing.T) {
+	r, control, data := newLimitedConnection(t)
+	r.SetSendRateLimit(10, 5, rtc.RateLimitDrop)
+
+	dropped := 0
+	for i := 0; i < 20; i++ {
+		err := r.SendDataBytes([]byte("flood"))
+		if errors.Is(err, rtc.ErrRateLimited) {
+			dropped++
+		} else if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if sent := len(data.Sent()); sent != 5 {
+		t.Errorf("Expected the burst of 5 messages to be sent, got %d", sent)
+	}
+	if dropped != 15 {
+		t.Errorf("Expected 15 messages to be dropped, got %d", dropped)
+	}
+	stats, err := r.Stats()
+	if err != nil {
+		t.Fatalf("Cannot get statistics: %v", err)
+	}
+	if stats.Data.RateLimited != 15 || stats.Control.RateLimited != 0 {
+		t.Errorf("Expected 15 dropped data messages in the statistics, got %d data and %d control", stats.Data.RateLimited, stats.Control.RateLimited)
+	}
+
+	// The control channel has its own limit, which is not set
+	for i := 0; i < 20; i++ {
+		if err := r.SendControlBytes([]byte("stop")); err != nil {
+			t.Fatalf("Expected the control channel to not be limited, got %v", err)
+		}
+	}
+	if sent := len(control.Sent()); sent != 20 {
+		t.Errorf("Expected all control messages to be sent, got %d", sent)
+	}
+}
+
+func TestSendRateLimitBlock(t *testing.T) {
+	r, _, data := newLimitedConnection(t)
+	r.SetSendRateLimit(20, 1, rtc.RateLimitBlock)
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if err := r.SendDataBytes([]byte("flood")); err != nil {
+			t.Fatalf("Expected the message to be delayed instead of dropped, got %v", err)
+		}
+	}
+	// The first message uses the burst, the other four wait 50ms each
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("Expected the messages to be delayed to the rate, sending took %s", elapsed)
+	}
+	if sent := len(data.Sent()); sent != 5 {
+		t.Errorf("Expected all messages to be sent, got %d", sent)
+	}
+}
+
+func TestControlRateLimitIsIndependent(t *testing.T) {
+	r, control, data := newLimitedConnection(t)
+	// A burst of 0 still allows a single message
+	r.SetControlRateLimit(1, 0, rtc.RateLimitDrop)
+
+	if err := r.SendControlBytes([]byte("stop")); err != nil {
+		t.Fatalf("Expected the first control message to be allowed, got %v", err)
+	}
+	if err := r.SendControlBytes([]byte("stop")); !errors.Is(err, rtc.ErrRateLimited) {
+		t.Errorf("Expected the second control message to be dropped, got %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := r.SendDataBytes([]byte("telemetry")); err != nil {
+			t.Fatalf("Expected the data channel to not be limited, got %v", err)
+		}
+	}
+	if sent := len(control.Sent()); sent != 1 {
+		t.Errorf("Expected 1 control message to be sent, got %d", sent)
+	}
+	if sent := len(data.Sent()); sent != 10 {
+		t.Errorf("Expected all data messages to be sent, got %d", sent)
+	}
+}
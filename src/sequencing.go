@@ -0,0 +1,135 @@
+package rtc
+
+import (
+	"sync"
+)
+
+//
+// This file contains the (opt-in) loss and ordering detection of the data channel, to measure how much is lost on an unreliable channel
+// (e.g. for telemetry). Outgoing data messages are prefixed with a sequence number (the same prefix as the reorder buffer, see reorder.go),
+// and the receiver counts the messages that are delivered, lost (a gap in the sequence numbers), reordered (a message that fills a gap)
+// and duplicate. Sequence numbers wrap around, they are compared in signed space. Control messages are never sequenced.
+// Both peers need to enable sequencing
+//
+
+// The number of missing sequence numbers that are remembered, so that a late message can be told apart from a duplicate
+const lossWindow = 1024
+
+// The loss and ordering statistics of the data channel
+type LossStats struct {
+	Delivered uint64 // the number of messages received (excluding duplicates)
+	Lost      uint64 // the number of messages that are missing (not counting the ones that arrived late)
+	Reordered uint64 // the number of messages that arrived after a later message
+	Duplicate uint64 // the number of messages that were received before, or arrived too late to tell
+}
+
+type lossTracker struct {
+	lock    *sync.Mutex
+	stats   LossStats
+	started bool
+	highest uint32              // the highest sequence number received so far
+	missing map[uint32]struct{} // the missing sequence numbers within the loss window
+}
+
+// Enable or disable the loss and ordering detection of the data channel (see LossStats). Disabled by default
+func (r *RTC) EnableSequencing(enabled bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.sequencing = nil
+	if enabled {
+		var lock sync.Mutex
+		r.sequencing = &lossTracker{lock: &lock, missing: make(map[uint32]struct{})}
+	}
+}
+
+// Returns the loss and ordering statistics of the data channel, zero if sequencing is not enabled
+func (r *RTC) LossStats() LossStats {
+	r.lock.Lock()
+	tracker := r.sequencing
+	r.lock.Unlock()
+
+	if tracker == nil {
+		return LossStats{}
+	}
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+	return tracker.stats
+}
+
+// Register a handler that is called when a gap in the sequence numbers is detected, with the first missing sequence number and the
+// sequence number that was received instead
+func (r *RTC) OnGap(handler func(expected, received uint32)) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.onGap = handler
+}
+
+// Count a received sequence number, and pass a gap in front of it to the OnGap handler
+func (r *RTC) trackSequence(tracker *lossTracker, seq uint32) {
+	expected, gap := tracker.observe(seq)
+	if !gap {
+		return
+	}
+
+	r.lock.Lock()
+	handler := r.onGap
+	r.lock.Unlock()
+	if handler != nil {
+		handler(expected, seq)
+	}
+}
+
+// Count a received sequence number. Returns the first missing sequence number if it leaves a gap
+func (t *lossTracker) observe(seq uint32) (uint32, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if !t.started {
+		t.started = true
+		t.highest = seq
+		t.stats.Delivered++
+		return 0, false
+	}
+
+	// Compare in signed space, so that the wraparound of the sequence number is handled
+	distance := int32(seq - t.highest)
+	switch {
+	case distance > 0:
+		expected := t.highest + 1
+		first := expected
+		if distance-1 > lossWindow {
+			first = seq - lossWindow
+		}
+		for missed := first; missed != seq; missed++ {
+			t.missing[missed] = struct{}{}
+		}
+		t.stats.Lost += uint64(distance - 1)
+		t.stats.Delivered++
+		t.highest = seq
+		t.forget()
+		return expected, distance > 1
+	case distance == 0:
+		t.stats.Duplicate++
+	default:
+		if _, ok := t.missing[seq]; ok {
+			delete(t.missing, seq)
+			t.stats.Lost--
+			t.stats.Reordered++
+			t.stats.Delivered++
+		} else {
+			t.stats.Duplicate++
+		}
+	}
+	return 0, false
+}
+
+// Forget the missing sequence numbers that are outside of the loss window, they remain counted as lost
+func (t *lossTracker) forget() {
+	for seq := range t.missing {
+		if t.highest-seq > lossWindow {
+			delete(t.missing, seq)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package rtc_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+)
+
+// Returns a data message with the given sequence number, as a sequencing peer sends it
+func sequenced(seq uint32, payload string) []byte {
+	return append(binary.BigEndian.AppendUint32(nil, seq), payload...)
+}
+
+// A gap reported to the OnGap handler
+type gap struct {
+	expected, received uint32
+}
+
+// Create a connection with sequencing on a mock data channel, returns the channel and the gaps it reports
+func newSequencedReceiver() (*rtc.RTC, *rtc.MockChannel, *[]gap) {
+	r := rtc.NewRTC("operator")
+	dc := rtc.NewMockChannel(rtc.DataChannelLabel)
+	r.SetDataChannel(dc)
+	r.EnableSequencing(true)
+	gaps := &[]gap{}
+	r.OnGap(func(expected, received uint32) {
+		*gaps = append(*gaps, gap{expected, received})
+	})
+	return r, dc, gaps
+}
+
+func TestLossStats(t *testing.T) {
+	r, dc, gaps := newSequencedReceiver()
+	received := collectData(r)
+
+	for _, seq := range []uint32{0, 1, 3, 4, 2, 3, 7} {
+		dc.Inject(sequenced(seq, "telemetry"))
+	}
+	// The handler receives the messages without their sequence number
+	expectMessage(t, received, []byte("telemetry"))
+
+	want := rtc.LossStats{Delivered: 6, Lost: 2, Reordered: 1, Duplicate: 1}
+	if stats := r.LossStats(); stats != want {
+		t.Errorf("Expected %+v, got %+v", want, stats)
+	}
+	wantGaps := []gap{{2, 3}, {5, 7}}
+	if len(*gaps) != len(wantGaps) || (*gaps)[0] != wantGaps[0] || (*gaps)[1] != wantGaps[1] {
+		t.Errorf("Expected gaps %v, got %v", wantGaps, *gaps)
+	}
+}
+
+func TestLossStatsWraparound(t *testing.T) {
+	r, dc, gaps := newSequencedReceiver()
+
+	for _, seq := range []uint32{math.MaxUint32 - 1, math.MaxUint32, 1, 0} {
+		dc.Inject(sequenced(seq, "telemetry"))
+	}
+	want := rtc.LossStats{Delivered: 4, Reordered: 1}
+	if stats := r.LossStats(); stats != want {
+		t.Errorf("Expected %+v, got %+v", want, stats)
+	}
+	if len(*gaps) != 1 || (*gaps)[0] != (gap{0, 1}) {
+		t.Errorf("Expected a single gap at 0, got %v", *gaps)
+	}
+}
+
+func TestSequencingOutgoing(t *testing.T) {
+	r := rtc.NewRTC("rover")
+	control, data := rtc.NewMockChannel(rtc.ControlChannelLabel), rtc.NewMockChannel(rtc.DataChannelLabel)
+	r.SetControlChannel(control)
+	r.SetDataChannel(data)
+	r.EnableSequencing(true)
+
+	for i := 0; i < 2; i++ {
+		if err := r.SendDataBytes([]byte("telemetry")); err != nil {
+			t.Fatalf("Cannot send message: %v", err)
+		}
+	}
+	if err := r.SendControlBytes([]byte("stop")); err != nil {
+		t.Fatalf("Cannot send control message: %v", err)
+	}
+
+	for i, sent := range data.Sent() {
+		if want := sequenced(uint32(i), "telemetry"); !bytes.Equal(sent, want) {
+			t.Errorf("Expected data message %d to be %v, got %v", i, want, sent)
+		}
+	}
+	if sent := control.Sent(); len(sent) != 1 || !bytes.Equal(sent[0], []byte("stop")) {
+		t.Errorf("Expected the control message to not be sequenced, got %v", sent)
+	}
+}
+
+func TestLossStatsWithoutSequencing(t *testing.T) {
+	r := rtc.NewRTC("operator")
+	if stats := r.LossStats(); stats != (rtc.LossStats{}) {
+		t.Errorf("Expected no statistics without sequencing, got %+v", stats)
+	}
+}
@@ -0,0 +1,122 @@
+package rtc
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pion/dtls/v2"
+	"github.com/pion/interceptor"
+	"github.com/pion/webrtc/v4"
+)
+
+//
+// This file contains the creation of the underlying webRTC connection, using the settings (pion's SettingEngine) configured on the RTC.
+// Settings only take effect when they are configured before CreatePeerConnection is called
+//
+
+// The keep-alive and failure detection parameters of a connection. pion (at the version used by this package) does not expose the heartbeat
+// and retransmission parameters of the SCTP association, so keep-alives are configured on the ICE layer, which carries the SCTP traffic.
+// Aggressive values detect failures faster but cost (cellular) data on the rover, lax values save data but detect failures later
+type KeepaliveConfig struct {
+	KeepaliveInterval   time.Duration // how often keep-alive traffic is sent when the connection is otherwise idle
+	DisconnectedTimeout time.Duration // how long without network activity before the connection is considered disconnected
+	FailedTimeout       time.Duration // how long (after being disconnected) without network activity before the connection is considered failed
+}
+
+// The keep-alive parameters used when none are configured (the pion defaults)
+var DefaultKeepaliveConfig = KeepaliveConfig{
+	KeepaliveInterval:   2 * time.Second,
+	DisconnectedTimeout: 5 * time.Second,
+	FailedTimeout:       25 * time.Second,
+}
+
+// Create the webRTC connection with the given configuration and the settings configured on this RTC
+func (r *RTC) CreatePeerConnection(config webrtc.Configuration) error {
+	if r.peerConnection() != nil {
+		return fmt.Errorf("Cannot create RTC connection. Connection already exists")
+	}
+
+	pc, err := r.newPeerConnection(config)
+	if err != nil {
+		return err
+	}
+
+	r.SetPeerConnection(pc)
+	return nil
+}
+
+// Create a webRTC connection with the given configuration and the settings configured on this RTC, without setting it up as Pc
+func (r *RTC) newPeerConnection(config webrtc.Configuration) (*webrtc.PeerConnection, error) {
+	// Register the default codecs and interceptors (e.g. NACK), so that media tracks can be used
+	media := &webrtc.MediaEngine{}
+	if err := media.RegisterDefaultCodecs(); err != nil {
+		return nil, err
+	}
+	interceptors := &interceptor.Registry{}
+	if err := webrtc.RegisterDefaultInterceptors(media, interceptors); err != nil {
+		return nil, err
+	}
+
+	r.lock.Lock()
+	api := webrtc.NewAPI(webrtc.WithSettingEngine(r.settings), webrtc.WithMediaEngine(media), webrtc.WithInterceptorRegistry(interceptors))
+	r.lock.Unlock()
+
+	return api.NewPeerConnection(config)
+}
+
+// Set the DTLS cipher suites to use for the connection, in order of preference. The suites are stateful, so newSuites must return new instances
+// on every call. Must be called before CreatePeerConnection.
+//
+// Tradeoffs: pion (at the version used by this package) always appends its default suites after the configured ones, so the configured suites
+// are offered first and will be negotiated when the peer supports them, but the defaults remain available as a fallback for peers that do not.
+// This is therefore a preference and not a strict restriction. Only certificate-based suites can be used, since webRTC authenticates the
+// DTLS handshake with certificates
+func (r *RTC) SetDTLSCipherSuites(newSuites func() []dtls.CipherSuite) error {
+	if r.peerConnection() != nil {
+		return fmt.Errorf("Cannot set DTLS cipher suites. Connection already exists")
+	}
+
+	suites := newSuites()
+	if len(suites) == 0 {
+		return fmt.Errorf("Cannot set DTLS cipher suites. No cipher suites given")
+	}
+	for _, suite := range suites {
+		if suite.AuthenticationType() != dtls.CipherSuiteAuthenticationTypeCertificate {
+			return fmt.Errorf("Cannot set DTLS cipher suites. %s is not a certificate-based cipher suite", suite)
+		}
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.settings.SetDTLSCustomerCipherSuites(newSuites)
+	return nil
+}
+
+// Set the keep-alive parameters of the connection. Must be called before CreatePeerConnection
+func (r *RTC) SetKeepaliveConfig(config KeepaliveConfig) error {
+	if r.peerConnection() != nil {
+		return fmt.Errorf("Cannot set keep-alive parameters. Connection already exists")
+	}
+	if config.KeepaliveInterval <= 0 || config.DisconnectedTimeout <= 0 || config.FailedTimeout <= 0 {
+		return fmt.Errorf("Cannot set keep-alive parameters. All durations must be positive")
+	}
+	if config.KeepaliveInterval >= config.DisconnectedTimeout {
+		return fmt.Errorf("Cannot set keep-alive parameters. The keep-alive interval must be shorter than the disconnected timeout")
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.settings.SetICETimeouts(config.DisconnectedTimeout, config.FailedTimeout, config.KeepaliveInterval)
+	r.keepaliveConfig = config
+	return nil
+}
+
+// Returns the effective keep-alive parameters of the connection
+func (r *RTC) KeepaliveConfig() KeepaliveConfig {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.keepaliveConfig
+}
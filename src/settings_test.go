@@ -0,0 +1,201 @@
+package rtc_test
+
+import (
+	"context"
+	"fmt"
+	"hash"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/pion/dtls/v2"
+	"github.com/pion/dtls/v2/pkg/crypto/clientcertificate"
+	"github.com/pion/dtls/v2/pkg/protocol/recordlayer"
+	"github.com/pion/webrtc/v4"
+)
+
+// A cipher suite that cannot be negotiated with a peer that does not know its id, it only has to pass the validation of SetDTLSCipherSuites
+type unknownCipherSuite struct {
+	authentication dtls.CipherSuiteAuthenticationType
+}
+
+func (s *unknownCipherSuite) String() string         { return "unknown" }
+func (s *unknownCipherSuite) ID() dtls.CipherSuiteID { return 0xfe01 }
+func (s *unknownCipherSuite) CertificateType() clientcertificate.Type {
+	return clientcertificate.ECDSASign
+}
+func (s *unknownCipherSuite) HashFunc() func() hash.Hash { return nil }
+func (s *unknownCipherSuite) AuthenticationType() dtls.CipherSuiteAuthenticationType {
+	return s.authentication
+}
+func (s *unknownCipherSuite) KeyExchangeAlgorithm() dtls.CipherSuiteKeyExchangeAlgorithm {
+	return dtls.CipherSuiteKeyExchangeAlgorithmEcdhe
+}
+func (s *unknownCipherSuite) ECC() bool { return true }
+func (s *unknownCipherSuite) Init(masterSecret, clientRandom, serverRandom []byte, isClient bool) error {
+	return fmt.Errorf("Cipher suite is not implemented")
+}
+func (s *unknownCipherSuite) IsInitialized() bool { return false }
+func (s *unknownCipherSuite) Encrypt(pkt *recordlayer.RecordLayer, raw []byte) ([]byte, error) {
+	return nil, fmt.Errorf("Cipher suite is not implemented")
+}
+func (s *unknownCipherSuite) Decrypt(in []byte) ([]byte, error) {
+	return nil, fmt.Errorf("Cipher suite is not implemented")
+}
+
+// Exchange the offer and answer between two connections that were set up by hand, and wait until both are connected
+func connectManually(t *testing.T, offerer, answerer *rtc.RTC) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), receiveTimeout)
+	defer cancel()
+	if err := offerer.SetupDataChannel(rtc.ReliableChannel); err != nil {
+		t.Fatalf("Cannot set up data channel: %v", err)
+	}
+	offer, err := offerer.Pc.CreateOffer(nil)
+	if err != nil {
+		t.Fatalf("Cannot create offer: %v", err)
+	}
+	if err := offerer.SetLocalDescription(offer); err != nil {
+		t.Fatalf("Cannot set offer: %v", err)
+	}
+	if err := offerer.WaitForICEGathering(ctx); err != nil {
+		t.Fatalf("Cannot gather candidates: %v", err)
+	}
+	if err := answerer.SetRemoteDescription(*offerer.Pc.LocalDescription()); err != nil {
+		t.Fatalf("Cannot apply offer: %v", err)
+	}
+	answer, err := answerer.Pc.CreateAnswer(nil)
+	if err != nil {
+		t.Fatalf("Cannot create answer: %v", err)
+	}
+	if err := answerer.SetLocalDescription(answer); err != nil {
+		t.Fatalf("Cannot set answer: %v", err)
+	}
+	if err := answerer.WaitForICEGathering(ctx); err != nil {
+		t.Fatalf("Cannot gather candidates: %v", err)
+	}
+	if err := offerer.SetRemoteDescription(*answerer.Pc.LocalDescription()); err != nil {
+		t.Fatalf("Cannot apply answer: %v", err)
+	}
+
+	for _, peer := range []*rtc.RTC{offerer, answerer} {
+		if err := peer.WaitUntilConnected(ctx); err != nil {
+			t.Fatalf("Expected %s to connect, got %v", peer.Id, err)
+		}
+	}
+}
+
+func TestSetDTLSCipherSuitesValidates(t *testing.T) {
+	r := rtc.NewRTC("client")
+	if err := r.SetDTLSCipherSuites(func() []dtls.CipherSuite { return nil }); err == nil {
+		t.Error("Expected an error without cipher suites")
+	}
+	psk := func() []dtls.CipherSuite {
+		return []dtls.CipherSuite{&unknownCipherSuite{authentication: dtls.CipherSuiteAuthenticationTypePreSharedKey}}
+	}
+	if err := r.SetDTLSCipherSuites(psk); err == nil {
+		t.Error("Expected an error for a cipher suite that is not certificate-based")
+	}
+
+	if err := r.CreatePeerConnection(webrtc.Configuration{}); err != nil {
+		t.Fatalf("Cannot create peer connection: %v", err)
+	}
+	t.Cleanup(func() { r.Destroy() })
+	certificate := func() []dtls.CipherSuite {
+		return []dtls.CipherSuite{&unknownCipherSuite{authentication: dtls.CipherSuiteAuthenticationTypeCertificate}}
+	}
+	if err := r.SetDTLSCipherSuites(certificate); err == nil {
+		t.Error("Expected an error when the connection already exists")
+	}
+}
+
+func TestSetDTLSCipherSuitesFallsBack(t *testing.T) {
+	var calls atomic.Int32
+	suites := func() []dtls.CipherSuite {
+		calls.Add(1)
+		return []dtls.CipherSuite{&unknownCipherSuite{authentication: dtls.CipherSuiteAuthenticationTypeCertificate}}
+	}
+
+	client, server := rtc.NewRTC("client"), rtc.NewRTC("server")
+	if err := server.SetDTLSCipherSuites(suites); err != nil {
+		t.Fatalf("Cannot set cipher suites: %v", err)
+	}
+	for _, peer := range []*rtc.RTC{client, server} {
+		if err := peer.CreatePeerConnection(webrtc.Configuration{}); err != nil {
+			t.Fatalf("Cannot create peer connection: %v", err)
+		}
+		t.Cleanup(func() { peer.Destroy() })
+	}
+
+	// The configured suite is preferred, but the client does not support it, so the handshake falls back to the default suites
+	connectManually(t, client, server)
+	if calls.Load() == 0 {
+		t.Error("Expected the configured cipher suites to be used in the handshake")
+	}
+}
+
+func TestKeepaliveConfig(t *testing.T) {
+	r := rtc.NewRTC("rover")
+	if config := r.KeepaliveConfig(); config != rtc.DefaultKeepaliveConfig {
+		t.Errorf("Expected the default keep-alive parameters %+v, got %+v", rtc.DefaultKeepaliveConfig, config)
+	}
+
+	invalid := []rtc.KeepaliveConfig{
+		{},
+		{KeepaliveInterval: time.Second, DisconnectedTimeout: time.Second, FailedTimeout: 5 * time.Second},
+		{KeepaliveInterval: time.Second, DisconnectedTimeout: 3 * time.Second, FailedTimeout: -time.Second},
+	}
+	for _, config := range invalid {
+		if err := r.SetKeepaliveConfig(config); err == nil {
+			t.Errorf("Expected an error for %+v", config)
+		}
+	}
+	if config := r.KeepaliveConfig(); config != rtc.DefaultKeepaliveConfig {
+		t.Errorf("Expected invalid parameters to be ignored, got %+v", config)
+	}
+
+	// A rover on a cellular link trades slower failure detection for less data
+	lax := rtc.KeepaliveConfig{KeepaliveInterval: 10 * time.Second, DisconnectedTimeout: 30 * time.Second, FailedTimeout: time.Minute}
+	if err := r.SetKeepaliveConfig(lax); err != nil {
+		t.Fatalf("Cannot set keep-alive parameters: %v", err)
+	}
+	if config := r.KeepaliveConfig(); config != lax {
+		t.Errorf("Expected the effective parameters %+v, got %+v", lax, config)
+	}
+
+	if err := r.CreatePeerConnection(webrtc.Configuration{}); err != nil {
+		t.Fatalf("Cannot create peer connection: %v", err)
+	}
+	t.Cleanup(func() { r.Destroy() })
+	if err := r.SetKeepaliveConfig(rtc.DefaultKeepaliveConfig); err == nil {
+		t.Error("Expected an error when the connection already exists")
+	}
+	if config := r.KeepaliveConfig(); config != lax {
+		t.Errorf("Expected the parameters of the existing connection to be kept, got %+v", config)
+	}
+}
+
+func TestKeepaliveConfigConnects(t *testing.T) {
+	aggressive := rtc.KeepaliveConfig{KeepaliveInterval: 100 * time.Millisecond, DisconnectedTimeout: time.Second, FailedTimeout: 2 * time.Second}
+	client, server := rtc.NewRTC("client"), rtc.NewRTC("server")
+	for _, peer := range []*rtc.RTC{client, server} {
+		if err := peer.SetKeepaliveConfig(aggressive); err != nil {
+			t.Fatalf("Cannot set keep-alive parameters: %v", err)
+		}
+		if err := peer.CreatePeerConnection(webrtc.Configuration{}); err != nil {
+			t.Fatalf("Cannot create peer connection: %v", err)
+		}
+		t.Cleanup(func() { peer.Destroy() })
+	}
+	connectManually(t, client, server)
+
+	// The keep-alives keep the idle connection up for longer than the disconnected timeout
+	time.Sleep(2 * aggressive.DisconnectedTimeout)
+	for _, peer := range []*rtc.RTC{client, server} {
+		if state := peer.ConnectionState(); state != webrtc.PeerConnectionStateConnected {
+			t.Errorf("Expected %s to stay connected, got %s", peer.Id, state)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package rtc
+
+import (
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+//
+// This file contains the timing of the connection setup. The major milestones (from receiving the offer to opening the channels) are
+// recorded the first time they are reached, so that a slow setup can be attributed to signaling, ICE checking or the DTLS handshake.
+// The milestones are recorded by the package-owned handlers on the peer connection, which are installed by SetPeerConnection
+//
+
+// The milestones of the connection setup
+const (
+	setupOfferReceived = iota
+	setupRemoteDescription
+	setupICEChecking
+	setupICEConnected
+	setupDTLSConnected
+	setupChannelsOpen
+	setupMilestones
+)
+
+// The time it took to reach each milestone of the connection setup, since the connection was created. A milestone that was not reached
+// (yet) is zero
+type SetupTimings struct {
+	OfferReceived        time.Duration // only on the peer that accepted the offer (see AcceptOffer)
+	RemoteDescriptionSet time.Duration
+	ICEChecking          time.Duration // the first candidate pair is being checked
+	ICEConnected         time.Duration
+	DTLSConnected        time.Duration
+	ChannelsOpen         time.Duration // both the control and the data channel are open
+}
+
+// Returns the time it took to reach each milestone of the connection setup
+func (r *RTC) SetupTimings() SetupTimings {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	since := func(milestone int) time.Duration {
+		if r.setup[milestone].IsZero() {
+			return 0
+		}
+		return r.setup[milestone].Sub(r.createdAt)
+	}
+	return SetupTimings{
+		OfferReceived:        since(setupOfferReceived),
+		RemoteDescriptionSet: since(setupRemoteDescription),
+		ICEChecking:          since(setupICEChecking),
+		ICEConnected:         since(setupICEConnected),
+		DTLSConnected:        since(setupDTLSConnected),
+		ChannelsOpen:         since(setupChannelsOpen),
+	}
+}
+
+// Record that a milestone of the connection setup was reached, unless it was reached before
+func (r *RTC) markSetup(milestone int) {
+	now := time.Now()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.setup[milestone].IsZero() {
+		r.setup[milestone] = now
+	}
+}
+
+// Install the handlers that record the ICE and DTLS milestones on a peer connection
+func (r *RTC) hookSetupTimings(pc *webrtc.PeerConnection) {
+	pc.OnICEConnectionStateChange(func(state webrtc.ICEConnectionState) {
+		switch state {
+		case webrtc.ICEConnectionStateChecking:
+			r.markSetup(setupICEChecking)
+		case webrtc.ICEConnectionStateConnected, webrtc.ICEConnectionStateCompleted:
+			r.markSetup(setupICEConnected)
+		}
+	})
+
+	if sctp := pc.SCTP(); sctp != nil && sctp.Transport() != nil {
+		sctp.Transport().OnStateChange(func(state webrtc.DTLSTransportState) {
+			if state == webrtc.DTLSTransportStateConnected {
+				r.markSetup(setupDTLSConnected)
+			}
+		})
+	}
+}
+
+// Record that the channels are open once both the control and the data channel are
+func (r *RTC) checkChannelsOpen() {
+	if r.IsControlChannelOpen() && r.IsDataChannelOpen() {
+		r.markSetup(setupChannelsOpen)
+	}
+}
@@ -0,0 +1,66 @@
+package rtc_test
+
+import (
+	"testing"
+	"time"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/VU-ASE/roverrtc/src/rtctest"
+)
+
+// Returns the setup timings of the connection once its channels are open (which is recorded right after they opened)
+func completedSetup(t *testing.T, r *rtc.RTC) rtc.SetupTimings {
+	t.Helper()
+
+	deadline := time.Now().Add(receiveTimeout)
+	for {
+		timings := r.SetupTimings()
+		if timings.ChannelsOpen > 0 {
+			return timings
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the channels of %s to be recorded as open, got %+v", r.Id, timings)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Fail the test unless every milestone was reached, and in order
+func expectOrderedTimings(t *testing.T, id string, milestones []time.Duration) {
+	t.Helper()
+
+	for i, milestone := range milestones {
+		if milestone <= 0 {
+			t.Errorf("Expected milestone %d of %s to be reached, got %s", i, id, milestone)
+		}
+		if i > 0 && milestone < milestones[i-1] {
+			t.Errorf("Expected milestone %d of %s (%s) to be reached after milestone %d (%s)", i, id, milestone, i-1, milestones[i-1])
+		}
+	}
+}
+
+func TestSetupTimings(t *testing.T) {
+	client, server := rtctest.NewConnectedPair(t)
+
+	timings := completedSetup(t, server)
+	expectOrderedTimings(t, server.Id, []time.Duration{timings.OfferReceived, timings.RemoteDescriptionSet, timings.ICEChecking,
+		timings.ICEConnected, timings.DTLSConnected, timings.ChannelsOpen})
+	if dump := server.DumpState(); dump.Setup != timings {
+		t.Errorf("Expected the dump to include the setup timings %+v, got %+v", timings, dump.Setup)
+	}
+
+	// The client created the offer, so it did not receive one
+	timings = completedSetup(t, client)
+	if timings.OfferReceived != 0 {
+		t.Errorf("Expected no offer to be received by the client, got %s", timings.OfferReceived)
+	}
+	expectOrderedTimings(t, client.Id, []time.Duration{timings.RemoteDescriptionSet, timings.ICEChecking, timings.ICEConnected,
+		timings.DTLSConnected, timings.ChannelsOpen})
+}
+
+func TestSetupTimingsWithoutConnection(t *testing.T) {
+	r := rtc.NewRTC("rover")
+	if timings := r.SetupTimings(); timings != (rtc.SetupTimings{}) {
+		t.Errorf("Expected no milestones to be reached, got %+v", timings)
+	}
+}
@@ -0,0 +1,83 @@
+package rtc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+//
+// This file contains the graceful shutdown of an RTCMap (e.g. on SIGTERM). Every connection is closed with the close handshake (see Close)
+// at the same time, so that the peers learn why the connection goes down. Connections that are still closing when the context is done
+// are destroyed without waiting for them any longer. Once shut down, the map does not accept new connections
+//
+
+// The map was shut down and does not accept new connections
+var ErrMapClosed = errors.New("Map is closed, no new connections are accepted")
+
+// Close all connections in the map gracefully with the given reason (see Close), concurrently, and empty the map. The peers are waited for
+// until the deadline of ctx (or ContextCloseTimeout if ctx has no deadline), connections that are still closing when ctx is done are
+// destroyed. Afterwards, adding a connection fails with ErrMapClosed. Returns the errors of closing the connections joined together
+func (m *RTCMap) Shutdown(ctx context.Context, reason string) error {
+	m.lock.Lock()
+	m.closed = true
+	m.stopWatching()
+	conns := m.rtcMap
+	m.rtcMap = make(map[string]*RTC)
+	if m.draining {
+		m.drained += len(conns)
+	}
+	for id, rtc := range conns {
+		m.recordRemoved(id, rtc)
+	}
+	m.lock.Unlock()
+	m.notify()
+
+	timeout := ContextCloseTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 0, len(conns))
+	var errsLock sync.Mutex
+	for _, rtc := range conns {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := rtc.Close(reason, timeout); err != nil {
+				errsLock.Lock()
+				errs = append(errs, err)
+				errsLock.Unlock()
+			}
+		}()
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(closed)
+	}()
+
+	log := getDefaultLogger()
+	select {
+	case <-closed:
+	case <-ctx.Done():
+		// Destroying ends the wait of Close for the acknowledgement of the peer
+		stragglers := 0
+		for _, rtc := range conns {
+			if rtc.ConnectionState() != webrtc.PeerConnectionStateClosed {
+				stragglers++
+			}
+			_ = rtc.destroy(reason)
+		}
+		<-closed
+		log.Warn().Int("connections", stragglers).Msg("Destroyed RTC connections that did not close in time")
+	}
+
+	log.Info().Int("connections", len(conns)).Str("reason", reason).Msg("Shut down RTC map")
+	return errors.Join(errs...)
+}
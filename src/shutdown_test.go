@@ -0,0 +1,80 @@
+package rtc_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/pion/webrtc/v4"
+)
+
+func TestShutdownWithPeerThatNeverAcks(t *testing.T) {
+	m := rtc.NewRTCMap()
+	ids := []string{"car", "operator", "stuck"}
+	clients := connectToMap(t, m, ids...)
+	servers := make(map[string]*rtc.RTC)
+	for _, id := range ids {
+		servers[id] = m.Get(id)
+	}
+
+	reasons := make(chan string, len(ids))
+	unblock := make(chan struct{})
+	t.Cleanup(func() { close(unblock) })
+	for id, client := range clients {
+		client.OnPeerClosing(func(reason string) {
+			reasons <- reason
+			// The peer waits for the handler before it acknowledges, so this peer never does
+			if id == "stuck" {
+				<-unblock
+			}
+		})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	time.AfterFunc(200*time.Millisecond, cancel)
+	start := time.Now()
+	if err := m.Shutdown(ctx, "server shutting down"); err != nil {
+		t.Errorf("Cannot shut down map: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= rtc.ContextCloseTimeout {
+		t.Errorf("Expected the peer that never acknowledges to be destroyed once the context is done, shutdown took %s", elapsed)
+	}
+
+	for range ids {
+		select {
+		case reason := <-reasons:
+			if reason != "server shutting down" {
+				t.Errorf("Expected reason %q, got %q", "server shutting down", reason)
+			}
+		default:
+			t.Fatal("Expected every peer to receive the reason before Shutdown returned")
+		}
+	}
+	for id, server := range servers {
+		if state := server.ConnectionState(); state != webrtc.PeerConnectionStateClosed {
+			t.Errorf("Expected connection %s to be closed, it is %s", id, state)
+		}
+	}
+	if count := m.Count(); count != 0 {
+		t.Errorf("Expected an empty map, got %d connections", count)
+	}
+	if err := m.AddConnection("late", rtc.NewRTC("late")); !errors.Is(err, rtc.ErrMapClosed) {
+		t.Errorf("Expected ErrMapClosed after Shutdown, got %v", err)
+	}
+	if _, _, err := m.GetOrCreate("late", func() (*rtc.RTC, error) { return rtc.NewRTC("late"), nil }); !errors.Is(err, rtc.ErrMapClosed) {
+		t.Errorf("Expected ErrMapClosed from GetOrCreate after Shutdown, got %v", err)
+	}
+}
+
+func TestShutdownEmptyMap(t *testing.T) {
+	m := rtc.NewRTCMap()
+	if err := m.Shutdown(context.Background(), "server shutting down"); err != nil {
+		t.Errorf("Cannot shut down empty map: %v", err)
+	}
+	if err := m.AddConnection("late", rtc.NewRTC("late")); !errors.Is(err, rtc.ErrMapClosed) {
+		t.Errorf("Expected ErrMapClosed after Shutdown, got %v", err)
+	}
+}
@@ -0,0 +1,225 @@
+package rtc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+//
+// This file contains the HTTP endpoints for the signaling exchange, so that every deployment uses the same status codes and error bodies:
+//
+//	POST /sdp (body RequestSDP): accepts the offer and adds the connection to the map, responds with the answer (webrtc.SessionDescription)
+//	POST /ice (body RequestICE or RequestICEBatch): adds the remote ICE candidate(s) to the connection with the given id, responds with 204 No Content
+//
+// Errors are returned as a JSON body of the form {"error": "..."}. If some candidates of a batch cannot be added, the others are still added
+// and the body holds the errors per candidate as well: {"error": "...", "candidateErrors": {"<index>": "..."}}
+//
+
+// The maximum size of a signaling request body
+const maxSignalingBodySize = 64 * 1024
+
+type signalingHandler struct {
+	m    *RTCMap
+	opts []Option
+	o    options
+}
+
+// The body of a signaling error response
+type signalingError struct {
+	Error           string         `json:"error"`
+	CandidateErrors map[int]string `json:"candidateErrors,omitempty"`
+}
+
+// The body of an ICE request, which is either a RequestICE (with "candidate") or a RequestICEBatch (with "candidates")
+type iceRequestBody struct {
+	Candidate  *webrtc.ICECandidateInit  `json:"candidate"`
+	Candidates []webrtc.ICECandidateInit `json:"candidates"`
+	Id         string                    `json:"id"`
+	Timestamp  int64                     `json:"timestamp"`
+	Token      string                    `json:"token,omitempty"`
+}
+
+// Returns the candidates of the request, in order
+func (body iceRequestBody) candidates() []webrtc.ICECandidateInit {
+	if body.Candidate != nil {
+		return []webrtc.ICECandidateInit{*body.Candidate}
+	}
+	return body.Candidates
+}
+
+// Validate the request in the format it was sent in. The timestamp is checked once the connection (and so the clock of the peer) is known
+func (body iceRequestBody) Validate() error {
+	switch {
+	case body.Candidate != nil && body.Candidates != nil:
+		return fmt.Errorf("%w: request holds both a candidate and a batch", ErrInvalidCandidate)
+	case body.Candidate != nil:
+		return RequestICE{Candidate: *body.Candidate, Id: body.Id}.validateContent()
+	default:
+		return RequestICEBatch{Candidates: body.Candidates, Id: body.Id}.validateContent()
+	}
+}
+
+// Returns an http.Handler that serves the signaling endpoints for the connections in the map. The options are used to create the connections
+func NewSignalingHandler(m *RTCMap, opts ...Option) http.Handler {
+	h := &signalingHandler{m: m, opts: opts, o: applyOptions(opts)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /sdp", h.handleSDP)
+	mux.HandleFunc("POST /ice", h.handleICE)
+	return mux
+}
+
+// Accept an offer and respond with the answer
+func (h *signalingHandler) handleSDP(w http.ResponseWriter, req *http.Request) {
+	start := time.Now()
+
+	var sdp RequestSDP
+	if err := decodeSignalingBody(w, req, &sdp); err != nil {
+		h.respondError(w, req, start, sdp.Id, http.StatusBadRequest, err)
+		return
+	}
+
+	// Reject the offer before the peer connection is created (and ICE gathered) if the map cannot take the connection. The map can
+	// change in the meantime, so Add checks again
+	precheck := func() error {
+		return h.m.checkAdd(sdp.Id, h.o.role.Privileged())
+	}
+	rtc, answer, err := acceptOffer(sdp, h.o, h.m.replay, precheck)
+	if err != nil {
+		h.respondError(w, req, start, sdp.Id, acceptErrorStatus(err), err)
+		return
+	}
+
+	if err := h.m.Add(sdp.Id, rtc, false); err != nil {
+		rtc.Destroy()
+		h.respondError(w, req, start, sdp.Id, addErrorStatus(err), err)
+		return
+	}
+
+	h.respond(w, req, start, sdp.Id, http.StatusOK, answer)
+}
+
+// Add remote ICE candidates to an existing connection
+func (h *signalingHandler) handleICE(w http.ResponseWriter, req *http.Request) {
+	start := time.Now()
+
+	var ice iceRequestBody
+	if err := decodeSignalingBody(w, req, &ice); err != nil {
+		h.respondError(w, req, start, ice.Id, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := h.o.authenticate(ice.Id, ice.Token); err != nil {
+		h.respondError(w, req, start, ice.Id, http.StatusUnauthorized, err)
+		return
+	}
+	if err := h.o.signalingLimiter.allowICE(ice.Id); err != nil {
+		h.respondError(w, req, start, ice.Id, http.StatusTooManyRequests, err)
+		return
+	}
+
+	rtc := h.m.Get(ice.Id)
+	if rtc == nil {
+		h.respondError(w, req, start, ice.Id, http.StatusNotFound, fmt.Errorf("Connection with id %s does not exist", ice.Id))
+		return
+	}
+
+	// The candidates must come from the client that the connection was accepted for
+	if h.o.auth != nil && !rtc.verifyToken(ice.Token) {
+		h.respondError(w, req, start, ice.Id, http.StatusUnauthorized, fmt.Errorf("%w: token does not match the connection", ErrUnauthorized))
+		return
+	}
+
+	candidates := ice.candidates()
+	if err := rtc.checkFresh(h.m.replay, ice.Timestamp, candidateStrings(candidates)...); err != nil {
+		h.respondError(w, req, start, ice.Id, http.StatusBadRequest, err)
+		return
+	}
+	if failed := rtc.AddRemoteCandidates(candidates); len(failed) > 0 {
+		body := signalingError{
+			Error:           fmt.Sprintf("Cannot add %d of %d ICE candidates", len(failed), len(candidates)),
+			CandidateErrors: make(map[int]string, len(failed)),
+		}
+		for i, err := range failed {
+			body.CandidateErrors[i] = err.Error()
+		}
+		h.respond(w, req, start, ice.Id, http.StatusBadRequest, body)
+		return
+	}
+
+	h.respond(w, req, start, ice.Id, http.StatusNoContent, nil)
+}
+
+// Decode a JSON request body of limited size, rejecting unknown fields and invalid requests
+func decodeSignalingBody(w http.ResponseWriter, req *http.Request, v interface{ Validate() error }) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxSignalingBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("Invalid request body: %w", err)
+	}
+	return v.Validate()
+}
+
+// Returns the status code for an error of accepting an offer. Errors caused by the request are client errors, errors of the map are
+// mapped as by addErrorStatus, and any other error (e.g. of pion creating the answer) is an internal server error
+func acceptErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrUnauthorized):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrSignalingThrottled):
+		return http.StatusTooManyRequests
+	case errors.Is(err, ErrEmptyID), errors.Is(err, ErrInvalidSDP), errors.Is(err, ErrInvalidSDPType),
+		errors.Is(err, ErrStaleTimestamp), errors.Is(err, ErrReplayedRequest):
+		return http.StatusBadRequest
+	default:
+		return addErrorStatus(err)
+	}
+}
+
+// Returns the status code for an error of RTCMap.Add
+func addErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrConnectionExists):
+		return http.StatusConflict
+	case errors.Is(err, ErrAcceptThrottled):
+		return http.StatusTooManyRequests
+	case errors.Is(err, ErrMapFull), errors.Is(err, ErrDraining), errors.Is(err, ErrMapClosed):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// Respond with an error body
+func (h *signalingHandler) respondError(w http.ResponseWriter, req *http.Request, start time.Time, id string, status int, err error) {
+	h.respond(w, req, start, id, status, signalingError{Error: err.Error()})
+}
+
+// Respond with a JSON body (or no body if it is nil) and log the request
+func (h *signalingHandler) respond(w http.ResponseWriter, req *http.Request, start time.Time, id string, status int, body interface{}) {
+	log := getDefaultLogger()
+
+	if body != nil {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.WriteHeader(status)
+	if body != nil {
+		if err := json.NewEncoder(w).Encode(body); err != nil {
+			log.Debug().Err(err).Msg("Cannot write signaling response")
+		}
+	}
+
+	event := log.Info()
+	if status >= http.StatusBadRequest {
+		event = log.Warn()
+		if e, ok := body.(signalingError); ok {
+			event = event.Str("error", e.Error)
+		}
+	}
+	event.Str("method", req.Method).Str("path", req.URL.Path).Str("rtcId", id).Int("status", status).Dur("duration", time.Since(start)).Msg("Handled signaling request")
+}
@@ -0,0 +1,250 @@
+package rtc_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/pion/webrtc/v4"
+)
+
+// Post a JSON body to the signaling handler and return the response
+func postSignaling(t *testing.T, handler http.Handler, path string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var payload []byte
+	switch body := body.(type) {
+	case string:
+		payload = []byte(body)
+	default:
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			t.Fatalf("Cannot marshal request: %v", err)
+		}
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(payload)))
+	return w
+}
+
+// Fail the test if the response does not have the given status and a JSON error body
+func expectSignalingError(t *testing.T, w *httptest.ResponseRecorder, status int) {
+	t.Helper()
+
+	if w.Code != status {
+		t.Fatalf("Expected status %d, got %d: %s", status, w.Code, w.Body)
+	}
+	var body struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Error == "" {
+		t.Errorf("Expected a JSON error body, got %q", w.Body)
+	}
+}
+
+func TestSignalingHandlerExchange(t *testing.T) {
+	m := rtc.NewRTCMap()
+	t.Cleanup(func() { m.DestroyAll() })
+	handler := rtc.NewSignalingHandler(m)
+	client, offer := newOffer(t, "rover")
+
+	w := postSignaling(t, handler, "/sdp", offer)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body)
+	}
+	var answer webrtc.SessionDescription
+	if err := json.Unmarshal(w.Body.Bytes(), &answer); err != nil {
+		t.Fatalf("Cannot decode answer: %v", err)
+	}
+	if err := client.ApplyAnswer(answer); err != nil {
+		t.Fatalf("Cannot apply answer: %v", err)
+	}
+	server := m.Get("rover")
+	if server == nil {
+		t.Fatal("Expected the connection to be added to the map")
+	}
+
+	candidates := client.GetAllLocalCandidates()
+	if len(candidates) == 0 {
+		t.Fatal("Expected the client to gather candidates")
+	}
+	ice := rtc.RequestICE{Candidate: candidates[0], Id: "rover", Timestamp: time.Now().UnixMilli()}
+	if w := postSignaling(t, handler, "/ice", ice); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d: %s", w.Code, w.Body)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), receiveTimeout)
+	defer cancel()
+	for _, peer := range []*rtc.RTC{client, server} {
+		if err := peer.WaitUntilConnected(ctx); err != nil {
+			t.Fatalf("Connection %s did not connect: %v", peer.Id, err)
+		}
+	}
+}
+
+func TestSignalingHandlerMalformedJSON(t *testing.T) {
+	handler := rtc.NewSignalingHandler(rtc.NewRTCMap())
+
+	expectSignalingError(t, postSignaling(t, handler, "/sdp", `{"offer": `), http.StatusBadRequest)
+	expectSignalingError(t, postSignaling(t, handler, "/ice", `not json`), http.StatusBadRequest)
+	expectSignalingError(t, postSignaling(t, handler, "/sdp", `{"unknown": true}`), http.StatusBadRequest)
+	oversized := `{"id": "` + strings.Repeat("a", 128*1024) + `"}`
+	expectSignalingError(t, postSignaling(t, handler, "/sdp", oversized), http.StatusBadRequest)
+}
+
+func TestSignalingHandlerUnknownId(t *testing.T) {
+	handler := rtc.NewSignalingHandler(rtc.NewRTCMap())
+
+	candidate := webrtc.ICECandidateInit{Candidate: "candidate:1 1 udp 2130706431 127.0.0.1 50000 typ host"}
+	ice := rtc.RequestICE{Candidate: candidate, Id: "unknown", Timestamp: time.Now().UnixMilli()}
+	expectSignalingError(t, postSignaling(t, handler, "/ice", ice), http.StatusNotFound)
+}
+
+func TestSignalingHandlerExistingId(t *testing.T) {
+	m := rtc.NewRTCMap()
+	connectToMap(t, m, "rover")
+	handler := rtc.NewSignalingHandler(m)
+
+	_, offer := newOffer(t, "rover")
+	expectSignalingError(t, postSignaling(t, handler, "/sdp", offer), http.StatusConflict)
+}
+
+// Returns a candidate filter that counts the local and remote candidates it is asked about
+func countingFilter(count *atomic.Int32) rtc.Option {
+	return rtc.WithCandidateFilter(func(candidate webrtc.ICECandidateInit) bool {
+		count.Add(1)
+		return true
+	})
+}
+
+func TestSignalingHandlerRejectsBeforeGathering(t *testing.T) {
+	m := rtc.NewRTCMapWithLimit(1)
+	t.Cleanup(func() { m.DestroyAll() })
+	connectToMap(t, m, "rover")
+	var candidates atomic.Int32
+	handler := rtc.NewSignalingHandler(m, countingFilter(&candidates))
+
+	_, offer := newOffer(t, "rover")
+	expectSignalingError(t, postSignaling(t, handler, "/sdp", offer), http.StatusConflict)
+	_, offer = newOffer(t, "other")
+	expectSignalingError(t, postSignaling(t, handler, "/sdp", offer), http.StatusServiceUnavailable)
+	if err := m.Shutdown(context.Background(), "test"); err != nil {
+		t.Fatalf("Cannot shut down map: %v", err)
+	}
+	_, offer = newOffer(t, "third")
+	expectSignalingError(t, postSignaling(t, handler, "/sdp", offer), http.StatusServiceUnavailable)
+
+	if count := candidates.Load(); count != 0 {
+		t.Errorf("Expected no connection to gather candidates, got %d candidates", count)
+	}
+}
+
+func TestSignalingHandlerErrorStatus(t *testing.T) {
+	m := rtc.NewRTCMap()
+	t.Cleanup(func() { m.DestroyAll() })
+
+	// An offer that parses but that pion rejects is a client error
+	_, offer := newOffer(t, "rover")
+	var lines []string
+	for _, line := range strings.Split(offer.Offer.SDP, "\r\n") {
+		if !strings.HasPrefix(line, "a=fingerprint:") {
+			lines = append(lines, line)
+		}
+	}
+	offer.Offer.SDP = strings.Join(lines, "\r\n")
+	expectSignalingError(t, postSignaling(t, rtc.NewSignalingHandler(m), "/sdp", offer), http.StatusBadRequest)
+
+	// A server that cannot create the connection fails internally
+	servers := []webrtc.ICEServer{{URLs: []string{"turn:127.0.0.1:3478"}}}
+	handler := rtc.NewSignalingHandler(m, rtc.WithICEServers(servers))
+	_, offer = newOffer(t, "rover")
+	expectSignalingError(t, postSignaling(t, handler, "/sdp", offer), http.StatusInternalServerError)
+}
+
+func TestSignalingHandlerAuthentication(t *testing.T) {
+	m := rtc.NewRTCMapWithLimit(1)
+	t.Cleanup(func() { m.DestroyAll() })
+	handler := rtc.NewSignalingHandler(m, rtc.WithAuthFunc(checkSecret))
+
+	// Failed attempts do not take the only slot
+	for _, token := range []string{"", "guess"} {
+		_, offer := newOffer(t, "rover", rtc.WithToken(token))
+		expectSignalingError(t, postSignaling(t, handler, "/sdp", offer), http.StatusUnauthorized)
+	}
+	if count := m.Count(); count != 0 {
+		t.Fatalf("Expected no connections after failed authentication, got %d", count)
+	}
+
+	client, offer := newOffer(t, "rover", rtc.WithToken("secret"))
+	if w := postSignaling(t, handler, "/sdp", offer); w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body)
+	}
+
+	// Candidates are re-verified against the token the connection was accepted with
+	candidate := client.GetAllLocalCandidates()[0]
+	ice := rtc.RequestICE{Candidate: candidate, Id: "rover", Timestamp: time.Now().UnixMilli()}
+	expectSignalingError(t, postSignaling(t, handler, "/ice", ice), http.StatusUnauthorized)
+	ice.Token = "secret"
+	if w := postSignaling(t, handler, "/ice", ice); w.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestSignalingHandlerCandidateBatch(t *testing.T) {
+	m := rtc.NewRTCMap()
+	t.Cleanup(func() { m.DestroyAll() })
+	handler := rtc.NewSignalingHandler(m)
+	_, offer := newOffer(t, "rover")
+	if w := postSignaling(t, handler, "/sdp", offer); w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body)
+	}
+	server := m.Get("rover")
+	if server == nil {
+		t.Fatal("Expected the connection to be added to the map")
+	}
+
+	batch := rtc.RequestICEBatch{
+		Candidates: []webrtc.ICECandidateInit{candidateOfType("host", 50001), {Candidate: "candidate:malformed"}, candidateOfType("host", 50002)},
+		Id:         "rover",
+		Timestamp:  time.Now().UnixMilli(),
+	}
+	w := postSignaling(t, handler, "/ice", batch)
+	expectSignalingError(t, w, http.StatusBadRequest)
+	var body struct {
+		CandidateErrors map[int]string `json:"candidateErrors"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Cannot decode error body: %v", err)
+	}
+	if _, ok := body.CandidateErrors[1]; len(body.CandidateErrors) != 1 || !ok {
+		t.Errorf("Expected an error for candidate 1 only, got %v", body.CandidateErrors)
+	}
+	// The candidates around the malformed one are still added
+	if added := countEvents(server, rtc.EventRemoteCandidate); added != 2 {
+		t.Errorf("Expected 2 remote candidates to be added, got %d", added)
+	}
+
+	// A batch without errors, and the single candidate format on the same endpoint
+	batch.Candidates = []webrtc.ICECandidateInit{candidateOfType("host", 50003)}
+	if w := postSignaling(t, handler, "/ice", batch); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d: %s", w.Code, w.Body)
+	}
+	ice := rtc.RequestICE{Candidate: candidateOfType("host", 50004), Id: "rover", Timestamp: time.Now().UnixMilli()}
+	if w := postSignaling(t, handler, "/ice", ice); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d: %s", w.Code, w.Body)
+	}
+	if added := countEvents(server, rtc.EventRemoteCandidate); added != 4 {
+		t.Errorf("Expected 4 remote candidates to be added, got %d", added)
+	}
+
+	// A request cannot be both
+	both := `{"id": "rover", "candidate": {"candidate": "candidate:1 1 udp 2130706431 192.0.2.1 50005 typ host"}, "candidates": []}`
+	expectSignalingError(t, postSignaling(t, handler, "/ice", both), http.StatusBadRequest)
+}
@@ -0,0 +1,97 @@
+package rtc
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+//
+// This file contains the per-id rate limiting of the signaling helpers, so that a client that retries its offer in a tight loop cannot keep
+// the server busy creating and destroying peer connections. Requests beyond the limit are rejected before any pion object is created.
+// The limits are tracked per id, and ids that have not sent a request for a while are forgotten, so the memory use does not grow unbounded
+//
+
+// The client with this id sends signaling requests faster than the configured rate, it should retry with backoff
+var ErrSignalingThrottled = errors.New("Too many signaling requests, try again later")
+
+// How long an id may be idle before its limits are forgotten
+const signalingLimitExpiry = 2 * time.Minute
+
+// Limits the rate of the signaling requests per id. Share one limiter between the signaling helpers (see WithSignalingLimiter)
+type SignalingLimiter struct {
+	lock         *sync.Mutex
+	offersPerMin int
+	icePerSecond int
+	offers       map[string]*limitedID
+	ice          map[string]*limitedID
+	lastSweep    time.Time
+}
+
+type limitedID struct {
+	bucket   *tokenBucket
+	lastSeen time.Time
+}
+
+// Create a limiter that allows at most offersPerMinute offers and icePerSecond ICE submissions per id (0 means unlimited)
+func NewSignalingLimiter(offersPerMinute int, icePerSecond int) *SignalingLimiter {
+	var lock sync.Mutex
+	return &SignalingLimiter{
+		lock:         &lock,
+		offersPerMin: offersPerMinute,
+		icePerSecond: icePerSecond,
+		offers:       make(map[string]*limitedID),
+		ice:          make(map[string]*limitedID),
+		lastSweep:    time.Now(),
+	}
+}
+
+// Returns ErrSignalingThrottled if the id sent more offers than allowed
+func (l *SignalingLimiter) allowOffer(id string) error {
+	if l == nil || l.offersPerMin <= 0 {
+		return nil
+	}
+	return l.allow(l.offers, id, float64(l.offersPerMin)/60, l.offersPerMin)
+}
+
+// Returns ErrSignalingThrottled if the id sent more ICE submissions than allowed
+func (l *SignalingLimiter) allowICE(id string) error {
+	if l == nil || l.icePerSecond <= 0 {
+		return nil
+	}
+	return l.allow(l.ice, id, float64(l.icePerSecond), l.icePerSecond)
+}
+
+// Take a token from the bucket of the id, creating the bucket if the id is new
+func (l *SignalingLimiter) allow(ids map[string]*limitedID, id string, rate float64, burst int) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastSweep) > signalingLimitExpiry {
+		l.sweep(now)
+	}
+
+	entry := ids[id]
+	if entry == nil {
+		entry = &limitedID{bucket: newTokenBucket(rate, burst)}
+		ids[id] = entry
+	}
+	entry.lastSeen = now
+	if !entry.bucket.allow() {
+		return ErrSignalingThrottled
+	}
+	return nil
+}
+
+// Forget the ids that have been idle for longer than the expiry, their buckets are full again by now
+func (l *SignalingLimiter) sweep(now time.Time) {
+	for _, ids := range []map[string]*limitedID{l.offers, l.ice} {
+		for id, entry := range ids {
+			if now.Sub(entry.lastSeen) > signalingLimitExpiry {
+				delete(ids, id)
+			}
+		}
+	}
+	l.lastSweep = now
+}
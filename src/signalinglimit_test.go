@@ -0,0 +1,79 @@
+package rtc_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/pion/webrtc/v4"
+)
+
+// Post the same ICE request a number of times, returns how many requests were throttled
+func hammerICE(t *testing.T, handler http.Handler, id string, times int) int {
+	t.Helper()
+
+	candidate := webrtc.ICECandidateInit{Candidate: "candidate:1 1 udp 2130706431 127.0.0.1 50000 typ host"}
+	throttled := 0
+	for i := 0; i < times; i++ {
+		ice := rtc.RequestICE{Candidate: candidate, Id: id, Timestamp: time.Now().UnixMilli() + int64(i)}
+		w := postSignaling(t, handler, "/ice", ice)
+		switch w.Code {
+		case http.StatusTooManyRequests:
+			throttled++
+		case http.StatusNotFound:
+		default:
+			t.Fatalf("Expected status 404 or 429, got %d: %s", w.Code, w.Body)
+		}
+	}
+	return throttled
+}
+
+func TestSignalingLimitICE(t *testing.T) {
+	handler := rtc.NewSignalingHandler(rtc.NewRTCMap(), rtc.WithSignalingLimiter(rtc.NewSignalingLimiter(0, 5)))
+
+	if throttled := hammerICE(t, handler, "rover", 20); throttled != 15 {
+		t.Errorf("Expected 15 of 20 requests to be throttled, got %d", throttled)
+	}
+	if throttled := hammerICE(t, handler, "other", 5); throttled != 0 {
+		t.Errorf("Expected the limit to apply per id, got %d throttled requests", throttled)
+	}
+
+	// The limit is per second, so the id can submit again after a second
+	time.Sleep(time.Second + 100*time.Millisecond)
+	if throttled := hammerICE(t, handler, "rover", 5); throttled != 0 {
+		t.Errorf("Expected the id to recover after the window, got %d throttled requests", throttled)
+	}
+}
+
+func TestSignalingLimitOffers(t *testing.T) {
+	m := rtc.NewRTCMap()
+	t.Cleanup(func() { m.DestroyAll() })
+	handler := rtc.NewSignalingHandler(m, rtc.WithSignalingLimiter(rtc.NewSignalingLimiter(2, 0)))
+
+	_, offer := newOffer(t, "rover")
+	statuses := make(map[int]int)
+	for i := 0; i < 10; i++ {
+		// A retrying client sends the offer with a new timestamp, so it is not rejected as a replay
+		offer.Timestamp++
+		statuses[postSignaling(t, handler, "/sdp", offer).Code]++
+	}
+	if statuses[http.StatusOK] != 1 || statuses[http.StatusConflict] != 1 || statuses[http.StatusTooManyRequests] != 8 {
+		t.Errorf("Expected one accepted, one conflicting and eight throttled offers, got %v", statuses)
+	}
+	if count := m.Count(); count != 1 {
+		t.Errorf("Expected a single connection, got %d", count)
+	}
+}
+
+func TestSignalingLimitBeforeParsing(t *testing.T) {
+	limiter := rtc.WithSignalingLimiter(rtc.NewSignalingLimiter(2, 0))
+
+	// Throttled offers are rejected before they are parsed, so no peer connection is created for them
+	for i, want := range []error{rtc.ErrInvalidSDPType, rtc.ErrInvalidSDPType, rtc.ErrSignalingThrottled, rtc.ErrSignalingThrottled} {
+		if _, _, err := rtc.AcceptOffer(rtc.RequestSDP{Id: "rover"}, limiter); !errors.Is(err, want) {
+			t.Errorf("Expected offer %d to fail with %v, got %v", i, want, err)
+		}
+	}
+}
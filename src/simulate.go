@@ -0,0 +1,92 @@
+package rtc
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+//
+// This file contains the send interceptors, which see every outgoing message right before it is sent and can modify, delay or drop it.
+// They are meant for testing against a realistic link instead of a perfect localhost link: SimulateLatency and SimulateLoss can be combined
+// (interceptors are applied in the order they were added), and their randomness can be made deterministic with SeedSimulation.
+// Interceptors apply to the data channel, the control channel only gets the interceptors that are explicitly added for it
+//
+
+// Sees an outgoing message before it is sent. Returns the message to send, or false to drop it
+type SendInterceptor func(b []byte) ([]byte, bool)
+
+var simulationLock sync.Mutex
+var simulationRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+// Seed the randomness of SimulateLatency and SimulateLoss, so that a simulation can be repeated exactly
+func SeedSimulation(seed int64) {
+	simulationLock.Lock()
+	defer simulationLock.Unlock()
+
+	simulationRand = rand.New(rand.NewSource(seed))
+}
+
+// Returns an interceptor that delays every message by latency plus a random jitter in [-jitter, jitter]. The delay blocks the sender,
+// like a slow link would, so the order of the messages is kept
+func SimulateLatency(latency time.Duration, jitter time.Duration) SendInterceptor {
+	return func(b []byte) ([]byte, bool) {
+		delay := latency
+		if jitter > 0 {
+			simulationLock.Lock()
+			delay += time.Duration(simulationRand.Int63n(int64(2*jitter)+1)) - jitter
+			simulationLock.Unlock()
+		}
+		if delay > 0 {
+			time.Sleep(delay)
+		}
+		return b, true
+	}
+}
+
+// Returns an interceptor that drops every message with the given probability (between 0 and 1)
+func SimulateLoss(probability float64) SendInterceptor {
+	return func(b []byte) ([]byte, bool) {
+		simulationLock.Lock()
+		drop := simulationRand.Float64() < probability
+		simulationLock.Unlock()
+		return b, !drop
+	}
+}
+
+// Add an interceptor for the messages sent on the data channel, after the interceptors that were added before
+func (r *RTC) AddSendInterceptor(interceptor func(b []byte) ([]byte, bool)) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.dataInterceptors = append(r.dataInterceptors, interceptor)
+}
+
+// Add an interceptor for the messages sent on the control channel (e.g. to simulate a lossy link for the keep-alive as well)
+func (r *RTC) AddControlSendInterceptor(interceptor func(b []byte) ([]byte, bool)) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.controlInterceptors = append(r.controlInterceptors, interceptor)
+}
+
+// Pass an outgoing message through the interceptors of its channel. Returns false if it is dropped
+func (r *RTC) intercept(dc MessageChannel, b []byte) ([]byte, bool) {
+	r.lock.Lock()
+	var interceptors []SendInterceptor
+	switch dc {
+	case r.dataChannel:
+		interceptors = r.dataInterceptors
+	case r.controlChannel:
+		interceptors = r.controlInterceptors
+	}
+	r.lock.Unlock()
+
+	for _, interceptor := range interceptors {
+		var ok bool
+		if b, ok = interceptor(b); !ok {
+			return nil, false
+		}
+	}
+	return b, true
+}
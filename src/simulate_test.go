@@ -0,0 +1,124 @@
+package rtc_test
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"testing"
+	"time"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/VU-ASE/roverrtc/src/rtctest"
+)
+
+// Create a connection with mock channels and the given data channel interceptors
+func newSimulatedConnection(interceptors ...rtc.SendInterceptor) (*rtc.RTC, *rtc.MockChannel, *rtc.MockChannel) {
+	r := rtc.NewRTC("rover")
+	control, data := rtc.NewMockChannel(rtc.ControlChannelLabel), rtc.NewMockChannel(rtc.DataChannelLabel)
+	r.SetControlChannel(control)
+	r.SetDataChannel(data)
+	for _, interceptor := range interceptors {
+		r.AddSendInterceptor(interceptor)
+	}
+	return r, control, data
+}
+
+// Send numbered messages on the data channel, returns the numbers of the messages that were delivered
+func sendNumbered(t *testing.T, r *rtc.RTC, data *rtc.MockChannel, count int) []string {
+	t.Helper()
+
+	for i := 0; i < count; i++ {
+		if err := r.SendDataBytes([]byte(fmt.Sprint(i))); err != nil {
+			t.Fatalf("Expected a dropped message to not be an error, got %v", err)
+		}
+	}
+	var delivered []string
+	for _, b := range data.Sent() {
+		delivered = append(delivered, string(b))
+	}
+	return delivered
+}
+
+func TestSimulateLossRate(t *testing.T) {
+	rtc.SeedSimulation(1)
+	r, _, data := newSimulatedConnection(rtc.SimulateLoss(0.3))
+
+	const sent = 5000
+	delivered := sendNumbered(t, r, data, sent)
+	rate := 1 - float64(len(delivered))/sent
+	if math.Abs(rate-0.3) > 0.03 {
+		t.Errorf("Expected a drop rate of about 0.3, got %.3f", rate)
+	}
+}
+
+func TestSimulationIsDeterministic(t *testing.T) {
+	var runs [2][]string
+	for i := range runs {
+		rtc.SeedSimulation(42)
+		r, _, data := newSimulatedConnection(rtc.SimulateLoss(0.5))
+		runs[i] = sendNumbered(t, r, data, 100)
+	}
+	if !slices.Equal(runs[0], runs[1]) {
+		t.Errorf("Expected the same messages to be dropped with the same seed, got %v and %v", runs[0], runs[1])
+	}
+}
+
+func TestSimulateLatency(t *testing.T) {
+	r, _, data := newSimulatedConnection(rtc.SimulateLatency(30*time.Millisecond, 10*time.Millisecond))
+
+	for i := 0; i < 5; i++ {
+		start := time.Now()
+		if err := r.SendDataBytes([]byte("telemetry")); err != nil {
+			t.Fatalf("Cannot send data: %v", err)
+		}
+		if elapsed := time.Since(start); elapsed < 20*time.Millisecond || elapsed > 80*time.Millisecond {
+			t.Errorf("Expected a delay of 30ms +- 10ms, got %s", elapsed)
+		}
+	}
+	if sent := len(data.Sent()); sent != 5 {
+		t.Errorf("Expected every delayed message to be sent, got %d", sent)
+	}
+}
+
+func TestSimulationComposes(t *testing.T) {
+	rtc.SeedSimulation(7)
+	r, _, data := newSimulatedConnection(rtc.SimulateLatency(time.Millisecond, 0), rtc.SimulateLoss(0.5))
+
+	start := time.Now()
+	delivered := sendNumbered(t, r, data, 100)
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("Expected every message to be delayed, including the dropped ones, took %s", elapsed)
+	}
+	if len(delivered) == 0 || len(delivered) == 100 {
+		t.Errorf("Expected some messages to be dropped, %d of 100 were delivered", len(delivered))
+	}
+}
+
+func TestSimulationSkipsControlChannel(t *testing.T) {
+	r, control, _ := newSimulatedConnection(rtc.SimulateLoss(1))
+
+	if err := r.SendControlBytes([]byte("stop")); err != nil {
+		t.Fatalf("Cannot send control message: %v", err)
+	}
+	if sent := len(control.Sent()); sent != 1 {
+		t.Fatalf("Expected the control channel to be unaffected by the data channel interceptors, got %d messages", sent)
+	}
+
+	r.AddControlSendInterceptor(rtc.SimulateLoss(1))
+	if err := r.SendControlBytes([]byte("stop")); err != nil {
+		t.Fatalf("Cannot send control message: %v", err)
+	}
+	if sent := len(control.Sent()); sent != 1 {
+		t.Errorf("Expected the explicitly added control interceptor to drop the message, got %d messages", sent)
+	}
+}
+
+func TestWithSendInterceptor(t *testing.T) {
+	client, server := rtctest.NewConnectedPair(t, rtc.WithSendInterceptor(rtc.SimulateLoss(1)))
+	received := collectData(server)
+
+	if err := client.SendDataBytes([]byte("telemetry")); err != nil {
+		t.Fatalf("Cannot send data: %v", err)
+	}
+	expectNoMessage(t, received)
+}
@@ -0,0 +1,74 @@
+package rtc
+
+import (
+	"sort"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+//
+// This file contains point-in-time snapshots of an RTCMap, which can be diffed to emit only the changes (e.g. "client-3 connected")
+// between two polls instead of the full state
+//
+
+// The ids and connection states in an RTCMap at a moment in time
+type MapSnapshot struct {
+	Time   time.Time                             // the moment the snapshot was taken
+	States map[string]webrtc.PeerConnectionState // id -> state (unknown for connections that are not set up yet)
+}
+
+// The kind of change between two snapshots
+type StateChangeKind int
+
+const (
+	ConnectionAdded   StateChangeKind = iota // the connection is new in the map
+	ConnectionRemoved                        // the connection is no longer in the map
+	ConnectionChanged                        // the state of the connection changed
+)
+
+// A single change between two snapshots
+type StateChange struct {
+	Id   string
+	Kind StateChangeKind
+	Old  webrtc.PeerConnectionState // the previous state (unknown for added connections)
+	New  webrtc.PeerConnectionState // the current state (unknown for removed connections)
+}
+
+// Take a snapshot of all ids and their connection states
+func (m *RTCMap) Snapshot() MapSnapshot {
+	snapshot := MapSnapshot{
+		Time:   time.Now(),
+		States: make(map[string]webrtc.PeerConnectionState),
+	}
+
+	m.ForEach(func(id string, rtc *RTC) {
+		snapshot.States[id] = rtc.ConnectionState()
+	})
+	return snapshot
+}
+
+// Returns the additions, removals and state transitions from prev to this snapshot, ordered by id
+func (s MapSnapshot) Diff(prev MapSnapshot) []StateChange {
+	changes := make([]StateChange, 0)
+
+	for id, state := range s.States {
+		prevState, existed := prev.States[id]
+		switch {
+		case !existed:
+			changes = append(changes, StateChange{Id: id, Kind: ConnectionAdded, Old: webrtc.PeerConnectionStateUnknown, New: state})
+		case prevState != state:
+			changes = append(changes, StateChange{Id: id, Kind: ConnectionChanged, Old: prevState, New: state})
+		}
+	}
+	for id, prevState := range prev.States {
+		if _, exists := s.States[id]; !exists {
+			changes = append(changes, StateChange{Id: id, Kind: ConnectionRemoved, Old: prevState, New: webrtc.PeerConnectionStateUnknown})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Id < changes[j].Id
+	})
+	return changes
+}
@@ -0,0 +1,66 @@
+package rtc_test
+
+import (
+	"reflect"
+	"testing"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/pion/webrtc/v4"
+)
+
+func TestSnapshotDiff(t *testing.T) {
+	prev := rtc.MapSnapshot{States: map[string]webrtc.PeerConnectionState{
+		"car":       webrtc.PeerConnectionStateConnected,
+		"operator":  webrtc.PeerConnectionStateConnecting,
+		"spectator": webrtc.PeerConnectionStateConnected,
+	}}
+	current := rtc.MapSnapshot{States: map[string]webrtc.PeerConnectionState{
+		"car":      webrtc.PeerConnectionStateConnected,
+		"operator": webrtc.PeerConnectionStateConnected,
+		"client-3": webrtc.PeerConnectionStateNew,
+	}}
+
+	want := []rtc.StateChange{
+		{Id: "client-3", Kind: rtc.ConnectionAdded, Old: webrtc.PeerConnectionStateUnknown, New: webrtc.PeerConnectionStateNew},
+		{Id: "operator", Kind: rtc.ConnectionChanged, Old: webrtc.PeerConnectionStateConnecting, New: webrtc.PeerConnectionStateConnected},
+		{Id: "spectator", Kind: rtc.ConnectionRemoved, Old: webrtc.PeerConnectionStateConnected, New: webrtc.PeerConnectionStateUnknown},
+	}
+	if changes := current.Diff(prev); !reflect.DeepEqual(changes, want) {
+		t.Errorf("Expected changes %+v, got %+v", want, changes)
+	}
+	if changes := current.Diff(current); len(changes) != 0 {
+		t.Errorf("Expected no changes between equal snapshots, got %+v", changes)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	m := rtc.NewRTCMap()
+	connectToMap(t, m, "car")
+	pending := rtc.NewRTC("operator")
+	if err := m.AddConnection("operator", pending); err != nil {
+		t.Fatalf("Cannot add connection: %v", err)
+	}
+
+	before := m.Snapshot()
+	want := map[string]webrtc.PeerConnectionState{
+		"car":      webrtc.PeerConnectionStateConnected,
+		"operator": webrtc.PeerConnectionStateUnknown,
+	}
+	if !reflect.DeepEqual(before.States, want) {
+		t.Errorf("Expected states %v, got %v", want, before.States)
+	}
+
+	if err := m.Remove("car"); err != nil {
+		t.Fatalf("Cannot remove connection: %v", err)
+	}
+	after := m.Snapshot()
+	if after.Time.Before(before.Time) {
+		t.Error("Expected the later snapshot to not be taken before the earlier one")
+	}
+	wantChanges := []rtc.StateChange{
+		{Id: "car", Kind: rtc.ConnectionRemoved, Old: webrtc.PeerConnectionStateConnected, New: webrtc.PeerConnectionStateUnknown},
+	}
+	if changes := after.Diff(before); !reflect.DeepEqual(changes, wantChanges) {
+		t.Errorf("Expected changes %+v, got %+v", wantChanges, changes)
+	}
+}
@@ -0,0 +1,423 @@
+package rtc
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+//
+// This file contains the ICE restart over in-band signaling (see RestartICE). pion resets the ICE agent of the offering peer as soon as it
+// creates the restart offer, which takes down the control channel until the restart completed, so the control channel cannot carry the restart
+// itself. Instead, the peers first set up a standby connection over the control channel: a second peer connection with a single signaling
+// channel (negotiated by both peers, so it is not announced in-band). The restart offer and its answer are sent over the signaling channel
+// without candidates, the candidates of both peers are trickled over it (see EnableInBandTrickle), and the standby connection is closed once
+// the restarted ICE session connected. The standby connection uses the network paths that are up when the restart starts, so this restarts
+// a connection that is still up (e.g. to move it to another interface). A connection whose network path is already gone cannot set up the
+// standby connection, and needs out-of-band signaling (see SetSignalingTransport)
+//
+
+// The label and id of the signaling channel of the standby connection
+const (
+	standbyChannelLabel        = "signaling"
+	standbyChannelID    uint16 = 0
+)
+
+// A peer connection next to the connection itself, that only carries the signaling of an ICE restart
+type standbyConnection struct {
+	pc      *webrtc.PeerConnection
+	dc      *webrtc.DataChannel
+	open    chan struct{}             // closed when the signaling channel opened
+	holding bool                      // whether local candidates are held back, as the peer did not receive the restart offer yet
+	held    []webrtc.ICECandidateInit // the local candidates that were held back, guarded by the lock of the RTC
+}
+
+// Create a standby connection with the ICE configuration and settings of the connection
+func (r *RTC) newStandby() (*standbyConnection, error) {
+	pc := r.peerConnection()
+	if pc == nil {
+		return nil, fmt.Errorf("Cannot create standby connection. Connection is nil")
+	}
+	standbyPc, err := r.newPeerConnection(pc.GetConfiguration())
+	if err != nil {
+		return nil, err
+	}
+
+	negotiated := true
+	id := standbyChannelID
+	dc, err := standbyPc.CreateDataChannel(standbyChannelLabel, &webrtc.DataChannelInit{Negotiated: &negotiated, ID: &id})
+	if err != nil {
+		_ = standbyPc.Close()
+		return nil, err
+	}
+
+	s := &standbyConnection{pc: standbyPc, dc: dc, open: make(chan struct{})}
+	dc.OnOpen(func() {
+		close(s.open)
+	})
+	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+		r.handleStandbyMessage(msg.Data)
+	})
+	// The peer closes the standby connection once the restart completed (or failed)
+	dc.OnClose(func() {
+		go r.closeStandby(s)
+	})
+	return s, nil
+}
+
+// Use the standby connection for the signaling of the ICE restart, replacing an earlier one
+func (r *RTC) setStandby(s *standbyConnection) {
+	r.lock.Lock()
+	previous := r.standby
+	r.standby = s
+	r.lock.Unlock()
+
+	if previous != nil {
+		_ = previous.pc.Close()
+	}
+}
+
+// Close the standby connection, and stop using it for signaling if it is still in use
+func (r *RTC) closeStandby(s *standbyConnection) {
+	log := r.Log()
+
+	r.lock.Lock()
+	if r.standby == s {
+		r.standby = nil
+	}
+	r.lock.Unlock()
+
+	if err := s.pc.Close(); err != nil {
+		log.Debug().Err(err).Msg("Cannot close standby connection")
+	}
+}
+
+// Set up a standby connection with the peer over the control channel, until ctx is done. The offer is sent once ICE gathering completed,
+// so the standby connection does not need trickled candidates itself
+func (r *RTC) openStandby(ctx context.Context) (*standbyConnection, error) {
+	s, err := r.newStandby()
+	if err != nil {
+		return nil, err
+	}
+
+	// Drop an answer to an earlier standby offer that arrived too late
+	select {
+	case <-r.standbyAnswer:
+	default:
+	}
+
+	offer, err := s.pc.CreateOffer(nil)
+	if err == nil {
+		err = s.gather(ctx, offer)
+	}
+	var content []byte
+	if err == nil {
+		content, err = json.Marshal(s.pc.LocalDescription())
+	}
+	if err == nil {
+		if sendErr := r.SendControlFrame(controlTypeStandbyOffer, content); sendErr != nil {
+			err = fmt.Errorf("%w: %w", ErrNotConnected, sendErr)
+		}
+	}
+	if err != nil {
+		_ = s.pc.Close()
+		return nil, err
+	}
+
+	select {
+	case answer := <-r.standbyAnswer:
+		err = s.pc.SetRemoteDescription(answer)
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-r.closed:
+		err = fmt.Errorf("Cannot set up standby connection. Connection is destroyed")
+	}
+	if err == nil {
+		select {
+		case <-s.open:
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-r.closed:
+			err = fmt.Errorf("Cannot set up standby connection. Connection is destroyed")
+		}
+	}
+	if err != nil {
+		_ = s.pc.Close()
+		return nil, err
+	}
+	r.setStandby(s)
+	return s, nil
+}
+
+// Set the local description of the standby connection and wait until ICE gathering completed or ctx is done
+func (s *standbyConnection) gather(ctx context.Context, desc webrtc.SessionDescription) error {
+	gathered := webrtc.GatheringCompletePromise(s.pc)
+	if err := s.pc.SetLocalDescription(desc); err != nil {
+		return err
+	}
+	select {
+	case <-gathered:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Set up the standby connection that the peer offered over the control channel, and send our answer
+func (r *RTC) handleStandbyOffer(payload []byte) {
+	log := r.Log()
+
+	var offer webrtc.SessionDescription
+	if err := json.Unmarshal(payload, &offer); err != nil {
+		log.Warn().Err(err).Msg("Cannot unmarshal standby offer")
+		return
+	}
+
+	// Gathering can take a while, so do not block the receive path of the control channel
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultGatheringTimeout)
+		defer cancel()
+
+		s, err := r.newStandby()
+		if err != nil {
+			log.Warn().Err(err).Msg("Cannot create standby connection")
+			return
+		}
+		err = s.pc.SetRemoteDescription(offer)
+		var answer webrtc.SessionDescription
+		if err == nil {
+			answer, err = s.pc.CreateAnswer(nil)
+		}
+		if err == nil {
+			err = s.gather(ctx, answer)
+		}
+		var content []byte
+		if err == nil {
+			content, err = json.Marshal(s.pc.LocalDescription())
+		}
+		if err != nil {
+			log.Warn().Err(err).Msg("Cannot answer standby offer")
+			_ = s.pc.Close()
+			return
+		}
+		// The peer sends the restart offer as soon as the standby connection is up, the answer is sent over it
+		r.setStandby(s)
+		if err := r.SendControlFrame(controlTypeStandbyAnswer, content); err != nil {
+			log.Warn().Err(err).Msg("Cannot send standby answer")
+			r.closeStandby(s)
+		}
+	}()
+}
+
+// Pass the answer of the peer to the waiting openStandby
+func (r *RTC) handleStandbyAnswer(payload []byte) {
+	log := r.Log()
+
+	var answer webrtc.SessionDescription
+	if err := json.Unmarshal(payload, &answer); err != nil {
+		log.Warn().Err(err).Msg("Cannot unmarshal standby answer")
+		return
+	}
+	select {
+	case r.standbyAnswer <- answer:
+	default:
+		log.Debug().Msg("Dropped standby answer, no standby connection is waiting for it")
+	}
+}
+
+// Dispatch a message received on the signaling channel of the standby connection. Only the messages of the ICE restart are accepted
+func (r *RTC) handleStandbyMessage(b []byte) {
+	log := r.Log()
+
+	if len(b) < controlFrameHeaderSize || b[0] != controlFrameMarker {
+		log.Debug().Int("length", len(b)).Msg("Dropped raw message on standby connection")
+		return
+	}
+	typeID := binary.BigEndian.Uint16(b[1:controlFrameHeaderSize])
+	switch typeID {
+	case controlTypeRestartOffer, controlTypeAnswer, controlTypeCandidate:
+	default:
+		log.Debug().Uint16("type", typeID).Msg("Dropped message on standby connection")
+		return
+	}
+
+	r.lock.Lock()
+	handler := r.controlHandlers[typeID]
+	r.lock.Unlock()
+	handler(b[controlFrameHeaderSize:])
+}
+
+// Send a framed control message over the standby connection if it is open, otherwise over the control channel
+func (r *RTC) sendSignaling(typeID uint16, payload []byte) error {
+	r.lock.Lock()
+	s := r.standby
+	r.lock.Unlock()
+
+	if s == nil || s.dc.ReadyState() != webrtc.DataChannelStateOpen {
+		return r.SendControlFrame(typeID, payload)
+	}
+	return s.dc.Send(controlFrame(typeID, payload))
+}
+
+// Returns whether signaling messages can be sent to the peer in-band, over the standby connection or the control channel
+func (r *RTC) canSignalInBand() bool {
+	r.lock.Lock()
+	s := r.standby
+	r.lock.Unlock()
+
+	if s != nil && s.dc.ReadyState() == webrtc.DataChannelStateOpen {
+		return true
+	}
+	return r.IsControlChannelOpen()
+}
+
+// Hold back a local candidate if the peer did not receive the restart offer yet, returns whether it was held back
+func (r *RTC) holdCandidate(candidate webrtc.ICECandidateInit) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.standby == nil || !r.standby.holding {
+		return false
+	}
+	r.standby.held = append(r.standby.held, candidate)
+	return true
+}
+
+// Answer the ICE restart offer that the peer sent over the standby connection. This is done on the receive path of the standby connection,
+// so that the candidates the peer trickles after its offer are applied to the new ICE session. The answer is sent right away, our candidates
+// are trickled after it
+func (r *RTC) handleRestartOffer(payload []byte) {
+	log := r.Log()
+
+	var offer webrtc.SessionDescription
+	if err := json.Unmarshal(payload, &offer); err != nil {
+		log.Warn().Err(err).Msg("Cannot unmarshal ICE restart offer")
+		return
+	}
+	answer, err := r.answerOffer(offer)
+	if err != nil {
+		log.Warn().Err(err).Msg("Cannot answer ICE restart offer")
+		return
+	}
+	content, err := json.Marshal(withoutCandidates(answer))
+	if err != nil {
+		log.Warn().Err(err).Msg("Cannot marshal answer")
+		return
+	}
+	if err := r.sendSignaling(controlTypeAnswer, content); err != nil {
+		log.Warn().Err(err).Msg("Cannot send answer")
+	}
+}
+
+// Restart ICE with in-band signaling: set up a standby connection, send the restart offer over it, and trickle the candidates of the new
+// ICE session over it until the connection is connected again or ctx is done
+func (r *RTC) restartICEInBand(ctx context.Context) error {
+	if !r.negotiating.CompareAndSwap(false, true) {
+		return ErrNegotiationInProgress
+	}
+	defer r.negotiating.Store(false)
+
+	// Drop an answer to an earlier offer that arrived too late
+	select {
+	case <-r.negotiationAnswer:
+	default:
+	}
+
+	s, err := r.openStandby(ctx)
+	if err != nil {
+		return fmt.Errorf("Cannot set up standby connection: %w", err)
+	}
+	defer r.closeStandby(s)
+
+	pc := r.peerConnection()
+	if pc == nil {
+		return fmt.Errorf("Cannot restart ICE. Connection is nil")
+	}
+	offer, err := pc.CreateOffer(&webrtc.OfferOptions{ICERestart: true})
+	if err != nil {
+		return err
+	}
+	content, err := json.Marshal(withoutCandidates(offer))
+	if err != nil {
+		return err
+	}
+
+	// Our candidates are held back until the offer is sent, so that the peer does not apply them to the old ICE session
+	r.lock.Lock()
+	s.holding = true
+	r.lock.Unlock()
+	err = r.setICERestartOffer(offer)
+	if err == nil {
+		err = r.sendSignaling(controlTypeRestartOffer, content)
+	}
+	r.lock.Lock()
+	held := s.held
+	s.holding, s.held = false, nil
+	r.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	for _, candidate := range held {
+		r.trickleInBand(candidate)
+	}
+
+	select {
+	case result := <-r.negotiationAnswer:
+		if result.err != nil {
+			return result.err
+		}
+		if err := r.ApplyAnswer(result.answer); err != nil {
+			return err
+		}
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-r.closed:
+		return fmt.Errorf("Cannot restart ICE. Connection is destroyed")
+	}
+
+	// The candidates are trickled over the standby connection until the new ICE session connected
+	return r.waitForICEConnected(ctx)
+}
+
+// Returns the session description without the candidates that pion put in it, as those are trickled (pion gathers the candidates of an
+// answer as soon as the offer is set, so some might already be in it)
+func withoutCandidates(desc webrtc.SessionDescription) webrtc.SessionDescription {
+	lines := strings.Split(desc.SDP, "\r\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "a=candidate:") && line != "a=end-of-candidates" {
+			kept = append(kept, line)
+		}
+	}
+	desc.SDP = strings.Join(kept, "\r\n")
+	return desc
+}
+
+// Wait until the ICE session of the connection is connected, until ctx is done
+func (r *RTC) waitForICEConnected(ctx context.Context) error {
+	for {
+		pc := r.peerConnection()
+		if pc == nil {
+			return fmt.Errorf("Cannot wait for ICE. Connection is nil")
+		}
+		switch state := pc.ICEConnectionState(); state {
+		case webrtc.ICEConnectionStateConnected, webrtc.ICEConnectionStateCompleted:
+			return nil
+		case webrtc.ICEConnectionStateFailed, webrtc.ICEConnectionStateClosed:
+			return fmt.Errorf("%w: ICE is %s", ErrConnectionFailed, state)
+		}
+
+		select {
+		case <-time.After(stateCheckInterval):
+		case <-r.closed:
+			return fmt.Errorf("Cannot wait for ICE. Connection is destroyed")
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
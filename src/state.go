@@ -0,0 +1,125 @@
+package rtc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+//
+// This file contains the connection state notifications. pion only allows one OnConnectionStateChange handler per peer connection,
+// so the package installs its own and fans the state changes out to all handlers registered with OnStateChange
+//
+
+// The connection failed or was closed before it was established
+var ErrConnectionFailed = errors.New("Connection failed")
+
+// Register a handler that is called with every state change of the connection. This can be called before the peer connection is set up,
+// the handlers are installed once it is (see SetPeerConnection). Do not use Pc.OnConnectionStateChange directly, as it replaces these handlers
+func (r *RTC) OnStateChange(handler func(state webrtc.PeerConnectionState)) {
+	r.lock.Lock()
+	r.stateHandlers = append(r.stateHandlers, handler)
+	r.lock.Unlock()
+
+	r.hookStateChange()
+}
+
+// Set the webRTC connection and install the state change, remote track and negotiation handlers on it
+func (r *RTC) SetPeerConnection(pc *webrtc.PeerConnection) {
+	r.lock.Lock()
+	r.Pc = pc
+	r.lock.Unlock()
+
+	r.hookStateChange()
+	r.hookSetupTimings(pc)
+	pc.OnTrack(r.handleRemoteTrack)
+	pc.OnNegotiationNeeded(r.handleNegotiationNeeded)
+}
+
+// Returns the peer connection, or nil if it is not set up or the connection is destroyed. Pc is set and cleared under the lock
+// (see SetPeerConnection and Destroy), so read it through this method when the connection may be destroyed concurrently
+func (r *RTC) peerConnection() *webrtc.PeerConnection {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.Pc
+}
+
+// How often WaitUntilConnected checks the state, in case the peer connection is assigned to Pc directly and no state changes are signalled
+const stateCheckInterval = 100 * time.Millisecond
+
+// Blocks until the connection is established. Returns an error wrapping ErrConnectionFailed if the connection failed or was closed
+// (or destroyed) in the meantime, and the context error when ctx is done
+func (r *RTC) WaitUntilConnected(ctx context.Context) error {
+	for {
+		r.hookStateChange()
+
+		r.lock.Lock()
+		changed := r.stateChanged
+		r.lock.Unlock()
+
+		switch state := r.ConnectionState(); state {
+		case webrtc.PeerConnectionStateConnected:
+			return nil
+		case webrtc.PeerConnectionStateFailed, webrtc.PeerConnectionStateClosed:
+			return fmt.Errorf("%w: connection is %s", ErrConnectionFailed, state)
+		}
+
+		// The peer connection might be assigned to Pc directly instead of through SetPeerConnection, so check periodically as well
+		select {
+		case <-changed:
+		case <-r.closed:
+		case <-time.After(stateCheckInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Wake up the waiters for a state change, the caller must hold the lock
+func (r *RTC) signalStateChanged() {
+	close(r.stateChanged)
+	r.stateChanged = make(chan struct{})
+}
+
+// Install the state change handler on the current peer connection, if that did not happen yet
+func (r *RTC) hookStateChange() {
+	pc := r.peerConnection()
+	if pc == nil {
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.stateHooked == pc {
+		return
+	}
+	r.stateHooked = pc
+	pc.OnConnectionStateChange(r.handleStateChange)
+}
+
+// Wake up the waiters and pass a state change to the handlers
+func (r *RTC) handleStateChange(state webrtc.PeerConnectionState) {
+	// Look up the network path once connected, so that it is part of the log context from now on
+	if state == webrtc.PeerConnectionStateConnected {
+		_, _ = r.SelectedCandidatePair()
+	}
+	log := r.Log()
+	log.Debug().Stringer("state", state).Msg("Connection state changed")
+	r.recordEvent(EventStateChange, state.String())
+	r.applyLiveness(state)
+
+	r.lock.Lock()
+	r.signalStateChanged()
+	handlers := make([]func(webrtc.PeerConnectionState), len(r.stateHandlers))
+	copy(handlers, r.stateHandlers)
+	r.lock.Unlock()
+
+	for _, handler := range handlers {
+		handler(state)
+	}
+}
@@ -0,0 +1,79 @@
+package rtc_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/pion/webrtc/v4"
+)
+
+// Returns a channel that receives every state change of the connection
+func collectStates(r *rtc.RTC) <-chan webrtc.PeerConnectionState {
+	states := make(chan webrtc.PeerConnectionState, 16)
+	r.OnStateChange(func(state webrtc.PeerConnectionState) { states <- state })
+	return states
+}
+
+// Fail the test unless the connection reports the given state within receiveTimeout
+func expectState(t *testing.T, states <-chan webrtc.PeerConnectionState, want webrtc.PeerConnectionState) {
+	t.Helper()
+
+	timeout := time.After(receiveTimeout)
+	for {
+		select {
+		case state := <-states:
+			if state == want {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("Expected state %s", want)
+		}
+	}
+}
+
+func TestOnStateChangeBeforePeerConnection(t *testing.T) {
+	client, server := rtc.NewRTC("client"), rtc.NewRTC("server")
+	// Registered before the peer connection exists, and more than one handler per connection
+	first, second := collectStates(server), collectStates(server)
+	for _, peer := range []*rtc.RTC{client, server} {
+		if err := peer.CreatePeerConnection(webrtc.Configuration{}); err != nil {
+			t.Fatalf("Cannot create peer connection: %v", err)
+		}
+		t.Cleanup(func() { peer.Destroy() })
+	}
+
+	connectManually(t, client, server)
+	expectState(t, first, webrtc.PeerConnectionStateConnected)
+	expectState(t, second, webrtc.PeerConnectionStateConnected)
+}
+
+func TestWaitUntilConnectedFailsWhenDestroyed(t *testing.T) {
+	r, err := rtc.NewRTCWithOptions("client")
+	if err != nil {
+		t.Fatalf("Cannot create connection: %v", err)
+	}
+
+	// Nobody answers, so the connection never connects
+	short, cancel := context.WithTimeout(context.Background(), silenceTimeout)
+	defer cancel()
+	if err := r.WaitUntilConnected(short); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the wait to give up with the context, got %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- r.WaitUntilConnected(context.Background()) }()
+	if err := r.Destroy(); err != nil {
+		t.Fatalf("Cannot destroy connection: %v", err)
+	}
+	select {
+	case err := <-done:
+		if !errors.Is(err, rtc.ErrConnectionFailed) {
+			t.Errorf("Expected ErrConnectionFailed, got %v", err)
+		}
+	case <-time.After(receiveTimeout):
+		t.Fatal("Expected the wait to return once the connection was destroyed")
+	}
+}
@@ -0,0 +1,161 @@
+package rtc
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+//
+// This file contains a typed summary of the statistics that pion collects for a connection. pion (at the version used by this package)
+// does not report SCTP retransmissions, so those are not part of the summary
+//
+
+// The statistics of a single data channel
+type DataChannelStats struct {
+	Label            string
+	Config           ChannelConfig // the delivery semantics of the channel
+	MessagesSent     uint64
+	BytesSent        uint64
+	MessagesReceived uint64
+	BytesReceived    uint64
+	RateLimited      uint64 // the messages dropped by the send rate limit of the channel
+	Failures         int    // the number of consecutive failed sends
+	Breaker          BreakerState
+	QueueDropped     uint64 // the messages dropped by the policy of the send queue (see StartWriterWithPolicy)
+}
+
+// The statistics of a connection
+type Stats struct {
+	Control           DataChannelStats
+	Data              DataChannelStats
+	ICERTT            time.Duration // the current round trip time on the selected candidate pair
+	SCTPBytesSent     uint64        // the bytes sent on the SCTP transport, which carries all data channels
+	SCTPBytesReceived uint64
+	Channels          map[string]DataChannelStats // the statistics of all registered channels by name, including the control and data channel
+}
+
+// Returns the statistics of the connection, can be called at any time (e.g. while messages are being sent)
+func (r *RTC) Stats() (Stats, error) {
+	pc := r.peerConnection()
+	if pc == nil {
+		return Stats{}, fmt.Errorf("Cannot get statistics. Connection is nil")
+	}
+
+	stats := Stats{Channels: make(map[string]DataChannelStats)}
+	r.lock.Lock()
+	channels := make(map[string]*webrtc.DataChannel, len(r.channels))
+	for label, dc := range r.channels {
+		channels[label] = dc
+		channelStats := DataChannelStats{Label: label, Config: channelConfig(dc)}
+		channelStats.Breaker, channelStats.Failures = r.healthOf(label)
+		stats.Channels[label] = channelStats
+	}
+	stats.Control.Breaker, stats.Control.Failures = r.healthOf(ControlChannelLabel)
+	stats.Data.Breaker, stats.Data.Failures = r.healthOf(DataChannelLabel)
+	r.lock.Unlock()
+	stats.Control.RateLimited, stats.Data.RateLimited = r.rateLimitedMessages()
+	stats.Control.QueueDropped, stats.Data.QueueDropped = r.queueDropped(ControlChannelLabel), r.queueDropped(DataChannelLabel)
+	for label, channelStats := range stats.Channels {
+		channelStats.QueueDropped = r.queueDropped(label)
+		stats.Channels[label] = channelStats
+	}
+	control, data := r.ControlChannel(), r.DataChannel()
+	if control != nil {
+		stats.Control.Label = control.Label()
+		stats.Control.Config = channelConfig(control)
+	}
+	if data != nil {
+		stats.Data.Label = data.Label()
+		stats.Data.Config = channelConfig(data)
+	}
+
+	for _, s := range pc.GetStats() {
+		switch s := s.(type) {
+		case webrtc.DataChannelStats:
+			switch {
+			case control != nil && isChannel(s, control):
+				stats.Control.add(s)
+			case data != nil && isChannel(s, data):
+				stats.Data.add(s)
+			}
+			for label, dc := range channels {
+				if isChannel(s, dc) {
+					channelStats := stats.Channels[label]
+					channelStats.add(s)
+					stats.Channels[label] = channelStats
+				}
+			}
+		case webrtc.ICECandidatePairStats:
+			if s.Nominated {
+				stats.ICERTT = time.Duration(s.CurrentRoundTripTime * float64(time.Second))
+			}
+		case webrtc.SCTPTransportStats:
+			stats.SCTPBytesSent += s.BytesSent
+			stats.SCTPBytesReceived += s.BytesReceived
+		}
+	}
+	return stats, nil
+}
+
+// Returns the statistics summed over all connections in the map. ICERTT is the average over the connections that report one.
+// Connections that are not set up are skipped
+func (m *RTCMap) AggregateStats() Stats {
+	total := Stats{Channels: make(map[string]DataChannelStats)}
+	var rttSum time.Duration
+	rttCount := 0
+
+	m.ForEach(func(id string, rtc *RTC) {
+		stats, err := rtc.Stats()
+		if err != nil {
+			return
+		}
+
+		total.Control.addStats(stats.Control)
+		total.Data.addStats(stats.Data)
+		for label, channelStats := range stats.Channels {
+			sum := total.Channels[label]
+			sum.Label = label
+			sum.Config = channelStats.Config
+			sum.addStats(channelStats)
+			total.Channels[label] = sum
+		}
+		total.SCTPBytesSent += stats.SCTPBytesSent
+		total.SCTPBytesReceived += stats.SCTPBytesReceived
+		if stats.ICERTT > 0 {
+			rttSum += stats.ICERTT
+			rttCount++
+		}
+	})
+
+	if rttCount > 0 {
+		total.ICERTT = rttSum / time.Duration(rttCount)
+	}
+	return total
+}
+
+// Whether the statistics belong to the given channel
+func isChannel(s webrtc.DataChannelStats, dc *webrtc.DataChannel) bool {
+	if s.Label != dc.Label() {
+		return false
+	}
+	id := dc.ID()
+	return id == nil || int32(*id) == s.DataChannelIdentifier
+}
+
+func (s *DataChannelStats) add(stats webrtc.DataChannelStats) {
+	s.MessagesSent += uint64(stats.MessagesSent)
+	s.BytesSent += stats.BytesSent
+	s.MessagesReceived += uint64(stats.MessagesReceived)
+	s.BytesReceived += stats.BytesReceived
+}
+
+func (s *DataChannelStats) addStats(stats DataChannelStats) {
+	s.MessagesSent += stats.MessagesSent
+	s.BytesSent += stats.BytesSent
+	s.MessagesReceived += stats.MessagesReceived
+	s.BytesReceived += stats.BytesReceived
+	s.RateLimited += stats.RateLimited
+	s.QueueDropped += stats.QueueDropped
+}
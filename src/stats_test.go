@@ -0,0 +1,113 @@
+package rtc_test
+
+import (
+	"sync"
+	"testing"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/VU-ASE/roverrtc/src/rtctest"
+)
+
+// Send messages from client to server and wait until the server received all of them
+func sendAndReceive(t *testing.T, client *rtc.RTC, received <-chan []byte, count int) {
+	t.Helper()
+
+	for i := 0; i < count; i++ {
+		if err := client.SendDataBytes([]byte("telemetry")); err != nil {
+			t.Fatalf("Cannot send message: %v", err)
+		}
+	}
+	for i := 0; i < count; i++ {
+		expectMessage(t, received, []byte("telemetry"))
+	}
+}
+
+func stats(t *testing.T, r *rtc.RTC) rtc.Stats {
+	t.Helper()
+
+	s, err := r.Stats()
+	if err != nil {
+		t.Fatalf("Cannot get statistics of %s: %v", r.Id, err)
+	}
+	return s
+}
+
+func TestStatsCountTraffic(t *testing.T) {
+	client, server := rtctest.NewConnectedPair(t)
+	received := collectData(server)
+
+	sendAndReceive(t, client, received, 10)
+	sent, recv := stats(t, client), stats(t, server)
+	if sent.Data.MessagesSent == 0 || sent.Data.BytesSent == 0 {
+		t.Errorf("Expected the client to count sent messages, got %+v", sent.Data)
+	}
+	if recv.Data.MessagesReceived == 0 || recv.Data.BytesReceived == 0 {
+		t.Errorf("Expected the server to count received messages, got %+v", recv.Data)
+	}
+	if sent.SCTPBytesSent == 0 || recv.SCTPBytesReceived == 0 {
+		t.Errorf("Expected bytes on the SCTP transport, got %d sent and %d received", sent.SCTPBytesSent, recv.SCTPBytesReceived)
+	}
+	if sent.Data.Label != rtc.DataChannelLabel || sent.Control.Label != rtc.ControlChannelLabel {
+		t.Errorf("Expected the channel labels in the statistics, got %q and %q", sent.Control.Label, sent.Data.Label)
+	}
+
+	sendAndReceive(t, client, received, 10)
+	sentAfter, recvAfter := stats(t, client), stats(t, server)
+	if sentAfter.Data.MessagesSent <= sent.Data.MessagesSent || sentAfter.Data.BytesSent <= sent.Data.BytesSent {
+		t.Errorf("Expected the sent counters to increase, got %+v after %+v", sentAfter.Data, sent.Data)
+	}
+	if recvAfter.Data.MessagesReceived <= recv.Data.MessagesReceived || recvAfter.SCTPBytesReceived <= recv.SCTPBytesReceived {
+		t.Errorf("Expected the received counters to increase, got %+v after %+v", recvAfter.Data, recv.Data)
+	}
+}
+
+func TestStatsWhileSending(t *testing.T) {
+	client, server := rtctest.NewConnectedPair(t)
+	received := collectData(server)
+
+	const count = 100
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < count; i++ {
+			if err := client.SendDataBytes([]byte("telemetry")); err != nil {
+				t.Errorf("Cannot send message: %v", err)
+				return
+			}
+		}
+	}()
+	var last uint64
+	for i := 0; i < 50; i++ {
+		s := stats(t, client)
+		if s.Data.MessagesSent < last {
+			t.Fatalf("Expected the sent messages to never decrease, got %d after %d", s.Data.MessagesSent, last)
+		}
+		last = s.Data.MessagesSent
+	}
+	wg.Wait()
+	for i := 0; i < count; i++ {
+		expectMessage(t, received, []byte("telemetry"))
+	}
+}
+
+func TestAggregateStats(t *testing.T) {
+	m := rtc.NewRTCMap()
+	clients := connectToMap(t, m, "a", "b")
+	for id, client := range clients {
+		received := collectData(m.Get(id))
+		sendAndReceive(t, client, received, 5)
+	}
+
+	var want uint64
+	m.ForEach(func(id string, r *rtc.RTC) {
+		want += stats(t, r).Data.MessagesReceived
+	})
+	total := m.AggregateStats()
+	if total.Data.MessagesReceived != want || want == 0 {
+		t.Errorf("Expected %d received messages in total, got %d", want, total.Data.MessagesReceived)
+	}
+	if total.SCTPBytesReceived == 0 {
+		t.Error("Expected the bytes on the SCTP transports to be summed")
+	}
+}
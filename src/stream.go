@@ -0,0 +1,73 @@
+package rtc
+
+//
+// This file contains the multiplexing of logical streams (e.g. tuning state, debug output and sensor frames) over the data channel.
+// Every message on a stream is prefixed with its stream id:
+//
+//	| stream id (1 byte) | payload |
+//
+// Streams are combined with chunking by chunking the complete stream message (see SendOnStreamChunked): the receiver first reassembles
+// the chunks and then dispatches the message to its stream. Once a stream handler is registered, all data messages are dispatched to
+// streams, so the OnData handler is no longer called
+//
+
+const streamHeaderSize = 1
+
+// Send a message on the logical stream with the given id. The peer needs to register a handler for the stream with OnStream
+func (r *RTC) SendOnStream(streamID uint8, payload []byte) error {
+	return r.SendDataBytes(appendStreamId(streamID, payload))
+}
+
+// Send a message of any size on the logical stream with the given id, split into chunks. The peer needs to use OnDataMessageReassembled
+// (its handler is not called for stream messages) and register a handler for the stream with OnStream
+func (r *RTC) SendOnStreamChunked(streamID uint8, payload []byte) error {
+	return r.SendDataChunked(appendStreamId(streamID, payload))
+}
+
+// Register a handler for messages on the logical stream with the given id. Messages on streams without a handler are dropped
+// (see UnhandledStreamMessages)
+func (r *RTC) OnStream(streamID uint8, handler func(b []byte)) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.streamHandlers == nil {
+		r.streamHandlers = make(map[uint8]func(b []byte))
+	}
+	r.streamHandlers[streamID] = handler
+}
+
+// Returns the number of messages that were dropped because there was no handler registered for their stream
+func (r *RTC) UnhandledStreamMessages() uint64 {
+	return r.unhandledStream.Load()
+}
+
+// Pass a message to the handler of its stream
+func (r *RTC) dispatchStream(b []byte) {
+	log := r.Log()
+
+	if len(b) < streamHeaderSize {
+		r.unhandledStream.Add(1)
+		log.Debug().Msg("Dropped stream message, too short to contain a stream id")
+		return
+	}
+	streamID := b[0]
+
+	r.lock.Lock()
+	handler := r.streamHandlers[streamID]
+	r.lock.Unlock()
+
+	if handler == nil {
+		r.unhandledStream.Add(1)
+		log.Debug().Uint8("stream", streamID).Int("length", len(b)).Msg("Dropped stream message, no handler registered for its stream")
+		return
+	}
+	handler(b[streamHeaderSize:])
+}
+
+// Prefix a payload with a stream id
+func appendStreamId(streamID uint8, payload []byte) []byte {
+	b := make([]byte, streamHeaderSize+len(payload))
+	b[0] = streamID
+	copy(b[streamHeaderSize:], payload)
+	return b
+}
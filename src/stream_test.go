@@ -0,0 +1,86 @@
+package rtc_test
+
+import (
+	"bytes"
+	"testing"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/VU-ASE/roverrtc/src/rtctest"
+)
+
+// Collect the messages of a logical stream
+func collectStream(r *rtc.RTC, streamID uint8) <-chan []byte {
+	received := make(chan []byte, 16)
+	r.OnStream(streamID, func(b []byte) { received <- b })
+	return received
+}
+
+func TestStreams(t *testing.T) {
+	client, server := rtctest.NewConnectedPair(t)
+	tuning := collectStream(server, 1)
+	debug := collectStream(server, 2)
+
+	for _, message := range []struct {
+		stream  uint8
+		payload string
+	}{{1, "speed=3"}, {2, "lap 1"}, {1, "speed=4"}} {
+		if err := client.SendOnStream(message.stream, []byte(message.payload)); err != nil {
+			t.Fatalf("Cannot send on stream %d: %v", message.stream, err)
+		}
+	}
+	expectMessage(t, tuning, []byte("speed=3"))
+	expectMessage(t, tuning, []byte("speed=4"))
+	expectMessage(t, debug, []byte("lap 1"))
+	expectNoMessage(t, tuning)
+	expectNoMessage(t, debug)
+}
+
+func TestStreamWireFormat(t *testing.T) {
+	r := rtc.NewRTC("rover")
+	dc := rtc.NewMockChannel(rtc.DataChannelLabel)
+	r.SetDataChannel(dc)
+
+	if err := r.SendOnStream(7, []byte("frame")); err != nil {
+		t.Fatalf("Cannot send on stream: %v", err)
+	}
+	sent := dc.Sent()
+	if want := append([]byte{7}, "frame"...); len(sent) != 1 || !bytes.Equal(sent[0], want) {
+		t.Errorf("Expected %v on the wire, got %v", want, sent)
+	}
+}
+
+func TestUnhandledStreamMessages(t *testing.T) {
+	r := rtc.NewRTC("operator")
+	dc := rtc.NewMockChannel(rtc.DataChannelLabel)
+	r.SetDataChannel(dc)
+	data := collectData(r)
+	tuning := collectStream(r, 1)
+
+	// Once streams are used, messages no longer reach the OnData handler
+	dc.Inject(append([]byte{2}, "lap 1"...))
+	dc.Inject([]byte{})
+	dc.Inject(append([]byte{1}, "speed=3"...))
+
+	expectMessage(t, tuning, []byte("speed=3"))
+	expectNoMessage(t, data)
+	if unhandled := r.UnhandledStreamMessages(); unhandled != 2 {
+		t.Errorf("Expected 2 unhandled stream messages, got %d", unhandled)
+	}
+}
+
+func TestStreamChunked(t *testing.T) {
+	client, server := rtctest.NewConnectedPair(t)
+	server.OnDataMessageReassembled(func(b []byte) {
+		t.Errorf("Expected stream messages not to reach the reassembled handler, got %d bytes", len(b))
+	})
+	frames := collectStream(server, 3)
+	if err := client.SetChunkSize(64); err != nil {
+		t.Fatalf("Cannot set chunk size: %v", err)
+	}
+
+	payload := bytes.Repeat([]byte("0123456789"), 100)
+	if err := client.SendOnStreamChunked(3, payload); err != nil {
+		t.Fatalf("Cannot send chunked on stream: %v", err)
+	}
+	expectMessage(t, frames, payload)
+}
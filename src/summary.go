@@ -0,0 +1,86 @@
+package rtc
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+//
+// This file contains the concise summary of a connection, used when a connection is printed (e.g. in logs) or serialized to JSON
+// (e.g. by a debug endpoint). Printing an RTC as-is would dump its locks and the internals of pion. The summary can be taken at any point
+// in the lifecycle, also before the connection is set up or after it is destroyed. See DumpState for the full state of a connection
+//
+
+// The state of a channel in the summary if the channel is not set up
+const channelStateNone = "none"
+
+// A concise summary of a connection
+type Summary struct {
+	Id              string `json:"id"`
+	ConnectionState string `json:"connectionState"`
+	ICEState        string `json:"iceState"`
+	LocalCandidates int    `json:"localCandidates"`
+	ControlChannel  string `json:"controlChannel"`  // the ready state of the control channel, or "none"
+	DataChannel     string `json:"dataChannel"`     // the ready state of the data channel, or "none"
+	TimestampOffset int64  `json:"timestampOffset"` // in milliseconds
+	Age             string `json:"age"`
+}
+
+// Returns a concise summary of the connection
+func (r *RTC) Summary() Summary {
+	summary := Summary{
+		Id:              r.Id,
+		ConnectionState: r.ConnectionState().String(),
+		ICEState:        "unknown",
+		LocalCandidates: len(r.GetAllLocalCandidates()),
+		ControlChannel:  channelState(r.controlMessageChannel()),
+		DataChannel:     channelState(r.dataMessageChannel()),
+		Age:             r.Age().Round(time.Millisecond).String(),
+	}
+	r.lock.Lock()
+	summary.TimestampOffset = r.TimestampOffset
+	r.lock.Unlock()
+	if pc := r.peerConnection(); pc != nil {
+		summary.ICEState = pc.ICEConnectionState().String()
+	}
+	return summary
+}
+
+// Returns the ready state of a channel, or "none" if it is not set up
+func channelState(dc MessageChannel) string {
+	if dc == nil {
+		return channelStateNone
+	}
+	return dc.ReadyState().String()
+}
+
+func (s Summary) String() string {
+	return fmt.Sprintf("RTC{id=%s, state=%s, ice=%s, candidates=%d, control=%s, data=%s, offset=%dms, age=%s}",
+		s.Id, s.ConnectionState, s.ICEState, s.LocalCandidates, s.ControlChannel, s.DataChannel, s.TimestampOffset, s.Age)
+}
+
+// Prints the summary of the connection
+func (r *RTC) String() string {
+	if r == nil {
+		return "RTC{nil}"
+	}
+	return r.Summary().String()
+}
+
+// Serializes the summary of the connection
+func (r *RTC) MarshalJSON() ([]byte, error) {
+	if r == nil {
+		return []byte("null"), nil
+	}
+	return json.Marshal(r.Summary())
+}
+
+// Serializes the summaries of all connections in the map, ordered by id
+func (m *RTCMap) MarshalJSON() ([]byte, error) {
+	summaries := make([]Summary, 0, m.Count())
+	m.ForEachOrdered(func(id string, rtc *RTC) {
+		summaries = append(summaries, rtc.Summary())
+	})
+	return json.Marshal(summaries)
+}
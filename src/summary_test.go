@@ -0,0 +1,93 @@
+package rtc_test
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"testing"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/VU-ASE/roverrtc/src/rtctest"
+)
+
+var (
+	ageField             = regexp.MustCompile(`"age":"[^"]*"`)
+	localCandidatesField = regexp.MustCompile(`"localCandidates":(\d+)`)
+)
+
+// Marshal a value and replace the fields that depend on the time and the network interfaces, returns the number of local candidates
+func marshalSummary(t *testing.T, v interface{}) (string, int) {
+	t.Helper()
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("Cannot marshal summary: %v", err)
+	}
+	candidates := 0
+	if match := localCandidatesField.FindSubmatch(b); match != nil {
+		candidates, _ = strconv.Atoi(string(match[1]))
+	}
+	b = ageField.ReplaceAll(b, []byte(`"age":"<age>"`))
+	b = localCandidatesField.ReplaceAll(b, []byte(`"localCandidates":"<candidates>"`))
+	return string(b), candidates
+}
+
+func TestSummaryWithoutPeerConnection(t *testing.T) {
+	r := rtc.NewRTC("rover")
+	r.TimestampOffset = 42
+
+	golden := `{"id":"rover","connectionState":"unknown","iceState":"unknown","localCandidates":"<candidates>",` +
+		`"controlChannel":"none","dataChannel":"none","timestampOffset":42,"age":"<age>"}`
+	if got, candidates := marshalSummary(t, r); got != golden || candidates != 0 {
+		t.Errorf("Expected %s, got %s (%d candidates)", golden, got, candidates)
+	}
+	want := "RTC{id=rover, state=unknown, ice=unknown, candidates=0, control=none, data=none, offset=42ms, age="
+	if got := r.String(); len(got) < len(want) || got[:len(want)] != want {
+		t.Errorf("Expected %s...}, got %s", want, got)
+	}
+
+	r.Destroy()
+	golden = `{"id":"rover","connectionState":"closed","iceState":"unknown","localCandidates":"<candidates>",` +
+		`"controlChannel":"none","dataChannel":"none","timestampOffset":42,"age":"<age>"}`
+	if got, _ := marshalSummary(t, r); got != golden {
+		t.Errorf("Expected %s after Destroy, got %s", golden, got)
+	}
+}
+
+func TestSummaryOfConnectedPair(t *testing.T) {
+	client, server := rtctest.NewConnectedPair(t)
+
+	golden := `{"id":"client","connectionState":"connected","iceState":"connected","localCandidates":"<candidates>",` +
+		`"controlChannel":"open","dataChannel":"open","timestampOffset":0,"age":"<age>"}`
+	if got, candidates := marshalSummary(t, client); got != golden || candidates == 0 {
+		t.Errorf("Expected %s with local candidates, got %s (%d candidates)", golden, got, candidates)
+	}
+
+	m := rtc.NewRTCMap()
+	for _, r := range []*rtc.RTC{server, client} {
+		if err := m.AddConnection(r.Id, r); err != nil {
+			t.Fatalf("Cannot add %s: %v", r.Id, err)
+		}
+	}
+	var summaries []rtc.Summary
+	b, err := json.Marshal(m)
+	if err != nil {
+		t.Fatalf("Cannot marshal map: %v", err)
+	}
+	if err := json.Unmarshal(b, &summaries); err != nil {
+		t.Fatalf("Cannot unmarshal summaries: %v", err)
+	}
+	if len(summaries) != 2 || summaries[0].Id != "client" || summaries[1].Id != "server" {
+		t.Errorf("Expected the summaries of the client and the server, ordered by id, got %+v", summaries)
+	}
+}
+
+func TestSummaryOfNilConnection(t *testing.T) {
+	var r *rtc.RTC
+	if got := r.String(); got != "RTC{nil}" {
+		t.Errorf("Expected RTC{nil}, got %s", got)
+	}
+	if b, err := json.Marshal(r); err != nil || string(b) != "null" {
+		t.Errorf("Expected null, got %s (%v)", b, err)
+	}
+}
@@ -0,0 +1,80 @@
+package rtc
+
+import (
+	"sync"
+	"time"
+)
+
+//
+// This file contains the rolling-window bandwidth accounting of a connection. Bytes sent and received (on all channels) are counted in a ring
+// of fixed-width time buckets, so the throughput over any recent window can be computed cheaply and the memory used is bounded
+//
+
+const throughputBucketWidth = 100 * time.Millisecond
+const throughputBuckets = 600 // one minute of history
+
+type throughputCounter struct {
+	lock   *sync.Mutex
+	sent   [throughputBuckets]uint64
+	recv   [throughputBuckets]uint64
+	bucket [throughputBuckets]int64 // the (absolute) bucket number each slot currently holds
+}
+
+func newThroughputCounter() *throughputCounter {
+	var lock sync.Mutex
+	return &throughputCounter{
+		lock: &lock,
+	}
+}
+
+// Returns the average throughput (in bytes per second) sent and received over the given window (up to one minute)
+func (r *RTC) Throughput(window time.Duration) (sent, recv float64) {
+	return r.throughput.rates(window)
+}
+
+// Count bytes that were sent or received now
+func (c *throughputCounter) add(sent bool, n int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	bucket := time.Now().UnixNano() / int64(throughputBucketWidth)
+	slot := bucket % throughputBuckets
+	if c.bucket[slot] != bucket {
+		c.bucket[slot] = bucket
+		c.sent[slot] = 0
+		c.recv[slot] = 0
+	}
+
+	if sent {
+		c.sent[slot] += uint64(n)
+	} else {
+		c.recv[slot] += uint64(n)
+	}
+}
+
+// Sum the buckets that fall within the window and convert them to a rate
+func (c *throughputCounter) rates(window time.Duration) (float64, float64) {
+	if window <= 0 {
+		return 0, 0
+	}
+	buckets := int64((window + throughputBucketWidth - 1) / throughputBucketWidth)
+	if buckets > throughputBuckets {
+		buckets = throughputBuckets
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	current := time.Now().UnixNano() / int64(throughputBucketWidth)
+	var sent, recv uint64
+	for bucket := current - buckets + 1; bucket <= current; bucket++ {
+		slot := bucket % throughputBuckets
+		if c.bucket[slot] == bucket {
+			sent += c.sent[slot]
+			recv += c.recv[slot]
+		}
+	}
+
+	seconds := (time.Duration(buckets) * throughputBucketWidth).Seconds()
+	return float64(sent) / seconds, float64(recv) / seconds
+}
@@ -0,0 +1,56 @@
+package rtc_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+)
+
+func TestThroughput(t *testing.T) {
+	r := rtc.NewRTC("rover")
+	data := rtc.NewMockChannel(rtc.DataChannelLabel)
+	r.SetDataChannel(data)
+
+	for i := 0; i < 4; i++ {
+		if err := r.SendDataBytes(bytes.Repeat([]byte{0x2a}, 250)); err != nil {
+			t.Fatalf("Cannot send message: %v", err)
+		}
+	}
+	data.Inject(bytes.Repeat([]byte{0x2a}, 500))
+
+	tests := []struct {
+		window     time.Duration
+		sent, recv float64
+	}{
+		{time.Second, 1000, 500},
+		{10 * time.Second, 100, 50},
+		// Windows are limited to the minute of history that is kept
+		{time.Hour, 1000.0 / 60, 500.0 / 60},
+		{0, 0, 0},
+	}
+	for _, test := range tests {
+		if sent, recv := r.Throughput(test.window); sent != test.sent || recv != test.recv {
+			t.Errorf("Expected %.2f B/s sent and %.2f B/s received over %v, got %.2f and %.2f", test.sent, test.recv, test.window, sent, recv)
+		}
+	}
+}
+
+func TestThroughputForgetsOldTraffic(t *testing.T) {
+	r := rtc.NewRTC("rover")
+	data := rtc.NewMockChannel(rtc.DataChannelLabel)
+	r.SetDataChannel(data)
+	if err := r.SendDataBytes([]byte("telemetry")); err != nil {
+		t.Fatalf("Cannot send message: %v", err)
+	}
+
+	// The traffic falls outside of a window that is shorter than its age, but is still part of a longer window
+	time.Sleep(250 * time.Millisecond)
+	if sent, _ := r.Throughput(100 * time.Millisecond); sent != 0 {
+		t.Errorf("Expected no throughput over a window without traffic, got %.2f B/s", sent)
+	}
+	if sent, _ := r.Throughput(time.Minute); sent == 0 {
+		t.Error("Expected the traffic to be counted over a window that includes it")
+	}
+}
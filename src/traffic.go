@@ -0,0 +1,215 @@
+package rtc
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+//
+// This file contains the (opt-in) traffic recorder, which captures every message sent and received on the channels of a connection, so that
+// a bug from the track can be reproduced later by feeding the recording back into test code (see ReplayRecording). Messages are recorded as
+// they are on the wire (i.e. including the framing of the control channel). Each record looks like this:
+//
+//	| label length (1 byte) | label | direction (1 byte, 0 = in, 1 = out) | unix time in nanoseconds (8 bytes, big endian) | payload length (4 bytes, big endian) | payload |
+//
+// Recording does not block the send and receive path: records are queued and written by a background goroutine through a buffered writer.
+// Records that do not fit in the queue are dropped (and counted)
+//
+
+// The number of records that can wait to be written
+const trafficQueueSize = 1024
+
+// How often the buffered records are flushed to the writer
+const trafficFlushInterval = time.Second
+
+// A message sent or received on a channel of a connection
+type RecordedMessage struct {
+	Label    string // the label of the channel
+	Outbound bool   // whether the message was sent (true) or received (false)
+	Time     time.Time
+	Payload  []byte
+}
+
+type trafficRecorder struct {
+	records chan RecordedMessage
+	stop    chan struct{} // closed to stop the writer goroutine
+	done    chan struct{} // closed when the writer goroutine stopped
+	dropped atomic.Uint64 // the number of records that did not fit in the queue
+	err     error         // the first write error, set before done is closed
+}
+
+// Start recording every message sent and received on the channels of the connection to w. The recording stops with StopRecording,
+// or when the connection is destroyed (after which w holds the complete recording)
+func (r *RTC) StartRecording(w io.Writer) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.trafficRecorder != nil {
+		return fmt.Errorf("Cannot start recording. Already recording")
+	}
+	rec := &trafficRecorder{
+		records: make(chan RecordedMessage, trafficQueueSize),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	r.trafficRecorder = rec
+	go rec.run(r, w)
+	return nil
+}
+
+// Stop recording, after writing the queued records. Returns the first error of writing the recording, if any
+func (r *RTC) StopRecording() error {
+	r.lock.Lock()
+	rec := r.trafficRecorder
+	r.trafficRecorder = nil
+	r.lock.Unlock()
+
+	if rec == nil {
+		return nil
+	}
+	close(rec.stop)
+	<-rec.done
+	return rec.err
+}
+
+// Read a recording written by StartRecording and pass every message in it to handler, in order
+func ReplayRecording(src io.Reader, handler func(msg RecordedMessage)) error {
+	reader := bufio.NewReader(src)
+	for {
+		msg, err := readRecord(reader)
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("Cannot read recorded message: %w", err)
+		}
+		handler(msg)
+	}
+}
+
+// Queue a message to be recorded, if recording is enabled. The payload is copied, as the caller may reuse it
+func (r *RTC) recordTraffic(label string, outbound bool, payload []byte) {
+	r.lock.Lock()
+	rec := r.trafficRecorder
+	r.lock.Unlock()
+
+	if rec == nil {
+		return
+	}
+
+	msg := RecordedMessage{Label: label, Outbound: outbound, Time: time.Now(), Payload: make([]byte, len(payload))}
+	copy(msg.Payload, payload)
+	select {
+	case rec.records <- msg:
+	default:
+		rec.dropped.Add(1)
+	}
+}
+
+// Write the queued records until the recording is stopped (which destroying the connection does as well)
+func (rec *trafficRecorder) run(r *RTC, w io.Writer) {
+	defer close(rec.done)
+	log := r.Log()
+
+	buffered := bufio.NewWriter(w)
+	ticker := time.NewTicker(trafficFlushInterval)
+	defer ticker.Stop()
+
+	write := func(msg RecordedMessage) {
+		if rec.err != nil {
+			return
+		}
+		if rec.err = writeRecord(buffered, msg); rec.err != nil {
+			log.Warn().Err(rec.err).Msg("Cannot write recorded message, recording stopped")
+		}
+	}
+	finish := func() {
+		for {
+			select {
+			case msg := <-rec.records:
+				write(msg)
+			default:
+				if rec.err == nil {
+					rec.err = buffered.Flush()
+				}
+				if dropped := rec.dropped.Load(); dropped > 0 {
+					log.Warn().Uint64("dropped", dropped).Msg("Dropped recorded messages, the recording could not keep up")
+				}
+				return
+			}
+		}
+	}
+
+	for {
+		select {
+		case msg := <-rec.records:
+			write(msg)
+		case <-ticker.C:
+			if rec.err == nil {
+				rec.err = buffered.Flush()
+			}
+		case <-rec.stop:
+			finish()
+			return
+		}
+	}
+}
+
+// Write a single record
+func writeRecord(w io.Writer, msg RecordedMessage) error {
+	if len(msg.Label) > 255 {
+		return fmt.Errorf("Label %q is too long to record", msg.Label)
+	}
+
+	header := make([]byte, 0, 1+len(msg.Label)+1+8+4)
+	header = append(header, byte(len(msg.Label)))
+	header = append(header, msg.Label...)
+	direction := byte(0)
+	if msg.Outbound {
+		direction = 1
+	}
+	header = append(header, direction)
+	header = binary.BigEndian.AppendUint64(header, uint64(msg.Time.UnixNano()))
+	header = binary.BigEndian.AppendUint32(header, uint32(len(msg.Payload)))
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(msg.Payload)
+	return err
+}
+
+// Read a single record. Returns io.EOF if there are no more records, and io.ErrUnexpectedEOF if the last record is incomplete
+func readRecord(r *bufio.Reader) (RecordedMessage, error) {
+	labelLength, err := r.ReadByte()
+	if err != nil {
+		return RecordedMessage{}, err
+	}
+
+	buf := make([]byte, int(labelLength)+1+8+4)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return RecordedMessage{}, unexpectedEOF(err)
+	}
+	msg := RecordedMessage{
+		Label:    string(buf[:labelLength]),
+		Outbound: buf[labelLength] == 1,
+		Time:     time.Unix(0, int64(binary.BigEndian.Uint64(buf[labelLength+1:]))),
+	}
+	msg.Payload = make([]byte, binary.BigEndian.Uint32(buf[labelLength+9:]))
+	if _, err := io.ReadFull(r, msg.Payload); err != nil {
+		return RecordedMessage{}, unexpectedEOF(err)
+	}
+	return msg, nil
+}
+
+// A record that ends early is incomplete, not the end of the recording
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
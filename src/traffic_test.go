@@ -0,0 +1,133 @@
+package rtc_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+)
+
+// Returns a payload with every byte value, to check that nothing is lost or escaped
+func allBytes() []byte {
+	b := make([]byte, 256)
+	for i := range b {
+		b[i] = byte(i)
+	}
+	return b
+}
+
+// Read a complete recording
+func replayAll(t *testing.T, recording []byte) []rtc.RecordedMessage {
+	t.Helper()
+
+	var messages []rtc.RecordedMessage
+	if err := rtc.ReplayRecording(bytes.NewReader(recording), func(msg rtc.RecordedMessage) {
+		messages = append(messages, msg)
+	}); err != nil {
+		t.Fatalf("Cannot replay recording: %v", err)
+	}
+	return messages
+}
+
+func TestRecordingRoundTrip(t *testing.T) {
+	r := rtc.NewRTC("rover")
+	control, data := rtc.NewMockChannel(rtc.ControlChannelLabel), rtc.NewMockChannel(rtc.DataChannelLabel)
+	r.SetControlChannel(control)
+	r.SetDataChannel(data)
+	received := collectData(r)
+
+	var recording bytes.Buffer
+	if err := r.StartRecording(&recording); err != nil {
+		t.Fatalf("Cannot start recording: %v", err)
+	}
+	if err := r.StartRecording(io.Discard); err == nil {
+		t.Error("Expected an error when starting a second recording")
+	}
+
+	want := []rtc.RecordedMessage{
+		{Label: rtc.DataChannelLabel, Outbound: true, Payload: allBytes()},
+		{Label: rtc.ControlChannelLabel, Outbound: true, Payload: []byte("stop")},
+		{Label: rtc.DataChannelLabel, Outbound: false, Payload: []byte{0xff, 0x00, 0x0a}},
+		{Label: rtc.DataChannelLabel, Outbound: true, Payload: []byte{}},
+	}
+	if err := r.SendDataBytes(want[0].Payload); err != nil {
+		t.Fatalf("Cannot send data: %v", err)
+	}
+	if err := r.SendControlBytes(want[1].Payload); err != nil {
+		t.Fatalf("Cannot send control message: %v", err)
+	}
+	data.Inject(want[2].Payload)
+	expectMessage(t, received, want[2].Payload)
+	if err := r.SendDataBytes(want[3].Payload); err != nil {
+		t.Fatalf("Cannot send data: %v", err)
+	}
+	// Destroying the connection completes the recording
+	r.Destroy()
+
+	messages := replayAll(t, recording.Bytes())
+	if len(messages) != len(want) {
+		t.Fatalf("Expected %d recorded messages, got %d", len(want), len(messages))
+	}
+	for i, msg := range messages {
+		if msg.Label != want[i].Label || msg.Outbound != want[i].Outbound || !bytes.Equal(msg.Payload, want[i].Payload) {
+			t.Errorf("Expected message %d to be %+v, got %+v", i, want[i], msg)
+		}
+		if i > 0 && msg.Time.Before(messages[i-1].Time) {
+			t.Errorf("Expected message %d to be recorded after the previous one", i)
+		}
+	}
+}
+
+func TestStopRecording(t *testing.T) {
+	r := rtc.NewRTC("rover")
+	t.Cleanup(func() { r.Destroy() })
+	data := rtc.NewMockChannel(rtc.DataChannelLabel)
+	r.SetDataChannel(data)
+
+	var recording bytes.Buffer
+	if err := r.StartRecording(&recording); err != nil {
+		t.Fatalf("Cannot start recording: %v", err)
+	}
+	if err := r.SendDataBytes([]byte("recorded")); err != nil {
+		t.Fatalf("Cannot send data: %v", err)
+	}
+	if err := r.StopRecording(); err != nil {
+		t.Fatalf("Cannot stop recording: %v", err)
+	}
+	if err := r.SendDataBytes([]byte("not recorded")); err != nil {
+		t.Fatalf("Cannot send data: %v", err)
+	}
+
+	messages := replayAll(t, recording.Bytes())
+	if len(messages) != 1 || string(messages[0].Payload) != "recorded" {
+		t.Errorf("Expected only the message sent while recording, got %+v", messages)
+	}
+}
+
+func TestReplayTruncatedRecording(t *testing.T) {
+	r := rtc.NewRTC("rover")
+	r.SetDataChannel(rtc.NewMockChannel(rtc.DataChannelLabel))
+
+	var recording bytes.Buffer
+	if err := r.StartRecording(&recording); err != nil {
+		t.Fatalf("Cannot start recording: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := r.SendDataBytes([]byte("telemetry")); err != nil {
+			t.Fatalf("Cannot send data: %v", err)
+		}
+	}
+	r.Destroy()
+
+	truncated := recording.Bytes()[:recording.Len()-1]
+	replayed := 0
+	err := rtc.ReplayRecording(bytes.NewReader(truncated), func(msg rtc.RecordedMessage) { replayed++ })
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Expected io.ErrUnexpectedEOF for an incomplete record, got %v", err)
+	}
+	if replayed != 1 {
+		t.Errorf("Expected the complete record to be replayed, got %d", replayed)
+	}
+}
@@ -0,0 +1,100 @@
+package rtc
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+//
+// This file contains the transport-level information of a connection: the network path it uses, and the activity tracking which
+// detects a dead path (no packets at all, including SCTP heartbeats) before the connection state machine marks the connection as disconnected
+//
+
+// The network path of a connection, i.e. the local and remote ICE candidate that were selected
+type CandidatePair struct {
+	Protocol       webrtc.ICEProtocol
+	LocalType      webrtc.ICECandidateType // e.g. host on the LAN, or relay through the TURN server
+	LocalAddress   string
+	LocalPort      uint16
+	LocalInterface string // the name of the local network interface, empty if it is not known (e.g. for relay candidates)
+	RemoteType     webrtc.ICECandidateType
+	RemoteAddress  string
+	RemotePort     uint16
+}
+
+func (p CandidatePair) String() string {
+	return fmt.Sprintf("%s %s %s:%d -> %s %s:%d", p.Protocol, p.LocalType, p.LocalAddress, p.LocalPort, p.RemoteType, p.RemoteAddress, p.RemotePort)
+}
+
+// Returns the selected ICE candidate pair of the connection, or an error wrapping ErrNotConnected if no pair was selected yet
+func (r *RTC) SelectedCandidatePair() (CandidatePair, error) {
+	pc := r.peerConnection()
+	if pc == nil {
+		return CandidatePair{}, fmt.Errorf("%w: connection is nil", ErrNotConnected)
+	}
+
+	sctp := pc.SCTP()
+	if sctp == nil || sctp.Transport() == nil || sctp.Transport().ICETransport() == nil {
+		return CandidatePair{}, fmt.Errorf("%w: no ICE transport available", ErrNotConnected)
+	}
+	selected, err := sctp.Transport().ICETransport().GetSelectedCandidatePair()
+	if err != nil {
+		return CandidatePair{}, err
+	}
+	if selected == nil || selected.Local == nil || selected.Remote == nil {
+		return CandidatePair{}, fmt.Errorf("%w: no candidate pair selected yet", ErrNotConnected)
+	}
+
+	pair := CandidatePair{
+		Protocol:       selected.Local.Protocol,
+		LocalType:      selected.Local.Typ,
+		LocalAddress:   selected.Local.Address,
+		LocalPort:      selected.Local.Port,
+		RemoteType:     selected.Remote.Typ,
+		RemoteAddress:  selected.Remote.Address,
+		RemotePort:     selected.Remote.Port,
+		LocalInterface: interfaceOf(selected.Local.Address),
+	}
+	// Remember the path, so that it is added to the log context
+	path := pair.String()
+	r.candidatePath.Store(&path)
+	return pair, nil
+}
+
+// Returns the address (host:port) of the peer on the selected network path
+func (r *RTC) RemoteAddress() (string, error) {
+	pair, err := r.SelectedCandidatePair()
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(pair.RemoteAddress, strconv.Itoa(int(pair.RemotePort))), nil
+}
+
+// Returns how long the ICE transport has not received any packets. pion (at the version used by this package) does not report the time
+// of the last received packet, so this is derived from the transport's received byte counter, sampled on every call: the first call
+// returns 0, and the resolution of the result is the interval between calls (e.g. the interval of a reaper)
+func (r *RTC) TransportIdleFor() (time.Duration, error) {
+	pc := r.peerConnection()
+	if pc == nil {
+		return 0, fmt.Errorf("Cannot get transport activity. Connection is nil")
+	}
+
+	stats, ok := pc.GetStats()["iceTransport"].(webrtc.TransportStats)
+	if !ok {
+		return 0, fmt.Errorf("Cannot get transport activity. No transport statistics available")
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	now := time.Now()
+	if r.transportActivity.IsZero() || stats.BytesReceived != r.transportBytesReceived {
+		r.transportBytesReceived = stats.BytesReceived
+		r.transportActivity = now
+	}
+	return now.Sub(r.transportActivity), nil
+}
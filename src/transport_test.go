@@ -0,0 +1,115 @@
+package rtc_test
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/VU-ASE/roverrtc/src/rtctest"
+	"github.com/pion/webrtc/v4"
+	"github.com/rs/zerolog"
+)
+
+// Returns how long the transport of the connection has not received any packets
+func transportIdleFor(t *testing.T, r *rtc.RTC) time.Duration {
+	t.Helper()
+
+	idle, err := r.TransportIdleFor()
+	if err != nil {
+		t.Fatalf("Cannot get transport activity: %v", err)
+	}
+	return idle
+}
+
+func TestTransportIdleFor(t *testing.T) {
+	client, server := rtctest.NewConnectedPair(t)
+	received := collectData(server)
+
+	// The first call takes the baseline
+	if idle := transportIdleFor(t, server); idle != 0 {
+		t.Errorf("Expected the first call to return 0, got %v", idle)
+	}
+
+	// Received traffic resets the idle time
+	if err := client.SendDataBytes([]byte("telemetry")); err != nil {
+		t.Fatalf("Cannot send message: %v", err)
+	}
+	expectMessage(t, received, []byte("telemetry"))
+	if idle := transportIdleFor(t, server); idle != 0 {
+		t.Errorf("Expected received traffic to reset the idle time, got %v", idle)
+	}
+
+	// Once the peer is gone, nothing is received anymore
+	if err := client.Destroy(); err != nil {
+		t.Fatalf("Cannot destroy client: %v", err)
+	}
+	time.Sleep(silenceTimeout)
+	transportIdleFor(t, server)
+	time.Sleep(silenceTimeout)
+	if idle := transportIdleFor(t, server); idle < silenceTimeout {
+		t.Errorf("Expected the transport to be idle for at least %v, got %v", silenceTimeout, idle)
+	}
+}
+
+func TestTransportIdleForWithoutConnection(t *testing.T) {
+	if _, err := rtc.NewRTC("client").TransportIdleFor(); err == nil {
+		t.Error("Expected an error without a connection")
+	}
+}
+
+func TestSelectedCandidatePair(t *testing.T) {
+	client, server := rtctest.NewConnectedPair(t)
+
+	pair, err := client.SelectedCandidatePair()
+	if err != nil {
+		t.Fatalf("Cannot get candidate pair: %v", err)
+	}
+	if pair.LocalType != webrtc.ICECandidateTypeHost || pair.RemoteType != webrtc.ICECandidateTypeHost {
+		t.Errorf("Expected a host to host connection, got %s", pair)
+	}
+	if pair.Protocol != webrtc.ICEProtocolUDP {
+		t.Errorf("Expected protocol udp, got %s", pair.Protocol)
+	}
+	if pair.LocalAddress == "" || pair.LocalPort == 0 || pair.RemoteAddress == "" || pair.RemotePort == 0 {
+		t.Errorf("Expected addresses and ports on both ends, got %s", pair)
+	}
+
+	// Both peers see the same path, from their own end
+	other, err := server.SelectedCandidatePair()
+	if err != nil {
+		t.Fatalf("Cannot get candidate pair: %v", err)
+	}
+	if other.LocalPort != pair.RemotePort || other.RemotePort != pair.LocalPort {
+		t.Errorf("Expected the peers to see the same path, got %s and %s", pair, other)
+	}
+
+	address, err := client.RemoteAddress()
+	if err != nil {
+		t.Fatalf("Cannot get remote address: %v", err)
+	}
+	if want := net.JoinHostPort(pair.RemoteAddress, strconv.Itoa(int(pair.RemotePort))); address != want {
+		t.Errorf("Expected remote address %s, got %s", want, address)
+	}
+
+	// Once known, the path is part of the log context
+	logs := newLogBuffer()
+	log := client.Log().Output(logs).Level(zerolog.InfoLevel)
+	log.Info().Msg("telemetry")
+	if !strings.Contains(logs.String(), pair.String()) {
+		t.Errorf("Expected the candidate pair in the log context, got %s", logs)
+	}
+}
+
+func TestSelectedCandidatePairWithoutConnection(t *testing.T) {
+	r := rtc.NewRTC("client")
+	if _, err := r.SelectedCandidatePair(); !errors.Is(err, rtc.ErrNotConnected) {
+		t.Errorf("Expected error %v, got %v", rtc.ErrNotConnected, err)
+	}
+	if _, err := r.RemoteAddress(); !errors.Is(err, rtc.ErrNotConnected) {
+		t.Errorf("Expected error %v, got %v", rtc.ErrNotConnected, err)
+	}
+}
@@ -0,0 +1,64 @@
+package rtc
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+//
+// This file contains the in-band trickle of ICE candidates. Once the control channel is open, local candidates that are gathered later
+// (e.g. relay candidates of a slow TURN server, or host candidates of an interface that came up) can be sent to the peer over the control
+// channel, so that the signaling server is no longer needed. The candidates are sent as JSON encoded RequestICE messages in framed control
+// messages. During an ICE restart without out-of-band signaling, the candidates are sent over the standby connection instead (see standby.go)
+//
+
+// Enable or disable sending local candidates that are gathered while the control channel is open to the peer over the control channel.
+// This also lets RestartICE restart ICE without a signaling transport. Disabled by default. Candidates sent in-band by the peer are always applied
+func (r *RTC) EnableInBandTrickle(enabled bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.inBandTrickle = enabled
+}
+
+// Send a local candidate to the peer over the control channel (or the standby connection during an ICE restart), if in-band trickle is enabled
+func (r *RTC) trickleInBand(candidate webrtc.ICECandidateInit) {
+	log := r.Log()
+
+	r.lock.Lock()
+	enabled := r.inBandTrickle
+	token := r.token
+	r.lock.Unlock()
+	if !enabled || !r.canSignalInBand() || r.holdCandidate(candidate) {
+		return
+	}
+
+	content, err := json.Marshal(RequestICE{Candidate: candidate, Id: r.Id, Timestamp: time.Now().UnixMilli(), Token: token})
+	if err != nil {
+		log.Warn().Err(err).Msg("Cannot marshal local ICE candidate")
+		return
+	}
+	if err := r.sendSignaling(controlTypeCandidate, content); err != nil {
+		log.Debug().Err(err).Msg("Cannot send local ICE candidate in-band")
+	}
+}
+
+// Apply a candidate that the peer sent over the control channel
+func (r *RTC) handleCandidate(payload []byte) {
+	log := r.Log()
+
+	var req RequestICE
+	if err := json.Unmarshal(payload, &req); err != nil {
+		log.Warn().Err(err).Msg("Cannot unmarshal in-band ICE candidate")
+		return
+	}
+	if err := validateCandidate(req.Candidate); err != nil {
+		log.Warn().Err(err).Msg("Dropped in-band ICE candidate")
+		return
+	}
+	if err := r.AddRemoteCandidate(req.Candidate); err != nil {
+		log.Warn().Err(err).Msg("Cannot add in-band ICE candidate")
+	}
+}
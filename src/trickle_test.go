@@ -0,0 +1,63 @@
+package rtc_test
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/VU-ASE/roverrtc/src/rtctest"
+	"github.com/pion/webrtc/v4"
+)
+
+// A host candidate that is gathered after the connection is set up (e.g. of an interface that just came up)
+func lateCandidate() webrtc.ICECandidateInit {
+	mid := "0"
+	return webrtc.ICECandidateInit{Candidate: "candidate:1 1 udp 2130706431 192.0.2.10 50000 typ host", SDPMid: &mid}
+}
+
+// Wait until the connection applied the given number of remote candidates, returns whether it did within timeout
+func waitForRemoteCandidates(r *rtc.RTC, want int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for countEvents(r, rtc.EventRemoteCandidate) < want {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return true
+}
+
+func TestInBandTrickle(t *testing.T) {
+	client, server := rtctest.NewConnectedPair(t, rtc.WithInBandTrickle(true))
+	var raw, unhandled atomic.Int32
+	server.OnControlBytes(func(b []byte) { raw.Add(1) })
+	server.OnUnhandledControl(func(typeID uint16, payload []byte) { unhandled.Add(1) })
+	applied := countEvents(server, rtc.EventRemoteCandidate)
+
+	client.AddLocalCandidate(lateCandidate())
+	if !waitForRemoteCandidates(server, applied+1, receiveTimeout) {
+		t.Fatal("Expected the server to apply the candidate sent over the control channel")
+	}
+
+	// The candidate is handled by the package, user messages on the control channel are unaffected
+	received := make(chan []byte, 1)
+	server.OnControlBytes(func(b []byte) { received <- b })
+	if err := client.SendControlBytes([]byte("stop")); err != nil {
+		t.Fatalf("Cannot send control message: %v", err)
+	}
+	expectMessage(t, received, []byte("stop"))
+	if raw.Load() != 0 || unhandled.Load() != 0 {
+		t.Errorf("Expected the candidate to be handled internally, got %d raw and %d unhandled control messages", raw.Load(), unhandled.Load())
+	}
+}
+
+func TestInBandTrickleDisabled(t *testing.T) {
+	client, server := rtctest.NewConnectedPair(t)
+	applied := countEvents(server, rtc.EventRemoteCandidate)
+
+	client.AddLocalCandidate(lateCandidate())
+	if waitForRemoteCandidates(server, applied+1, silenceTimeout) {
+		t.Error("Expected the candidate to not be sent when in-band trickle is disabled")
+	}
+}
@@ -0,0 +1,96 @@
+package rtc
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+)
+
+//
+// This file contains the typed channels, for the common case of sending exactly one protobuf message type on a channel. A typed channel
+// marshals and unmarshals the messages, so that the handlers deal with messages of type T instead of bytes. On the control and data channel,
+// the messages go through the package-owned send and receive path (and its framing), on other named channels they are sent as-is
+//
+
+// A named channel that carries messages of a single protobuf type T (a pointer to a generated message, e.g. *pb.SensorOutput)
+type TypedChannel[T proto.Message] struct {
+	ch      *Channel
+	onError func(err error, raw []byte)
+}
+
+// Wrap the registered channel with the given name (see OpenChannel and OnNewChannel) to send and receive messages of type T
+func NewTypedChannel[T proto.Message](r *RTC, channelName string) (*TypedChannel[T], error) {
+	ch := r.Channel(channelName)
+	if ch == nil {
+		return nil, fmt.Errorf("Cannot create typed channel. Channel %s does not exist", channelName)
+	}
+	return &TypedChannel[T]{ch: ch}, nil
+}
+
+// Marshal a message and send it on the channel
+func (t *TypedChannel[T]) Send(msg T) error {
+	buf, err := marshalPooled(msg)
+	if err != nil {
+		return err
+	}
+	defer releaseBuffer(buf)
+
+	switch t.ch.Name {
+	case ControlChannelLabel:
+		return t.ch.rtc.SendControlBytes(*buf)
+	case DataChannelLabel:
+		return t.ch.rtc.SendDataBytes(*buf)
+	default:
+		return t.ch.Send(*buf)
+	}
+}
+
+// Register a handler for the messages received on the channel. Messages that cannot be unmarshalled into a T are passed to the OnError
+// handler. On the control and data channel, this replaces the OnControlBytes and OnData handler respectively
+func (t *TypedChannel[T]) OnMessage(handler func(msg T)) {
+	receive := func(b []byte) {
+		var zero T
+		msg := zero.ProtoReflect().New().Interface().(T)
+		if err := proto.Unmarshal(b, msg); err != nil {
+			t.handleError(fmt.Errorf("Cannot unmarshal message on channel %s: %w", t.ch.Name, err), b)
+			return
+		}
+		handler(msg)
+	}
+
+	switch t.ch.Name {
+	case ControlChannelLabel:
+		t.ch.rtc.OnControlBytes(receive)
+	case DataChannelLabel:
+		t.ch.rtc.OnData(receive)
+	default:
+		t.ch.OnMessage(receive)
+	}
+}
+
+// Register a handler for messages that cannot be unmarshalled, with the error and the raw message. Without it, they are logged
+func (t *TypedChannel[T]) OnError(handler func(err error, raw []byte)) {
+	t.ch.rtc.lock.Lock()
+	defer t.ch.rtc.lock.Unlock()
+
+	t.onError = handler
+}
+
+// Returns the underlying named channel
+func (t *TypedChannel[T]) Channel() *Channel {
+	return t.ch
+}
+
+// Pass a decode error to the OnError handler, or log it
+func (t *TypedChannel[T]) handleError(err error, raw []byte) {
+	t.ch.rtc.lock.Lock()
+	handler := t.onError
+	t.ch.rtc.lock.Unlock()
+
+	if handler == nil {
+		log := t.ch.rtc.Log()
+		log.Warn().Err(err).Int("length", len(raw)).Msg("Dropped typed message")
+		return
+	}
+	handler(err, raw)
+}
@@ -0,0 +1,157 @@
+package rtc_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/VU-ASE/roverrtc/src/rtctest"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// Open a channel and wait until it is open
+func openChannel(t *testing.T, r *rtc.RTC, name string) *rtc.Channel {
+	t.Helper()
+
+	ch, err := r.OpenChannel(name, rtc.ReliableChannel)
+	if err != nil {
+		t.Fatalf("Cannot open channel %s: %v", name, err)
+	}
+	deadline := time.Now().Add(receiveTimeout)
+	for !ch.IsOpen() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Channel %s did not open", name)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return ch
+}
+
+// Fail the test unless the next value received is want
+func expectValue[T comparable](t *testing.T, received <-chan T, want T) {
+	t.Helper()
+
+	select {
+	case got := <-received:
+		if got != want {
+			t.Errorf("Expected %v, got %v", want, got)
+		}
+	case <-time.After(receiveTimeout):
+		t.Errorf("Expected %v, got nothing", want)
+	}
+}
+
+func TestTypedChannelsWithoutCrossTalk(t *testing.T) {
+	client, server := rtctest.NewConnectedPair(t)
+	speeds, names, errs := make(chan float64, 8), make(chan string, 8), make(chan error, 8)
+
+	// Register the typed handlers as soon as the channels of the client arrive
+	server.OnNewChannel(func(ch *rtc.Channel) {
+		switch ch.Name {
+		case "speed":
+			typed, err := rtc.NewTypedChannel[*wrapperspb.DoubleValue](server, ch.Name)
+			if err != nil {
+				errs <- err
+				return
+			}
+			typed.OnError(func(err error, raw []byte) { errs <- err })
+			typed.OnMessage(func(msg *wrapperspb.DoubleValue) { speeds <- msg.Value })
+		case "names":
+			typed, err := rtc.NewTypedChannel[*wrapperspb.StringValue](server, ch.Name)
+			if err != nil {
+				errs <- err
+				return
+			}
+			typed.OnError(func(err error, raw []byte) { errs <- err })
+			typed.OnMessage(func(msg *wrapperspb.StringValue) { names <- msg.Value })
+		}
+	})
+	openChannel(t, client, "speed")
+	openChannel(t, client, "names")
+
+	speed, err := rtc.NewTypedChannel[*wrapperspb.DoubleValue](client, "speed")
+	if err != nil {
+		t.Fatalf("Cannot create typed channel: %v", err)
+	}
+	name, err := rtc.NewTypedChannel[*wrapperspb.StringValue](client, "names")
+	if err != nil {
+		t.Fatalf("Cannot create typed channel: %v", err)
+	}
+	for _, send := range []func() error{
+		func() error { return speed.Send(wrapperspb.Double(1.5)) },
+		func() error { return name.Send(wrapperspb.String("rover")) },
+		func() error { return speed.Send(wrapperspb.Double(2.5)) },
+	} {
+		if err := send(); err != nil {
+			t.Fatalf("Cannot send message: %v", err)
+		}
+	}
+
+	expectValue(t, speeds, 1.5)
+	expectValue(t, speeds, 2.5)
+	expectValue(t, names, "rover")
+	select {
+	case err := <-errs:
+		t.Errorf("Expected no errors, got %v", err)
+	case got := <-speeds:
+		t.Errorf("Expected no more speeds, got %v", got)
+	case got := <-names:
+		t.Errorf("Expected no more names, got %q", got)
+	case <-time.After(silenceTimeout):
+	}
+}
+
+func TestTypedDataChannel(t *testing.T) {
+	client, server := rtctest.NewConnectedPair(t)
+	received := make(chan int64, 1)
+	typed, err := rtc.NewTypedChannel[*wrapperspb.Int64Value](server, rtc.DataChannelLabel)
+	if err != nil {
+		t.Fatalf("Cannot create typed channel: %v", err)
+	}
+	typed.OnMessage(func(msg *wrapperspb.Int64Value) { received <- msg.Value })
+
+	sender, err := rtc.NewTypedChannel[*wrapperspb.Int64Value](client, rtc.DataChannelLabel)
+	if err != nil {
+		t.Fatalf("Cannot create typed channel: %v", err)
+	}
+	if err := sender.Send(wrapperspb.Int64(42)); err != nil {
+		t.Fatalf("Cannot send message: %v", err)
+	}
+	expectValue(t, received, 42)
+}
+
+func TestTypedChannelDecodeError(t *testing.T) {
+	client, server := rtctest.NewConnectedPair(t)
+	type decodeError struct {
+		err error
+		raw []byte
+	}
+	errs := make(chan decodeError, 1)
+	typed, err := rtc.NewTypedChannel[*wrapperspb.Int64Value](server, rtc.DataChannelLabel)
+	if err != nil {
+		t.Fatalf("Cannot create typed channel: %v", err)
+	}
+	typed.OnMessage(func(msg *wrapperspb.Int64Value) { t.Errorf("Expected no message, got %v", msg) })
+	typed.OnError(func(err error, raw []byte) { errs <- decodeError{err, bytes.Clone(raw)} })
+
+	garbage := []byte{0x0a, 0xff}
+	if err := client.SendDataBytes(garbage); err != nil {
+		t.Fatalf("Cannot send message: %v", err)
+	}
+	select {
+	case got := <-errs:
+		if got.err == nil || !bytes.Equal(got.raw, garbage) {
+			t.Errorf("Expected the decode error with the raw message, got %v and %v", got.err, got.raw)
+		}
+	case <-time.After(receiveTimeout):
+		t.Error("Expected the decode error to be passed to the error handler")
+	}
+}
+
+func TestTypedChannelDoesNotExist(t *testing.T) {
+	r := rtc.NewRTC("rover")
+	if _, err := rtc.NewTypedChannel[*wrapperspb.Int64Value](r, "missing"); err == nil {
+		t.Error("Expected an error for a channel that does not exist")
+	}
+}
@@ -0,0 +1,131 @@
+package rtc
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+//
+// This file contains the validation of incoming signaling requests, so that malformed requests are rejected with a typed error
+// before they reach pion
+//
+
+var (
+	// The request does not carry an id
+	ErrEmptyID = errors.New("Id is empty")
+	// The timestamp of the request is too far from the local clock (see SetTimestampSkew)
+	ErrStaleTimestamp = errors.New("Timestamp is outside of the allowed clock skew")
+	// The SDP of the request is empty or cannot be parsed
+	ErrInvalidSDP = errors.New("SDP is invalid")
+	// The session description is not of the expected type (i.e. an offer or an answer)
+	ErrInvalidSDPType = errors.New("Session description type is invalid")
+	// The ICE candidate of the request is empty or malformed
+	ErrInvalidCandidate = errors.New("ICE candidate is invalid")
+)
+
+// The maximum difference between the timestamp of a request and the local clock, if not configured otherwise
+const DefaultTimestampSkew = 5 * time.Minute
+
+var timestampSkewLock sync.RWMutex
+var timestampSkew = DefaultTimestampSkew
+
+// Set the maximum difference between the timestamp of a signaling request and the local clock (0 disables the check)
+func SetTimestampSkew(skew time.Duration) {
+	timestampSkewLock.Lock()
+	defer timestampSkewLock.Unlock()
+
+	timestampSkew = skew
+}
+
+// Check that the request carries an id, a parsable offer or answer and a recent timestamp
+func (req RequestSDP) Validate() error {
+	if req.Id == "" {
+		return ErrEmptyID
+	}
+	if req.Offer.Type != webrtc.SDPTypeOffer && req.Offer.Type != webrtc.SDPTypeAnswer {
+		return fmt.Errorf("%w: %s", ErrInvalidSDPType, req.Offer.Type)
+	}
+	if req.Offer.SDP == "" {
+		return fmt.Errorf("%w: SDP is empty", ErrInvalidSDP)
+	}
+	// pion parses anything without a syntax error, but every session description starts with its version
+	if !strings.HasPrefix(req.Offer.SDP, "v=") {
+		return fmt.Errorf("%w: SDP does not start with a version line", ErrInvalidSDP)
+	}
+	if _, err := req.Offer.Unmarshal(); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSDP, err)
+	}
+	return validateTimestamp(req.Timestamp)
+}
+
+// Check that the request carries an id, an ICE candidate and a recent timestamp
+func (req RequestICE) Validate() error {
+	if err := req.validateContent(); err != nil {
+		return err
+	}
+	return validateTimestamp(req.Timestamp)
+}
+
+// Check that the request carries an id and an ICE candidate. The timestamp is left to checkFresh, which knows the clock of the peer
+func (req RequestICE) validateContent() error {
+	if req.Id == "" {
+		return ErrEmptyID
+	}
+	return validateCandidate(req.Candidate)
+}
+
+// Check that the request carries an id, at least one ICE candidate and a recent timestamp
+func (req RequestICEBatch) Validate() error {
+	if err := req.validateContent(); err != nil {
+		return err
+	}
+	return validateTimestamp(req.Timestamp)
+}
+
+// Check that the request carries an id and at least one ICE candidate. The timestamp is left to checkFresh, which knows the clock of the peer
+func (req RequestICEBatch) validateContent() error {
+	if req.Id == "" {
+		return ErrEmptyID
+	}
+	if len(req.Candidates) == 0 {
+		return fmt.Errorf("%w: batch is empty", ErrInvalidCandidate)
+	}
+	for i, candidate := range req.Candidates {
+		if err := validateCandidate(candidate); err != nil {
+			return fmt.Errorf("candidate %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Check that a candidate is not empty and looks like an ICE candidate attribute
+func validateCandidate(candidate webrtc.ICECandidateInit) error {
+	if candidate.Candidate == "" {
+		return fmt.Errorf("%w: candidate is empty", ErrInvalidCandidate)
+	}
+	if !strings.HasPrefix(strings.TrimPrefix(candidate.Candidate, "a="), "candidate:") {
+		return fmt.Errorf("%w: %q is not a candidate attribute", ErrInvalidCandidate, candidate.Candidate)
+	}
+	return nil
+}
+
+// Check that a timestamp (in milliseconds) is within the allowed clock skew
+func validateTimestamp(timestamp int64) error {
+	timestampSkewLock.RLock()
+	skew := timestampSkew
+	timestampSkewLock.RUnlock()
+
+	if skew <= 0 {
+		return nil
+	}
+	diff := time.Since(time.UnixMilli(timestamp))
+	if diff > skew || diff < -skew {
+		return fmt.Errorf("%w: timestamp is %s off", ErrStaleTimestamp, diff.Round(time.Millisecond))
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package rtc_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/pion/webrtc/v4"
+)
+
+// A parsable offer, taken from a real connection
+func validOffer(t *testing.T) webrtc.SessionDescription {
+	t.Helper()
+
+	_, offer := newOffer(t, "client")
+	return offer.Offer
+}
+
+func TestRequestSDPValidate(t *testing.T) {
+	offer := validOffer(t)
+	now := time.Now().UnixMilli()
+
+	tests := []struct {
+		name string
+		req  rtc.RequestSDP
+		want error
+	}{
+		{"valid offer", rtc.RequestSDP{Offer: offer, Id: "rover", Timestamp: now}, nil},
+		{"valid answer", rtc.RequestSDP{Offer: webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: offer.SDP}, Id: "rover", Timestamp: now}, nil},
+		{"empty id", rtc.RequestSDP{Offer: offer, Timestamp: now}, rtc.ErrEmptyID},
+		{"empty SDP", rtc.RequestSDP{Offer: webrtc.SessionDescription{Type: webrtc.SDPTypeOffer}, Id: "rover", Timestamp: now}, rtc.ErrInvalidSDP},
+		{"malformed SDP", rtc.RequestSDP{Offer: webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: "not an sdp"}, Id: "rover", Timestamp: now}, rtc.ErrInvalidSDP},
+		{"rollback", rtc.RequestSDP{Offer: webrtc.SessionDescription{Type: webrtc.SDPTypeRollback, SDP: offer.SDP}, Id: "rover", Timestamp: now}, rtc.ErrInvalidSDPType},
+		{"stale timestamp", rtc.RequestSDP{Offer: offer, Id: "rover", Timestamp: now - time.Hour.Milliseconds()}, rtc.ErrStaleTimestamp},
+		{"future timestamp", rtc.RequestSDP{Offer: offer, Id: "rover", Timestamp: now + time.Hour.Milliseconds()}, rtc.ErrStaleTimestamp},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.req.Validate()
+			if test.want == nil && err != nil {
+				t.Errorf("Expected the request to be valid, got %v", err)
+			} else if !errors.Is(err, test.want) {
+				t.Errorf("Expected an error wrapping %v, got %v", test.want, err)
+			}
+		})
+	}
+}
+
+func TestRequestICEValidate(t *testing.T) {
+	candidate := webrtc.ICECandidateInit{Candidate: "candidate:1 1 udp 2130706431 127.0.0.1 50000 typ host"}
+	now := time.Now().UnixMilli()
+
+	tests := []struct {
+		name string
+		req  rtc.RequestICE
+		want error
+	}{
+		{"valid", rtc.RequestICE{Candidate: candidate, Id: "rover", Timestamp: now}, nil},
+		{"attribute prefix", rtc.RequestICE{Candidate: webrtc.ICECandidateInit{Candidate: "a=" + candidate.Candidate}, Id: "rover", Timestamp: now}, nil},
+		{"empty id", rtc.RequestICE{Candidate: candidate, Timestamp: now}, rtc.ErrEmptyID},
+		{"empty candidate", rtc.RequestICE{Id: "rover", Timestamp: now}, rtc.ErrInvalidCandidate},
+		{"malformed candidate", rtc.RequestICE{Candidate: webrtc.ICECandidateInit{Candidate: "127.0.0.1 50000"}, Id: "rover", Timestamp: now}, rtc.ErrInvalidCandidate},
+		{"stale timestamp", rtc.RequestICE{Candidate: candidate, Id: "rover", Timestamp: now - time.Hour.Milliseconds()}, rtc.ErrStaleTimestamp},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.req.Validate()
+			if test.want == nil && err != nil {
+				t.Errorf("Expected the request to be valid, got %v", err)
+			} else if !errors.Is(err, test.want) {
+				t.Errorf("Expected an error wrapping %v, got %v", test.want, err)
+			}
+		})
+	}
+}
+
+func TestRequestICEBatchValidate(t *testing.T) {
+	candidate := webrtc.ICECandidateInit{Candidate: "candidate:1 1 udp 2130706431 127.0.0.1 50000 typ host"}
+	malformed := webrtc.ICECandidateInit{Candidate: "127.0.0.1 50000"}
+	now := time.Now().UnixMilli()
+
+	tests := []struct {
+		name string
+		req  rtc.RequestICEBatch
+		want error
+	}{
+		{"valid", rtc.RequestICEBatch{Candidates: []webrtc.ICECandidateInit{candidate, candidate}, Id: "rover", Timestamp: now}, nil},
+		{"empty id", rtc.RequestICEBatch{Candidates: []webrtc.ICECandidateInit{candidate}, Timestamp: now}, rtc.ErrEmptyID},
+		{"empty batch", rtc.RequestICEBatch{Id: "rover", Timestamp: now}, rtc.ErrInvalidCandidate},
+		{"malformed candidate", rtc.RequestICEBatch{Candidates: []webrtc.ICECandidateInit{candidate, malformed}, Id: "rover", Timestamp: now}, rtc.ErrInvalidCandidate},
+		{"stale timestamp", rtc.RequestICEBatch{Candidates: []webrtc.ICECandidateInit{candidate}, Id: "rover", Timestamp: now - time.Hour.Milliseconds()}, rtc.ErrStaleTimestamp},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.req.Validate()
+			if test.want == nil && err != nil {
+				t.Errorf("Expected the request to be valid, got %v", err)
+			} else if !errors.Is(err, test.want) {
+				t.Errorf("Expected an error wrapping %v, got %v", test.want, err)
+			}
+		})
+	}
+}
+
+func TestTimestampSkew(t *testing.T) {
+	t.Cleanup(func() { rtc.SetTimestampSkew(rtc.DefaultTimestampSkew) })
+	candidate := webrtc.ICECandidateInit{Candidate: "candidate:1 1 udp 2130706431 127.0.0.1 50000 typ host"}
+	req := rtc.RequestICE{Candidate: candidate, Id: "rover", Timestamp: time.Now().Add(-10 * time.Second).UnixMilli()}
+
+	rtc.SetTimestampSkew(time.Second)
+	if err := req.Validate(); !errors.Is(err, rtc.ErrStaleTimestamp) {
+		t.Errorf("Expected ErrStaleTimestamp outside of the skew window, got %v", err)
+	}
+	rtc.SetTimestampSkew(time.Minute)
+	if err := req.Validate(); err != nil {
+		t.Errorf("Expected the request to be valid within the skew window, got %v", err)
+	}
+	rtc.SetTimestampSkew(0)
+	req.Timestamp = 0
+	if err := req.Validate(); err != nil {
+		t.Errorf("Expected the timestamp to not be checked without a skew window, got %v", err)
+	}
+}
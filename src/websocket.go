@@ -0,0 +1,242 @@
+package rtc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"golang.org/x/net/websocket"
+)
+
+//
+// This file contains the WebSocket signaling transport, over which candidates trickle both ways as soon as they are gathered. Both peers
+// exchange JSON messages that hold one of the following:
+//
+//	{"sdp": RequestSDP}  the offer (client to server) or the answer (server to client, in the "offer" field)
+//	{"ice": RequestICE}  a local ICE candidate of the sender
+//	{"iceBatch": RequestICEBatch}  several local ICE candidates of the sender
+//	{"error": "..."}     the server could not accept the offer
+//
+// The socket is closed once the connection is established. If it closes before that, the half-built connection is destroyed
+//
+
+// How long a peer waits for the connection to be established after the other peer closed the signaling socket
+const signalingCloseGrace = time.Second
+
+type signalingMessage struct {
+	SDP      *RequestSDP      `json:"sdp,omitempty"`
+	ICE      *RequestICE      `json:"ice,omitempty"`
+	ICEBatch *RequestICEBatch `json:"iceBatch,omitempty"`
+	Error    string           `json:"error,omitempty"`
+}
+
+// Serve the WebSocket signaling exchange of a client, accepting its offer and adding the connection to the map. The options are used to create
+// the connection. Returns once the connection is established or the exchange failed
+func ServeSignalingWS(m *RTCMap, w http.ResponseWriter, req *http.Request, opts ...Option) {
+	websocket.Handler(func(ws *websocket.Conn) {
+		serveSignalingWS(m, ws, opts)
+	}).ServeHTTP(w, req)
+}
+
+// Connect to the server over the WebSocket signaling transport at address (e.g. "ws://rover.local/ws"), creating the connection with the
+// given options. Returns once the connection is established or the exchange failed
+func DialSignalingWS(address string, id string, opts ...Option) (*RTC, error) {
+	origin, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+	// The origin is required by the WebSocket handshake, the server itself is the closest match
+	if origin.Scheme == "wss" {
+		origin.Scheme = "https"
+	} else {
+		origin.Scheme = "http"
+	}
+
+	ws, err := websocket.Dial(address, "", origin.String())
+	if err != nil {
+		return nil, err
+	}
+	defer ws.Close()
+
+	token := applyOptions(opts).token
+	r, err := NewRTCWithOptions(id, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	offer, err := r.peerConnection().CreateOffer(nil)
+	if err == nil {
+		err = r.SetLocalDescription(offer)
+	}
+	if err == nil {
+		err = websocket.JSON.Send(ws, signalingMessage{SDP: &RequestSDP{Offer: offer, Id: id, Timestamp: time.Now().UnixMilli(), Token: token}})
+	}
+	if err == nil {
+		err = r.exchangeCandidatesWS(ws, defaultReplayCache, func(answer RequestSDP) error {
+			return r.ApplyAnswer(answer.Offer)
+		})
+	}
+	if err != nil {
+		r.Destroy()
+		return nil, err
+	}
+	return r, nil
+}
+
+// Accept the offer of a client and trickle candidates until the connection is established
+func serveSignalingWS(m *RTCMap, ws *websocket.Conn, opts []Option) {
+	log := getDefaultLogger()
+	defer ws.Close()
+
+	var msg signalingMessage
+	if err := websocket.JSON.Receive(ws, &msg); err != nil {
+		log.Warn().Err(err).Msg("Cannot receive offer over signaling socket")
+		return
+	}
+	if msg.SDP == nil {
+		sendSignalingErrorWS(ws, fmt.Errorf("Expected an offer as the first message"))
+		return
+	}
+	offer := *msg.SDP
+	o := applyOptions(opts)
+	if err := o.authenticate(offer.Id, offer.Token); err != nil {
+		sendSignalingErrorWS(ws, err)
+		return
+	}
+	if err := o.signalingLimiter.allowOffer(offer.Id); err != nil {
+		sendSignalingErrorWS(ws, err)
+		return
+	}
+	if err := checkOffer(offer, m.replay); err != nil {
+		sendSignalingErrorWS(ws, err)
+		return
+	}
+
+	r, err := newPeer(offer.Id, o)
+	if err != nil {
+		sendSignalingErrorWS(ws, err)
+		return
+	}
+	r.token = offer.Token
+	answer, err := r.createAnswer(offer.Offer)
+	if err == nil {
+		err = m.Add(offer.Id, r, false)
+	}
+	if err != nil {
+		r.Destroy()
+		sendSignalingErrorWS(ws, err)
+		return
+	}
+
+	err = websocket.JSON.Send(ws, signalingMessage{SDP: &RequestSDP{Offer: answer, Id: offer.Id, Timestamp: time.Now().UnixMilli()}})
+	if err == nil {
+		err = r.exchangeCandidatesWS(ws, m.replay, nil)
+	}
+	if err != nil {
+		log.Warn().Err(err).Str("rtcId", offer.Id).Msg("Signaling over socket failed, destroying connection")
+		// The connection might have been replaced in the meantime
+		if m.Get(offer.Id) == r {
+			_ = m.Remove(offer.Id)
+		} else {
+			r.Destroy()
+		}
+	}
+}
+
+// Trickle local candidates to the peer and apply the candidates (and the answer, if onAnswer is set) of the peer, until the connection is
+// established. Candidates that are already in the replay cache are dropped. Returns an error if the connection failed or the socket closed before that
+func (r *RTC) exchangeCandidatesWS(ws *websocket.Conn, replay *replayCache, onAnswer func(answer RequestSDP) error) error {
+	log := r.Log()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		for candidate := range r.SubscribeLocalCandidates(ctx) {
+			msg := signalingMessage{ICE: &RequestICE{Candidate: candidate, Id: r.Id, Timestamp: time.Now().UnixMilli()}}
+			if err := websocket.JSON.Send(ws, msg); err != nil {
+				log.Debug().Err(err).Msg("Cannot send local ICE candidate over signaling socket")
+				return
+			}
+		}
+	}()
+
+	connected := make(chan error, 1)
+	go func() {
+		connected <- r.WaitUntilConnected(ctx)
+	}()
+
+	// Reads until the socket is closed (by the caller, once we return)
+	failed := make(chan error, 1)
+	closed := make(chan error, 1)
+	go func() {
+		for {
+			var msg signalingMessage
+			if err := websocket.JSON.Receive(ws, &msg); err != nil {
+				closed <- fmt.Errorf("Signaling socket closed before the connection was established: %w", err)
+				return
+			}
+
+			var err error
+			switch {
+			case msg.Error != "":
+				err = fmt.Errorf("Peer refused the connection: %s", msg.Error)
+			case msg.SDP != nil && onAnswer != nil && msg.SDP.Offer.Type == webrtc.SDPTypeAnswer:
+				err = onAnswer(*msg.SDP)
+			case msg.ICE != nil:
+				if err := msg.ICE.validateContent(); err != nil {
+					log.Warn().Err(err).Msg("Dropped invalid ICE candidate received over signaling socket")
+				} else if err := r.checkFresh(replay, msg.ICE.Timestamp, msg.ICE.Candidate.Candidate); err != nil {
+					log.Debug().Err(err).Msg("Dropped ICE candidate received over signaling socket")
+				} else if err := r.AddRemoteCandidate(msg.ICE.Candidate); err != nil {
+					log.Warn().Err(err).Msg("Cannot add remote ICE candidate received over signaling socket")
+				}
+			case msg.ICEBatch != nil:
+				if err := msg.ICEBatch.validateContent(); err != nil {
+					log.Warn().Err(err).Msg("Dropped invalid ICE candidates received over signaling socket")
+					break
+				}
+				if err := r.checkFresh(replay, msg.ICEBatch.Timestamp, candidateStrings(msg.ICEBatch.Candidates)...); err != nil {
+					log.Debug().Err(err).Msg("Dropped ICE candidates received over signaling socket")
+					break
+				}
+				for i, err := range r.AddRemoteCandidates(msg.ICEBatch.Candidates) {
+					log.Warn().Err(err).Int("index", i).Msg("Cannot add remote ICE candidate received over signaling socket")
+				}
+			}
+			if err != nil {
+				failed <- err
+				return
+			}
+		}
+	}()
+
+	select {
+	case err := <-connected:
+		return err
+	case err := <-failed:
+		return err
+	case err := <-closed:
+		// The peer closes the socket once it is connected, which can be just before this side is
+		select {
+		case connectErr := <-connected:
+			if connectErr == nil {
+				return nil
+			}
+		case <-time.After(signalingCloseGrace):
+		}
+		return err
+	}
+}
+
+// Tell the client why its offer was not accepted
+func sendSignalingErrorWS(ws *websocket.Conn, err error) {
+	log := getDefaultLogger()
+	log.Warn().Err(err).Msg("Refused offer over signaling socket")
+
+	if err := websocket.JSON.Send(ws, signalingMessage{Error: err.Error()}); err != nil {
+		log.Debug().Err(err).Msg("Cannot send error over signaling socket")
+	}
+}
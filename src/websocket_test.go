@@ -0,0 +1,83 @@
+package rtc_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/pion/webrtc/v4"
+	"golang.org/x/net/websocket"
+)
+
+// Start a server that serves the WebSocket signaling exchange for the map, returns its address
+func newSignalingServer(t *testing.T, m *rtc.RTCMap) string {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		rtc.ServeSignalingWS(m, w, req)
+	}))
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+func TestSignalingOverWebSocket(t *testing.T) {
+	m := rtc.NewRTCMap()
+	t.Cleanup(func() { m.DestroyAll() })
+	address := newSignalingServer(t, m)
+
+	client, err := rtc.DialSignalingWS(address, "rover")
+	if err != nil {
+		t.Fatalf("Cannot connect over signaling socket: %v", err)
+	}
+	t.Cleanup(func() { client.Destroy() })
+	if !client.IsConnected() {
+		t.Error("Expected the client to be connected once dialing returns")
+	}
+
+	server := m.Get("rover")
+	if server == nil {
+		t.Fatal("Expected the connection to be added to the map")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), receiveTimeout)
+	defer cancel()
+	if err := server.WaitUntilConnected(ctx); err != nil {
+		t.Fatalf("Server did not connect: %v", err)
+	}
+}
+
+func TestSignalingSocketClosedEarly(t *testing.T) {
+	m := rtc.NewRTCMap()
+	t.Cleanup(func() { m.DestroyAll() })
+	address := newSignalingServer(t, m)
+	_, offer := newOffer(t, "rover")
+
+	ws, err := websocket.Dial(address, "", "http://localhost")
+	if err != nil {
+		t.Fatalf("Cannot dial signaling socket: %v", err)
+	}
+	if err := websocket.JSON.Send(ws, map[string]rtc.RequestSDP{"sdp": offer}); err != nil {
+		t.Fatalf("Cannot send offer: %v", err)
+	}
+	// Wait for the answer, then go away without applying it
+	var answer map[string]any
+	if err := websocket.JSON.Receive(ws, &answer); err != nil {
+		t.Fatalf("Cannot receive answer: %v", err)
+	}
+	server := m.Get("rover")
+	if server == nil {
+		t.Fatal("Expected the half-built connection to be added to the map")
+	}
+	ws.Close()
+
+	deadline := time.Now().Add(receiveTimeout)
+	for m.Get("rover") != nil || server.ConnectionState() != webrtc.PeerConnectionStateClosed {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the half-built connection to be destroyed and removed, it is %s (in map: %v)", server.ConnectionState(), m.Get("rover") != nil)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,321 @@
+package rtc
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+)
+
+//
+// This file contains the (opt-in) single writer of a connection. When it is started, all Send* methods enqueue their message and a single
+// goroutine drains the queue, which guarantees the send order, provides a natural backpressure point and keeps all calls to pion's Send
+// in one goroutine. Messages with a higher priority are sent first, messages with the same priority are sent in order. The queue is bounded
+// per channel, and the queue policy decides what happens to a message for a channel whose queue is full (e.g. for real-time telemetry,
+// dropping the oldest message is better than delivering a backlog of stale ones)
+//
+
+// The priority of messages sent with SendData and SendDataBytes
+const DefaultPriority = 0
+
+// The priority of messages sent on the control channel, so that control messages are not stuck behind a backlog of data
+const ControlPriority = 100
+
+// What happens to a message for a channel whose queue is full
+type QueuePolicy int
+
+const (
+	QueueBlock      QueuePolicy = iota // wait until the writer took a message of the channel from the queue
+	QueueDropOldest                    // drop the oldest queued message of the channel to make room, so sending never blocks
+	QueueDropNewest                    // drop the message and return ErrQueueFull
+)
+
+// The message was dropped because the queue of the writer was full for its channel (see QueueDropNewest)
+var ErrQueueFull = errors.New("Send queue is full")
+
+type outgoingMessage struct {
+	channel  MessageChannel
+	payload  []byte
+	priority int
+	seq      uint64 // to keep the order between messages with the same priority
+}
+
+// A priority queue of outgoing messages, bounded per channel
+type writeQueue struct {
+	lock     *sync.Mutex
+	messages messageHeap
+	seq      uint64
+	size     int               // the maximum number of queued messages per channel
+	policy   QueuePolicy       // what happens to a message for a channel whose queue is full
+	queued   map[string]int    // label -> the number of queued messages of the channel
+	dropped  map[string]uint64 // label -> the number of messages of the channel dropped by the policy
+	ready    chan struct{}     // signalled when a message is queued, to wake up the writer
+	space    chan struct{}     // closed (and replaced) when the writer takes a message from the queue, to wake up blocked senders
+}
+
+type messageHeap []outgoingMessage
+
+func (h messageHeap) Len() int { return len(h) }
+func (h messageHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+func (h messageHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *messageHeap) Push(x interface{}) { *h = append(*h, x.(outgoingMessage)) }
+func (h *messageHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	msg := old[n-1]
+	*h = old[:n-1]
+	return msg
+}
+
+// Start the writer goroutine with a queue that holds up to queueSize messages per channel. Once started, sending blocks while the queue of
+// the channel is full, and errors of the underlying Send are logged instead of returned. The writer stops when the connection is destroyed
+func (r *RTC) StartWriter(queueSize int) {
+	if err := r.StartWriterWithPolicy(queueSize, QueueBlock); err != nil {
+		log := r.Log()
+		log.Error().Err(err).Msg("Cannot start writer")
+	}
+}
+
+// Same as StartWriter, but with the given policy for messages of a channel whose queue is full. The queued messages that were not sent
+// yet are discarded when the connection is destroyed, and the writer stops. Returns an error if queueSize is not positive
+func (r *RTC) StartWriterWithPolicy(queueSize int, policy QueuePolicy) error {
+	if queueSize <= 0 {
+		return fmt.Errorf("Cannot start writer. Queue size %d is not positive", queueSize)
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.writeQueue != nil {
+		return nil
+	}
+
+	var lock sync.Mutex
+	r.writeQueue = &writeQueue{
+		lock:     &lock,
+		messages: make(messageHeap, 0, queueSize),
+		size:     queueSize,
+		policy:   policy,
+		queued:   make(map[string]int),
+		dropped:  make(map[string]uint64),
+		ready:    make(chan struct{}, 1),
+		space:    make(chan struct{}),
+	}
+	go r.runWriter(r.writeQueue)
+	return nil
+}
+
+// Returns the number of messages waiting in the queue of the writer
+func (r *RTC) QueueDepth() int {
+	r.lock.Lock()
+	queue := r.writeQueue
+	r.lock.Unlock()
+
+	if queue == nil {
+		return 0
+	}
+
+	queue.lock.Lock()
+	defer queue.lock.Unlock()
+	return queue.messages.Len()
+}
+
+// Send a message on the data channel with the given priority. When the writer is started, queued messages with a higher priority
+// (e.g. an emergency stop) are sent before those with a lower priority (e.g. telemetry). Without the writer, the message is sent immediately
+func (r *RTC) SendDataPrio(pb proto.Message, prio int) error {
+	buf, err := marshalPooled(pb)
+	if err != nil {
+		return err
+	}
+	defer releaseBuffer(buf)
+	content := *buf
+
+	log := r.Log()
+	dc := r.dataMessageChannel()
+	if err := channelOpen(dc); err != nil {
+		log.Warn().Err(err).Msg("Cannot send on data channel")
+		return err
+	}
+	return r.send(dc, r.encodeData(r.unbatched(r.compress(content))), prio)
+}
+
+// Drain the queue until the connection is destroyed (which discards the messages that are left, see Destroy)
+func (r *RTC) runWriter(queue *writeQueue) {
+	log := r.Log()
+
+	for {
+		select {
+		case <-r.closed:
+			return
+		case <-queue.ready:
+		}
+
+		for {
+			msg, ok := queue.pop()
+			if !ok {
+				break
+			}
+			select {
+			case <-r.closed:
+				return
+			default:
+			}
+
+			err := msg.channel.Send(msg.payload)
+			recordSend(msg.channel.Label(), len(msg.payload), err)
+			r.recordSendResult(msg.channel.Label(), err)
+			if err != nil {
+				r.recordEvent(EventSendFailed, err.Error())
+				log.Warn().Err(err).Str("label", msg.channel.Label()).Msg("Cannot send queued message")
+			}
+		}
+	}
+}
+
+// Add a message to the queue, applying the policy if the queue of its channel is full
+func (r *RTC) enqueue(ctx context.Context, queue *writeQueue, msg outgoingMessage) error {
+	label := msg.channel.Label()
+	for {
+		queue.lock.Lock()
+		full := queue.queued[label] >= queue.size
+		switch {
+		case full && queue.policy == QueueDropNewest:
+			queue.dropped[label]++
+			queue.lock.Unlock()
+			return ErrQueueFull
+		case full && queue.policy == QueueDropOldest:
+			queue.dropOldest(label)
+			full = false
+		}
+		if !full {
+			queue.seq++
+			msg.seq = queue.seq
+			heap.Push(&queue.messages, msg)
+			queue.queued[label]++
+			queue.lock.Unlock()
+
+			select {
+			case queue.ready <- struct{}{}:
+			default:
+			}
+			return nil
+		}
+		space := queue.space
+		queue.lock.Unlock()
+
+		select {
+		case <-space:
+		case <-r.closed:
+			err := fmt.Errorf("Cannot send message. Connection is destroyed")
+			recordSend(label, len(msg.payload), err)
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Take the message with the highest priority from the queue, returns false if the queue is empty
+func (queue *writeQueue) pop() (outgoingMessage, bool) {
+	queue.lock.Lock()
+	defer queue.lock.Unlock()
+
+	if queue.messages.Len() == 0 {
+		return outgoingMessage{}, false
+	}
+	msg := heap.Pop(&queue.messages).(outgoingMessage)
+	queue.queued[msg.channel.Label()]--
+	close(queue.space)
+	queue.space = make(chan struct{})
+	return msg, true
+}
+
+// Drop the oldest queued message of a channel, the caller must hold the lock of the queue
+func (queue *writeQueue) dropOldest(label string) {
+	oldest := -1
+	for i, msg := range queue.messages {
+		if msg.channel.Label() == label && (oldest < 0 || msg.seq < queue.messages[oldest].seq) {
+			oldest = i
+		}
+	}
+	if oldest < 0 {
+		return
+	}
+	heap.Remove(&queue.messages, oldest)
+	queue.queued[label]--
+	queue.dropped[label]++
+}
+
+// Empty the queue, returns the number of messages that were discarded
+func (queue *writeQueue) discard() int {
+	queue.lock.Lock()
+	defer queue.lock.Unlock()
+
+	discarded := queue.messages.Len()
+	queue.messages = queue.messages[:0]
+	clear(queue.queued)
+	return discarded
+}
+
+// Returns the number of messages of the channel with the given label that were dropped by the queue policy
+func (r *RTC) queueDropped(label string) uint64 {
+	r.lock.Lock()
+	queue := r.writeQueue
+	r.lock.Unlock()
+
+	if queue == nil {
+		return 0
+	}
+
+	queue.lock.Lock()
+	defer queue.lock.Unlock()
+	return queue.dropped[label]
+}
+
+// Send bytes on a channel, through the writer (with the given priority) if it is started
+func (r *RTC) send(dc MessageChannel, b []byte, prio int) error {
+	return r.sendCtx(context.Background(), dc, b, prio)
+}
+
+// Same as send, but gives up when ctx is done while the queue of the writer is full
+func (r *RTC) sendCtx(ctx context.Context, dc MessageChannel, b []byte, prio int) error {
+	b, ok := r.intercept(dc, b)
+	if !ok {
+		// Dropped by an interceptor, like a lossy link would
+		return nil
+	}
+	if err := r.allowSend(dc.Label()); err != nil {
+		return err
+	}
+
+	r.throughput.add(true, len(b))
+	r.recordActivity(dc.Label(), true)
+	r.recordTraffic(dc.Label(), true, b)
+
+	r.lock.Lock()
+	queue := r.writeQueue
+	r.lock.Unlock()
+
+	if queue == nil {
+		err := dc.Send(b)
+		recordSend(dc.Label(), len(b), err)
+		r.recordSendResult(dc.Label(), err)
+		if err != nil {
+			r.recordEvent(EventSendFailed, err.Error())
+		}
+		return err
+	}
+
+	// The caller may reuse its buffer once we return
+	payload := make([]byte, len(b))
+	copy(payload, b)
+	return r.enqueue(ctx, queue, outgoingMessage{channel: dc, payload: payload, priority: prio})
+}
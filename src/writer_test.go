@@ -0,0 +1,318 @@
+package rtc_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	rtc "github.com/VU-ASE/roverrtc/src"
+	"github.com/VU-ASE/roverrtc/src/rtctest"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// A mock channel whose sends stall until it is released, like a link that stopped moving
+type stalledChannel struct {
+	*rtc.MockChannel
+	entered chan struct{} // receives when a send started
+	release chan struct{} // closed to let all sends through
+	once    *sync.Once
+}
+
+func (c *stalledChannel) Send(b []byte) error {
+	c.entered <- struct{}{}
+	<-c.release
+	return c.MockChannel.Send(b)
+}
+
+func (c *stalledChannel) unstall() {
+	c.once.Do(func() { close(c.release) })
+}
+
+// Create a connection with a writer with the given queue on a stalled data channel, the first message is sent (and stalls in the channel)
+func newStalledConnection(t *testing.T, size int, policy rtc.QueuePolicy) (*rtc.RTC, *stalledChannel) {
+	t.Helper()
+
+	r := newAnswerer(t, "rover")
+	data := &stalledChannel{
+		MockChannel: rtc.NewMockChannel(rtc.DataChannelLabel),
+		entered:     make(chan struct{}, 100),
+		release:     make(chan struct{}),
+		once:        &sync.Once{},
+	}
+	t.Cleanup(data.unstall)
+	r.SetDataChannel(data)
+	if err := r.StartWriterWithPolicy(size, policy); err != nil {
+		t.Fatalf("Cannot start writer: %v", err)
+	}
+
+	if err := r.SendDataBytes([]byte("0")); err != nil {
+		t.Fatalf("Cannot send first message: %v", err)
+	}
+	select {
+	case <-data.entered:
+	case <-time.After(receiveTimeout):
+		t.Fatal("Expected the writer to send the first message")
+	}
+	return r, data
+}
+
+// Let the stalled channel go and wait until the given messages are sent, in order
+func expectSentAfterUnstall(t *testing.T, data *stalledChannel, want ...string) {
+	t.Helper()
+
+	data.unstall()
+	deadline := time.Now().Add(receiveTimeout)
+	var sent []string
+	for {
+		sent = sent[:0]
+		for _, b := range data.Sent() {
+			sent = append(sent, string(b))
+		}
+		if len(sent) >= len(want) || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if !slices.Equal(sent, want) {
+		t.Errorf("Expected messages %v to be sent, got %v", want, sent)
+	}
+}
+
+// Returns the number of data messages dropped by the queue policy
+func queueDropped(t *testing.T, r *rtc.RTC) uint64 {
+	t.Helper()
+
+	stats, err := r.Stats()
+	if err != nil {
+		t.Fatalf("Cannot get statistics: %v", err)
+	}
+	return stats.Data.QueueDropped
+}
+
+func TestSendQueueDropOldest(t *testing.T) {
+	r, data := newStalledConnection(t, 2, rtc.QueueDropOldest)
+
+	start := time.Now()
+	for i := 1; i <= 4; i++ {
+		if err := r.SendDataBytes([]byte(fmt.Sprint(i))); err != nil {
+			t.Fatalf("Expected the send to never fail, got %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("Expected sends to never block, took %s", elapsed)
+	}
+	if dropped := queueDropped(t, r); dropped != 2 {
+		t.Errorf("Expected 2 dropped messages, got %d", dropped)
+	}
+	expectSentAfterUnstall(t, data, "0", "3", "4")
+}
+
+func TestSendQueueDropNewest(t *testing.T) {
+	r, data := newStalledConnection(t, 2, rtc.QueueDropNewest)
+
+	for i := 1; i <= 4; i++ {
+		err := r.SendDataBytes([]byte(fmt.Sprint(i)))
+		if i <= 2 && err != nil {
+			t.Fatalf("Expected message %d to be queued, got %v", i, err)
+		} else if i > 2 && !errors.Is(err, rtc.ErrQueueFull) {
+			t.Errorf("Expected ErrQueueFull for message %d, got %v", i, err)
+		}
+	}
+	if dropped := queueDropped(t, r); dropped != 2 {
+		t.Errorf("Expected 2 dropped messages, got %d", dropped)
+	}
+	expectSentAfterUnstall(t, data, "0", "1", "2")
+}
+
+func TestSendQueueBlock(t *testing.T) {
+	r, data := newStalledConnection(t, 2, rtc.QueueBlock)
+
+	for i := 1; i <= 2; i++ {
+		if err := r.SendDataBytes([]byte(fmt.Sprint(i))); err != nil {
+			t.Fatalf("Cannot queue message %d: %v", i, err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := r.SendDataBytesCtx(ctx, []byte("late")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the send to give up with the context while the queue is full, got %v", err)
+	}
+
+	sent := make(chan error, 1)
+	go func() { sent <- r.SendDataBytes([]byte("3")) }()
+	select {
+	case err := <-sent:
+		t.Fatalf("Expected the send to block while the queue is full, got %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	expectSentAfterUnstall(t, data, "0", "1", "2", "3")
+	if err := <-sent; err != nil {
+		t.Errorf("Expected the blocked send to succeed, got %v", err)
+	}
+	if dropped := queueDropped(t, r); dropped != 0 {
+		t.Errorf("Expected no dropped messages, got %d", dropped)
+	}
+}
+
+func TestDestroyDiscardsSendQueue(t *testing.T) {
+	r, data := newStalledConnection(t, 2, rtc.QueueBlock)
+	for i := 1; i <= 2; i++ {
+		if err := r.SendDataBytes([]byte(fmt.Sprint(i))); err != nil {
+			t.Fatalf("Cannot queue message %d: %v", i, err)
+		}
+	}
+	blocked := make(chan error, 1)
+	go func() { blocked <- r.SendDataBytes([]byte("3")) }()
+
+	r.Destroy()
+	select {
+	case err := <-blocked:
+		if err == nil {
+			t.Error("Expected the blocked send to fail once the connection is destroyed")
+		}
+	case <-time.After(receiveTimeout):
+		t.Fatal("Expected the blocked send to return once the connection is destroyed")
+	}
+	if depth := r.QueueDepth(); depth != 0 {
+		t.Errorf("Expected the queue to be discarded, got %d messages", depth)
+	}
+
+	// The message that was stalled fails on the closed channel, and the writer does not attempt the discarded ones
+	data.unstall()
+	time.Sleep(silenceTimeout)
+	if sent, attempted := len(data.Sent()), len(data.entered); sent != 0 || attempted != 0 {
+		t.Errorf("Expected no messages to be sent after Destroy, got %d sent and %d attempted", sent, attempted)
+	}
+}
+
+func TestWithSendQueue(t *testing.T) {
+	client, server := rtctest.NewConnectedPair(t, rtc.WithSendQueue(8, rtc.QueueDropOldest))
+	received := collectData(server)
+
+	for i := 0; i < 3; i++ {
+		if err := client.SendDataBytes([]byte(fmt.Sprint(i))); err != nil {
+			t.Fatalf("Cannot send message %d: %v", i, err)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		expectMessage(t, received, []byte(fmt.Sprint(i)))
+	}
+}
+
+// Create a connection with a writer with the given queue size on a mock data channel
+func newWritingConnection(t *testing.T, size int) (*rtc.RTC, *rtc.MockChannel) {
+	t.Helper()
+
+	r := rtc.NewRTC("rover")
+	t.Cleanup(func() { r.Destroy() })
+	data := rtc.NewMockChannel(rtc.DataChannelLabel)
+	r.SetDataChannel(data)
+	r.StartWriter(size)
+	return r, data
+}
+
+// Wait until the channel sent count messages, returns them
+func waitForSent(t *testing.T, dc *rtc.MockChannel, count int) [][]byte {
+	t.Helper()
+
+	deadline := time.Now().Add(receiveTimeout)
+	for {
+		sent := dc.Sent()
+		if len(sent) >= count {
+			return sent
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d messages to be sent, got %d", count, len(sent))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWriterKeepsSendOrder(t *testing.T) {
+	r, data := newWritingConnection(t, 4)
+
+	// The queue is smaller than the number of messages, so sending blocks while the writer catches up
+	for i := 0; i < 100; i++ {
+		if err := r.SendDataBytes([]byte(fmt.Sprint(i))); err != nil {
+			t.Fatalf("Cannot send message %d: %v", i, err)
+		}
+	}
+	sent := waitForSent(t, data, 100)
+	for i, b := range sent {
+		if string(b) != fmt.Sprint(i) {
+			t.Fatalf("Expected message %d to be sent in order, got %s", i, b)
+		}
+	}
+	if depth := r.QueueDepth(); depth != 0 {
+		t.Errorf("Expected an empty queue, got %d messages", depth)
+	}
+}
+
+func TestWriterLogsSendErrors(t *testing.T) {
+	r, data := newWritingConnection(t, 4)
+	data.FailSends(errors.New("link down"))
+
+	if err := r.SendDataBytes([]byte("telemetry")); err != nil {
+		t.Errorf("Expected the error of the queued send to not be returned, got %v", err)
+	}
+	deadline := time.Now().Add(receiveTimeout)
+	for countEvents(r, rtc.EventSendFailed) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the failed send to be recorded")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestStartWriterRejectsInvalidQueueSize(t *testing.T) {
+	r := rtc.NewRTC("rover")
+	data := rtc.NewMockChannel(rtc.DataChannelLabel)
+	r.SetDataChannel(data)
+	if err := r.StartWriterWithPolicy(0, rtc.QueueBlock); err == nil {
+		t.Error("Expected an error for a queue size that is not positive")
+	}
+
+	// Without a writer, messages are sent immediately
+	if err := r.SendDataBytes([]byte("telemetry")); err != nil {
+		t.Fatalf("Cannot send message: %v", err)
+	}
+	if sent := data.Sent(); len(sent) != 1 {
+		t.Errorf("Expected the message to be sent immediately, got %d messages", len(sent))
+	}
+}
+
+func TestWriterSendsHigherPriorityFirst(t *testing.T) {
+	r, data := newStalledConnection(t, 8, rtc.QueueBlock)
+
+	// Queued while the first message is stalled in the channel
+	for i := 1; i <= 2; i++ {
+		if err := r.SendDataBytes([]byte(fmt.Sprint(i))); err != nil {
+			t.Fatalf("Cannot queue message %d: %v", i, err)
+		}
+	}
+	urgent := []proto.Message{wrapperspb.String("brake"), wrapperspb.String("stop")}
+	for _, msg := range urgent {
+		if err := r.SendDataPrio(msg, 10); err != nil {
+			t.Fatalf("Cannot queue priority message: %v", err)
+		}
+	}
+	if depth := r.QueueDepth(); depth != 4 {
+		t.Errorf("Expected 4 queued messages, got %d", depth)
+	}
+
+	// Messages with the same priority keep their order
+	want := []string{"0"}
+	for _, msg := range urgent {
+		encoded, err := proto.Marshal(msg)
+		if err != nil {
+			t.Fatalf("Cannot marshal message: %v", err)
+		}
+		want = append(want, string(encoded))
+	}
+	expectSentAfterUnstall(t, data, append(want, "1", "2")...)
+}